@@ -1,10 +1,15 @@
 package any
 
 import (
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/headerspec"
+	"github.com/coalescent-labs/mcastmkt/pkg/latency"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/sbe"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
 	"github.com/coalescent-labs/mcastmkt/pkg/util"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/net/ipv4"
 	"log"
 	"net"
 	"strings"
@@ -17,6 +22,16 @@ var (
 	listenInterface         string
 	listenDumpBytes         bool
 	listenReceiveBufferSize int
+	listenBatchSize         int
+	listenRingSize          int
+	listenPinCPU            int
+	listenHeaderSpec        string
+	listenSequenceWindow    int
+	listenLatencyOutlier    int
+	listenSbeSchemaFile     string
+	listenSbeOffset         int
+	listenSbeFramingSize    int
+	listenSbeJSON           bool
 
 	listenStatsInterval uint64 = 30
 
@@ -25,29 +40,87 @@ var (
 	listenNumPackets      uint64 = 0
 	listenTotalNumPackets uint64 = 0
 
+	listenNumMessagesOoO  uint64 = 0
+	listenNumPacketsMessy uint64 = 0
+	listenNumDuplicates   uint64 = 0
+	listenNumHeartbeats   uint64 = 0
+	listenNumResets       uint64 = 0
+	listenNumStreams      uint64 = 0
+	listenNumShort        uint64 = 0
+
+	listenSpec    *headerspec.Spec
+	listenLatency *latency.Recorder
+	listenSchema  *sbe.Schema
+
 	listenCmd = &cobra.Command{
 		Use:   "listen",
 		Short: "Listen multicast stream and dump statistics and data",
-		Long:  ``,
-		RunE:  listen,
-	}
-)
+		Long: `Without --header-spec the datagrams are only counted, and dumped in dump mode.
+With --header-spec the packet header of a feed without a dedicated command is decoded by the named spec of the
+"header-specs" section of the config file, e.g.:
 
-const (
-	listenMaxDatagramSize = 1024 * 8
+header-specs:
+  myfeed:
+    byte-order: little             # big (default) or little, can be overridden per field
+    sequence: {offset: 4, size: 4} # required
+    count: {offset: 2, size: 1}    # messages per packet, the sequence is the one of the first message
+    stream: {offset: 3, size: 1}   # independent sequences, e.g. per channel or unit
+    timestamp: {offset: 8, size: 8, byte-order: big}
+    timestamp-unit: ns             # s, ms, us or ns since the epoch
+
+and the duplicates, gaps and latency are tracked per stream as the market listeners do. With count, the packets
+without messages are heartbeats carrying the next sequence number. A stream restarting from sequence number 1 resets
+its sequence check.
+With an SBE schema file (--sbe-schema) the dump mode prints the decoded messages, as text or JSON, instead of the raw
+bytes: they start after --sbe-offset bytes (e.g. the packet header) and, with --sbe-framing-size, each message is
+prefixed by a framing header starting with the message size including it (2 for CME MDP 3.0, 4 for B3 UMDF).`,
+		RunE: listen,
+	}
 )
 
-func listenStatsPrinter() {
+func listenStatsPrinter(l *mcast.Listener) {
 	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
 		recvMsg := atomic.SwapUint64(&listenNumPackets, 0)
 		recvTotalMsg := atomic.SwapUint64(&listenTotalNumPackets, 0)
 		recvBytes := atomic.SwapUint64(&listenNumBytes, 0)
 		recvTotalBytes := atomic.SwapUint64(&listenTotalNumBytes, 0)
-		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s]",
-			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes))
+		sockStats := l.SwapStats()
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], Syscalls/pkt: %.3f, Kernel drops: %d, Ring full: %d",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			sockStats.SyscallsPerPacket(), sockStats.KernelDrops, sockStats.RingFull)
+		if listenSpec == nil {
+			continue
+		}
+		recvOoO := atomic.SwapUint64(&listenNumMessagesOoO, 0)
+		recvMessy := atomic.SwapUint64(&listenNumPacketsMessy, 0)
+		recvDuplicates := atomic.SwapUint64(&listenNumDuplicates, 0)
+		recvHeartbeats := atomic.SwapUint64(&listenNumHeartbeats, 0)
+		recvResets := atomic.SwapUint64(&listenNumResets, 0)
+		recvShort := atomic.SwapUint64(&listenNumShort, 0)
+		log.Printf("SEQUENCE Streams: %d, Missing: %d, Messy: %d, Duplicates: %d, Heartbeats: %d, Resets: %d, Short packets: %d\n",
+			atomic.LoadUint64(&listenNumStreams), recvOoO, recvMessy, recvDuplicates, recvHeartbeats, recvResets, recvShort)
+		for _, s := range listenLatency.SwapStats() {
+			log.Printf("LATENCY stream %d: %v\n", s.Stream, s)
+		}
 	}
 }
 
+// loadHeaderSpec loads the named header spec of the config file
+func loadHeaderSpec(name string) (*headerspec.Spec, error) {
+	key := "header-specs." + name
+	if !viper.IsSet(key) {
+		return nil, fmt.Errorf("header spec %q not found in the config file", name)
+	}
+	var spec headerspec.Spec
+	if err := viper.UnmarshalKey(key, &spec); err != nil {
+		return nil, fmt.Errorf("header spec %q: %w", name, err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("header spec %q: %w", name, err)
+	}
+	return &spec, nil
+}
+
 func listen(*cobra.Command, []string) error {
 	// Parse the string address
 	addr, err := net.ResolveUDPAddr("udp4", listenAddress)
@@ -64,49 +137,53 @@ func listen(*cobra.Command, []string) error {
 		}
 	}
 
-	conn, err := net.ListenPacket("udp4", listenAddress)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	if listenReceiveBufferSize > 0 {
-		if err := util.SetReceiveBuffer(conn, listenReceiveBufferSize); err != nil {
+	if listenHeaderSpec != "" {
+		listenSpec, err = loadHeaderSpec(listenHeaderSpec)
+		if err != nil {
 			return err
 		}
+		listenLatency = latency.NewRecorder(time.Microsecond * time.Duration(listenLatencyOutlier))
 	}
-
-	packetConn := ipv4.NewPacketConn(conn)
-	if err := packetConn.JoinGroup(intf, addr); err != nil {
-		return err
+	if listenSbeSchemaFile != "" {
+		if listenSbeFramingSize != 0 && listenSbeFramingSize < 2 {
+			return fmt.Errorf("invalid SBE framing size %d, the message size takes 2 bytes", listenSbeFramingSize)
+		}
+		listenSchema, err = sbe.LoadSchemaFile(listenSbeSchemaFile)
+		if err != nil {
+			return err
+		}
+		log.Printf("Loaded %d SBE messages from %s\n", listenSchema.Len(), listenSbeSchemaFile)
 	}
-	defer packetConn.LeaveGroup(intf, addr)
+	// sliding windows per stream for sequence numbers duplicates and gaps check
+	tracker := sequence.NewTracker(listenSequenceWindow)
 
-	err = packetConn.SetControlMessage(ipv4.FlagTTL|ipv4.FlagSrc|ipv4.FlagDst|ipv4.FlagInterface, true)
+	l, err := mcast.Listen(listenAddress, intf, mcast.Options{
+		ReceiveBufferSize: listenReceiveBufferSize,
+		BatchSize:         listenBatchSize,
+		RingSize:          listenRingSize,
+		PinCPU:            listenPinCPU,
+	})
 	if err != nil {
 		return err
 	}
-	buffer := make([]byte, listenMaxDatagramSize)
+	defer l.Close()
 
-	go listenStatsPrinter()
+	go listenStatsPrinter(l)
 
 	log.Printf("Listening to %s@%s  %v\n", listenAddress, util.StringIfEmpty(listenInterface, "default"), intf)
 
 	// Loop forever reading from the socket
-	for {
-		numBytes, cm, srcAddr, err := packetConn.ReadFrom(buffer)
-		if err != nil {
-			log.Fatal("ReadFromUDP failed:", err)
-		}
+	err = l.Read(func(p *mcast.Packet) {
+		numBytes := len(p.Data)
 		atomic.AddUint64(&listenTotalNumPackets, 1)
 		atomic.AddUint64(&listenTotalNumBytes, uint64(numBytes))
 
-		if !cm.Dst.IsMulticast() {
-			continue
+		if !p.Dst.IsMulticast() {
+			return
 		}
-		if !cm.Dst.Equal(addr.IP) {
+		if !p.Dst.Equal(addr.IP) {
 			// unknown group, discard
-			continue
+			return
 		}
 
 		atomic.AddUint64(&listenNumPackets, 1)
@@ -114,9 +191,107 @@ func listen(*cobra.Command, []string) error {
 
 		if listenDumpBytes {
 			log.Printf(strings.Repeat("-", 80))
-			log.Printf("addr: %v, numBytes: %d\n", srcAddr, numBytes)
-			util.DumpByteSlice(buffer[:numBytes])
+			log.Printf("addr: %v, numBytes: %d\n", p.Src, numBytes)
+			if listenSchema != nil {
+				dumpSbe(p.Data)
+			} else {
+				util.DumpByteSlice(p.Data)
+			}
+		}
+		if listenSpec != nil {
+			trackHeader(p, tracker)
+		}
+	})
+	return fmt.Errorf("ReadFromUDP failed: %w", err)
+}
+
+// trackHeader checks the sequence of the packet decoded by the header spec
+// and records its latency
+func trackHeader(p *mcast.Packet, tracker *sequence.Tracker) {
+	header, err := listenSpec.Parse(p.Data)
+	if err != nil {
+		atomic.AddUint64(&listenNumShort, 1)
+		return
+	}
+	if !header.Timestamp.IsZero() {
+		if lat, outlier := listenLatency.Record(header.Stream, header.Timestamp, p.Time); outlier {
+			log.Printf("Latency outlier on stream %d: sequence %d, %v\n", header.Stream, header.Sequence, lat)
+		}
+	}
+
+	window := tracker.Window(header.Stream)
+	atomic.StoreUint64(&listenNumStreams, uint64(tracker.Streams()))
+	last := window.Last()
+	result, missing, reset := window.AddPacket(header.Sequence, header.Count)
+	if reset {
+		atomic.AddUint64(&listenNumResets, 1)
+		log.Printf("Sequence reset on stream %d from %d\n", header.Stream, last)
+	}
+	if header.Heartbeat() {
+		atomic.AddUint64(&listenNumHeartbeats, 1)
+		// the next sequence number reveals the messages lost on an idle stream
+		if result == sequence.Gap {
+			atomic.AddUint64(&listenNumMessagesOoO, missing)
+			log.Printf("Out of sequence heartbeat: stream %d, %d -> %d [%d]\n", header.Stream, last, header.Sequence, missing)
+		}
+		return
+	}
+
+	switch result {
+	case sequence.Duplicate:
+		atomic.AddUint64(&listenNumDuplicates, 1)
+		log.Printf("Duplicate message: stream %d, sequence %d\n", header.Stream, header.Sequence)
+	case sequence.Gap:
+		atomic.AddUint64(&listenNumMessagesOoO, missing)
+		log.Printf("Out of sequence message: stream %d, %d -> %d [%d]\n", header.Stream, header.Sequence-missing-1, header.Sequence, missing)
+	case sequence.Late, sequence.TooOld:
+		atomic.AddUint64(&listenNumPacketsMessy, 1)
+		log.Printf("Messy message: stream %d, sequence %d\n", header.Stream, header.Sequence)
+	}
+}
+
+// dumpSbe prints the SBE messages of the packet, and the raw bytes from the
+// first one which can't be decoded
+func dumpSbe(b []byte) {
+	if len(b) < listenSbeOffset {
+		log.Printf("Packet shorter than the SBE offset %d\n", listenSbeOffset)
+		util.DumpByteSlice(b)
+		return
+	}
+	b = b[listenSbeOffset:]
+	for len(b) > 0 {
+		msg, size := b, 0
+		if listenSbeFramingSize > 0 {
+			if len(b) >= listenSbeFramingSize {
+				size = int(listenSchema.ByteOrder.Uint16(b[0:2]))
+			}
+			if size < listenSbeFramingSize || size > len(b) {
+				log.Printf("SBE message framing failed: size %d of %d bytes\n", size, len(b))
+				util.DumpByteSlice(b)
+				return
+			}
+			msg = b[listenSbeFramingSize:size]
+		}
+		m, n, err := listenSchema.Decode(msg)
+		if err != nil {
+			log.Printf("SBE decoding failed: %v\n", err)
+			util.DumpByteSlice(b)
+			return
+		}
+		if size == 0 {
+			size = n
+		}
+		if listenSbeJSON {
+			j, err := m.JSON()
+			if err != nil {
+				log.Printf("JSON rendering of %s failed: %v\n", m.Name, err)
+			} else {
+				fmt.Println(string(j))
+			}
+		} else {
+			fmt.Print(m.String())
 		}
+		b = b[size:]
 	}
 }
 
@@ -125,11 +300,31 @@ func init() {
 	listenCmd.PersistentFlags().StringVarP(&listenInterface, "interface", "i", "", "The multicast listener interface name or IP address")
 	listenCmd.PersistentFlags().BoolVarP(&listenDumpBytes, "dump", "d", false, "Dump the raw bytes of the message")
 	listenCmd.PersistentFlags().IntVarP(&listenReceiveBufferSize, "receive-buffer-size", "r", 0, "Socket receive buffer size in bytes (0 use system default)")
+	listenCmd.PersistentFlags().IntVarP(&listenBatchSize, "batch-size", "b", mcast.DefaultBatchSize, "Number of datagrams read by a single syscall (Linux only)")
+	listenCmd.PersistentFlags().IntVar(&listenRingSize, "ring-size", mcast.DefaultRingSize, "Number of datagrams buffered between the socket reader and the decoder (0 decode in the reader). An idle decoder polls the ring yielding the CPU, then sleeping 50µs between polls: up to 50µs of latency after a quiet period")
+	listenCmd.PersistentFlags().IntVar(&listenPinCPU, "pin-cpu", -1, "Pin the socket reader to the CPU number (-1 don't pin, Linux only)")
 	listenCmd.PersistentFlags().Uint64VarP(&listenStatsInterval, "stats-interval", "s", 30, "Statistics print interval in seconds")
+	listenCmd.Flags().StringVar(&listenHeaderSpec, "header-spec", "", "Name of the header spec of the config file used to track the sequence and latency of the packets")
+	listenCmd.Flags().IntVarP(&listenSequenceWindow, "sequence-window", "w", 65536, "Number of sequence numbers per stream remembered for duplicates and gaps detection")
+	listenCmd.Flags().IntVar(&listenLatencyOutlier, "latency-outlier", 1000, "Microseconds above the lowest latency of a stream for a packet to be logged as latency outlier (0 disables it)")
+	listenCmd.Flags().StringVar(&listenSbeSchemaFile, "sbe-schema", "", "SBE schema XML file used to decode the messages in dump mode")
+	listenCmd.Flags().IntVar(&listenSbeOffset, "sbe-offset", 0, "Bytes of the packet before the first SBE message, e.g. the packet header")
+	listenCmd.Flags().IntVar(&listenSbeFramingSize, "sbe-framing-size", 0, "Bytes of the framing header prefixed to every SBE message, starting with the message size (0 no framing)")
+	listenCmd.Flags().BoolVar(&listenSbeJSON, "json", false, "Print the SBE decoded messages as JSON, one per line")
 	_ = listenCmd.MarkPersistentFlagRequired("address")
 	_ = viper.BindPFlag("address", listenCmd.PersistentFlags().Lookup("address"))
 	_ = viper.BindPFlag("interface", listenCmd.PersistentFlags().Lookup("interface"))
 	_ = viper.BindPFlag("dump", listenCmd.PersistentFlags().Lookup("dump"))
 	_ = viper.BindPFlag("receive-buffer-size", listenCmd.PersistentFlags().Lookup("receive-buffer-size"))
+	_ = viper.BindPFlag("batch-size", listenCmd.PersistentFlags().Lookup("batch-size"))
+	_ = viper.BindPFlag("ring-size", listenCmd.PersistentFlags().Lookup("ring-size"))
+	_ = viper.BindPFlag("pin-cpu", listenCmd.PersistentFlags().Lookup("pin-cpu"))
 	_ = viper.BindPFlag("stats-interval", listenCmd.PersistentFlags().Lookup("stats-interval"))
+	_ = viper.BindPFlag("header-spec", listenCmd.Flags().Lookup("header-spec"))
+	_ = viper.BindPFlag("sequence-window", listenCmd.Flags().Lookup("sequence-window"))
+	_ = viper.BindPFlag("latency-outlier", listenCmd.Flags().Lookup("latency-outlier"))
+	_ = viper.BindPFlag("sbe-schema", listenCmd.Flags().Lookup("sbe-schema"))
+	_ = viper.BindPFlag("sbe-offset", listenCmd.Flags().Lookup("sbe-offset"))
+	_ = viper.BindPFlag("sbe-framing-size", listenCmd.Flags().Lookup("sbe-framing-size"))
+	_ = viper.BindPFlag("json", listenCmd.Flags().Lookup("json"))
 }
@@ -0,0 +1,19 @@
+package b3
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	B3Cmd = &cobra.Command{
+		Use:   "b3",
+		Short: "B3 UMDF multicast commands",
+		Long:  ``,
+	}
+)
+
+func init() {
+	// Add subcommands here
+	B3Cmd.AddCommand(listenCmd)
+
+}
@@ -0,0 +1,50 @@
+package b3
+
+import (
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	listenAddresses         []string
+	listenInterface         string
+	listenDumpBytes         bool
+	listenReceiveBufferSize int
+	listenBatchSize         int
+	listenRingSize          int
+	listenPinCPU            int
+	listenStatsInterval     uint64 = 30
+	listenSequenceWindow    int    = 65536
+
+	listenCmd = &cobra.Command{
+		Use:   "listen",
+		Short: "Listen B3 multicast streams and dump out of sequence messages",
+		Long:  ``,
+	}
+)
+
+func init() {
+	listenCmd.PersistentFlags().StringSliceVarP(&listenAddresses, "address", "a", []string{"233.252.8.5:30001"}, "The multicast addresses and ports, one per incremental feed (comma separated)")
+	listenCmd.PersistentFlags().StringVarP(&listenInterface, "interface", "i", "", "The multicast listener interface name or IP address")
+	listenCmd.PersistentFlags().BoolVarP(&listenDumpBytes, "dump", "d", false, "Dump the raw bytes of the message")
+	listenCmd.PersistentFlags().IntVarP(&listenReceiveBufferSize, "receive-buffer-size", "r", 0, "Socket receive buffer size in bytes (0 use system default)")
+	listenCmd.PersistentFlags().IntVarP(&listenBatchSize, "batch-size", "b", mcast.DefaultBatchSize, "Number of datagrams read by a single syscall (Linux only)")
+	listenCmd.PersistentFlags().IntVar(&listenRingSize, "ring-size", mcast.DefaultRingSize, "Number of datagrams buffered between the socket reader and the decoder (0 decode in the reader). An idle decoder polls the ring yielding the CPU, then sleeping 50µs between polls: up to 50µs of latency after a quiet period")
+	listenCmd.PersistentFlags().IntVar(&listenPinCPU, "pin-cpu", -1, "Pin the socket reader of the first address to the CPU number (-1 don't pin, Linux only)")
+	listenCmd.PersistentFlags().Uint64VarP(&listenStatsInterval, "stats-interval", "s", 30, "Statistics print interval in seconds")
+	listenCmd.PersistentFlags().IntVarP(&listenSequenceWindow, "sequence-window", "w", 65536, "Number of sequence numbers per stream remembered for duplicates and gaps detection")
+	_ = listenCmd.MarkPersistentFlagRequired("address")
+	_ = viper.BindPFlag("address", listenCmd.PersistentFlags().Lookup("address"))
+	_ = viper.BindPFlag("interface", listenCmd.PersistentFlags().Lookup("interface"))
+	_ = viper.BindPFlag("dump", listenCmd.PersistentFlags().Lookup("dump"))
+	_ = viper.BindPFlag("receive-buffer-size", listenCmd.PersistentFlags().Lookup("receive-buffer-size"))
+	_ = viper.BindPFlag("batch-size", listenCmd.PersistentFlags().Lookup("batch-size"))
+	_ = viper.BindPFlag("ring-size", listenCmd.PersistentFlags().Lookup("ring-size"))
+	_ = viper.BindPFlag("pin-cpu", listenCmd.PersistentFlags().Lookup("pin-cpu"))
+	_ = viper.BindPFlag("stats-interval", listenCmd.PersistentFlags().Lookup("stats-interval"))
+	_ = viper.BindPFlag("sequence-window", listenCmd.PersistentFlags().Lookup("sequence-window"))
+
+	// Add subcommands here
+	listenCmd.AddCommand(listenUmdfCmd)
+}
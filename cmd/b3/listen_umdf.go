@@ -0,0 +1,260 @@
+package b3
+
+import (
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/sbe"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
+	"github.com/coalescent-labs/mcastmkt/pkg/umdf"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	umdfTotalNumBytes       uint64 = 0
+	umdfNumBytes            uint64 = 0
+	umdfNumPackets          uint64 = 0
+	umdfTotalNumPackets     uint64 = 0
+	umdfNumMessages         uint64 = 0
+	umdfNumPacketsOoO       uint64 = 0
+	umdfNumPacketsMessy     uint64 = 0
+	umdfNumDuplicates       uint64 = 0
+	umdfNumVersionChanges   uint64 = 0
+	umdfNumCycles           uint64 = 0
+	umdfNumErrors           uint64 = 0
+	umdfSchemaFile          string
+	umdfSnapshotAddresses   []string
+	umdfInstrumentAddresses []string
+
+	umdfSchema *sbe.Schema
+
+	listenUmdfCmd = &cobra.Command{
+		Use:   "umdf",
+		Short: "Listen B3 UMDF binary multicast streams and dump out of sequence packets",
+		Long: `Detecting duplicates and gaps by the SequenceNumber of the packet header, per feed and channel. Each --address
+is an incremental feed, --snapshot-address and --instrument-address are the snapshot and instrument definition feeds.
+A newer SequenceVersion of a channel restarts its sequence check, the packets of an older one are counted as messy.
+A snapshot or instrument definition feed starting a new cycle from sequence number 1 restarts it too.
+With the B3 SBE schema file (--schema) the dump mode prints the decoded messages instead of the raw bytes.`,
+		RunE: listenUmdf,
+	}
+)
+
+// umdfFeed is the sequence check of the channels of a feed, owned by its
+// reader
+type umdfFeed struct {
+	kind     string
+	address  string
+	tracker  *sequence.Tracker
+	versions map[uint8]uint16
+	// lastSeqNum and lastVersion are the ones of the last packet, read by
+	// the stats printer
+	lastSeqNum  uint64
+	lastVersion uint64
+}
+
+func umdfStatsPrinter(feeds []*umdfFeed, listeners []*mcast.Listener) {
+	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
+		recvMsg := atomic.SwapUint64(&umdfNumPackets, 0)
+		recvTotalMsg := atomic.SwapUint64(&umdfTotalNumPackets, 0)
+		recvBytes := atomic.SwapUint64(&umdfNumBytes, 0)
+		recvTotalBytes := atomic.SwapUint64(&umdfTotalNumBytes, 0)
+		recvMessages := atomic.SwapUint64(&umdfNumMessages, 0)
+		recvOoO := atomic.SwapUint64(&umdfNumPacketsOoO, 0)
+		recvMessy := atomic.SwapUint64(&umdfNumPacketsMessy, 0)
+		recvDuplicates := atomic.SwapUint64(&umdfNumDuplicates, 0)
+		recvVersions := atomic.SwapUint64(&umdfNumVersionChanges, 0)
+		recvCycles := atomic.SwapUint64(&umdfNumCycles, 0)
+		recvErrors := atomic.SwapUint64(&umdfNumErrors, 0)
+		var sockStats mcast.Stats
+		for _, l := range listeners {
+			s := l.SwapStats()
+			sockStats.KernelDrops += s.KernelDrops
+			sockStats.RingFull += s.RingFull
+		}
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], UMDF messages: %d, Feeds: %d, OoO: %d, Kernel drops: %d, Messy: %d, Duplicates: %d, Version changes: %d, Cycles: %d, Decoding errors: %d, Ring full: %d\n",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			recvMessages, len(feeds), recvOoO, sockStats.KernelDrops, recvMessy, recvDuplicates, recvVersions, recvCycles,
+			recvErrors, sockStats.RingFull)
+		for _, f := range feeds {
+			log.Printf("FEED %s %s: Last seqNo: %d, Sequence version: %d\n",
+				f.kind, f.address, atomic.LoadUint64(&f.lastSeqNum), atomic.LoadUint64(&f.lastVersion))
+		}
+	}
+}
+
+func listenUmdf(*cobra.Command, []string) error {
+	var intf *net.Interface = nil
+	var err error
+
+	if listenInterface != "" {
+		intf, err = util.GetInterfaceFromIPorName(listenInterface)
+		if err != nil {
+			return err
+		}
+	}
+
+	if umdfSchemaFile != "" {
+		umdfSchema, err = sbe.LoadSchemaFile(umdfSchemaFile)
+		if err != nil {
+			return err
+		}
+		log.Printf("Loaded %d SBE messages from %s\n", umdfSchema.Len(), umdfSchemaFile)
+	}
+
+	var feeds []*umdfFeed
+	for _, address := range listenAddresses {
+		feeds = append(feeds, &umdfFeed{kind: "incremental", address: address})
+	}
+	for _, address := range umdfSnapshotAddresses {
+		feeds = append(feeds, &umdfFeed{kind: "snapshot", address: address})
+	}
+	for _, address := range umdfInstrumentAddresses {
+		feeds = append(feeds, &umdfFeed{kind: "instrument", address: address})
+	}
+
+	listeners := make([]*mcast.Listener, len(feeds))
+	for i, f := range feeds {
+		pinCPU := -1
+		if i == 0 {
+			pinCPU = listenPinCPU
+		}
+		l, err := mcast.Listen(f.address, intf, mcast.Options{
+			ReceiveBufferSize: listenReceiveBufferSize,
+			BatchSize:         listenBatchSize,
+			RingSize:          listenRingSize,
+			PinCPU:            pinCPU,
+		})
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		listeners[i] = l
+		f.tracker = sequence.NewTracker(listenSequenceWindow)
+		f.versions = make(map[uint8]uint16)
+		log.Printf("Listening to %s feed %s@%s  %v\n", f.kind, f.address, util.StringIfEmpty(listenInterface, "default"), intf)
+	}
+
+	go umdfStatsPrinter(feeds, listeners)
+
+	errs := make(chan error, len(listeners))
+	for i := range listeners {
+		go func(l *mcast.Listener, f *umdfFeed) {
+			errs <- readUmdf(l, f)
+		}(listeners[i], feeds[i])
+	}
+	return fmt.Errorf("ReadFromUDP failed: %w", <-errs)
+}
+
+// readUmdf checks the sequence of the packets of the feed
+func readUmdf(l *mcast.Listener, f *umdfFeed) error {
+	group := l.Group()
+
+	return l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
+		atomic.AddUint64(&umdfTotalNumPackets, 1)
+		atomic.AddUint64(&umdfTotalNumBytes, uint64(numBytes))
+
+		if !p.Dst.IsMulticast() || !p.Dst.Equal(group.IP) {
+			// unknown group, discard
+			return
+		}
+
+		atomic.AddUint64(&umdfNumPackets, 1)
+		atomic.AddUint64(&umdfNumBytes, uint64(numBytes))
+		header, err := umdf.ParsePacketHeader(buffer)
+		if err != nil {
+			log.Printf("Packet too short from %v: %d bytes\n", p.Src, numBytes)
+			return
+		}
+		msgs, err := umdf.Messages(buffer)
+		atomic.AddUint64(&umdfNumMessages, uint64(len(msgs)))
+		if err != nil {
+			atomic.AddUint64(&umdfNumErrors, 1)
+		}
+
+		if listenDumpBytes {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("addr: %v, numBytes: %d, feed: %s, channel: %d, sequenceVersion: %d, sequenceNumber: %d, sendingTime: %d\n",
+				p.Src, numBytes, f.kind, header.Channel, header.SequenceVersion, header.SequenceNumber, header.SendingTime)
+			dumpUmdf(msgs)
+			if err != nil {
+				log.Printf("UMDF message framing failed: %v\n", err)
+				util.DumpByteSlice(buffer)
+			}
+		}
+
+		window := f.tracker.Window(uint64(header.Channel))
+		if version, ok := f.versions[header.Channel]; ok && version != header.SequenceVersion {
+			if !umdf.NewerVersion(header.SequenceVersion, version) {
+				// a late packet of a previous version
+				atomic.AddUint64(&umdfNumPacketsMessy, 1)
+				log.Printf("Messy message: %s feed, channel %d, sequenceVersion %d after %d, seqNo %d\n",
+					f.kind, header.Channel, header.SequenceVersion, version, header.SequenceNumber)
+				return
+			}
+			atomic.AddUint64(&umdfNumVersionChanges, 1)
+			log.Printf("Sequence version change on %s feed, channel %d: %d -> %d, last seqNo %d\n",
+				f.kind, header.Channel, version, header.SequenceVersion, window.Last())
+			window.Reset()
+		} else if header.SequenceNumber == 1 && window.Last() > 1 {
+			if f.kind == "incremental" {
+				log.Printf("Sequence reset on %s feed, channel %d from %d\n", f.kind, header.Channel, window.Last())
+			} else {
+				atomic.AddUint64(&umdfNumCycles, 1)
+			}
+			window.Reset()
+		}
+		f.versions[header.Channel] = header.SequenceVersion
+		atomic.StoreUint64(&f.lastVersion, uint64(header.SequenceVersion))
+		atomic.StoreUint64(&f.lastSeqNum, uint64(header.SequenceNumber))
+
+		switch result, missing := window.Add(uint64(header.SequenceNumber)); result {
+		case sequence.Gap:
+			atomic.AddUint64(&umdfNumPacketsOoO, missing)
+			log.Printf("Out of sequence message: %s feed, channel %d, %d -> %d [%d]\n",
+				f.kind, header.Channel, uint64(header.SequenceNumber)-missing-1, header.SequenceNumber, missing)
+		case sequence.Duplicate:
+			atomic.AddUint64(&umdfNumDuplicates, 1)
+			log.Printf("Duplicate message: %s feed, channel %d, seqNo %d\n", f.kind, header.Channel, header.SequenceNumber)
+		case sequence.Late, sequence.TooOld:
+			atomic.AddUint64(&umdfNumPacketsMessy, 1)
+			log.Printf("Messy message: %s feed, channel %d, seqNo %d\n", f.kind, header.Channel, header.SequenceNumber)
+		}
+	})
+}
+
+// dumpUmdf prints the SBE decoded messages, or their raw bytes when no
+// schema is loaded or they can't be decoded
+func dumpUmdf(msgs []umdf.Message) {
+	for _, msg := range msgs {
+		if umdfSchema == nil {
+			util.DumpByteSlice(msg.Data)
+			continue
+		}
+		m, _, err := umdfSchema.Decode(msg.Data)
+		if err != nil {
+			atomic.AddUint64(&umdfNumErrors, 1)
+			log.Printf("SBE decoding of template %d failed: %v\n", msg.TemplateID, err)
+			util.DumpByteSlice(msg.Data)
+			continue
+		}
+		fmt.Print(m.String())
+	}
+}
+
+func init() {
+	listenUmdfCmd.Flags().StringVarP(&umdfSchemaFile, "schema", "x", "", "B3 UMDF SBE schema XML file used to decode the messages in dump mode")
+	_ = viper.BindPFlag("schema", listenUmdfCmd.Flags().Lookup("schema"))
+	listenUmdfCmd.Flags().StringSliceVar(&umdfSnapshotAddresses, "snapshot-address", nil, "The snapshot feed multicast addresses and ports (comma separated)")
+	_ = viper.BindPFlag("snapshot-address", listenUmdfCmd.Flags().Lookup("snapshot-address"))
+	listenUmdfCmd.Flags().StringSliceVar(&umdfInstrumentAddresses, "instrument-address", nil, "The instrument definition feed multicast addresses and ports (comma separated)")
+	_ = viper.BindPFlag("instrument-address", listenUmdfCmd.Flags().Lookup("instrument-address"))
+}
@@ -0,0 +1,19 @@
+package cboe
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	CboeCmd = &cobra.Command{
+		Use:   "cboe",
+		Short: "Cboe PITCH multicast commands",
+		Long:  ``,
+	}
+)
+
+func init() {
+	// Add subcommands here
+	CboeCmd.AddCommand(listenCmd)
+
+}
@@ -0,0 +1,200 @@
+package cboe
+
+import (
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/pitch"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/spf13/cobra"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	pitchTotalNumBytes     uint64 = 0
+	pitchNumBytes          uint64 = 0
+	pitchNumPackets        uint64 = 0
+	pitchTotalNumPackets   uint64 = 0
+	pitchNumMessages       uint64 = 0
+	pitchNumMessagesOoO    uint64 = 0
+	pitchNumPacketsMessy   uint64 = 0
+	pitchNumHeartbeats     uint64 = 0
+	pitchNumUnsequenced    uint64 = 0
+	pitchNumUnitClears     uint64 = 0
+	pitchNumResets         uint64 = 0
+	pitchNumUnits          uint64 = 0
+	pitchNumDecodingErrors uint64 = 0
+
+	listenPitchCmd = &cobra.Command{
+		Use:   "pitch",
+		Short: "Listen Cboe PITCH multicast stream and dump out of sequence messages",
+		Long: `Detecting duplicates and gaps by the Sequenced Unit Header, per unit: a multicast group carries several units,
+each one with its own sequence. The header has the sequence number of the first message and the message count, so
+the gaps are reported in number of missing messages.
+Heartbeats (count 0) announce the next sequence number of the unit and reveal the gaps of an idle unit, the
+unsequenced packets (sequence 0) are not checked. The Unit Clear and End Of Session messages are logged, and a unit
+restarting from sequence 1 resets its sequence check. In dump mode the PITCH messages are decoded.`,
+		RunE: listenPitch,
+	}
+)
+
+func pitchStatsPrinter(l *mcast.Listener) {
+	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
+		recvMsg := atomic.SwapUint64(&pitchNumPackets, 0)
+		recvTotalMsg := atomic.SwapUint64(&pitchTotalNumPackets, 0)
+		recvBytes := atomic.SwapUint64(&pitchNumBytes, 0)
+		recvTotalBytes := atomic.SwapUint64(&pitchTotalNumBytes, 0)
+		recvMessages := atomic.SwapUint64(&pitchNumMessages, 0)
+		recvOoO := atomic.SwapUint64(&pitchNumMessagesOoO, 0)
+		recvMessy := atomic.SwapUint64(&pitchNumPacketsMessy, 0)
+		recvHeartbeats := atomic.SwapUint64(&pitchNumHeartbeats, 0)
+		recvUnsequenced := atomic.SwapUint64(&pitchNumUnsequenced, 0)
+		recvUnitClears := atomic.SwapUint64(&pitchNumUnitClears, 0)
+		recvResets := atomic.SwapUint64(&pitchNumResets, 0)
+		recvErrors := atomic.SwapUint64(&pitchNumDecodingErrors, 0)
+		sockStats := l.SwapStats()
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], PITCH messages: %d, Units: %d, Missing messages: %d, Kernel drops: %d, Messy: %d, Heartbeats: %d, Unsequenced: %d, Unit clears: %d, Resets: %d, Decoding errors: %d, Ring full: %d, Syscalls/pkt: %.3f\n",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			recvMessages, atomic.LoadUint64(&pitchNumUnits), recvOoO, sockStats.KernelDrops, recvMessy, recvHeartbeats,
+			recvUnsequenced, recvUnitClears, recvResets, recvErrors, sockStats.RingFull, sockStats.SyscallsPerPacket())
+	}
+}
+
+func listenPitch(*cobra.Command, []string) error {
+	// Parse the string address
+	addr, err := net.ResolveUDPAddr("udp4", listenAddress)
+	if err != nil {
+		return err
+	}
+
+	var intf *net.Interface = nil
+
+	if listenInterface != "" {
+		intf, err = util.GetInterfaceFromIPorName(listenInterface)
+		if err != nil {
+			return err
+		}
+	}
+
+	l, err := mcast.Listen(listenAddress, intf, mcast.Options{
+		ReceiveBufferSize: listenReceiveBufferSize,
+		BatchSize:         listenBatchSize,
+		RingSize:          listenRingSize,
+		PinCPU:            listenPinCPU,
+	})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	// sliding windows per unit for message sequence numbers duplicates and gaps check
+	tracker := sequence.NewTracker(listenSequenceWindow)
+
+	go pitchStatsPrinter(l)
+
+	log.Printf("Listening to %s@%s  %v\n", listenAddress, util.StringIfEmpty(listenInterface, "default"), intf)
+
+	// Loop forever reading from the socket
+	err = l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
+		atomic.AddUint64(&pitchTotalNumPackets, 1)
+		atomic.AddUint64(&pitchTotalNumBytes, uint64(numBytes))
+
+		if !p.Dst.IsMulticast() {
+			return
+		}
+		if !p.Dst.Equal(addr.IP) {
+			// unknown group, discard
+			return
+		}
+
+		atomic.AddUint64(&pitchNumPackets, 1)
+		atomic.AddUint64(&pitchNumBytes, uint64(numBytes))
+
+		header, err := pitch.ParseHeader(buffer)
+		if err != nil {
+			log.Printf("Invalid packet from %v: %v\n", p.Src, err)
+			return
+		}
+		msgs, framingErr := pitch.Messages(buffer, &header)
+		atomic.AddUint64(&pitchNumMessages, uint64(len(msgs)))
+
+		if listenDumpBytes {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("addr: %v, numBytes: %d, unit: %d, sequence: %d, count: %d\n", p.Src, numBytes, header.Unit, header.Sequence, header.Count)
+			dumpPitch(msgs)
+			if framingErr != nil {
+				log.Printf("PITCH message framing failed: %v\n", framingErr)
+				util.DumpByteSlice(buffer)
+			}
+		}
+		if framingErr != nil {
+			atomic.AddUint64(&pitchNumDecodingErrors, 1)
+		}
+
+		if !header.Sequenced() {
+			atomic.AddUint64(&pitchNumUnsequenced, 1)
+			return
+		}
+		for _, m := range msgs {
+			switch m.Type {
+			case pitch.TypeUnitClear:
+				atomic.AddUint64(&pitchNumUnitClears, 1)
+				log.Printf("Unit clear: unit %d, sequence %d\n", header.Unit, header.Sequence)
+			case pitch.TypeEndOfSession:
+				log.Printf("End of session: unit %d, sequence %d\n", header.Unit, header.Sequence)
+			}
+		}
+
+		window := tracker.Window(uint64(header.Unit))
+		atomic.StoreUint64(&pitchNumUnits, uint64(tracker.Streams()))
+		last := window.Last()
+		result, missing, reset := window.AddPacket(uint64(header.Sequence), uint64(header.Count))
+		if reset {
+			atomic.AddUint64(&pitchNumResets, 1)
+			log.Printf("Sequence reset on unit %d from %d\n", header.Unit, last)
+		}
+		if header.Heartbeat() {
+			atomic.AddUint64(&pitchNumHeartbeats, 1)
+			// the next sequence number reveals the messages lost on an idle unit
+			if result == sequence.Gap {
+				atomic.AddUint64(&pitchNumMessagesOoO, missing)
+				log.Printf("Out of sequence heartbeat: unit %d, %d -> %d [%d]\n", header.Unit, last, header.Sequence, missing)
+			}
+			return
+		}
+
+		switch result {
+		case sequence.Duplicate:
+			log.Printf("Duplicate message: unit %d, sequence %d\n", header.Unit, header.Sequence)
+		case sequence.Gap:
+			atomic.AddUint64(&pitchNumMessagesOoO, missing)
+			log.Printf("Out of sequence message: unit %d, %d -> %d [%d]\n", header.Unit, uint64(header.Sequence)-missing-1, header.Sequence, missing)
+		case sequence.Late, sequence.TooOld:
+			atomic.AddUint64(&pitchNumPacketsMessy, 1)
+			log.Printf("Messy message: unit %d, sequence %d\n", header.Unit, header.Sequence)
+		}
+	})
+	return fmt.Errorf("ReadFromUDP failed: %w", err)
+}
+
+// dumpPitch prints the decoded PITCH messages, and the raw bytes of the ones
+// which can't be decoded
+func dumpPitch(msgs []pitch.Message) {
+	for i := range msgs {
+		err := msgs[i].Decode()
+		fmt.Println(msgs[i].String())
+		if err != nil || !msgs[i].Known() {
+			if err != nil {
+				atomic.AddUint64(&pitchNumDecodingErrors, 1)
+				log.Printf("PITCH decoding failed: %v\n", err)
+			}
+			util.DumpByteSlice(msgs[i].Body)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package cme
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	CmeCmd = &cobra.Command{
+		Use:   "cme",
+		Short: "CME MDP 3.0 multicast commands",
+		Long:  ``,
+	}
+)
+
+func init() {
+	// Add subcommands here
+	CmeCmd.AddCommand(listenCmd)
+
+}
@@ -0,0 +1,266 @@
+package cme
+
+import (
+	"errors"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/mdp3"
+	"github.com/coalescent-labs/mcastmkt/pkg/sbe"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	mdp3TotalNumBytes   uint64 = 0
+	mdp3NumBytes        uint64 = 0
+	mdp3NumPackets      uint64 = 0
+	mdp3TotalNumPackets uint64 = 0
+	mdp3NumMessages     uint64 = 0
+	mdp3NumPacketsLost  uint64 = 0
+	mdp3NumErrors       uint64 = 0
+	mdp3SchemaFile      string
+	mdp3AddressesB      []string
+	mdp3ArbitrationWait int
+
+	mdp3Schema *sbe.Schema
+
+	listenMdp3Cmd = &cobra.Command{
+		Use:   "mdp3",
+		Short: "Listen CME MDP 3.0 multicast streams and dump out of sequence messages",
+		Long: `Detecting duplicates and gaps by the MsgSeqNum of the binary packet header, per channel.
+Each --address is a channel feed, e.g. the incremental feed A; the --address-b feeds, in the same order, are the
+redundant feeds of the channels. The packets of the A and B feeds are arbitrated by MsgSeqNum: the first copy wins,
+a packet missing on a feed and received on the other is recovered, and it's lost when missing on both feeds once
+both moved past it or after --arbitration-timeout milliseconds.
+With the CME SBE templates file (--schema) the dump mode prints the decoded messages instead of the raw bytes.`,
+		RunE: listenMdp3,
+	}
+)
+
+var mdp3FeedNames = [...]string{"A", "B"}
+
+// mdp3Channel is the arbitration of the feeds of a channel, serialized by mu
+// between their readers
+type mdp3Channel struct {
+	id      int
+	address string
+	mu      sync.Mutex
+	arbiter *sequence.Arbiter
+	feeds   int
+}
+
+func mdp3StatsPrinter(channels []*mdp3Channel, listeners []*mcast.Listener) {
+	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
+		recvMsg := atomic.SwapUint64(&mdp3NumPackets, 0)
+		recvTotalMsg := atomic.SwapUint64(&mdp3TotalNumPackets, 0)
+		recvBytes := atomic.SwapUint64(&mdp3NumBytes, 0)
+		recvTotalBytes := atomic.SwapUint64(&mdp3TotalNumBytes, 0)
+		recvMessages := atomic.SwapUint64(&mdp3NumMessages, 0)
+		recvLost := atomic.SwapUint64(&mdp3NumPacketsLost, 0)
+		recvErrors := atomic.SwapUint64(&mdp3NumErrors, 0)
+		var sockStats mcast.Stats
+		for _, l := range listeners {
+			s := l.SwapStats()
+			sockStats.KernelDrops += s.KernelDrops
+			sockStats.RingFull += s.RingFull
+		}
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], MDP messages: %d, Channels: %d, Lost: %d, Kernel drops: %d, Decoding errors: %d, Ring full: %d\n",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			recvMessages, len(channels), recvLost, sockStats.KernelDrops, recvErrors, sockStats.RingFull)
+		for _, ch := range channels {
+			ch.mu.Lock()
+			s := ch.arbiter.SwapStats()
+			last := ch.arbiter.Last()
+			ch.mu.Unlock()
+			if ch.feeds == 1 {
+				log.Printf("CHANNEL %d %s: Last seqNo: %d, Gaps: %d, Lost: %d, Duplicates: %d\n",
+					ch.id, ch.address, last, s.Gaps[0], s.Lost, s.Duplicates[0])
+				continue
+			}
+			log.Printf("CHANNEL %d %s: Last seqNo: %d, Won A/B: %d/%d, Gaps A/B: %d/%d, Recovered: %d, Lost: %d, Duplicates A/B: %d/%d\n",
+				ch.id, ch.address, last, s.Won[0], s.Won[1], s.Gaps[0], s.Gaps[1], s.Recovered, s.Lost, s.Duplicates[0], s.Duplicates[1])
+		}
+	}
+}
+
+// mdp3LossChecker logs the packets lost on all the feeds of the channels
+func mdp3LossChecker(channels []*mdp3Channel) {
+	interval := max(time.Millisecond*time.Duration(mdp3ArbitrationWait)/2, time.Millisecond)
+	for now := range time.Tick(interval) {
+		for _, ch := range channels {
+			ch.mu.Lock()
+			losses := ch.arbiter.Losses(now)
+			ch.mu.Unlock()
+			for _, loss := range losses {
+				atomic.AddUint64(&mdp3NumPacketsLost, loss.Missing)
+				log.Printf("Out of sequence message: channel %d, %d -> %d [%d]\n", ch.id, loss.From-1, loss.To+1, loss.Missing)
+			}
+		}
+	}
+}
+
+func listenMdp3(*cobra.Command, []string) error {
+	if len(mdp3AddressesB) > 0 && len(mdp3AddressesB) != len(listenAddresses) {
+		return errors.New("one feed B address (--address-b) is needed per feed A address (--address)")
+	}
+
+	var intf *net.Interface = nil
+	var err error
+
+	if listenInterface != "" {
+		intf, err = util.GetInterfaceFromIPorName(listenInterface)
+		if err != nil {
+			return err
+		}
+	}
+
+	if mdp3SchemaFile != "" {
+		mdp3Schema, err = sbe.LoadSchemaFile(mdp3SchemaFile)
+		if err != nil {
+			return err
+		}
+		log.Printf("Loaded %d SBE messages from %s\n", mdp3Schema.Len(), mdp3SchemaFile)
+	}
+
+	feeds := 1
+	if len(mdp3AddressesB) > 0 {
+		feeds = 2
+	}
+	channels := make([]*mdp3Channel, len(listenAddresses))
+	var listeners []*mcast.Listener
+	var readers []func() error
+	for i, address := range listenAddresses {
+		ch := &mdp3Channel{
+			id:      i,
+			address: address,
+			arbiter: sequence.NewArbiter(listenSequenceWindow, feeds, time.Millisecond*time.Duration(mdp3ArbitrationWait)),
+			feeds:   feeds,
+		}
+		channels[i] = ch
+		for feed := 0; feed < feeds; feed++ {
+			if feed == 1 {
+				address = mdp3AddressesB[i]
+			}
+			pinCPU := -1
+			if len(listeners) == 0 {
+				pinCPU = listenPinCPU
+			}
+			l, err := mcast.Listen(address, intf, mcast.Options{
+				ReceiveBufferSize: listenReceiveBufferSize,
+				BatchSize:         listenBatchSize,
+				RingSize:          listenRingSize,
+				PinCPU:            pinCPU,
+			})
+			if err != nil {
+				return err
+			}
+			defer l.Close()
+			listeners = append(listeners, l)
+			log.Printf("Listening to channel %d feed %s %s@%s  %v\n", i, mdp3FeedNames[feed], address, util.StringIfEmpty(listenInterface, "default"), intf)
+			feed := feed
+			readers = append(readers, func() error { return readMdp3(l, ch, feed) })
+		}
+	}
+
+	go mdp3StatsPrinter(channels, listeners)
+	go mdp3LossChecker(channels)
+
+	errs := make(chan error, len(readers))
+	for _, read := range readers {
+		go func(read func() error) {
+			errs <- read()
+		}(read)
+	}
+	return fmt.Errorf("ReadFromUDP failed: %w", <-errs)
+}
+
+// readMdp3 arbitrates the packets of a feed of the channel
+func readMdp3(l *mcast.Listener, ch *mdp3Channel, feed int) error {
+	group := l.Group()
+
+	return l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
+		atomic.AddUint64(&mdp3TotalNumPackets, 1)
+		atomic.AddUint64(&mdp3TotalNumBytes, uint64(numBytes))
+
+		if !p.Dst.IsMulticast() || !p.Dst.Equal(group.IP) {
+			// unknown group, discard
+			return
+		}
+
+		atomic.AddUint64(&mdp3NumPackets, 1)
+		atomic.AddUint64(&mdp3NumBytes, uint64(numBytes))
+		header, err := mdp3.ParsePacketHeader(buffer)
+		if err != nil {
+			log.Printf("Packet too short from %v: %d bytes\n", p.Src, numBytes)
+			return
+		}
+
+		ch.mu.Lock()
+		result, _ := ch.arbiter.Add(feed, uint64(header.MsgSeqNum), p.Time)
+		ch.mu.Unlock()
+		switch result {
+		case sequence.Duplicate:
+			// the copy of the other feed, or a duplicate of the same one
+			// counted by the arbiter
+			return
+		case sequence.TooOld:
+			log.Printf("Messy message: channel %d feed %s, msgSeqNum %d\n", ch.id, mdp3FeedNames[feed], header.MsgSeqNum)
+			return
+		}
+
+		msgs, err := mdp3.Messages(buffer)
+		atomic.AddUint64(&mdp3NumMessages, uint64(len(msgs)))
+		if err != nil {
+			atomic.AddUint64(&mdp3NumErrors, 1)
+		}
+
+		if listenDumpBytes {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("addr: %v, numBytes: %d, channel: %d, feed: %s, msgSeqNum: %d, sendingTime: %d\n",
+				p.Src, numBytes, ch.id, mdp3FeedNames[feed], header.MsgSeqNum, header.SendingTime)
+			dumpMdp3(msgs)
+			if err != nil {
+				log.Printf("MDP message framing failed: %v\n", err)
+				util.DumpByteSlice(buffer)
+			}
+		}
+	})
+}
+
+// dumpMdp3 prints the SBE decoded messages, or their raw bytes when no
+// schema is loaded or they can't be decoded
+func dumpMdp3(msgs []mdp3.Message) {
+	for _, msg := range msgs {
+		if mdp3Schema == nil {
+			util.DumpByteSlice(msg.Data)
+			continue
+		}
+		m, _, err := mdp3Schema.Decode(msg.Data)
+		if err != nil {
+			atomic.AddUint64(&mdp3NumErrors, 1)
+			log.Printf("SBE decoding of template %d failed: %v\n", msg.TemplateID, err)
+			util.DumpByteSlice(msg.Data)
+			continue
+		}
+		fmt.Print(m.String())
+	}
+}
+
+func init() {
+	listenMdp3Cmd.Flags().StringVarP(&mdp3SchemaFile, "schema", "x", "", "CME MDP 3.0 SBE templates XML file used to decode the messages in dump mode")
+	_ = viper.BindPFlag("schema", listenMdp3Cmd.Flags().Lookup("schema"))
+	listenMdp3Cmd.Flags().StringSliceVar(&mdp3AddressesB, "address-b", nil, "The feed B multicast addresses and ports, one per --address (comma separated)")
+	_ = viper.BindPFlag("address-b", listenMdp3Cmd.Flags().Lookup("address-b"))
+	listenMdp3Cmd.Flags().IntVar(&mdp3ArbitrationWait, "arbitration-timeout", 100, "Milliseconds a packet missing on a feed is waited for on the other one before being lost")
+	_ = viper.BindPFlag("arbitration-timeout", listenMdp3Cmd.Flags().Lookup("arbitration-timeout"))
+}
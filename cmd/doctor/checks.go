@@ -0,0 +1,235 @@
+package doctor
+
+import (
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/sysinfo"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"net"
+)
+
+const (
+	// recommendedReceiveBuffer is the minimum net.core.rmem_max for full depth market data feeds
+	recommendedReceiveBuffer = 16 * 1024 * 1024
+	// recommendedNetdevBacklog is the minimum net.core.netdev_max_backlog for bursty feeds
+	recommendedNetdevBacklog = 10000
+	// minimumMTU is the standard ethernet MTU, market data packets are sized for it
+	minimumMTU = 1500
+)
+
+// runChecks runs all the diagnostics for the optional interface and multicast address
+func runChecks(ifaceName string, address string) ([]check, error) {
+	var checks []check
+
+	var intf *net.Interface
+	if ifaceName != "" {
+		var err error
+		intf, err = util.GetInterfaceFromIPorName(ifaceName)
+		if err != nil {
+			checks = append(checks, fail("interface", "list the available interfaces with: mcastmkt interfaces", "%v", err))
+		}
+	}
+
+	var group *net.UDPAddr
+	if address != "" {
+		var err error
+		group, err = net.ResolveUDPAddr("udp4", address)
+		if err != nil {
+			return nil, err
+		}
+		if group.IP.IsMulticast() {
+			checks = append(checks, pass("address", "%s is a multicast address", group.IP))
+		} else {
+			checks = append(checks, fail("address", "multicast addresses are in 224.0.0.0/4", "%s is not a multicast address", group.IP))
+		}
+	}
+
+	if intf != nil {
+		checks = append(checks, checkInterface(intf)...)
+	}
+	checks = append(checks, checkReversePathFilter(intf))
+	checks = append(checks, checkIGMP(intf, group)...)
+	if group != nil {
+		checks = append(checks, checkRoute(intf, group))
+	}
+	checks = append(checks, checkBuffers()...)
+	checks = append(checks, checkUDPErrors())
+	return checks, nil
+}
+
+func checkInterface(intf *net.Interface) []check {
+	var checks []check
+
+	if intf.Flags&net.FlagUp == 0 {
+		checks = append(checks, fail("interface up", fmt.Sprintf("ip link set %s up", intf.Name), "%s is down", intf.Name))
+	} else if intf.Flags&net.FlagRunning == 0 {
+		checks = append(checks, fail("interface up", "check the cable/link of the interface", "%s is up but has no carrier", intf.Name))
+	} else {
+		checks = append(checks, pass("interface up", "%s is up and running", intf.Name))
+	}
+
+	if intf.Flags&net.FlagMulticast == 0 {
+		checks = append(checks, fail("interface multicast", fmt.Sprintf("ip link set %s multicast on", intf.Name), "%s has no MULTICAST flag", intf.Name))
+	} else {
+		checks = append(checks, pass("interface multicast", "%s supports multicast", intf.Name))
+	}
+
+	if intf.MTU < minimumMTU {
+		checks = append(checks, warn("interface mtu", fmt.Sprintf("ip link set %s mtu %d", intf.Name, minimumMTU), "%s MTU %d is lower than %d, large datagrams will be fragmented or lost", intf.Name, intf.MTU, minimumMTU))
+	} else {
+		checks = append(checks, pass("interface mtu", "%s MTU %d", intf.Name, intf.MTU))
+	}
+
+	addrs, err := intf.Addrs()
+	hasIPv4 := false
+	if err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				hasIPv4 = true
+			}
+		}
+	}
+	if hasIPv4 {
+		checks = append(checks, pass("interface address", "%s has an IPv4 address", intf.Name))
+	} else {
+		checks = append(checks, fail("interface address", fmt.Sprintf("ip addr add <ip>/<prefix> dev %s", intf.Name), "%s has no IPv4 address, IGMP joins can't be sent", intf.Name))
+	}
+	return checks
+}
+
+// checkReversePathFilter checks the strict reverse path filtering that drops
+// multicast coming from sources not routed through the receiving interface.
+// The effective value is the maximum of the "all" and the interface settings.
+func checkReversePathFilter(intf *net.Interface) check {
+	const name = "rp_filter"
+	all, err := sysinfo.ReadSysctlInt("net.ipv4.conf.all.rp_filter")
+	if err != nil {
+		return warn(name, "", "%v", err)
+	}
+	value, scope := all, "all"
+	if intf != nil {
+		if v, err := sysinfo.ReadSysctlInt("net.ipv4.conf." + intf.Name + ".rp_filter"); err == nil && v > value {
+			value, scope = v, intf.Name
+		}
+	}
+	switch value {
+	case 0:
+		return pass(name, "reverse path filtering disabled")
+	case 2:
+		return pass(name, "loose reverse path filtering (%s)", scope)
+	default:
+		hint := "sysctl -w net.ipv4.conf.all.rp_filter=2"
+		if intf != nil {
+			hint += " net.ipv4.conf." + intf.Name + ".rp_filter=2"
+		}
+		return warn(name, hint, "strict reverse path filtering (%s): multicast from sources not routed via the interface is dropped", scope)
+	}
+}
+
+func checkIGMP(intf *net.Interface, group *net.UDPAddr) []check {
+	var checks []check
+
+	if v, err := sysinfo.ReadSysctlInt("net.ipv4.igmp_max_memberships"); err == nil {
+		checks = append(checks, pass("igmp max memberships", "%d groups per socket", v))
+	}
+
+	memberships, err := sysinfo.IGMPMemberships()
+	if err != nil {
+		return append(checks, warn("igmp", "", "%v", err))
+	}
+
+	if intf != nil {
+		querier := ""
+		for _, m := range memberships {
+			if m.Device == intf.Name {
+				querier = m.Querier
+				break
+			}
+		}
+		forced, _ := sysinfo.ReadSysctlInt("net.ipv4.conf." + intf.Name + ".force_igmp_version")
+		switch {
+		case querier == "V1":
+			checks = append(checks, warn("igmp version", fmt.Sprintf("sysctl -w net.ipv4.conf.%s.force_igmp_version=2", intf.Name), "%s uses IGMPv1, leaves are not signalled to the network", intf.Name))
+		case forced != 0:
+			checks = append(checks, pass("igmp version", "%s forced to IGMPv%d (querier %s)", intf.Name, forced, util.StringIfEmpty(querier, "unknown")))
+		default:
+			checks = append(checks, pass("igmp version", "%s querier %s", intf.Name, util.StringIfEmpty(querier, "unknown")))
+		}
+	}
+
+	if group != nil {
+		var joined []string
+		for _, m := range memberships {
+			if m.Group.Equal(group.IP) {
+				joined = append(joined, m.Device)
+			}
+		}
+		if len(joined) > 0 {
+			checks = append(checks, pass("igmp membership", "%s already joined on %v", group.IP, joined))
+		} else {
+			checks = append(checks, pass("igmp membership", "%s is not joined yet on this host", group.IP))
+		}
+	}
+	return checks
+}
+
+// checkRoute checks that the kernel would join the group on the expected
+// interface when no interface is given to the listener.
+func checkRoute(intf *net.Interface, group *net.UDPAddr) check {
+	const name = "multicast route"
+	route, err := sysinfo.RouteFor(group.IP)
+	if err != nil {
+		hint := "ip route add 224.0.0.0/4 dev <interface>"
+		if intf != nil {
+			hint = "ip route add 224.0.0.0/4 dev " + intf.Name
+		}
+		return fail(name, hint, "no route for %s, a listener without --interface can't join it", group.IP)
+	}
+	ones, _ := route.Mask.Size()
+	if intf != nil && route.Iface != intf.Name {
+		return warn(name, fmt.Sprintf("ip route add %s/32 dev %s, or always pass --interface %s", group.IP, intf.Name, intf.Name),
+			"%s is routed via %s (%s/%d) instead of %s", group.IP, route.Iface, route.Destination, ones, intf.Name)
+	}
+	return pass(name, "%s is routed via %s (%s/%d)", group.IP, route.Iface, route.Destination, ones)
+}
+
+func checkBuffers() []check {
+	var checks []check
+
+	if v, err := sysinfo.ReadSysctlInt("net.core.rmem_max"); err != nil {
+		checks = append(checks, warn("rmem_max", "", "%v", err))
+	} else if v < recommendedReceiveBuffer {
+		checks = append(checks, warn("rmem_max", fmt.Sprintf("sysctl -w net.core.rmem_max=%d", recommendedReceiveBuffer),
+			"net.core.rmem_max is %s, --receive-buffer-size is capped to it", util.ByteCountIEC(uint64(v))))
+	} else {
+		checks = append(checks, pass("rmem_max", "net.core.rmem_max is %s", util.ByteCountIEC(uint64(v))))
+	}
+
+	if v, err := sysinfo.ReadSysctlInt("net.core.rmem_default"); err == nil {
+		checks = append(checks, pass("rmem_default", "net.core.rmem_default is %s (used without --receive-buffer-size)", util.ByteCountIEC(uint64(v))))
+	}
+
+	if v, err := sysinfo.ReadSysctlInt("net.core.netdev_max_backlog"); err == nil {
+		if v < recommendedNetdevBacklog {
+			checks = append(checks, warn("netdev_max_backlog", fmt.Sprintf("sysctl -w net.core.netdev_max_backlog=%d", recommendedNetdevBacklog),
+				"net.core.netdev_max_backlog is %d, bursts may be dropped before reaching the socket", v))
+		} else {
+			checks = append(checks, pass("netdev_max_backlog", "net.core.netdev_max_backlog is %d", v))
+		}
+	}
+	return checks
+}
+
+func checkUDPErrors() check {
+	const name = "udp errors"
+	counters, err := sysinfo.SNMPCounters("Udp")
+	if err != nil {
+		return warn(name, "", "%v", err)
+	}
+	rcvbuf := counters["RcvbufErrors"]
+	inErrors := counters["InErrors"]
+	if rcvbuf > 0 {
+		return warn(name, "increase --receive-buffer-size and net.core.rmem_max",
+			"%d datagrams dropped since boot because of full socket buffers (InErrors %d)", rcvbuf, inErrors)
+	}
+	return pass(name, "no socket buffer drops since boot (InErrors %d)", inErrors)
+}
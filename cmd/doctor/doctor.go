@@ -0,0 +1,100 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"runtime"
+	"strings"
+)
+
+var (
+	doctorAddress   string
+	doctorInterface string
+
+	DoctorCmd = &cobra.Command{
+		Use:   "doctor",
+		Short: "Inspect the host network configuration for multicast reception issues",
+		Long: `Runs a set of checks on the Linux host (sysctls, IGMP memberships, routes, interface
+flags and MTU, socket buffer limits) and prints pass/warn/fail results with remediation hints.`,
+		RunE: doctor,
+	}
+)
+
+type status int
+
+const (
+	statusPass status = iota
+	statusWarn
+	statusFail
+)
+
+func (s status) String() string {
+	switch s {
+	case statusPass:
+		return "PASS"
+	case statusWarn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+// check is the result of a single diagnostic
+type check struct {
+	status status
+	name   string
+	detail string
+	hint   string
+}
+
+func pass(name, format string, a ...any) check {
+	return check{status: statusPass, name: name, detail: fmt.Sprintf(format, a...)}
+}
+
+func warn(name, hint, format string, a ...any) check {
+	return check{status: statusWarn, name: name, detail: fmt.Sprintf(format, a...), hint: hint}
+}
+
+func fail(name, hint, format string, a ...any) check {
+	return check{status: statusFail, name: name, detail: fmt.Sprintf(format, a...), hint: hint}
+}
+
+func doctor(*cobra.Command, []string) error {
+	if runtime.GOOS != "linux" {
+		return errors.New("doctor is only supported on Linux")
+	}
+
+	checks, err := runChecks(doctorInterface, doctorAddress)
+	if err != nil {
+		return err
+	}
+
+	var failed, warned int
+	for _, c := range checks {
+		fmt.Printf("[%s] %-22s %s\n", c.status, c.name, c.detail)
+		if c.hint != "" {
+			fmt.Printf("       %-22s hint: %s\n", "", c.hint)
+		}
+		switch c.status {
+		case statusWarn:
+			warned++
+		case statusFail:
+			failed++
+		}
+	}
+	fmt.Println(strings.Repeat("-", 80))
+	fmt.Printf("%d checks, %d warnings, %d failures\n", len(checks), warned, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+func init() {
+	DoctorCmd.PersistentFlags().StringVarP(&doctorAddress, "address", "a", "", "The multicast address and port to check (optional)")
+	DoctorCmd.PersistentFlags().StringVarP(&doctorInterface, "interface", "i", "", "The multicast listener interface name or IP address to check (optional)")
+	_ = viper.BindPFlag("address", DoctorCmd.PersistentFlags().Lookup("address"))
+	_ = viper.BindPFlag("interface", DoctorCmd.PersistentFlags().Lookup("interface"))
+}
@@ -0,0 +1,232 @@
+package eurex
+
+import (
+	"errors"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/book"
+	"github.com/coalescent-labs/mcastmkt/pkg/fast"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	bookTotalNumBytes   uint64 = 0
+	bookNumBytes        uint64 = 0
+	bookNumPackets      uint64 = 0
+	bookTotalNumPackets uint64 = 0
+	bookNumUpdates      uint64 = 0
+	bookNumErrors       uint64 = 0
+
+	bookAddress           string
+	bookSnapshotAddress   string
+	bookInterface         string
+	bookReceiveBufferSize int
+	bookTemplatesFile     string
+	bookSecurityID        int64
+	bookLevels            int
+	bookPriceDecimals     int
+	bookRefreshInterval   int
+	bookExportFile        string
+	bookStatsInterval     uint64 = 30
+
+	// bookMu serializes the incremental and snapshot streams on the synchronizer
+	bookMu sync.Mutex
+
+	bookCmd = &cobra.Command{
+		Use:   "book",
+		Short: "Build the Eurex EMDI depth books and print the book of an instrument live",
+		Long: `Decodes the EMDI incremental (--address) and snapshot (--snapshot-address) streams with the FAST templates
+(--templates) and maintains a depth book per SecurityID from the DepthIncremental and DepthSnapshot messages.
+The incrementals of a stale book are buffered until a snapshot, then the ones after its LastMsgSeqNumProcessed
+are replayed. A gap in the MsgSeqNum of a product makes its books stale until their next snapshot.
+The top --levels of the --security-id book are printed when it changes, at most every --refresh milliseconds,
+and all the books are exported as JSON (--export) at each statistics interval.`,
+		RunE: runBook,
+	}
+)
+
+func bookStatsPrinter(emdi *book.EmdiSync, listeners []*mcast.Listener) {
+	for range time.Tick(time.Second * time.Duration(bookStatsInterval)) {
+		recvMsg := atomic.SwapUint64(&bookNumPackets, 0)
+		recvTotalMsg := atomic.SwapUint64(&bookTotalNumPackets, 0)
+		recvBytes := atomic.SwapUint64(&bookNumBytes, 0)
+		recvTotalBytes := atomic.SwapUint64(&bookTotalNumBytes, 0)
+		updates := atomic.SwapUint64(&bookNumUpdates, 0)
+		recvErrors := atomic.SwapUint64(&bookNumErrors, 0)
+		var sockStats mcast.Stats
+		for _, l := range listeners {
+			s := l.SwapStats()
+			sockStats.KernelDrops += s.KernelDrops
+			sockStats.RingFull += s.RingFull
+		}
+		bookMu.Lock()
+		syncStats := emdi.SwapStats()
+		bookMu.Unlock()
+		numBooks, stale := emdi.Books.Len()
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], Books: %d [Stale: %d, Synced: %d, Skipped snapshots: %d], Updates: %d, Gaps: %d, Kernel drops: %d, Decoding errors: %d, Ring full: %d\n",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			numBooks, stale, syncStats.Synced, syncStats.Skipped, updates, syncStats.Gaps,
+			sockStats.KernelDrops, recvErrors, sockStats.RingFull)
+
+		if bookExportFile != "" {
+			if err := emdi.Books.Export(bookExportFile); err != nil {
+				log.Printf("Books export failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// bookPrinter prints the book of the instrument when it changed or became stale
+func bookPrinter(books *book.Books, id int64) {
+	name := ""
+	if listenCatalog != nil {
+		name = listenCatalog.Describe(id)
+	}
+	var changes uint64
+	var stale bool
+	for range time.Tick(time.Millisecond * time.Duration(bookRefreshInterval)) {
+		books.View(uint64(id), func(b *book.Book) {
+			if b == nil || (b.Changes == changes && b.Stale == stale) {
+				return
+			}
+			changes, stale = b.Changes, b.Stale
+			if name != "" {
+				fmt.Println(name)
+			}
+			fmt.Print(b.Render(bookLevels))
+		})
+	}
+}
+
+func runBook(*cobra.Command, []string) error {
+	if bookTemplatesFile == "" {
+		return errors.New("the Eurex EMDI FAST templates file is required (--templates)")
+	}
+	templates, err := fast.LoadTemplatesFile(bookTemplatesFile)
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d FAST templates from %s\n", templates.Len(), bookTemplatesFile)
+
+	if err := loadInstruments(); err != nil {
+		return err
+	}
+
+	var intf *net.Interface = nil
+
+	if bookInterface != "" {
+		intf, err = util.GetInterfaceFromIPorName(bookInterface)
+		if err != nil {
+			return err
+		}
+	}
+
+	addresses := []string{bookAddress}
+	if bookSnapshotAddress != "" {
+		addresses = append(addresses, bookSnapshotAddress)
+	}
+
+	emdi := book.NewEmdiSync(-bookPriceDecimals)
+	listeners := make([]*mcast.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		l, err := mcast.Listen(address, intf, mcast.Options{
+			ReceiveBufferSize: bookReceiveBufferSize,
+			BatchSize:         mcast.DefaultBatchSize,
+			RingSize:          mcast.DefaultRingSize,
+			PinCPU:            -1,
+		})
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		listeners = append(listeners, l)
+		log.Printf("Listening to %s@%s  %v\n", address, util.StringIfEmpty(bookInterface, "default"), intf)
+	}
+
+	go bookStatsPrinter(emdi, listeners)
+	if bookSecurityID != 0 {
+		go bookPrinter(emdi.Books, bookSecurityID)
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l *mcast.Listener) {
+			errs <- readBook(l, fast.NewDecoder(templates), emdi)
+		}(l)
+	}
+	return fmt.Errorf("ReadFromUDP failed: %w", <-errs)
+}
+
+// readBook applies the depth messages of one EMDI stream to the books
+func readBook(l *mcast.Listener, decoder *fast.Decoder, emdi *book.EmdiSync) error {
+	group := l.Group()
+
+	return l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
+		atomic.AddUint64(&bookTotalNumPackets, 1)
+		atomic.AddUint64(&bookTotalNumBytes, uint64(numBytes))
+
+		if !p.Dst.IsMulticast() || !p.Dst.Equal(group.IP) {
+			// unknown group, discard
+			return
+		}
+
+		atomic.AddUint64(&bookNumPackets, 1)
+		atomic.AddUint64(&bookNumBytes, uint64(numBytes))
+		if numBytes <= 9 {
+			log.Printf("Packet too short from %v: %d bytes\n", p.Src, numBytes)
+			return
+		}
+		senderCompId := buffer[3]
+
+		// the dictionaries are reset at the beginning of each packet
+		decoder.Reset()
+		msgs, err := decoder.DecodeAll(buffer)
+		if err != nil {
+			atomic.AddUint64(&bookNumErrors, 1)
+			log.Printf("FAST decoding failed on %v: %v\n", group, err)
+		}
+
+		bookMu.Lock()
+		defer bookMu.Unlock()
+		for _, m := range msgs {
+			atomic.AddUint64(&bookNumUpdates, uint64(emdi.Apply(m, uint64(senderCompId))))
+		}
+	})
+}
+
+func init() {
+	bookCmd.Flags().StringVarP(&bookAddress, "address", "a", "224.0.50.59:59001", "The incremental multicast address and port")
+	bookCmd.Flags().StringVar(&bookSnapshotAddress, "snapshot-address", "", "The snapshot multicast address and port")
+	bookCmd.Flags().StringVarP(&bookInterface, "interface", "i", "", "The multicast listener interface name or IP address")
+	bookCmd.Flags().IntVarP(&bookReceiveBufferSize, "receive-buffer-size", "r", 0, "Socket receive buffer size in bytes (0 use system default)")
+	bookCmd.Flags().StringVarP(&bookTemplatesFile, "templates", "t", "", "Eurex EMDI FAST templates XML file")
+	bookCmd.Flags().Int64VarP(&bookSecurityID, "security-id", "n", 0, "SecurityID of the instrument whose book is printed (0 print none)")
+	bookCmd.Flags().IntVarP(&bookLevels, "levels", "l", 10, "Number of price levels printed per side")
+	bookCmd.Flags().IntVar(&bookPriceDecimals, "price-decimals", 4, "Number of decimals of the prices")
+	bookCmd.Flags().IntVar(&bookRefreshInterval, "refresh", 1000, "Minimum interval between two prints of the book in milliseconds")
+	bookCmd.Flags().StringVarP(&bookExportFile, "export", "e", "", "Export all the books as JSON to the file at each statistics interval")
+	bookCmd.Flags().StringVar(&listenInstrumentsFile, "instruments", "", "Instruments catalog (JSON) exported by the rdi listener, to print the instrument name")
+	bookCmd.Flags().Uint64VarP(&bookStatsInterval, "stats-interval", "s", 30, "Statistics print interval in seconds")
+	_ = bookCmd.MarkFlagRequired("address")
+	_ = viper.BindPFlag("book-address", bookCmd.Flags().Lookup("address"))
+	_ = viper.BindPFlag("book-snapshot-address", bookCmd.Flags().Lookup("snapshot-address"))
+	_ = viper.BindPFlag("book-interface", bookCmd.Flags().Lookup("interface"))
+	_ = viper.BindPFlag("book-receive-buffer-size", bookCmd.Flags().Lookup("receive-buffer-size"))
+	_ = viper.BindPFlag("book-templates", bookCmd.Flags().Lookup("templates"))
+	_ = viper.BindPFlag("security-id", bookCmd.Flags().Lookup("security-id"))
+	_ = viper.BindPFlag("levels", bookCmd.Flags().Lookup("levels"))
+	_ = viper.BindPFlag("price-decimals", bookCmd.Flags().Lookup("price-decimals"))
+	_ = viper.BindPFlag("refresh", bookCmd.Flags().Lookup("refresh"))
+	_ = viper.BindPFlag("book-export", bookCmd.Flags().Lookup("export"))
+	_ = viper.BindPFlag("book-instruments", bookCmd.Flags().Lookup("instruments"))
+	_ = viper.BindPFlag("book-stats-interval", bookCmd.Flags().Lookup("stats-interval"))
+}
@@ -15,5 +15,6 @@ var (
 func init() {
 	// Add subcommands here
 	EurexCmd.AddCommand(listenCmd)
+	EurexCmd.AddCommand(bookCmd)
 
 }
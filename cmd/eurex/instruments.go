@@ -0,0 +1,77 @@
+package eurex
+
+import (
+	"github.com/coalescent-labs/mcastmkt/pkg/eobi"
+	"github.com/coalescent-labs/mcastmkt/pkg/fast"
+	"github.com/coalescent-labs/mcastmkt/pkg/refdata"
+	"log"
+)
+
+// listenCatalog resolves the SecurityIDs of the dumps when --instruments is given
+var listenCatalog *refdata.Catalog
+
+// loadInstruments loads the instruments catalog exported by the rdi listener
+func loadInstruments() error {
+	if listenInstrumentsFile == "" {
+		return nil
+	}
+	c, err := refdata.LoadFile(listenInstrumentsFile)
+	if err != nil {
+		return err
+	}
+	products, instruments := c.Len()
+	log.Printf("Loaded %d products and %d instruments from %s\n", products, instruments, listenInstrumentsFile)
+	listenCatalog = c
+	return nil
+}
+
+// annotateFast adds the instrument name after each known SecurityID of a FAST message
+func annotateFast(m *fast.Message) {
+	if listenCatalog == nil {
+		return
+	}
+	m.Fields = annotateGroup(m.Fields)
+}
+
+func annotateGroup(g fast.Group) fast.Group {
+	out := make(fast.Group, 0, len(g)+1)
+	for _, v := range g {
+		switch val := v.Value.(type) {
+		case fast.Group:
+			v.Value = annotateGroup(val)
+		case []fast.Group:
+			for i := range val {
+				val[i] = annotateGroup(val[i])
+			}
+		case *fast.Message:
+			annotateFast(val)
+		}
+		out = append(out, v)
+		if v.Name == "SecurityID" {
+			if id, ok := g.Int("SecurityID"); ok {
+				if name := listenCatalog.Describe(id); name != "" {
+					out = append(out, fast.Value{Name: "Instrument", Value: name})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// annotateEobi adds the instrument name after the SecurityID of an EOBI message
+func annotateEobi(m *eobi.Message) {
+	if listenCatalog == nil {
+		return
+	}
+	for i, f := range m.Fields {
+		if f.Name != "SecurityID" {
+			continue
+		}
+		if id, ok := f.Value.(int64); ok {
+			if name := listenCatalog.Describe(id); name != "" {
+				m.Fields = append(m.Fields[:i+1], append([]eobi.Field{{Name: "Instrument", Value: name}}, m.Fields[i+1:]...)...)
+			}
+		}
+		return
+	}
+}
@@ -2,10 +2,13 @@ package eurex
 
 import (
 	"encoding/binary"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/fast"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
 	"github.com/coalescent-labs/mcastmkt/pkg/util"
-	"github.com/hashicorp/golang-lru"
 	"github.com/spf13/cobra"
-	"golang.org/x/net/ipv4"
+	"github.com/spf13/viper"
 	"log"
 	"net"
 	"strings"
@@ -13,10 +16,6 @@ import (
 	"time"
 )
 
-const (
-	listenMaxDatagramSize = 1024 * 8
-)
-
 var (
 	emdiTotalNumBytes   uint64 = 0
 	emdiNumBytes        uint64 = 0
@@ -25,17 +24,21 @@ var (
 	emdiNumPacketsOoO   uint64 = 0
 	emdiNumPacketsMessy uint64 = 0
 	lastSeqNum          uint32 = 0
+	emdiTemplatesFile   string
+
+	emdiDecoder *fast.Decoder
 
 	listenEmdiCmd = &cobra.Command{
 		Use:   "emdi",
 		Short: "Listen Eurex EMDI multicast stream and dump out of sequence messages",
 		Long: `Detecting duplicates and gaps by packet header.
-Packets with the same SenderCompID (field length: 1 Byte) have contiguous sequence numbers per multicast address / port combination.`,
+Packets with the same SenderCompID (field length: 1 Byte) have contiguous sequence numbers per multicast address / port combination.
+With the Eurex EMDI FAST templates file (--templates) the dump mode prints the decoded messages instead of the raw bytes.`,
 		RunE: listenEmdi,
 	}
 )
 
-func statsPrinter() {
+func statsPrinter(l *mcast.Listener) {
 	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
 		recvMsg := atomic.SwapUint64(&emdiNumPackets, 0)
 		recvTotalMsg := atomic.SwapUint64(&emdiTotalNumPackets, 0)
@@ -43,9 +46,10 @@ func statsPrinter() {
 		recvTotalBytes := atomic.SwapUint64(&emdiTotalNumBytes, 0)
 		recvOoO := atomic.SwapUint64(&emdiNumPacketsOoO, 0)
 		recvMessy := atomic.SwapUint64(&emdiNumPacketsMessy, 0)
-		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], Last seqNo: %d, OoO: %d, Messy: %d\n",
+		sockStats := l.SwapStats()
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], Last seqNo: %d, OoO: %d, Kernel drops: %d, Messy: %d, Ring full: %d, Syscalls/pkt: %.3f\n",
 			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
-			lastSeqNum, recvOoO, recvMessy)
+			lastSeqNum, recvOoO, sockStats.KernelDrops, recvMessy, sockStats.RingFull, sockStats.SyscallsPerPacket())
 	}
 }
 
@@ -65,53 +69,51 @@ func listenEmdi(*cobra.Command, []string) error {
 		}
 	}
 
-	conn, err := net.ListenPacket("udp4", listenAddress)
+	l, err := mcast.Listen(listenAddress, intf, mcast.Options{
+		ReceiveBufferSize: listenReceiveBufferSize,
+		BatchSize:         listenBatchSize,
+		RingSize:          listenRingSize,
+		PinCPU:            listenPinCPU,
+	})
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer l.Close()
 
-	if listenReceiveBufferSize > 0 {
-		if err := util.SetReceiveBuffer(conn, listenReceiveBufferSize); err != nil {
+	if emdiTemplatesFile != "" {
+		templates, err := fast.LoadTemplatesFile(emdiTemplatesFile)
+		if err != nil {
 			return err
 		}
+		log.Printf("Loaded %d FAST templates from %s\n", templates.Len(), emdiTemplatesFile)
+		emdiDecoder = fast.NewDecoder(templates)
 	}
 
-	packetConn := ipv4.NewPacketConn(conn)
-	if err := packetConn.JoinGroup(intf, addr); err != nil {
+	if err := loadInstruments(); err != nil {
 		return err
 	}
-	defer packetConn.LeaveGroup(intf, addr)
 
-	err = packetConn.SetControlMessage(ipv4.FlagTTL|ipv4.FlagSrc|ipv4.FlagDst|ipv4.FlagInterface, true)
-	if err != nil {
-		return err
-	}
-	buffer := make([]byte, listenMaxDatagramSize)
+	// sliding windows per stream for sequence numbers duplicates and gaps check
+	tracker := sequence.NewTracker(listenSequenceWindow)
 
-	// lru cache for sequence numbers duplicates check
-	cache, _ := lru.New(2048)
-
-	go statsPrinter()
+	go statsPrinter(l)
 
 	log.Printf("Listening to %s@%s  %v\n", listenAddress, util.StringIfEmpty(listenInterface, "default"), intf)
 
 	lastSeqNum = 0
 	// Loop forever reading from the socket
-	for {
-		numBytes, cm, srcAddr, err := packetConn.ReadFrom(buffer)
-		if err != nil {
-			log.Fatal("ReadFromUDP failed:", err)
-		}
+	err = l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
 		atomic.AddUint64(&emdiTotalNumPackets, 1)
 		atomic.AddUint64(&emdiTotalNumBytes, uint64(numBytes))
 
-		if !cm.Dst.IsMulticast() {
-			continue
+		if !p.Dst.IsMulticast() {
+			return
 		}
-		if !cm.Dst.Equal(addr.IP) {
+		if !p.Dst.Equal(addr.IP) {
 			// unknown group, discard
-			continue
+			return
 		}
 
 		atomic.AddUint64(&emdiNumPackets, 1)
@@ -124,33 +126,57 @@ func listenEmdi(*cobra.Command, []string) error {
 			length := buffer[4]
 			seqNum := binary.BigEndian.Uint32(buffer[5:9])
 
-			_, ok := cache.Get(seqNum)
-			if ok {
+			result, missing := tracker.Add(uint64(senderCompId), uint64(seqNum))
+			if result == sequence.Duplicate {
 				log.Printf("Duplicate message: %d\n", seqNum)
-				continue
+				return
 			}
-			cache.Add(seqNum, true)
 
 			if listenDumpBytes {
 				log.Printf(strings.Repeat("-", 80))
-				log.Printf("addr: %v, numBytes: %d, partitionId: %d, senderCompId: %d, length: %d, lastSeqNum: %d, seqNum: %d\n", srcAddr, numBytes, partitionId, senderCompId, length, lastSeqNum, seqNum)
-				util.DumpByteSlice(buffer[:numBytes])
+				log.Printf("addr: %v, numBytes: %d, partitionId: %d, senderCompId: %d, length: %d, lastSeqNum: %d, seqNum: %d\n", p.Src, numBytes, partitionId, senderCompId, length, lastSeqNum, seqNum)
+				dumpEmdi(buffer)
 			}
 
-			if lastSeqNum != 0 && seqNum > lastSeqNum && seqNum != lastSeqNum+1 {
-				ooo := uint64(seqNum - lastSeqNum - 1)
-				atomic.AddUint64(&emdiNumPacketsOoO, ooo)
-				log.Printf("Out of sequence message: %d -> %d [%d]\n", lastSeqNum, seqNum, ooo)
-			}
-			if lastSeqNum != 0 && seqNum < lastSeqNum {
+			switch result {
+			case sequence.Gap:
+				atomic.AddUint64(&emdiNumPacketsOoO, missing)
+				log.Printf("Out of sequence message: %d -> %d [%d]\n", seqNum-uint32(missing)-1, seqNum, missing)
+			case sequence.Late, sequence.TooOld:
 				atomic.AddUint64(&emdiNumPacketsMessy, 1)
 				log.Printf("Messy message: %d\n", seqNum)
 			}
-			if seqNum > lastSeqNum {
+			if result != sequence.Late && result != sequence.TooOld {
 				lastSeqNum = seqNum
 			}
 		} else {
 			log.Fatalf("ReadFromUDP failed wrong num bytes: %d", numBytes)
 		}
+	})
+	return fmt.Errorf("ReadFromUDP failed: %w", err)
+}
+
+// dumpEmdi prints the FAST decoded messages of the packet, or its raw bytes
+// when no templates are loaded or the packet can't be decoded
+func dumpEmdi(buffer []byte) {
+	if emdiDecoder == nil {
+		util.DumpByteSlice(buffer)
+		return
+	}
+	// the dictionaries are reset at the beginning of each packet
+	emdiDecoder.Reset()
+	msgs, err := emdiDecoder.DecodeAll(buffer)
+	for _, m := range msgs {
+		annotateFast(m)
+		fmt.Print(m.String())
 	}
+	if err != nil {
+		log.Printf("FAST decoding failed: %v\n", err)
+		util.DumpByteSlice(buffer)
+	}
+}
+
+func init() {
+	listenEmdiCmd.Flags().StringVarP(&emdiTemplatesFile, "templates", "t", "", "Eurex EMDI FAST templates XML file used to decode the messages in dump mode")
+	_ = viper.BindPFlag("templates", listenEmdiCmd.Flags().Lookup("templates"))
 }
@@ -0,0 +1,213 @@
+package eurex
+
+import (
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/eobi"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/spf13/cobra"
+	"hash/maphash"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	eobiTotalNumBytes   uint64 = 0
+	eobiNumBytes        uint64 = 0
+	eobiNumPackets      uint64 = 0
+	eobiTotalNumPackets uint64 = 0
+	eobiNumMessages     uint64 = 0
+	eobiNumPacketsOoO   uint64 = 0
+	eobiNumPacketsMessy uint64 = 0
+	eobiNumResets       uint64 = 0
+	eobiNumSegments     uint64 = 0
+	eobiLastApplSeqNum  uint32 = 0
+
+	listenEobiCmd = &cobra.Command{
+		Use:   "eobi",
+		Short: "Listen Eurex EOBI multicast stream and dump out of sequence messages",
+		Long: `Detecting duplicates and gaps by the ApplSeqNum of the packet header.
+ApplSeqNum is contiguous per MarketSegmentID, the packets of an event spanning more datagrams share
+the same ApplSeqNum until the CompletionIndicator is set, their duplicates are told apart by content.
+In dump mode the EOBI messages are decoded.`,
+		RunE: listenEobi,
+	}
+)
+
+// eobiSegment is the state of the last packet received for a market segment
+type eobiSegment struct {
+	applSeqNum uint32
+	complete   bool
+	// packets are the hashes of the packets of the incomplete event, telling
+	// apart the next packets from the duplicates of the ones already received
+	packets []uint64
+}
+
+// seen records the hash of a packet of the current event and returns true
+// when it was already received
+func (s *eobiSegment) seen(hash uint64) bool {
+	for _, h := range s.packets {
+		if h == hash {
+			return true
+		}
+	}
+	s.packets = append(s.packets, hash)
+	return false
+}
+
+func eobiStatsPrinter(l *mcast.Listener) {
+	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
+		recvMsg := atomic.SwapUint64(&eobiNumPackets, 0)
+		recvTotalMsg := atomic.SwapUint64(&eobiTotalNumPackets, 0)
+		recvBytes := atomic.SwapUint64(&eobiNumBytes, 0)
+		recvTotalBytes := atomic.SwapUint64(&eobiTotalNumBytes, 0)
+		recvMessages := atomic.SwapUint64(&eobiNumMessages, 0)
+		recvOoO := atomic.SwapUint64(&eobiNumPacketsOoO, 0)
+		recvMessy := atomic.SwapUint64(&eobiNumPacketsMessy, 0)
+		recvResets := atomic.SwapUint64(&eobiNumResets, 0)
+		sockStats := l.SwapStats()
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], EOBI messages: %d, Segments: %d, Last applSeqNo: %d, OoO: %d, Kernel drops: %d, Messy: %d, Resets: %d, Ring full: %d, Syscalls/pkt: %.3f\n",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			recvMessages, atomic.LoadUint64(&eobiNumSegments), atomic.LoadUint32(&eobiLastApplSeqNum), recvOoO, sockStats.KernelDrops, recvMessy,
+			recvResets, sockStats.RingFull, sockStats.SyscallsPerPacket())
+	}
+}
+
+func listenEobi(*cobra.Command, []string) error {
+	// Parse the string address
+	addr, err := net.ResolveUDPAddr("udp4", listenAddress)
+	if err != nil {
+		return err
+	}
+
+	var intf *net.Interface = nil
+
+	if listenInterface != "" {
+		intf, err = util.GetInterfaceFromIPorName(listenInterface)
+		if err != nil {
+			return err
+		}
+	}
+
+	l, err := mcast.Listen(listenAddress, intf, mcast.Options{
+		ReceiveBufferSize: listenReceiveBufferSize,
+		BatchSize:         listenBatchSize,
+		RingSize:          listenRingSize,
+		PinCPU:            listenPinCPU,
+	})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	if err := loadInstruments(); err != nil {
+		return err
+	}
+
+	// sliding windows per market segment for ApplSeqNum duplicates and gaps check
+	tracker := sequence.NewTracker(listenSequenceWindow)
+	segments := make(map[int32]*eobiSegment)
+	seed := maphash.MakeSeed()
+
+	go eobiStatsPrinter(l)
+
+	log.Printf("Listening to %s@%s  %v\n", listenAddress, util.StringIfEmpty(listenInterface, "default"), intf)
+
+	// Loop forever reading from the socket
+	err = l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
+		atomic.AddUint64(&eobiTotalNumPackets, 1)
+		atomic.AddUint64(&eobiTotalNumBytes, uint64(numBytes))
+
+		if !p.Dst.IsMulticast() {
+			return
+		}
+		if !p.Dst.Equal(addr.IP) {
+			// unknown group, discard
+			return
+		}
+
+		atomic.AddUint64(&eobiNumPackets, 1)
+		atomic.AddUint64(&eobiNumBytes, uint64(numBytes))
+
+		header, err := eobi.ParsePacketHeader(buffer)
+		if err != nil {
+			log.Printf("Invalid packet from %v: %v\n", p.Src, err)
+			return
+		}
+
+		segment, ok := segments[header.MarketSegmentID]
+		if !ok {
+			segment = &eobiSegment{}
+			segments[header.MarketSegmentID] = segment
+			atomic.AddUint64(&eobiNumSegments, 1)
+		}
+		window := tracker.Window(uint64(uint32(header.MarketSegmentID)))
+		if header.Reset() {
+			atomic.AddUint64(&eobiNumResets, 1)
+			log.Printf("ApplSeqNum reset on market segment %d at %d\n", header.MarketSegmentID, header.ApplSeqNum)
+			window.Reset()
+		}
+
+		// the next packets of an incomplete event share its ApplSeqNum
+		continuation := ok && !segment.complete && segment.applSeqNum == header.ApplSeqNum
+		result, missing := sequence.Next, uint64(0)
+		if continuation {
+			if segment.seen(maphash.Bytes(seed, buffer)) {
+				log.Printf("Duplicate message: segment %d, applSeqNum %d\n", header.MarketSegmentID, header.ApplSeqNum)
+				return
+			}
+		} else {
+			result, missing = window.Add(uint64(header.ApplSeqNum))
+			if result == sequence.Duplicate {
+				log.Printf("Duplicate message: segment %d, applSeqNum %d\n", header.MarketSegmentID, header.ApplSeqNum)
+				return
+			}
+		}
+
+		if result != sequence.Late && result != sequence.TooOld {
+			if !continuation {
+				segment.packets = segment.packets[:0]
+				segment.seen(maphash.Bytes(seed, buffer))
+			}
+			segment.applSeqNum = header.ApplSeqNum
+			segment.complete = header.Complete()
+			atomic.StoreUint32(&eobiLastApplSeqNum, header.ApplSeqNum)
+		}
+
+		msgs, decodeErr := eobi.DecodeMessages(buffer)
+		atomic.AddUint64(&eobiNumMessages, uint64(len(msgs)))
+
+		if listenDumpBytes {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("addr: %v, numBytes: %d, segment: %d, partition: %d, applSeqNum: %d, complete: %d, transactTime: %d\n",
+				p.Src, numBytes, header.MarketSegmentID, header.PartitionID, header.ApplSeqNum, header.CompletionIndicator, header.TransactTime)
+			for i := range msgs {
+				annotateEobi(&msgs[i])
+				fmt.Println(msgs[i].String())
+				if !msgs[i].Known() {
+					util.DumpByteSlice(msgs[i].Body)
+				}
+			}
+			if decodeErr != nil {
+				log.Printf("EOBI decoding failed: %v\n", decodeErr)
+				util.DumpByteSlice(buffer)
+			}
+		}
+
+		switch result {
+		case sequence.Gap:
+			atomic.AddUint64(&eobiNumPacketsOoO, missing)
+			log.Printf("Out of sequence message: segment %d, %d -> %d [%d]\n", header.MarketSegmentID, header.ApplSeqNum-uint32(missing)-1, header.ApplSeqNum, missing)
+		case sequence.Late, sequence.TooOld:
+			atomic.AddUint64(&eobiNumPacketsMessy, 1)
+			log.Printf("Messy message: segment %d, applSeqNum %d\n", header.MarketSegmentID, header.ApplSeqNum)
+		}
+	})
+	return fmt.Errorf("ReadFromUDP failed: %w", err)
+}
@@ -0,0 +1,192 @@
+package eurex
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/fast"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/refdata"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	rdiTotalNumBytes   uint64 = 0
+	rdiNumBytes        uint64 = 0
+	rdiNumPackets      uint64 = 0
+	rdiTotalNumPackets uint64 = 0
+	rdiNumPacketsOoO   uint64 = 0
+	rdiNumPacketsMessy uint64 = 0
+	rdiNumErrors       uint64 = 0
+
+	rdiTemplatesFile   string
+	rdiSnapshotAddress string
+	rdiExportFile      string
+
+	listenRdiCmd = &cobra.Command{
+		Use:   "rdi",
+		Short: "Listen Eurex RDI multicast streams and build the instruments catalog",
+		Long: `Consumes the Reference Data Interface incremental (--address) and optionally snapshot (--snapshot-address)
+streams, decodes them with the Eurex RDI FAST templates (--templates) and builds an in-memory catalog of the
+products by MarketSegmentID and of the instruments by SecurityID.
+The catalog is exported at each statistics interval as JSON or CSV (by the --export file extension); the JSON
+export can be given to the EMDI and EOBI listeners with --instruments to print symbols instead of numeric IDs.`,
+		RunE: listenRdi,
+	}
+)
+
+func rdiStatsPrinter(catalog *refdata.Catalog, listeners []*mcast.Listener) {
+	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
+		recvMsg := atomic.SwapUint64(&rdiNumPackets, 0)
+		recvTotalMsg := atomic.SwapUint64(&rdiTotalNumPackets, 0)
+		recvBytes := atomic.SwapUint64(&rdiNumBytes, 0)
+		recvTotalBytes := atomic.SwapUint64(&rdiTotalNumBytes, 0)
+		recvOoO := atomic.SwapUint64(&rdiNumPacketsOoO, 0)
+		recvMessy := atomic.SwapUint64(&rdiNumPacketsMessy, 0)
+		recvErrors := atomic.SwapUint64(&rdiNumErrors, 0)
+		var sockStats mcast.Stats
+		for _, l := range listeners {
+			s := l.SwapStats()
+			sockStats.KernelDrops += s.KernelDrops
+			sockStats.RingFull += s.RingFull
+		}
+		products, instruments := catalog.Len()
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], Products: %d, Instruments: %d, OoO: %d, Kernel drops: %d, Messy: %d, Decoding errors: %d, Ring full: %d\n",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			products, instruments, recvOoO, sockStats.KernelDrops, recvMessy, recvErrors, sockStats.RingFull)
+
+		if rdiExportFile != "" {
+			if err := catalog.Export(rdiExportFile); err != nil {
+				log.Printf("Catalog export failed: %v\n", err)
+			}
+		}
+	}
+}
+
+func listenRdi(*cobra.Command, []string) error {
+	if rdiTemplatesFile == "" {
+		return errors.New("the Eurex RDI FAST templates file is required (--templates)")
+	}
+	templates, err := fast.LoadTemplatesFile(rdiTemplatesFile)
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d FAST templates from %s\n", templates.Len(), rdiTemplatesFile)
+
+	var intf *net.Interface = nil
+
+	if listenInterface != "" {
+		intf, err = util.GetInterfaceFromIPorName(listenInterface)
+		if err != nil {
+			return err
+		}
+	}
+
+	addresses := []string{listenAddress}
+	if rdiSnapshotAddress != "" {
+		addresses = append(addresses, rdiSnapshotAddress)
+	}
+
+	catalog := refdata.NewCatalog()
+	listeners := make([]*mcast.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		l, err := mcast.Listen(address, intf, mcast.Options{
+			ReceiveBufferSize: listenReceiveBufferSize,
+			BatchSize:         listenBatchSize,
+			RingSize:          listenRingSize,
+			PinCPU:            -1,
+		})
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		listeners = append(listeners, l)
+		log.Printf("Listening to %s@%s  %v\n", address, util.StringIfEmpty(listenInterface, "default"), intf)
+	}
+
+	go rdiStatsPrinter(catalog, listeners)
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l *mcast.Listener) {
+			errs <- readRdi(l, fast.NewDecoder(templates), catalog)
+		}(l)
+	}
+	return fmt.Errorf("ReadFromUDP failed: %w", <-errs)
+}
+
+// readRdi decodes the packets of one RDI stream into the catalog
+func readRdi(l *mcast.Listener, decoder *fast.Decoder, catalog *refdata.Catalog) error {
+	group := l.Group()
+	// sliding windows per SenderCompID for sequence numbers duplicates and gaps check
+	tracker := sequence.NewTracker(listenSequenceWindow)
+
+	return l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
+		atomic.AddUint64(&rdiTotalNumPackets, 1)
+		atomic.AddUint64(&rdiTotalNumBytes, uint64(numBytes))
+
+		if !p.Dst.IsMulticast() || !p.Dst.Equal(group.IP) {
+			// unknown group, discard
+			return
+		}
+
+		atomic.AddUint64(&rdiNumPackets, 1)
+		atomic.AddUint64(&rdiNumBytes, uint64(numBytes))
+		if numBytes <= 9 {
+			log.Printf("Packet too short from %v: %d bytes\n", p.Src, numBytes)
+			return
+		}
+
+		// same packet header layout as EMDI
+		senderCompId := buffer[3]
+		seqNum := binary.BigEndian.Uint32(buffer[5:9])
+		result, missing := tracker.Add(uint64(senderCompId), uint64(seqNum))
+		switch result {
+		case sequence.Duplicate:
+			return
+		case sequence.Gap:
+			atomic.AddUint64(&rdiNumPacketsOoO, missing)
+			log.Printf("Out of sequence message on %v: %d -> %d [%d]\n", group, seqNum-uint32(missing)-1, seqNum, missing)
+		case sequence.Late, sequence.TooOld:
+			atomic.AddUint64(&rdiNumPacketsMessy, 1)
+		}
+
+		// the dictionaries are reset at the beginning of each packet
+		decoder.Reset()
+		msgs, err := decoder.DecodeAll(buffer)
+		if err != nil {
+			atomic.AddUint64(&rdiNumErrors, 1)
+			log.Printf("FAST decoding failed on %v: %v\n", group, err)
+		}
+		for _, m := range msgs {
+			catalog.ApplyFast(m)
+		}
+
+		if listenDumpBytes {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("addr: %v, group: %v, numBytes: %d, senderCompId: %d, seqNum: %d\n", p.Src, group, numBytes, senderCompId, seqNum)
+			for _, m := range msgs {
+				fmt.Print(m.String())
+			}
+		}
+	})
+}
+
+func init() {
+	listenRdiCmd.Flags().StringVarP(&rdiTemplatesFile, "templates", "t", "", "Eurex RDI FAST templates XML file")
+	listenRdiCmd.Flags().StringVar(&rdiSnapshotAddress, "snapshot-address", "", "The RDI snapshot multicast address and port")
+	listenRdiCmd.Flags().StringVarP(&rdiExportFile, "export", "e", "", "Export the catalog to the file (.json or .csv) at each statistics interval")
+	_ = viper.BindPFlag("rdi-templates", listenRdiCmd.Flags().Lookup("templates"))
+	_ = viper.BindPFlag("snapshot-address", listenRdiCmd.Flags().Lookup("snapshot-address"))
+	_ = viper.BindPFlag("export", listenRdiCmd.Flags().Lookup("export"))
+}
@@ -0,0 +1,250 @@
+package euronext
+
+import (
+	"errors"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/book"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/optiq"
+	"github.com/coalescent-labs/mcastmkt/pkg/sbe"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	bookTotalNumBytes   uint64 = 0
+	bookNumBytes        uint64 = 0
+	bookNumPackets      uint64 = 0
+	bookTotalNumPackets uint64 = 0
+	bookNumPacketsOoO   uint64 = 0
+	bookNumUpdates      uint64 = 0
+	bookNumErrors       uint64 = 0
+
+	bookAddress           string
+	bookSnapshotAddress   string
+	bookInterface         string
+	bookReceiveBufferSize int
+	bookSchemaFile        string
+	bookCompression       string
+	bookSymbolIndex       int64
+	bookLevels            int
+	bookPriceDecimals     int
+	bookRefreshInterval   int
+	bookExportFile        string
+	bookStatsInterval     uint64 = 30
+	bookSequenceWindow    int    = 65536
+	bookMaxBuffered       int    = book.DefaultMaxBuffered
+
+	bookCmd = &cobra.Command{
+		Use:   "book",
+		Short: "Build the Euronext Optiq MDG order books and print the book of an instrument live",
+		Long: `Decodes the Optiq MDG real-time (--address) and optionally snapshot (--snapshot-address) streams with the SBE
+schema (--schema) and applies the MarketUpdate (market by price) and OrderUpdate (market by order) messages to a
+book per SymbolIndex.
+Books start stale, and all become stale on a sequence gap: the real-time messages are then buffered until a
+complete snapshot cycle (or a start of day) rebuilds the books, and the buffered messages following the snapshot
+(by its LastMDSeqNum) are replayed. The top --levels of the --symbol-index book are printed when it changes, at most every --refresh
+milliseconds, and all the books are exported as JSON (--export) at each statistics interval.`,
+		RunE: runBook,
+	}
+)
+
+func bookStatsPrinter(recovery *book.OptiqRecovery, listeners []*mcast.Listener) {
+	for range time.Tick(time.Second * time.Duration(bookStatsInterval)) {
+		recvMsg := atomic.SwapUint64(&bookNumPackets, 0)
+		recvTotalMsg := atomic.SwapUint64(&bookTotalNumPackets, 0)
+		recvBytes := atomic.SwapUint64(&bookNumBytes, 0)
+		recvTotalBytes := atomic.SwapUint64(&bookTotalNumBytes, 0)
+		recvOoO := atomic.SwapUint64(&bookNumPacketsOoO, 0)
+		updates := atomic.SwapUint64(&bookNumUpdates, 0)
+		recvErrors := atomic.SwapUint64(&bookNumErrors, 0)
+		var sockStats mcast.Stats
+		for _, l := range listeners {
+			s := l.SwapStats()
+			sockStats.KernelDrops += s.KernelDrops
+			sockStats.RingFull += s.RingFull
+		}
+		numBooks, stale := recovery.Books.Len()
+		recoveryStats := recovery.Stats()
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], Books: %d [Stale: %d], Synced: %v [in %v, Buffered: %d], Updates: %d, OoO: %d, Kernel drops: %d, Decoding errors: %d, Ring full: %d\n",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			numBooks, stale, recoveryStats.Synced, recoveryStats.TimeToSync, recoveryStats.Buffered,
+			updates, recvOoO, sockStats.KernelDrops, recvErrors, sockStats.RingFull)
+
+		if bookExportFile != "" {
+			if err := recovery.Books.Export(bookExportFile); err != nil {
+				log.Printf("Books export failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// bookPrinter prints the book of the instrument when it changed or became stale
+func bookPrinter(books *book.Books, id uint64) {
+	var changes uint64
+	var stale bool
+	for range time.Tick(time.Millisecond * time.Duration(bookRefreshInterval)) {
+		books.View(id, func(b *book.Book) {
+			if b == nil || (b.Changes == changes && b.Stale == stale) {
+				return
+			}
+			changes, stale = b.Changes, b.Stale
+			fmt.Print(b.Render(bookLevels))
+		})
+	}
+}
+
+func runBook(*cobra.Command, []string) error {
+	if bookSchemaFile == "" {
+		return errors.New("the Optiq MDG SBE schema file is required (--schema)")
+	}
+	schema, err := sbe.LoadSchemaFile(bookSchemaFile)
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d SBE messages from %s\n", schema.Len(), bookSchemaFile)
+	fields, err := book.ResolveOptiqFields(schema)
+	if err != nil {
+		return err
+	}
+	if _, err := optiq.NewDecompressor(bookCompression); err != nil {
+		return err
+	}
+
+	var intf *net.Interface = nil
+
+	if bookInterface != "" {
+		intf, err = util.GetInterfaceFromIPorName(bookInterface)
+		if err != nil {
+			return err
+		}
+	}
+
+	addresses := []string{bookAddress}
+	if bookSnapshotAddress != "" {
+		addresses = append(addresses, bookSnapshotAddress)
+	}
+
+	recovery := book.NewOptiqRecovery(-bookPriceDecimals, bookMaxBuffered)
+	recovery.Books.SetOptiqFields(fields)
+	listeners := make([]*mcast.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		l, err := mcast.Listen(address, intf, mcast.Options{
+			ReceiveBufferSize: bookReceiveBufferSize,
+			BatchSize:         mcast.DefaultBatchSize,
+			RingSize:          mcast.DefaultRingSize,
+			PinCPU:            -1,
+		})
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		listeners = append(listeners, l)
+		log.Printf("Listening to %s@%s  %v\n", address, util.StringIfEmpty(bookInterface, "default"), intf)
+	}
+
+	go bookStatsPrinter(recovery, listeners)
+	if bookSymbolIndex >= 0 {
+		go bookPrinter(recovery.Books, uint64(bookSymbolIndex))
+	}
+
+	errs := make(chan error, len(listeners))
+	for i, l := range listeners {
+		decompressor, _ := optiq.NewDecompressor(bookCompression)
+		stream := &recoveryStream{recovery: recovery, schema: schema, snapshot: i > 0}
+		go func(l *mcast.Listener) {
+			errs <- readBook(l, decompressor, stream)
+		}(l)
+	}
+	return fmt.Errorf("ReadFromUDP failed: %w", <-errs)
+}
+
+// readBook feeds the messages of one MDG stream to the late join recovery
+// of the books
+func readBook(l *mcast.Listener, decompressor *optiq.Decompressor, stream *recoveryStream) error {
+	group := l.Group()
+	tracker := sequence.NewTracker(bookSequenceWindow)
+
+	return l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
+		atomic.AddUint64(&bookTotalNumPackets, 1)
+		atomic.AddUint64(&bookTotalNumBytes, uint64(numBytes))
+
+		if !p.Dst.IsMulticast() || !p.Dst.Equal(group.IP) {
+			// unknown group, discard
+			return
+		}
+
+		atomic.AddUint64(&bookNumPackets, 1)
+		atomic.AddUint64(&bookNumBytes, uint64(numBytes))
+		header, err := optiq.ParsePacketHeader(buffer)
+		if err != nil {
+			log.Printf("Packet too short from %v: %d bytes\n", p.Src, numBytes)
+			return
+		}
+
+		result, missing := tracker.Add(uint64(header.ChannelID), header.SeqNum)
+		switch result {
+		case sequence.Duplicate, sequence.Late, sequence.TooOld:
+			return
+		case sequence.Gap:
+			atomic.AddUint64(&bookNumPacketsOoO, missing)
+			log.Printf("Out of sequence message on %v: %d -> %d [%d]\n", group, header.SeqNum-missing-1, header.SeqNum, missing)
+			stream.gap()
+		}
+
+		body := buffer[optiq.PacketHeaderSize:]
+		if header.Compressed() {
+			body, err = decompressor.Decompress(body)
+			if err != nil {
+				atomic.AddUint64(&bookNumErrors, 1)
+				log.Printf("Packet %d on %v: %v\n", header.SeqNum, group, err)
+				stream.gap()
+				return
+			}
+		}
+
+		applied, errs := stream.apply(body)
+		atomic.AddUint64(&bookNumUpdates, uint64(applied))
+		atomic.AddUint64(&bookNumErrors, uint64(errs))
+	})
+}
+
+func init() {
+	bookCmd.Flags().StringVarP(&bookAddress, "address", "a", "224.0.50.59:59001", "The real-time multicast address and port")
+	bookCmd.Flags().StringVar(&bookSnapshotAddress, "snapshot-address", "", "The snapshot multicast address and port")
+	bookCmd.Flags().StringVarP(&bookInterface, "interface", "i", "", "The multicast listener interface name or IP address")
+	bookCmd.Flags().IntVarP(&bookReceiveBufferSize, "receive-buffer-size", "r", 0, "Socket receive buffer size in bytes (0 use system default)")
+	bookCmd.Flags().StringVarP(&bookSchemaFile, "schema", "x", "", "Euronext Optiq MDG SBE XML schema file")
+	bookCmd.Flags().StringVar(&bookCompression, "compression", optiq.CodecZlib, "Codec of the compressed packet bodies: zlib, flate or lz4")
+	bookCmd.Flags().Int64VarP(&bookSymbolIndex, "symbol-index", "n", -1, "SymbolIndex of the instrument whose book is printed (-1 print none)")
+	bookCmd.Flags().IntVarP(&bookLevels, "levels", "l", 10, "Number of price levels printed per side")
+	bookCmd.Flags().IntVar(&bookPriceDecimals, "price-decimals", 0, "Number of decimals of the prices")
+	bookCmd.Flags().IntVar(&bookRefreshInterval, "refresh", 1000, "Minimum interval between two prints of the book in milliseconds")
+	bookCmd.Flags().StringVarP(&bookExportFile, "export", "e", "", "Export all the books as JSON to the file at each statistics interval")
+	bookCmd.Flags().Uint64VarP(&bookStatsInterval, "stats-interval", "s", 30, "Statistics print interval in seconds")
+	bookCmd.Flags().IntVarP(&bookSequenceWindow, "sequence-window", "w", 65536, "Number of sequence numbers per stream remembered for duplicates and gaps detection")
+	bookCmd.Flags().IntVar(&bookMaxBuffered, "max-buffered", book.DefaultMaxBuffered, "Maximum number of real-time messages buffered while waiting for a snapshot cycle")
+	_ = bookCmd.MarkFlagRequired("address")
+	_ = viper.BindPFlag("book-address", bookCmd.Flags().Lookup("address"))
+	_ = viper.BindPFlag("book-snapshot-address", bookCmd.Flags().Lookup("snapshot-address"))
+	_ = viper.BindPFlag("book-interface", bookCmd.Flags().Lookup("interface"))
+	_ = viper.BindPFlag("book-receive-buffer-size", bookCmd.Flags().Lookup("receive-buffer-size"))
+	_ = viper.BindPFlag("book-schema", bookCmd.Flags().Lookup("schema"))
+	_ = viper.BindPFlag("book-compression", bookCmd.Flags().Lookup("compression"))
+	_ = viper.BindPFlag("symbol-index", bookCmd.Flags().Lookup("symbol-index"))
+	_ = viper.BindPFlag("levels", bookCmd.Flags().Lookup("levels"))
+	_ = viper.BindPFlag("price-decimals", bookCmd.Flags().Lookup("price-decimals"))
+	_ = viper.BindPFlag("refresh", bookCmd.Flags().Lookup("refresh"))
+	_ = viper.BindPFlag("book-export", bookCmd.Flags().Lookup("export"))
+	_ = viper.BindPFlag("book-stats-interval", bookCmd.Flags().Lookup("stats-interval"))
+	_ = viper.BindPFlag("book-sequence-window", bookCmd.Flags().Lookup("sequence-window"))
+	_ = viper.BindPFlag("max-buffered", bookCmd.Flags().Lookup("max-buffered"))
+}
@@ -15,5 +15,6 @@ var (
 func init() {
 	// Add subcommands here
 	EuronextCmd.AddCommand(listenCmd)
+	EuronextCmd.AddCommand(bookCmd)
 
 }
@@ -1,11 +1,17 @@
 package euronext
 
 import (
-	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/book"
+	"github.com/coalescent-labs/mcastmkt/pkg/latency"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/optiq"
+	"github.com/coalescent-labs/mcastmkt/pkg/sbe"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
 	"github.com/coalescent-labs/mcastmkt/pkg/util"
-	"github.com/hashicorp/golang-lru"
 	"github.com/spf13/cobra"
-	"golang.org/x/net/ipv4"
+	"github.com/spf13/viper"
 	"log"
 	"net"
 	"strings"
@@ -13,28 +19,50 @@ import (
 	"time"
 )
 
-const (
-	listenMaxDatagramSize = 1024 * 8
-)
-
 var (
-	mdgTotalNumBytes   uint64 = 0
-	mdgNumBytes        uint64 = 0
-	mdgNumPackets      uint64 = 0
-	mdgTotalNumPackets uint64 = 0
-	mdgNumPacketsOoO   uint64 = 0
-	mdgNumPacketsMessy uint64 = 0
-	lastSeqNum         uint32 = 0
+	mdgTotalNumBytes    uint64 = 0
+	mdgNumBytes         uint64 = 0
+	mdgNumPackets       uint64 = 0
+	mdgTotalNumPackets  uint64 = 0
+	mdgNumPacketsOoO    uint64 = 0
+	mdgNumPacketsMessy  uint64 = 0
+	mdgNumCompressed    uint64 = 0
+	mdgNumPlain         uint64 = 0
+	mdgCompressedBytes  uint64 = 0
+	mdgInflatedBytes    uint64 = 0
+	lastSeqNum          uint64 = 0
+	mdgSchemaFile       string
+	mdgSnapshotAddress  string
+	mdgCompression      string
+	mdgHeartbeatTimeout int
+	mdgLatencyOutlier   int
+
+	mdgSchema       *sbe.Schema
+	mdgDecompressor *optiq.Decompressor
+	mdgSession      *optiq.Session
+	mdgLatency      *latency.Recorder
+	mdgRecovery     *book.OptiqRecovery
+	mdgRealtime     *recoveryStream
 
 	listenMdgCmd = &cobra.Command{
 		Use:   "mdg",
 		Short: "Listen Euronext Optiq MDG multicast stream and dump out of sequence messages",
-		Long:  `Detecting duplicates and gaps by packet header.`,
-		RunE:  listenMdg,
+		Long: `Detecting duplicates and gaps by packet header.
+With the Optiq MDG SBE schema file (--schema) the dump mode prints the decoded messages instead of the raw bytes.
+Packet bodies flagged as compressed (packetFlags bit 0) are decompressed with the --compression codec (zlib, flate or lz4)
+before being dumped or decoded.
+Snapshot cycles (start/end, duration, packets), health status heartbeats and start/end of day events are tracked
+per channel; a missed heartbeat alert is logged when a channel is silent for longer than --heartbeat-timeout.
+The latency between the packet time and the receive timestamp is reported per channel (percentiles, drift of the
+minimum since the first interval and outliers slower than the minimum by more than --latency-outlier).
+With the snapshot multicast address (--snapshot-address) and the schema, the recovery mode joins the snapshot group
+too and synchronizes the books of a late joiner: the real-time messages are buffered until a complete snapshot
+cycle, then the ones following the snapshot are replayed and the time to synchronize is reported.`,
+		RunE: listenMdg,
 	}
 )
 
-func statsPrinter() {
+func statsPrinter(l *mcast.Listener) {
 	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
 		recvMsg := atomic.SwapUint64(&mdgNumPackets, 0)
 		recvTotalMsg := atomic.SwapUint64(&mdgTotalNumPackets, 0)
@@ -42,9 +70,40 @@ func statsPrinter() {
 		recvTotalBytes := atomic.SwapUint64(&mdgTotalNumBytes, 0)
 		recvOoO := atomic.SwapUint64(&mdgNumPacketsOoO, 0)
 		recvMessy := atomic.SwapUint64(&mdgNumPacketsMessy, 0)
-		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], Last seqNo: %d, OoO: %d, Messy: %d\n",
+		recvCompressed := atomic.SwapUint64(&mdgNumCompressed, 0)
+		recvPlain := atomic.SwapUint64(&mdgNumPlain, 0)
+		compressedBytes := atomic.SwapUint64(&mdgCompressedBytes, 0)
+		inflatedBytes := atomic.SwapUint64(&mdgInflatedBytes, 0)
+		ratio := 0.0
+		if compressedBytes > 0 {
+			ratio = float64(inflatedBytes) / float64(compressedBytes)
+		}
+		sockStats := l.SwapStats()
+		sessionStats := mdgSession.SwapStats()
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], Last seqNo: %d, OoO: %d, Kernel drops: %d, Messy: %d, Ring full: %d, Syscalls/pkt: %.3f, Compressed: %d, Uncompressed: %d, Compression ratio: %.2f, Snapshots: %d [Incomplete: %d, Last: %v/%d pkts], Heartbeats: %d [Missed: %d]\n",
 			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
-			lastSeqNum, recvOoO, recvMessy)
+			atomic.LoadUint64(&lastSeqNum), recvOoO, sockStats.KernelDrops, recvMessy, sockStats.RingFull, sockStats.SyscallsPerPacket(),
+			recvCompressed, recvPlain, ratio,
+			sessionStats.Cycles, sessionStats.IncompleteCycles, sessionStats.LastCycle.Duration(), sessionStats.LastCycle.Packets,
+			sessionStats.Heartbeats, sessionStats.MissedHeartbeats)
+		for _, s := range mdgLatency.SwapStats() {
+			log.Printf("LATENCY channel %d: %v\n", s.Stream, s)
+		}
+		if mdgRecovery != nil {
+			r := mdgRecovery.Stats()
+			numBooks, stale := mdgRecovery.Books.Len()
+			log.Printf("RECOVERY Synced: %v [in %v], Buffered: %d, Snapshot cycles: %d [Skipped: %d], Sync losses: %d, Books: %d [Stale: %d]\n",
+				r.Synced, r.TimeToSync, r.Buffered, r.Cycles, r.Skipped, r.Losses, numBooks, stale)
+		}
+	}
+}
+
+// heartbeatChecker logs the channels which stopped sending health status messages
+func heartbeatChecker() {
+	for now := range time.Tick(time.Second) {
+		for _, e := range mdgSession.CheckHeartbeats(now) {
+			log.Printf("ALERT %v\n", e)
+		}
 	}
 }
 
@@ -64,102 +123,239 @@ func listenMdg(*cobra.Command, []string) error {
 		}
 	}
 
-	conn, err := net.ListenPacket("udp4", listenAddress)
+	l, err := mcast.Listen(listenAddress, intf, mcast.Options{
+		ReceiveBufferSize: listenReceiveBufferSize,
+		BatchSize:         listenBatchSize,
+		RingSize:          listenRingSize,
+		PinCPU:            listenPinCPU,
+	})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	mdgDecompressor, err = optiq.NewDecompressor(mdgCompression)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
 
-	if listenReceiveBufferSize > 0 {
-		if err := util.SetReceiveBuffer(conn, listenReceiveBufferSize); err != nil {
+	if mdgSchemaFile != "" {
+		mdgSchema, err = sbe.LoadSchemaFile(mdgSchemaFile)
+		if err != nil {
 			return err
 		}
+		log.Printf("Loaded %d SBE messages from %s\n", mdgSchema.Len(), mdgSchemaFile)
 	}
 
-	packetConn := ipv4.NewPacketConn(conn)
-	if err := packetConn.JoinGroup(intf, addr); err != nil {
-		return err
-	}
-	defer packetConn.LeaveGroup(intf, addr)
+	if mdgSnapshotAddress != "" {
+		if mdgSchema == nil {
+			return errors.New("the recovery mode needs the Optiq MDG SBE schema file (--schema)")
+		}
+		fields, err := book.ResolveOptiqFields(mdgSchema)
+		if err != nil {
+			return err
+		}
+		sl, err := mcast.Listen(mdgSnapshotAddress, intf, mcast.Options{
+			ReceiveBufferSize: listenReceiveBufferSize,
+			BatchSize:         listenBatchSize,
+			RingSize:          listenRingSize,
+			PinCPU:            -1,
+		})
+		if err != nil {
+			return err
+		}
+		defer sl.Close()
+		log.Printf("Listening to snapshots %s@%s  %v\n", mdgSnapshotAddress, util.StringIfEmpty(listenInterface, "default"), intf)
 
-	err = packetConn.SetControlMessage(ipv4.FlagTTL|ipv4.FlagSrc|ipv4.FlagDst|ipv4.FlagInterface, true)
-	if err != nil {
-		return err
+		mdgRecovery = book.NewOptiqRecovery(0, book.DefaultMaxBuffered)
+		mdgRecovery.Books.SetOptiqFields(fields)
+		mdgRealtime = &recoveryStream{recovery: mdgRecovery, schema: mdgSchema}
+		go func() {
+			err := readMdgSnapshot(sl, &recoveryStream{recovery: mdgRecovery, schema: mdgSchema, snapshot: true})
+			log.Fatalf("ReadFromUDP failed on snapshots: %v", err)
+		}()
 	}
-	buffer := make([]byte, listenMaxDatagramSize)
 
-	// lru cache for sequence numbers duplicates check
-	cache, _ := lru.New(2048)
+	// sliding windows per stream for sequence numbers duplicates and gaps check
+	tracker := sequence.NewTracker(listenSequenceWindow)
+
+	mdgSession = optiq.NewSession(time.Second * time.Duration(mdgHeartbeatTimeout))
+	mdgLatency = latency.NewRecorder(time.Microsecond * time.Duration(mdgLatencyOutlier))
 
-	go statsPrinter()
+	go statsPrinter(l)
+	go heartbeatChecker()
 
 	log.Printf("Listening to %s@%s  %v\n", listenAddress, util.StringIfEmpty(listenInterface, "default"), intf)
 
-	lastSeqNum = 0
+	atomic.StoreUint64(&lastSeqNum, 0)
 	// Loop forever reading from the socket
-	for {
-		numBytes, cm, srcAddr, err := packetConn.ReadFrom(buffer)
-		if err != nil {
-			log.Fatal("ReadFromUDP failed:", err)
-		}
+	err = l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
 		atomic.AddUint64(&mdgTotalNumPackets, 1)
 		atomic.AddUint64(&mdgTotalNumBytes, uint64(numBytes))
 
-		if !cm.Dst.IsMulticast() {
-			continue
+		if !p.Dst.IsMulticast() {
+			return
 		}
-		if !cm.Dst.Equal(addr.IP) {
+		if !p.Dst.Equal(addr.IP) {
 			// unknown group, discard
-			continue
+			return
 		}
 
 		atomic.AddUint64(&mdgNumPackets, 1)
 		atomic.AddUint64(&mdgNumBytes, uint64(numBytes))
-		if numBytes >= 16 {
-			packetTime := binary.LittleEndian.Uint64(buffer[0:8])
-			/**
-			Used to flag information (Little-Endian):
-			- Bit 0: Compression
-			 - 0 = body of the packet is not compressed (the body is the packet without the packet header)
-			 - 1 = body of the packet is compressed
-			- Bit 1 to 3: will be set to 0 every morning and incremented for each restart of MDG in the same day (wrapping to 0 if the field overflows
-			- Bit 4 to 6: used if the Packet Sequence Number (PSN) goes over (2^32)-1. They are PSN high weight bits
-			- Bit 7: is set to 1 when in the packet there is a Start Of Snapshot (2101) message, 0 otherwise
-			- Bit 8: is set to 1 when in the packet there is an End Of Snapshot (2102) message, 0 otherwise
-			- Bit 9: is set to 1 when in the packet there is a Health Status (1103) message, Start Of Day (1101) message or End Of Day (1102) message, 0 otherwise
-			- Bit 10 to 15: for future use
-			*/
-			packetFlags := binary.LittleEndian.Uint16(buffer[12:14])
-			seqNum := binary.LittleEndian.Uint32(buffer[8:12])
-			channelId := binary.LittleEndian.Uint16(buffer[14:16])
-
-			_, ok := cache.Get(seqNum)
-			if ok {
-				log.Printf("Duplicate message: %d\n", seqNum)
-				continue
-			}
-			cache.Add(seqNum, true)
+		header, err := optiq.ParsePacketHeader(buffer)
+		if err != nil {
+			log.Fatalf("ReadFromUDP failed wrong num bytes: %d", numBytes)
+		}
+		seqNum := header.SeqNum
+
+		result, missing := tracker.Add(uint64(header.ChannelID), seqNum)
+		if result == sequence.Duplicate {
+			log.Printf("Duplicate message: %d\n", seqNum)
+			return
+		}
 
-			if listenDumpBytes {
-				log.Printf(strings.Repeat("-", 80))
-				log.Printf("addr: %v, numBytes: %d, time: %d, channelId: %d, flags: %x, lastSeqNum: %d, seqNum: %d\n", srcAddr, numBytes, packetTime, channelId, packetFlags, lastSeqNum, seqNum)
-				util.DumpByteSlice(buffer[:numBytes])
+		body := buffer[optiq.PacketHeaderSize:]
+		// the compressed messages of a failed decompression are lost
+		decoded := true
+		if header.Compressed() {
+			atomic.AddUint64(&mdgNumCompressed, 1)
+			inflated, err := mdgDecompressor.Decompress(body)
+			if err != nil {
+				log.Printf("Packet %d: %v\n", seqNum, err)
+				decoded = false
+				if mdgRealtime != nil {
+					mdgRealtime.gap()
+				}
+			} else {
+				atomic.AddUint64(&mdgCompressedBytes, uint64(len(body)))
+				atomic.AddUint64(&mdgInflatedBytes, uint64(len(inflated)))
+				body = inflated
 			}
+		} else {
+			atomic.AddUint64(&mdgNumPlain, 1)
+		}
 
-			if lastSeqNum != 0 && seqNum > lastSeqNum && seqNum != lastSeqNum+1 {
-				ooo := uint64(seqNum - lastSeqNum - 1)
-				atomic.AddUint64(&mdgNumPacketsOoO, ooo)
-				log.Printf("Out of sequence message: %d -> %d [%d]\n", lastSeqNum, seqNum, ooo)
+		var frames []optiq.Frame
+		if decoded && header.SessionStatus() {
+			// an error leaves the messages framed until then
+			frames, _ = optiq.Frames(body)
+		}
+		if result == sequence.Gap {
+			mdgSession.Gap(header.ChannelID)
+			if mdgRealtime != nil {
+				mdgRealtime.gap()
 			}
-			if lastSeqNum != 0 && seqNum < lastSeqNum {
-				atomic.AddUint64(&mdgNumPacketsMessy, 1)
-				log.Printf("Messy message: %d\n", seqNum)
+		}
+		if mdgRealtime != nil && decoded && result != sequence.Late && result != sequence.TooOld {
+			mdgRealtime.apply(body)
+		}
+		if lat, outlier := mdgLatency.Record(uint64(header.ChannelID), time.Unix(0, int64(header.PacketTime)), p.Time); outlier {
+			log.Printf("Latency outlier on channel %d: seqNum %d, %v\n", header.ChannelID, seqNum, lat)
+		}
+		for _, e := range mdgSession.Packet(&header, frames, time.Now()) {
+			log.Printf("%v\n", e)
+		}
+
+		if listenDumpBytes {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("addr: %v, numBytes: %d, time: %d, channelId: %d, flags: %x, lastSeqNum: %d, seqNum: %d\n", p.Src, numBytes, header.PacketTime, header.ChannelID, header.Flags, lastSeqNum, seqNum)
+			if decoded {
+				dumpMdg(body)
+			} else {
+				util.DumpByteSlice(body)
 			}
-			if seqNum > lastSeqNum {
-				lastSeqNum = seqNum
+		}
+
+		switch result {
+		case sequence.Gap:
+			atomic.AddUint64(&mdgNumPacketsOoO, missing)
+			log.Printf("Out of sequence message: %d -> %d [%d]\n", seqNum-missing-1, seqNum, missing)
+		case sequence.Late, sequence.TooOld:
+			atomic.AddUint64(&mdgNumPacketsMessy, 1)
+			log.Printf("Messy message: %d\n", seqNum)
+		}
+		if result != sequence.Late && result != sequence.TooOld {
+			atomic.StoreUint64(&lastSeqNum, seqNum)
+		}
+	})
+	return fmt.Errorf("ReadFromUDP failed: %w", err)
+}
+
+// readMdgSnapshot feeds the snapshot stream to the recovery
+func readMdgSnapshot(l *mcast.Listener, stream *recoveryStream) error {
+	group := l.Group()
+	tracker := sequence.NewTracker(listenSequenceWindow)
+	decompressor, err := optiq.NewDecompressor(mdgCompression)
+	if err != nil {
+		return err
+	}
+
+	return l.Read(func(p *mcast.Packet) {
+		if !p.Dst.IsMulticast() || !p.Dst.Equal(group.IP) {
+			// unknown group, discard
+			return
+		}
+		header, err := optiq.ParsePacketHeader(p.Data)
+		if err != nil {
+			log.Printf("Packet too short from %v: %d bytes\n", p.Src, len(p.Data))
+			return
+		}
+		result, missing := tracker.Add(uint64(header.ChannelID), header.SeqNum)
+		switch result {
+		case sequence.Duplicate, sequence.Late, sequence.TooOld:
+			return
+		case sequence.Gap:
+			log.Printf("Out of sequence snapshot message: %d -> %d [%d]\n", header.SeqNum-missing-1, header.SeqNum, missing)
+			stream.gap()
+		}
+
+		body := p.Data[optiq.PacketHeaderSize:]
+		if header.Compressed() {
+			if body, err = decompressor.Decompress(body); err != nil {
+				log.Printf("Snapshot packet %d: %v\n", header.SeqNum, err)
+				stream.gap()
+				return
 			}
-		} else {
-			log.Fatalf("ReadFromUDP failed wrong num bytes: %d", numBytes)
 		}
+		stream.apply(body)
+	})
+}
+
+// dumpMdg prints the SBE decoded messages of the packet body, or its raw
+// bytes when no schema is loaded or the body can't be decoded
+func dumpMdg(body []byte) {
+	if mdgSchema == nil {
+		util.DumpByteSlice(body)
+		return
+	}
+	frames, err := optiq.Frames(body)
+	for _, f := range frames {
+		m, _, decodeErr := mdgSchema.Decode(f.Data)
+		if decodeErr != nil {
+			log.Printf("SBE decoding of template %d failed: %v\n", f.TemplateID, decodeErr)
+			util.DumpByteSlice(f.Data)
+			continue
+		}
+		fmt.Print(m.String())
 	}
+	if err != nil {
+		log.Printf("Optiq message framing failed: %v\n", err)
+		util.DumpByteSlice(body)
+	}
+}
+
+func init() {
+	listenMdgCmd.Flags().StringVarP(&mdgSchemaFile, "schema", "x", "", "Euronext Optiq MDG SBE XML schema file used to decode the messages in dump mode")
+	listenMdgCmd.Flags().StringVar(&mdgSnapshotAddress, "snapshot-address", "", "The snapshot multicast address and port of the channel, enables the late join recovery mode")
+	_ = viper.BindPFlag("schema", listenMdgCmd.Flags().Lookup("schema"))
+	_ = viper.BindPFlag("snapshot-address", listenMdgCmd.Flags().Lookup("snapshot-address"))
+	listenMdgCmd.Flags().StringVar(&mdgCompression, "compression", optiq.CodecZlib, "Codec of the compressed packet bodies: zlib, flate or lz4")
+	_ = viper.BindPFlag("compression", listenMdgCmd.Flags().Lookup("compression"))
+	listenMdgCmd.Flags().IntVar(&mdgHeartbeatTimeout, "heartbeat-timeout", 5, "Seconds without health status messages on a channel before a missed heartbeat alert (0 disables it)")
+	_ = viper.BindPFlag("heartbeat-timeout", listenMdgCmd.Flags().Lookup("heartbeat-timeout"))
+	listenMdgCmd.Flags().IntVar(&mdgLatencyOutlier, "latency-outlier", 1000, "Microseconds above the lowest latency of a channel for a packet to be logged as latency outlier (0 disables it)")
+	_ = viper.BindPFlag("latency-outlier", listenMdgCmd.Flags().Lookup("latency-outlier"))
 }
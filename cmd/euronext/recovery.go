@@ -0,0 +1,81 @@
+package euronext
+
+import (
+	"github.com/coalescent-labs/mcastmkt/pkg/book"
+	"github.com/coalescent-labs/mcastmkt/pkg/optiq"
+	"github.com/coalescent-labs/mcastmkt/pkg/sbe"
+	"log"
+)
+
+// recoveryStream is the state of a real-time or snapshot stream fed to an
+// Optiq late join recovery
+type recoveryStream struct {
+	recovery *book.OptiqRecovery
+	schema   *sbe.Schema
+	snapshot bool
+	cycle    bool
+}
+
+// gap handles lost packets: the real-time stream restarts the recovery and
+// the snapshot stream abandons its cycle
+func (s *recoveryStream) gap() {
+	if s.snapshot {
+		if s.cycle {
+			log.Printf("Snapshot cycle aborted by a gap\n")
+		}
+		s.recovery.AbortSnapshot()
+		s.cycle = false
+	} else {
+		s.recovery.Gap()
+	}
+}
+
+// apply feeds the messages of an uncompressed packet body to the recovery.
+// It returns the number of applied entries and of messages which couldn't be
+// decoded.
+func (s *recoveryStream) apply(body []byte) (int, int) {
+	applied, errs := 0, 0
+	frames, err := optiq.Frames(body)
+	if err != nil {
+		errs++
+	}
+	for _, f := range frames {
+		switch f.TemplateID {
+		case optiq.TemplateStartOfDay:
+			s.recovery.StartOfDay()
+			continue
+		case optiq.TemplateStartOfSnapshot:
+			if s.snapshot {
+				// without the schema of the message the cycle can still be used
+				m, _, _ := s.schema.Decode(f.Data)
+				s.cycle = s.recovery.StartSnapshot(m)
+			}
+			continue
+		case optiq.TemplateEndOfSnapshot:
+			if s.snapshot && s.cycle {
+				s.cycle = false
+				if replayed, ok := s.recovery.EndSnapshot(); ok {
+					stats := s.recovery.Stats()
+					log.Printf("Synchronized in %v, %d buffered messages replayed\n", stats.TimeToSync, replayed)
+				} else {
+					log.Printf("Snapshot cycle skipped, older than the buffered messages\n")
+				}
+			}
+			continue
+		}
+		if f.Technical() {
+			continue
+		}
+		m, _, err := s.schema.Decode(f.Data)
+		if err != nil {
+			errs++
+			continue
+		}
+		if !s.snapshot {
+			applied += s.recovery.Incremental(m)
+		} else if s.cycle {
+			applied += s.recovery.Snapshot(m)
+		}
+	}
+	return applied, errs
+}
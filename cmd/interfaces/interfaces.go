@@ -0,0 +1,113 @@
+package interfaces
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/sysinfo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+var (
+	interfacesJson bool
+
+	InterfacesCmd = &cobra.Command{
+		Use:   "interfaces",
+		Short: "List network interfaces and their current multicast memberships",
+		Long: `Lists the network interfaces with addresses, MTU, flags, multicast capability and the groups
+currently joined on each of them (from /proc/net/igmp and /proc/net/igmp6 on Linux).
+The name or any of the addresses can be used as --interface value of the other commands.`,
+		RunE: listInterfaces,
+	}
+)
+
+type interfaceInfo struct {
+	Index     int      `json:"index"`
+	Name      string   `json:"name"`
+	MTU       int      `json:"mtu"`
+	Flags     []string `json:"flags"`
+	Multicast bool     `json:"multicast"`
+	Addresses []string `json:"addresses"`
+	Groups    []string `json:"groups"`
+	Querier   string   `json:"igmpQuerier,omitempty"`
+}
+
+func listInterfaces(*cobra.Command, []string) error {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return fmt.Errorf("failed to get network interfaces: %w", err)
+	}
+
+	// memberships are only available on Linux
+	memberships, err := sysinfo.IGMPMemberships()
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("IGMP memberships not available: %v\n", err)
+	}
+	memberships6, err := sysinfo.IGMP6Memberships()
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("IGMP6 memberships not available: %v\n", err)
+	}
+
+	infos := make([]interfaceInfo, 0, len(ifaces))
+	for _, iface := range ifaces {
+		info := interfaceInfo{
+			Index:     iface.Index,
+			Name:      iface.Name,
+			MTU:       iface.MTU,
+			Flags:     []string{},
+			Multicast: iface.Flags&net.FlagMulticast != 0,
+			Addresses: []string{},
+			Groups:    []string{},
+		}
+		if iface.Flags != 0 {
+			info.Flags = strings.Split(iface.Flags.String(), "|")
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				info.Addresses = append(info.Addresses, addr.String())
+			}
+		}
+		for _, m := range append(memberships, memberships6...) {
+			if m.IfIndex == iface.Index {
+				info.Groups = append(info.Groups, m.Group.String())
+				if m.Querier != "" {
+					info.Querier = m.Querier
+				}
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	if interfacesJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	}
+
+	for _, info := range infos {
+		multicast := "no"
+		if info.Multicast {
+			multicast = "yes"
+		}
+		fmt.Printf("%d: %s  mtu %d  multicast %s  <%s>\n", info.Index, info.Name, info.MTU, multicast, strings.Join(info.Flags, ","))
+		for _, addr := range info.Addresses {
+			fmt.Printf("    addr   %s\n", addr)
+		}
+		if info.Querier != "" {
+			fmt.Printf("    igmp   %s\n", info.Querier)
+		}
+		for _, group := range info.Groups {
+			fmt.Printf("    group  %s\n", group)
+		}
+	}
+	return nil
+}
+
+func init() {
+	InterfacesCmd.PersistentFlags().BoolVarP(&interfacesJson, "json", "j", false, "Print the interfaces as JSON")
+	_ = viper.BindPFlag("json", InterfacesCmd.PersistentFlags().Lookup("json"))
+}
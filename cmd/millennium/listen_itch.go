@@ -0,0 +1,213 @@
+package millennium
+
+import (
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/mitch"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/spf13/cobra"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	itchTotalNumBytes     uint64 = 0
+	itchNumBytes          uint64 = 0
+	itchNumPackets        uint64 = 0
+	itchTotalNumPackets   uint64 = 0
+	itchNumMessages       uint64 = 0
+	itchNumMessagesOoO    uint64 = 0
+	itchNumPacketsMessy   uint64 = 0
+	itchNumHeartbeats     uint64 = 0
+	itchNumUnsequenced    uint64 = 0
+	itchNumRecovery       uint64 = 0
+	itchNumResets         uint64 = 0
+	itchNumGroups         uint64 = 0
+	itchNumDecodingErrors uint64 = 0
+
+	listenItchCmd = &cobra.Command{
+		Use:   "itch",
+		Short: "Listen Millennium MITCH multicast stream and dump out of sequence messages",
+		Long: `Detecting duplicates and gaps by the unit header, per market data group: a multicast channel carries several
+groups, each one with its own sequence. The unit header has the sequence number of the first message and the message
+count, so the gaps are reported in number of missing messages.
+Heartbeats (count 0) announce the next sequence number of the group and reveal the gaps of an idle group, the
+unsequenced packets (sequence 0) are not checked. The messages of the replay and snapshot channels are logged, the
+Snapshot Complete one with the sequence number to resume the real-time group from, and a group restarting from
+sequence 1 resets its sequence check. In dump mode the MITCH messages are decoded.`,
+		RunE: listenItch,
+	}
+)
+
+func itchStatsPrinter(l *mcast.Listener) {
+	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
+		recvMsg := atomic.SwapUint64(&itchNumPackets, 0)
+		recvTotalMsg := atomic.SwapUint64(&itchTotalNumPackets, 0)
+		recvBytes := atomic.SwapUint64(&itchNumBytes, 0)
+		recvTotalBytes := atomic.SwapUint64(&itchTotalNumBytes, 0)
+		recvMessages := atomic.SwapUint64(&itchNumMessages, 0)
+		recvOoO := atomic.SwapUint64(&itchNumMessagesOoO, 0)
+		recvMessy := atomic.SwapUint64(&itchNumPacketsMessy, 0)
+		recvHeartbeats := atomic.SwapUint64(&itchNumHeartbeats, 0)
+		recvUnsequenced := atomic.SwapUint64(&itchNumUnsequenced, 0)
+		recvRecovery := atomic.SwapUint64(&itchNumRecovery, 0)
+		recvResets := atomic.SwapUint64(&itchNumResets, 0)
+		recvErrors := atomic.SwapUint64(&itchNumDecodingErrors, 0)
+		sockStats := l.SwapStats()
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], MITCH messages: %d, Groups: %d, Missing messages: %d, Kernel drops: %d, Messy: %d, Heartbeats: %d, Unsequenced: %d, Recovery messages: %d, Resets: %d, Decoding errors: %d, Ring full: %d, Syscalls/pkt: %.3f\n",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			recvMessages, atomic.LoadUint64(&itchNumGroups), recvOoO, sockStats.KernelDrops, recvMessy, recvHeartbeats,
+			recvUnsequenced, recvRecovery, recvResets, recvErrors, sockStats.RingFull, sockStats.SyscallsPerPacket())
+	}
+}
+
+func listenItch(*cobra.Command, []string) error {
+	// Parse the string address
+	addr, err := net.ResolveUDPAddr("udp4", listenAddress)
+	if err != nil {
+		return err
+	}
+
+	var intf *net.Interface = nil
+
+	if listenInterface != "" {
+		intf, err = util.GetInterfaceFromIPorName(listenInterface)
+		if err != nil {
+			return err
+		}
+	}
+
+	l, err := mcast.Listen(listenAddress, intf, mcast.Options{
+		ReceiveBufferSize: listenReceiveBufferSize,
+		BatchSize:         listenBatchSize,
+		RingSize:          listenRingSize,
+		PinCPU:            listenPinCPU,
+	})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	// sliding windows per market data group for message sequence numbers duplicates and gaps check
+	tracker := sequence.NewTracker(listenSequenceWindow)
+
+	go itchStatsPrinter(l)
+
+	log.Printf("Listening to %s@%s  %v\n", listenAddress, util.StringIfEmpty(listenInterface, "default"), intf)
+
+	// Loop forever reading from the socket
+	err = l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
+		atomic.AddUint64(&itchTotalNumPackets, 1)
+		atomic.AddUint64(&itchTotalNumBytes, uint64(numBytes))
+
+		if !p.Dst.IsMulticast() {
+			return
+		}
+		if !p.Dst.Equal(addr.IP) {
+			// unknown group, discard
+			return
+		}
+
+		atomic.AddUint64(&itchNumPackets, 1)
+		atomic.AddUint64(&itchNumBytes, uint64(numBytes))
+
+		header, err := mitch.ParseHeader(buffer)
+		if err != nil {
+			log.Printf("Invalid packet from %v: %v\n", p.Src, err)
+			return
+		}
+		msgs, framingErr := mitch.Messages(buffer, &header)
+		atomic.AddUint64(&itchNumMessages, uint64(len(msgs)))
+
+		if listenDumpBytes {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("addr: %v, numBytes: %d, group: %c, sequence: %d, count: %d\n", p.Src, numBytes, header.Group, header.Sequence, header.Count)
+			dumpItch(msgs)
+			if framingErr != nil {
+				log.Printf("MITCH message framing failed: %v\n", framingErr)
+				util.DumpByteSlice(buffer)
+			}
+		}
+		if framingErr != nil {
+			atomic.AddUint64(&itchNumDecodingErrors, 1)
+		}
+
+		for i := range msgs {
+			if msgs[i].Recovery() {
+				atomic.AddUint64(&itchNumRecovery, 1)
+				logRecovery(&header, &msgs[i])
+			}
+		}
+		if !header.Sequenced() {
+			atomic.AddUint64(&itchNumUnsequenced, 1)
+			return
+		}
+
+		window := tracker.Window(uint64(header.Group))
+		atomic.StoreUint64(&itchNumGroups, uint64(tracker.Streams()))
+		last := window.Last()
+		result, missing, reset := window.AddPacket(uint64(header.Sequence), uint64(header.Count))
+		if reset {
+			atomic.AddUint64(&itchNumResets, 1)
+			log.Printf("Sequence reset on group %c from %d\n", header.Group, last)
+		}
+		if header.Heartbeat() {
+			atomic.AddUint64(&itchNumHeartbeats, 1)
+			// the next sequence number reveals the messages lost on an idle group
+			if result == sequence.Gap {
+				atomic.AddUint64(&itchNumMessagesOoO, missing)
+				log.Printf("Out of sequence heartbeat: group %c, %d -> %d [%d]\n", header.Group, last, header.Sequence, missing)
+			}
+			return
+		}
+
+		switch result {
+		case sequence.Duplicate:
+			log.Printf("Duplicate message: group %c, sequence %d\n", header.Group, header.Sequence)
+		case sequence.Gap:
+			atomic.AddUint64(&itchNumMessagesOoO, missing)
+			log.Printf("Out of sequence message: group %c, %d -> %d [%d]\n", header.Group, uint64(header.Sequence)-missing-1, header.Sequence, missing)
+		case sequence.Late, sequence.TooOld:
+			atomic.AddUint64(&itchNumPacketsMessy, 1)
+			log.Printf("Messy message: group %c, sequence %d\n", header.Group, header.Sequence)
+		}
+	})
+	return fmt.Errorf("ReadFromUDP failed: %w", err)
+}
+
+// dumpItch prints the decoded MITCH messages, and the raw bytes of the ones
+// which can't be decoded
+func dumpItch(msgs []mitch.Message) {
+	for i := range msgs {
+		err := msgs[i].Decode()
+		fmt.Println(msgs[i].String())
+		if err != nil || !msgs[i].Known() {
+			if err != nil {
+				atomic.AddUint64(&itchNumDecodingErrors, 1)
+				log.Printf("MITCH decoding failed: %v\n", err)
+			}
+			util.DumpByteSlice(msgs[i].Body)
+		}
+	}
+}
+
+// logRecovery logs the replay and snapshot channel message
+func logRecovery(header *mitch.Header, m *mitch.Message) {
+	if err := m.Decode(); err != nil {
+		log.Printf("Invalid recovery message: group %c, %v\n", header.Group, err)
+		return
+	}
+	switch m.Type {
+	case mitch.TypeSnapshotComplete:
+		seq, _ := m.Uint("SequenceNumber")
+		log.Printf("Snapshot complete: group %c, resume from sequence %d\n", header.Group, seq)
+	default:
+		log.Printf("Recovery message: group %c, %s\n", header.Group, m.String())
+	}
+}
@@ -0,0 +1,19 @@
+package millennium
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	MillenniumCmd = &cobra.Command{
+		Use:   "millennium",
+		Short: "LSEG Millennium MITCH multicast commands",
+		Long:  ``,
+	}
+)
+
+func init() {
+	// Add subcommands here
+	MillenniumCmd.AddCommand(listenCmd)
+
+}
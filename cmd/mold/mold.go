@@ -0,0 +1,19 @@
+package mold
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	MoldCmd = &cobra.Command{
+		Use:   "mold",
+		Short: "MoldUDP64 tools",
+		Long:  ``,
+	}
+)
+
+func init() {
+	// Add subcommands here
+	MoldCmd.AddCommand(rerequestServerCmd)
+
+}
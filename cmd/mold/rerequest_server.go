@@ -0,0 +1,155 @@
+package mold
+
+import (
+	"errors"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/moldudp64"
+	"github.com/coalescent-labs/mcastmkt/pkg/pcap"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	serverNumRequests  uint64 = 0
+	serverNumMessages  uint64 = 0
+	serverNumBytes     uint64 = 0
+	serverNumUnserved  uint64 = 0
+	serverNumMalformed uint64 = 0
+
+	serverPcapFile      string
+	serverListenAddress string
+	serverFeedAddress   string
+	serverMaxPacketSize int
+	serverDumpBytes     bool
+	serverStatsInterval uint64 = 30
+
+	rerequestServerCmd = &cobra.Command{
+		Use:   "rerequest-server",
+		Short: "Serve MoldUDP64 re-requests with the messages of a pcap capture",
+		Long: `Loads the MoldUDP64 downstream packets of a classic pcap capture (--pcap), optionally only the ones sent to
+the feed multicast address (--feed-address), and answers the re-requests received on --listen with the stored
+messages, as many as fit in a packet of --max-packet-size bytes. It stands in for the re-request server of the
+exchange to test the re-request of the listeners offline.`,
+		RunE: rerequestServer,
+	}
+)
+
+func serverStatsPrinter() {
+	for range time.Tick(time.Second * time.Duration(serverStatsInterval)) {
+		requests := atomic.SwapUint64(&serverNumRequests, 0)
+		messages := atomic.SwapUint64(&serverNumMessages, 0)
+		sentBytes := atomic.SwapUint64(&serverNumBytes, 0)
+		unserved := atomic.SwapUint64(&serverNumUnserved, 0)
+		malformed := atomic.SwapUint64(&serverNumMalformed, 0)
+		log.Printf("STAT Requests: %d, Served messages: %d, Send bytes: %s, Unserved requests: %d, Malformed requests: %d\n",
+			requests, messages, util.ByteCountIEC(sentBytes), unserved, malformed)
+	}
+}
+
+// loadPcap stores the messages of the MoldUDP64 packets of the capture
+func loadPcap(store *moldudp64.Store) error {
+	var feed *net.UDPAddr
+	if serverFeedAddress != "" {
+		var err error
+		feed, err = net.ResolveUDPAddr("udp4", serverFeedAddress)
+		if err != nil {
+			return err
+		}
+	}
+	var datagrams, invalid int
+	err := pcap.ReadFile(serverPcapFile, func(d *pcap.Datagram) {
+		if feed != nil && (!d.Dst.IP.Equal(feed.IP) || d.Dst.Port != feed.Port) {
+			return
+		}
+		datagrams++
+		if _, err := store.Add(d.Payload); err != nil {
+			invalid++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	sessions, messages := store.Len()
+	log.Printf("Loaded %d messages of %d sessions from %d datagrams of %s (%d invalid)\n", messages, sessions, datagrams, serverPcapFile, invalid)
+	if messages == 0 {
+		return errors.New("no MoldUDP64 message in the capture")
+	}
+	return nil
+}
+
+func rerequestServer(*cobra.Command, []string) error {
+	store := moldudp64.NewStore()
+	if err := loadPcap(store); err != nil {
+		return err
+	}
+
+	addr, err := net.ResolveUDPAddr("udp4", serverListenAddress)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp4", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go serverStatsPrinter()
+
+	log.Printf("Serving re-requests on %s\n", serverListenAddress)
+
+	buffer := make([]byte, 1500)
+	var packet []byte
+	for {
+		n, src, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return fmt.Errorf("ReadFromUDP failed: %w", err)
+		}
+		atomic.AddUint64(&serverNumRequests, 1)
+		request, err := moldudp64.ParseRequest(buffer[:n])
+		if err != nil {
+			atomic.AddUint64(&serverNumMalformed, 1)
+			log.Printf("Invalid re-request from %v: %v\n", src, err)
+			continue
+		}
+		msgs := store.Get(request.Session, request.SeqNum, int(request.Count), serverMaxPacketSize)
+		if serverDumpBytes {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("addr: %v, session: %s, seqNum: %d, count: %d, served: %d\n", src, request.SessionName(), request.SeqNum, request.Count, len(msgs))
+		}
+		if len(msgs) == 0 {
+			atomic.AddUint64(&serverNumUnserved, 1)
+			log.Printf("No message to serve: session %s, seqNum %d, count %d\n", request.SessionName(), request.SeqNum, request.Count)
+			continue
+		}
+		packet = moldudp64.AppendPacket(packet[:0], request.Session, request.SeqNum, msgs)
+		numBytes, err := conn.WriteToUDP(packet, src)
+		if err != nil {
+			log.Printf("Write to %v failed: %v\n", src, err)
+			continue
+		}
+		atomic.AddUint64(&serverNumMessages, uint64(len(msgs)))
+		atomic.AddUint64(&serverNumBytes, uint64(numBytes))
+	}
+}
+
+func init() {
+	rerequestServerCmd.Flags().StringVarP(&serverPcapFile, "pcap", "p", "", "Classic pcap capture of the MoldUDP64 feed whose messages are served")
+	rerequestServerCmd.Flags().StringVarP(&serverListenAddress, "listen", "l", "0.0.0.0:5000", "The UDP address and port the re-requests are received on")
+	rerequestServerCmd.Flags().StringVarP(&serverFeedAddress, "feed-address", "f", "", "Only load the datagrams sent to the multicast address and port (all when empty)")
+	rerequestServerCmd.Flags().IntVar(&serverMaxPacketSize, "max-packet-size", 1472, "Maximum size in bytes of a response packet")
+	rerequestServerCmd.Flags().BoolVarP(&serverDumpBytes, "dump", "d", false, "Dump the received re-requests")
+	rerequestServerCmd.Flags().Uint64VarP(&serverStatsInterval, "stats-interval", "s", 30, "Statistics print interval in seconds")
+	_ = rerequestServerCmd.MarkFlagRequired("pcap")
+	_ = viper.BindPFlag("pcap", rerequestServerCmd.Flags().Lookup("pcap"))
+	_ = viper.BindPFlag("listen", rerequestServerCmd.Flags().Lookup("listen"))
+	_ = viper.BindPFlag("feed-address", rerequestServerCmd.Flags().Lookup("feed-address"))
+	_ = viper.BindPFlag("max-packet-size", rerequestServerCmd.Flags().Lookup("max-packet-size"))
+	_ = viper.BindPFlag("server-dump", rerequestServerCmd.Flags().Lookup("dump"))
+	_ = viper.BindPFlag("server-stats-interval", rerequestServerCmd.Flags().Lookup("stats-interval"))
+}
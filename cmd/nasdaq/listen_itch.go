@@ -0,0 +1,378 @@
+package nasdaq
+
+import (
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/itch"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/moldudp64"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	itchTotalNumBytes   uint64 = 0
+	itchNumBytes        uint64 = 0
+	itchNumPackets      uint64 = 0
+	itchTotalNumPackets uint64 = 0
+	itchNumMessages     uint64 = 0
+	itchNumMessagesOoO  uint64 = 0
+	itchNumPacketsMessy uint64 = 0
+	itchNumHeartbeats   uint64 = 0
+	itchNumSessions     uint64 = 0
+	itchNumDecodeErrors uint64 = 0
+	itchLastSeqNum      uint64 = 0
+	itchEndedSessions   uint64 = 0
+	// itchPacketsSeen is never reset, for the heartbeat checker
+	itchPacketsSeen       uint64 = 0
+	itchHeartbeatTimeout  int
+	itchRerequestAddress  string
+	itchRerequestTimeout  int
+	itchRerequestRetries  int
+	itchRerequestMaxCount int
+
+	// itchSessions are the sliding windows per session for the message
+	// sequence numbers duplicates and gaps check, serialized by itchMu
+	// between the feed and the re-request responses
+	itchSessions    map[string]*itchSession
+	itchMu          sync.Mutex
+	itchRerequester *moldudp64.Rerequester
+	itchFilled      []bool
+
+	listenItchCmd = &cobra.Command{
+		Use:   "itch",
+		Short: "Listen Nasdaq ITCH over MoldUDP64 multicast stream and dump out of sequence messages",
+		Long: `Detecting duplicates and gaps by the MoldUDP64 packet header.
+The sequence number counts messages, not packets: a packet carries the sequence number of its first message
+and the message count, so the gaps are reported in number of missing messages per session.
+Heartbeats (message count 0) announce the next sequence number and reveal the gaps of an idle stream, a missed
+heartbeat alert is logged when the stream is silent for longer than --heartbeat-timeout.
+The end of session packets (message count 0xFFFF) are logged. In dump mode the ITCH 5.0 messages are decoded.
+With the re-request server address (--rerequest-address) the missing messages are asked to the server, sent
+again after --rerequest-timeout up to --rerequest-retries times, and the recovered ones are merged into the stream:
+they fill the gaps of the sequence check and are dumped in dump mode. The recovery latency is the time from the
+detection of a gap to the reception of its last missing message.`,
+		RunE: listenItch,
+	}
+)
+
+// itchSession is the state of a MoldUDP64 session
+type itchSession struct {
+	window *sequence.Window
+	ended  bool
+}
+
+func itchStatsPrinter(l *mcast.Listener) {
+	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
+		recvMsg := atomic.SwapUint64(&itchNumPackets, 0)
+		recvTotalMsg := atomic.SwapUint64(&itchTotalNumPackets, 0)
+		recvBytes := atomic.SwapUint64(&itchNumBytes, 0)
+		recvTotalBytes := atomic.SwapUint64(&itchTotalNumBytes, 0)
+		recvMessages := atomic.SwapUint64(&itchNumMessages, 0)
+		recvOoO := atomic.SwapUint64(&itchNumMessagesOoO, 0)
+		recvMessy := atomic.SwapUint64(&itchNumPacketsMessy, 0)
+		recvHeartbeats := atomic.SwapUint64(&itchNumHeartbeats, 0)
+		recvErrors := atomic.SwapUint64(&itchNumDecodeErrors, 0)
+		sockStats := l.SwapStats()
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], ITCH messages: %d, Sessions: %d [Ended: %d], Last seqNo: %d, Missing messages: %d, Kernel drops: %d, Messy: %d, Heartbeats: %d, Decoding errors: %d, Ring full: %d, Syscalls/pkt: %.3f\n",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			recvMessages, atomic.LoadUint64(&itchNumSessions), atomic.LoadUint64(&itchEndedSessions), atomic.LoadUint64(&itchLastSeqNum),
+			recvOoO, sockStats.KernelDrops, recvMessy, recvHeartbeats, recvErrors, sockStats.RingFull, sockStats.SyscallsPerPacket())
+		if itchRerequester != nil {
+			r := itchRerequester.SwapStats()
+			log.Printf("REREQUEST Requests: %d, Recovered messages: %d [Gaps: %d], Unrecovered: %d, Pending: %d, Recovery latency: min %v, p50 %v, p99 %v, max %v\n",
+				r.Requests, r.Recovered, r.Gaps, r.Unrecovered, r.Pending, r.Latency.Min, r.Latency.P50, r.Latency.P99, r.Latency.Max)
+		}
+	}
+}
+
+// itchHeartbeatChecker logs when the stream stopped sending packets, heartbeats included
+func itchHeartbeatChecker() {
+	if itchHeartbeatTimeout <= 0 {
+		return
+	}
+	timeout := time.Second * time.Duration(itchHeartbeatTimeout)
+	var last uint64
+	silent := false
+	since := time.Now()
+	for now := range time.Tick(time.Second) {
+		total := atomic.LoadUint64(&itchPacketsSeen)
+		if total != last {
+			if silent {
+				log.Printf("Stream resumed after %v\n", now.Sub(since).Truncate(time.Millisecond))
+			}
+			last, silent, since = total, false, now
+			continue
+		}
+		if !silent && now.Sub(since) > timeout && atomic.LoadUint64(&itchEndedSessions) < atomic.LoadUint64(&itchNumSessions) {
+			silent = true
+			log.Printf("ALERT missed heartbeats: no packet for %v\n", now.Sub(since).Truncate(time.Millisecond))
+		}
+	}
+}
+
+func listenItch(*cobra.Command, []string) error {
+	// Parse the string address
+	addr, err := net.ResolveUDPAddr("udp4", listenAddress)
+	if err != nil {
+		return err
+	}
+
+	var intf *net.Interface = nil
+
+	if listenInterface != "" {
+		intf, err = util.GetInterfaceFromIPorName(listenInterface)
+		if err != nil {
+			return err
+		}
+	}
+
+	l, err := mcast.Listen(listenAddress, intf, mcast.Options{
+		ReceiveBufferSize: listenReceiveBufferSize,
+		BatchSize:         listenBatchSize,
+		RingSize:          listenRingSize,
+		PinCPU:            listenPinCPU,
+	})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	itchSessions = make(map[string]*itchSession)
+
+	if itchRerequestAddress != "" {
+		itchRerequester, err = moldudp64.DialRerequester(itchRerequestAddress, time.Millisecond*time.Duration(itchRerequestTimeout),
+			itchRerequestRetries, itchRerequestMaxCount)
+		if err != nil {
+			return err
+		}
+		defer itchRerequester.Close()
+		log.Printf("Re-requesting the missing messages to %s\n", itchRerequestAddress)
+		go func() {
+			err := itchRerequester.Read(func(packet []byte) {
+				itchMu.Lock()
+				defer itchMu.Unlock()
+				itchPacket(packet, true)
+			})
+			log.Fatalf("Reading the re-request responses failed: %v", err)
+		}()
+		go itchRerequestRetrier()
+	}
+
+	go itchStatsPrinter(l)
+	go itchHeartbeatChecker()
+
+	log.Printf("Listening to %s@%s  %v\n", listenAddress, util.StringIfEmpty(listenInterface, "default"), intf)
+
+	// Loop forever reading from the socket
+	err = l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
+		atomic.AddUint64(&itchTotalNumPackets, 1)
+		atomic.AddUint64(&itchTotalNumBytes, uint64(numBytes))
+
+		if !p.Dst.IsMulticast() {
+			return
+		}
+		if !p.Dst.Equal(addr.IP) {
+			// unknown group, discard
+			return
+		}
+
+		atomic.AddUint64(&itchNumPackets, 1)
+		atomic.AddUint64(&itchNumBytes, uint64(numBytes))
+		atomic.AddUint64(&itchPacketsSeen, 1)
+
+		if listenDumpBytes {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("addr: %v, numBytes: %d\n", p.Src, numBytes)
+		}
+		itchMu.Lock()
+		defer itchMu.Unlock()
+		itchPacket(buffer, false)
+	})
+	return fmt.Errorf("ReadFromUDP failed: %w", err)
+}
+
+// itchPacket checks the sequence of a MoldUDP64 packet of the feed or, when
+// recovered, of the re-request server whose messages fill the gaps
+func itchPacket(buffer []byte, recovered bool) {
+	header, err := moldudp64.ParseHeader(buffer)
+	if err != nil {
+		log.Printf("Invalid packet: %v\n", err)
+		return
+	}
+	name := header.SessionName()
+	session, ok := itchSessions[name]
+	if !ok {
+		session = &itchSession{window: sequence.NewWindow(listenSequenceWindow)}
+		itchSessions[name] = session
+		atomic.AddUint64(&itchNumSessions, 1)
+		log.Printf("Session %s started at seqNum %d\n", name, header.SeqNum)
+	}
+	window := session.window
+	now := time.Now()
+
+	if header.Heartbeat() || header.EndOfSession() {
+		if header.Heartbeat() {
+			atomic.AddUint64(&itchNumHeartbeats, 1)
+		} else if !session.ended {
+			session.ended = true
+			atomic.AddUint64(&itchEndedSessions, 1)
+			log.Printf("End of session %s at seqNum %d\n", name, header.SeqNum)
+		}
+		if listenDumpBytes {
+			log.Printf("session: %s, seqNum: %d, count: %#x\n", name, header.SeqNum, header.Count)
+		}
+		// the next sequence number reveals the messages lost on an idle stream
+		last := window.Last()
+		if header.SeqNum > 1 {
+			if missing := window.Skip(header.SeqNum - 1); missing > 0 {
+				atomic.AddUint64(&itchNumMessagesOoO, missing)
+				log.Printf("Out of sequence heartbeat: session %s, %d -> %d [%d]\n", name, last, header.SeqNum, missing)
+				itchRerequest(&header, last+1, missing, now)
+			}
+		}
+		return
+	}
+
+	result, missing := window.Add(header.SeqNum)
+	if result == sequence.Duplicate && !recovered {
+		log.Printf("Duplicate message: session %s, seqNum %d\n", name, header.SeqNum)
+		return
+	}
+	// the messages filling a gap, late from the feed or recovered
+	filled := append(itchFilled[:0], result == sequence.Late)
+	for seq := header.SeqNum + 1; seq < header.NextSeqNum(); seq++ {
+		r, _ := window.Add(seq)
+		filled = append(filled, r == sequence.Late)
+	}
+	itchFilled = filled
+	numFilled := 0
+	for i, f := range filled {
+		if f {
+			numFilled++
+			itchRecovered(&header, header.SeqNum+uint64(i), now)
+		}
+	}
+	if recovered {
+		atomic.AddUint64(&itchNumMessages, uint64(numFilled))
+		itchServed(&header, now)
+		if listenDumpBytes && numFilled > 0 {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("recovered, session: %s, seqNum: %d, count: %d\n", name, header.SeqNum, header.Count)
+			dumpItch(buffer, &header, filled)
+		}
+		return
+	}
+
+	atomic.AddUint64(&itchNumMessages, uint64(header.Count))
+	if result != sequence.Late && result != sequence.TooOld {
+		atomic.StoreUint64(&itchLastSeqNum, header.NextSeqNum()-1)
+	}
+
+	if listenDumpBytes {
+		log.Printf("session: %s, seqNum: %d, count: %d\n", name, header.SeqNum, header.Count)
+		dumpItch(buffer, &header, nil)
+	}
+
+	switch result {
+	case sequence.Gap:
+		atomic.AddUint64(&itchNumMessagesOoO, missing)
+		log.Printf("Out of sequence message: session %s, %d -> %d [%d]\n", name, header.SeqNum-missing-1, header.SeqNum, missing)
+		itchRerequest(&header, header.SeqNum-missing, missing, now)
+	case sequence.Late, sequence.TooOld:
+		atomic.AddUint64(&itchNumPacketsMessy, 1)
+		log.Printf("Messy message: session %s, seqNum %d\n", name, header.SeqNum)
+	}
+}
+
+// itchRerequest asks the re-request server for the missing messages
+func itchRerequest(header *moldudp64.Header, seqNum uint64, count uint64, now time.Time) {
+	if itchRerequester == nil {
+		return
+	}
+	if err := itchRerequester.Gap(header.Session, seqNum, count, now); err != nil {
+		log.Printf("Re-request failed: %v\n", err)
+	}
+}
+
+// itchRecovered reports a missing message received to the re-requester
+func itchRecovered(header *moldudp64.Header, seqNum uint64, now time.Time) {
+	if itchRerequester == nil {
+		return
+	}
+	elapsed, done, err := itchRerequester.Recovered(header.Session, seqNum, now)
+	if err != nil {
+		log.Printf("Re-request failed: %v\n", err)
+	}
+	if done {
+		log.Printf("Gap recovered: session %s, last seqNum %d, in %v\n", header.SessionName(), seqNum, elapsed)
+	}
+}
+
+// itchServed re-requests the rest of the gaps a response made progress on
+func itchServed(header *moldudp64.Header, now time.Time) {
+	if err := itchRerequester.Served(header.Session, now); err != nil {
+		log.Printf("Re-request failed: %v\n", err)
+	}
+}
+
+// itchRerequestRetrier sends again the unanswered re-requests
+func itchRerequestRetrier() {
+	for now := range time.Tick(time.Millisecond * 100) {
+		lost, err := itchRerequester.Retry(now)
+		if err != nil {
+			log.Printf("Re-request failed: %v\n", err)
+		}
+		if lost > 0 {
+			log.Printf("Re-request given up after %d retries: %d messages unrecovered\n", itchRerequestRetries, lost)
+		}
+	}
+}
+
+// dumpItch prints the ITCH 5.0 decoded messages of the packet, or their raw
+// bytes when they can't be decoded. With filter only the messages whose flag
+// is set are printed.
+func dumpItch(buffer []byte, header *moldudp64.Header, filter []bool) {
+	blocks, err := moldudp64.Blocks(buffer, header)
+	for i, b := range blocks {
+		if filter != nil && !filter[i] {
+			continue
+		}
+		m, decodeErr := itch.Decode(b)
+		fmt.Println(m.String())
+		if decodeErr != nil || !m.Known() {
+			if decodeErr != nil {
+				atomic.AddUint64(&itchNumDecodeErrors, 1)
+				log.Printf("ITCH decoding failed: %v\n", decodeErr)
+			}
+			util.DumpByteSlice(b)
+		}
+	}
+	if err != nil {
+		atomic.AddUint64(&itchNumDecodeErrors, 1)
+		log.Printf("MoldUDP64 message framing failed: %v\n", err)
+		util.DumpByteSlice(buffer)
+	}
+}
+
+func init() {
+	listenItchCmd.Flags().IntVar(&itchHeartbeatTimeout, "heartbeat-timeout", 5, "Seconds without packets, heartbeats included, before a missed heartbeat alert (0 disables it)")
+	_ = viper.BindPFlag("heartbeat-timeout", listenItchCmd.Flags().Lookup("heartbeat-timeout"))
+	listenItchCmd.Flags().StringVar(&itchRerequestAddress, "rerequest-address", "", "The MoldUDP64 re-request server address and port, enables the re-request of the missing messages")
+	_ = viper.BindPFlag("rerequest-address", listenItchCmd.Flags().Lookup("rerequest-address"))
+	listenItchCmd.Flags().IntVar(&itchRerequestTimeout, "rerequest-timeout", 1000, "Milliseconds before an unanswered re-request is sent again")
+	_ = viper.BindPFlag("rerequest-timeout", listenItchCmd.Flags().Lookup("rerequest-timeout"))
+	listenItchCmd.Flags().IntVar(&itchRerequestRetries, "rerequest-retries", 3, "Number of times an unanswered re-request is sent again before giving up its messages")
+	_ = viper.BindPFlag("rerequest-retries", listenItchCmd.Flags().Lookup("rerequest-retries"))
+	listenItchCmd.Flags().IntVar(&itchRerequestMaxCount, "rerequest-max-count", 1000, "Maximum number of messages asked by a single re-request")
+	_ = viper.BindPFlag("rerequest-max-count", listenItchCmd.Flags().Lookup("rerequest-max-count"))
+}
@@ -0,0 +1,19 @@
+package nasdaq
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	NasdaqCmd = &cobra.Command{
+		Use:   "nasdaq",
+		Short: "Nasdaq MoldUDP64 multicast commands",
+		Long:  ``,
+	}
+)
+
+func init() {
+	// Add subcommands here
+	NasdaqCmd.AddCommand(listenCmd)
+
+}
@@ -0,0 +1,252 @@
+package nyse
+
+import (
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/latency"
+	"github.com/coalescent-labs/mcastmkt/pkg/mcast"
+	"github.com/coalescent-labs/mcastmkt/pkg/sequence"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"github.com/coalescent-labs/mcastmkt/pkg/xdp"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	xdpTotalNumBytes      uint64 = 0
+	xdpNumBytes           uint64 = 0
+	xdpNumPackets         uint64 = 0
+	xdpTotalNumPackets    uint64 = 0
+	xdpNumMessages        uint64 = 0
+	xdpNumMessagesOoO     uint64 = 0
+	xdpNumPacketsMessy    uint64 = 0
+	xdpNumDuplicates      uint64 = 0
+	xdpNumHeartbeats      uint64 = 0
+	xdpNumResets          uint64 = 0
+	xdpNumFailovers       uint64 = 0
+	xdpNumRetransmissions uint64 = 0
+	xdpNumRefreshes       uint64 = 0
+	xdpNumDecodingErrors  uint64 = 0
+	xdpLatencyOutlier     int
+	xdpLatency            *latency.Recorder
+
+	listenXdpCmd = &cobra.Command{
+		Use:   "xdp",
+		Short: "Listen NYSE Pillar XDP multicast streams and dump out of sequence messages",
+		Long: `Detecting duplicates and gaps by the SeqNum of the packet header, per channel: each --address is a channel.
+The packet header has the sequence number of the first message and the message count, so the gaps are reported in
+number of missing messages. The delivery flags are interpreted: heartbeats carry the sequence number of the last
+message sent and reveal the gaps of an idle channel, a sequence reset restarts the sequence check, the publisher
+failovers are logged, and the retransmission and refresh packets, which keep their original sequence numbers, are
+counted without being checked.
+The latency between the packet SendTime and the receive timestamp is reported per channel. In dump mode the message
+headers are decoded.`,
+		RunE: listenXdp,
+	}
+)
+
+// xdpChannel is the sequence check of a channel, owned by its reader
+type xdpChannel struct {
+	id      int
+	address string
+	window  *sequence.Window
+	// lastSeqNum is the highest sequence number, read by the stats printer
+	lastSeqNum uint64
+}
+
+func xdpStatsPrinter(channels []*xdpChannel, listeners []*mcast.Listener) {
+	for range time.Tick(time.Second * time.Duration(listenStatsInterval)) {
+		recvMsg := atomic.SwapUint64(&xdpNumPackets, 0)
+		recvTotalMsg := atomic.SwapUint64(&xdpTotalNumPackets, 0)
+		recvBytes := atomic.SwapUint64(&xdpNumBytes, 0)
+		recvTotalBytes := atomic.SwapUint64(&xdpTotalNumBytes, 0)
+		recvMessages := atomic.SwapUint64(&xdpNumMessages, 0)
+		recvOoO := atomic.SwapUint64(&xdpNumMessagesOoO, 0)
+		recvMessy := atomic.SwapUint64(&xdpNumPacketsMessy, 0)
+		recvDuplicates := atomic.SwapUint64(&xdpNumDuplicates, 0)
+		recvHeartbeats := atomic.SwapUint64(&xdpNumHeartbeats, 0)
+		recvResets := atomic.SwapUint64(&xdpNumResets, 0)
+		recvFailovers := atomic.SwapUint64(&xdpNumFailovers, 0)
+		recvRetransmissions := atomic.SwapUint64(&xdpNumRetransmissions, 0)
+		recvRefreshes := atomic.SwapUint64(&xdpNumRefreshes, 0)
+		recvErrors := atomic.SwapUint64(&xdpNumDecodingErrors, 0)
+		var sockStats mcast.Stats
+		for _, l := range listeners {
+			s := l.SwapStats()
+			sockStats.KernelDrops += s.KernelDrops
+			sockStats.RingFull += s.RingFull
+		}
+		log.Printf("STAT Recv msg: %d [Tot %d], Recv bytes: %s [Tot: %s], XDP messages: %d, Channels: %d, Missing messages: %d, Kernel drops: %d, Messy: %d, Duplicates: %d, Heartbeats: %d, Resets: %d, Failovers: %d, Retransmissions: %d, Refreshes: %d, Decoding errors: %d, Ring full: %d\n",
+			recvMsg, recvTotalMsg, util.ByteCountIEC(recvBytes), util.ByteCountIEC(recvTotalBytes),
+			recvMessages, len(channels), recvOoO, sockStats.KernelDrops, recvMessy, recvDuplicates, recvHeartbeats,
+			recvResets, recvFailovers, recvRetransmissions, recvRefreshes, recvErrors, sockStats.RingFull)
+		for _, ch := range channels {
+			log.Printf("CHANNEL %d %s: Last seqNum: %d\n", ch.id, ch.address, atomic.LoadUint64(&ch.lastSeqNum))
+		}
+		for _, s := range xdpLatency.SwapStats() {
+			log.Printf("LATENCY channel %d: %v\n", s.Stream, s)
+		}
+	}
+}
+
+func listenXdp(*cobra.Command, []string) error {
+	var intf *net.Interface = nil
+	var err error
+
+	if listenInterface != "" {
+		intf, err = util.GetInterfaceFromIPorName(listenInterface)
+		if err != nil {
+			return err
+		}
+	}
+
+	xdpLatency = latency.NewRecorder(time.Microsecond * time.Duration(xdpLatencyOutlier))
+
+	channels := make([]*xdpChannel, len(listenAddresses))
+	listeners := make([]*mcast.Listener, len(listenAddresses))
+	for i, address := range listenAddresses {
+		pinCPU := -1
+		if i == 0 {
+			pinCPU = listenPinCPU
+		}
+		l, err := mcast.Listen(address, intf, mcast.Options{
+			ReceiveBufferSize: listenReceiveBufferSize,
+			BatchSize:         listenBatchSize,
+			RingSize:          listenRingSize,
+			PinCPU:            pinCPU,
+		})
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		listeners[i] = l
+		channels[i] = &xdpChannel{
+			id:      i,
+			address: address,
+			window:  sequence.NewWindow(listenSequenceWindow),
+		}
+		log.Printf("Listening to channel %d %s@%s  %v\n", i, address, util.StringIfEmpty(listenInterface, "default"), intf)
+	}
+
+	go xdpStatsPrinter(channels, listeners)
+
+	errs := make(chan error, len(listeners))
+	for i := range listeners {
+		go func(l *mcast.Listener, ch *xdpChannel) {
+			errs <- readXdp(l, ch)
+		}(listeners[i], channels[i])
+	}
+	return fmt.Errorf("ReadFromUDP failed: %w", <-errs)
+}
+
+// readXdp checks the sequence of the packets of the channel
+func readXdp(l *mcast.Listener, ch *xdpChannel) error {
+	group := l.Group()
+
+	return l.Read(func(p *mcast.Packet) {
+		buffer := p.Data
+		numBytes := len(buffer)
+		atomic.AddUint64(&xdpTotalNumPackets, 1)
+		atomic.AddUint64(&xdpTotalNumBytes, uint64(numBytes))
+
+		if !p.Dst.IsMulticast() || !p.Dst.Equal(group.IP) {
+			// unknown group, discard
+			return
+		}
+
+		atomic.AddUint64(&xdpNumPackets, 1)
+		atomic.AddUint64(&xdpNumBytes, uint64(numBytes))
+
+		header, err := xdp.ParsePacketHeader(buffer)
+		if err != nil {
+			log.Printf("Invalid packet from %v: %v\n", p.Src, err)
+			return
+		}
+		msgs, framingErr := xdp.Messages(buffer, &header)
+		atomic.AddUint64(&xdpNumMessages, uint64(len(msgs)))
+		if framingErr != nil {
+			atomic.AddUint64(&xdpNumDecodingErrors, 1)
+		}
+
+		if lat, outlier := xdpLatency.Record(uint64(ch.id), header.SendTimestamp(), p.Time); outlier {
+			log.Printf("Latency outlier on channel %d: seqNum %d, %v\n", ch.id, header.SeqNum, lat)
+		}
+
+		if listenDumpBytes {
+			log.Printf(strings.Repeat("-", 80))
+			log.Printf("addr: %v, numBytes: %d, channel: %d, deliveryFlag: %s, seqNum: %d, count: %d, sendTime: %v\n",
+				p.Src, numBytes, ch.id, xdp.FlagName(header.DeliveryFlag), header.SeqNum, header.Count, header.SendTimestamp().UTC())
+			dumpXdp(msgs)
+			if framingErr != nil {
+				log.Printf("XDP message framing failed: %v\n", framingErr)
+				util.DumpByteSlice(buffer)
+			}
+		}
+
+		window := ch.window
+		switch {
+		case header.Retransmission():
+			// original sequence numbers, re-sent on request
+			atomic.AddUint64(&xdpNumRetransmissions, 1)
+			return
+		case header.Refresh():
+			atomic.AddUint64(&xdpNumRefreshes, 1)
+			return
+		case header.DeliveryFlag == xdp.FlagSequenceReset:
+			atomic.AddUint64(&xdpNumResets, 1)
+			log.Printf("Sequence reset on channel %d from %d to %d\n", ch.id, window.Last(), header.SeqNum)
+			window.Reset()
+		case header.DeliveryFlag == xdp.FlagFailover:
+			atomic.AddUint64(&xdpNumFailovers, 1)
+			log.Printf("Publisher failover on channel %d: seqNum %d, last %d\n", ch.id, header.SeqNum, window.Last())
+		case header.Heartbeat():
+			atomic.AddUint64(&xdpNumHeartbeats, 1)
+			// the last sequence number sent reveals the messages lost on an
+			// idle channel
+			last := window.Last()
+			if missing := window.Skip(uint64(header.SeqNum)); missing > 0 {
+				atomic.AddUint64(&xdpNumMessagesOoO, missing)
+				atomic.StoreUint64(&ch.lastSeqNum, window.Last())
+				log.Printf("Out of sequence heartbeat: channel %d, %d -> %d [%d]\n", ch.id, last, header.SeqNum, missing)
+			}
+			return
+		}
+		if header.Count == 0 {
+			return
+		}
+
+		result, missing := window.AddRange(uint64(header.SeqNum), uint64(header.Count))
+		if result == sequence.Duplicate {
+			atomic.AddUint64(&xdpNumDuplicates, 1)
+			log.Printf("Duplicate message: channel %d, seqNum %d\n", ch.id, header.SeqNum)
+			return
+		}
+		atomic.StoreUint64(&ch.lastSeqNum, window.Last())
+
+		switch result {
+		case sequence.Gap:
+			atomic.AddUint64(&xdpNumMessagesOoO, missing)
+			log.Printf("Out of sequence message: channel %d, %d -> %d [%d]\n", ch.id, uint64(header.SeqNum)-missing-1, header.SeqNum, missing)
+		case sequence.Late, sequence.TooOld:
+			atomic.AddUint64(&xdpNumPacketsMessy, 1)
+			log.Printf("Messy message: channel %d, seqNum %d\n", ch.id, header.SeqNum)
+		}
+	})
+}
+
+// dumpXdp prints the message headers and the raw bytes of the messages
+func dumpXdp(msgs []xdp.Message) {
+	for i := range msgs {
+		fmt.Printf("%s [type %d, size %d]\n", msgs[i].Name(), msgs[i].Type, len(msgs[i].Data))
+		util.DumpByteSlice(msgs[i].Data[xdp.MessageHeaderSize:])
+	}
+}
+
+func init() {
+	listenXdpCmd.Flags().IntVar(&xdpLatencyOutlier, "latency-outlier", 1000, "Microseconds above the lowest latency of a channel for a packet to be logged as latency outlier (0 disables it)")
+	_ = viper.BindPFlag("latency-outlier", listenXdpCmd.Flags().Lookup("latency-outlier"))
+}
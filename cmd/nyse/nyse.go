@@ -0,0 +1,19 @@
+package nyse
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	NyseCmd = &cobra.Command{
+		Use:   "nyse",
+		Short: "NYSE Pillar XDP multicast commands",
+		Long:  ``,
+	}
+)
+
+func init() {
+	// Add subcommands here
+	NyseCmd.AddCommand(listenCmd)
+
+}
@@ -3,8 +3,17 @@ package cmd
 import (
 	"fmt"
 	"github.com/coalescent-labs/mcastmkt/cmd/any"
+	"github.com/coalescent-labs/mcastmkt/cmd/b3"
+	"github.com/coalescent-labs/mcastmkt/cmd/cboe"
+	"github.com/coalescent-labs/mcastmkt/cmd/cme"
+	"github.com/coalescent-labs/mcastmkt/cmd/doctor"
 	"github.com/coalescent-labs/mcastmkt/cmd/eurex"
 	"github.com/coalescent-labs/mcastmkt/cmd/euronext"
+	"github.com/coalescent-labs/mcastmkt/cmd/interfaces"
+	"github.com/coalescent-labs/mcastmkt/cmd/millennium"
+	"github.com/coalescent-labs/mcastmkt/cmd/mold"
+	"github.com/coalescent-labs/mcastmkt/cmd/nasdaq"
+	"github.com/coalescent-labs/mcastmkt/cmd/nyse"
 	"github.com/coalescent-labs/mcastmkt/pkg/version"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -36,8 +45,17 @@ func init() {
 
 	// Add subcommands here
 	mcastmktCmd.AddCommand(any.AnyCmd)
+	mcastmktCmd.AddCommand(b3.B3Cmd)
+	mcastmktCmd.AddCommand(cboe.CboeCmd)
+	mcastmktCmd.AddCommand(cme.CmeCmd)
+	mcastmktCmd.AddCommand(doctor.DoctorCmd)
 	mcastmktCmd.AddCommand(eurex.EurexCmd)
 	mcastmktCmd.AddCommand(euronext.EuronextCmd)
+	mcastmktCmd.AddCommand(interfaces.InterfacesCmd)
+	mcastmktCmd.AddCommand(millennium.MillenniumCmd)
+	mcastmktCmd.AddCommand(mold.MoldCmd)
+	mcastmktCmd.AddCommand(nasdaq.NasdaqCmd)
+	mcastmktCmd.AddCommand(nyse.NyseCmd)
 }
 
 func initConfig() {
@@ -0,0 +1,288 @@
+package book
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Side of a price level
+type Side int
+
+const (
+	Bid Side = iota
+	Ask
+)
+
+func (s Side) String() string {
+	if s == Bid {
+		return "Bid"
+	}
+	return "Ask"
+}
+
+// Level is an aggregated price level. Prices are integers scaled by the
+// exponent of the book: Price * 10^Exponent.
+type Level struct {
+	Price  int64
+	Qty    int64
+	Orders int64
+}
+
+type order struct {
+	side  Side
+	price int64
+	qty   int64
+}
+
+// Book is the depth book of an instrument, bids and asks best first. Levels
+// can be maintained by price (Set, Delete), by position (Insert, Update,
+// Remove, RemoveThru) as sent by market by price feeds, or aggregated from orders
+// (AddOrder, ModifyOrder, DeleteOrder) for market by order feeds.
+// A Book is not safe for concurrent use, see Books.
+type Book struct {
+	ID       uint64
+	Exponent int
+	// Stale is set when the book may have missed updates, e.g. after a
+	// sequence gap, until it's rebuilt from a snapshot
+	Stale bool
+	// Updated is the time of the last change
+	Updated time.Time
+	// Changes counts the updates applied to the book
+	Changes uint64
+
+	levels [2][]Level
+	orders map[uint64]order
+}
+
+// New returns an empty book
+func New(id uint64, exponent int) *Book {
+	return &Book{ID: id, Exponent: exponent}
+}
+
+func (b *Book) touch() {
+	b.Changes++
+	b.Updated = time.Now()
+}
+
+// better returns true when p1 is a better price than p2 for the side
+func better(side Side, p1, p2 int64) bool {
+	if side == Bid {
+		return p1 > p2
+	}
+	return p1 < p2
+}
+
+// find returns the position of the price in the side, or where to insert it
+func (b *Book) find(side Side, price int64) (int, bool) {
+	levels := b.levels[side]
+	i := sort.Search(len(levels), func(i int) bool { return !better(side, levels[i].Price, price) })
+	return i, i < len(levels) && levels[i].Price == price
+}
+
+// Set replaces the quantity and the number of orders of the price level,
+// deleting it when qty is not positive
+func (b *Book) Set(side Side, price, qty, orders int64) {
+	if qty <= 0 {
+		b.Delete(side, price)
+		return
+	}
+	i, found := b.find(side, price)
+	if found {
+		b.levels[side][i] = Level{Price: price, Qty: qty, Orders: orders}
+	} else {
+		b.levels[side] = append(b.levels[side], Level{})
+		copy(b.levels[side][i+1:], b.levels[side][i:])
+		b.levels[side][i] = Level{Price: price, Qty: qty, Orders: orders}
+	}
+	b.touch()
+}
+
+// Delete removes the price level
+func (b *Book) Delete(side Side, price int64) {
+	if i, found := b.find(side, price); found {
+		b.levels[side] = append(b.levels[side][:i], b.levels[side][i+1:]...)
+		b.touch()
+	}
+}
+
+// Insert adds a level at the position (1 for the best), shifting down the
+// following ones
+func (b *Book) Insert(side Side, position int, l Level) {
+	levels := b.levels[side]
+	i := position - 1
+	if i < 0 {
+		i = 0
+	}
+	if i > len(levels) {
+		i = len(levels)
+	}
+	levels = append(levels, Level{})
+	copy(levels[i+1:], levels[i:])
+	levels[i] = l
+	b.levels[side] = levels
+	b.touch()
+}
+
+// Update replaces the level at the position (1 for the best)
+func (b *Book) Update(side Side, position int, l Level) {
+	i := position - 1
+	if i < 0 || i >= len(b.levels[side]) {
+		// missing level, most likely a stale book
+		b.Insert(side, position, l)
+		return
+	}
+	b.levels[side][i] = l
+	b.touch()
+}
+
+// Remove deletes the level at the position (1 for the best), shifting up the
+// following ones
+func (b *Book) Remove(side Side, position int) {
+	i := position - 1
+	if i < 0 || i >= len(b.levels[side]) {
+		return
+	}
+	b.levels[side] = append(b.levels[side][:i], b.levels[side][i+1:]...)
+	b.touch()
+}
+
+// RemoveThru deletes the levels from the best one through the position,
+// shifting up the following ones
+func (b *Book) RemoveThru(side Side, position int) {
+	n := min(position, len(b.levels[side]))
+	if n <= 0 {
+		return
+	}
+	b.levels[side] = append(b.levels[side][:0], b.levels[side][n:]...)
+	b.touch()
+}
+
+// Truncate keeps only the first levels of the side
+func (b *Book) Truncate(side Side, levels int) {
+	if levels < 0 {
+		levels = 0
+	}
+	if levels < len(b.levels[side]) {
+		b.levels[side] = b.levels[side][:levels]
+		b.touch()
+	}
+}
+
+// AddOrder adds an order to its price level
+func (b *Book) AddOrder(id uint64, side Side, price, qty int64) {
+	if b.orders == nil {
+		b.orders = make(map[uint64]order)
+	}
+	if _, found := b.orders[id]; found {
+		b.DeleteOrder(id)
+	}
+	b.orders[id] = order{side: side, price: price, qty: qty}
+	b.addToLevel(side, price, qty, 1)
+}
+
+// ModifyOrder changes the price and the quantity of an order, returning
+// false when the order is unknown
+func (b *Book) ModifyOrder(id uint64, price, qty int64) bool {
+	o, found := b.orders[id]
+	if !found {
+		return false
+	}
+	b.addToLevel(o.side, o.price, -o.qty, -1)
+	o.price, o.qty = price, qty
+	b.orders[id] = o
+	b.addToLevel(o.side, price, qty, 1)
+	return true
+}
+
+// DeleteOrder removes an order, returning false when it's unknown
+func (b *Book) DeleteOrder(id uint64) bool {
+	o, found := b.orders[id]
+	if !found {
+		return false
+	}
+	delete(b.orders, id)
+	b.addToLevel(o.side, o.price, -o.qty, -1)
+	return true
+}
+
+func (b *Book) addToLevel(side Side, price, qty, orders int64) {
+	i, found := b.find(side, price)
+	if found {
+		l := b.levels[side][i]
+		b.Set(side, price, l.Qty+qty, l.Orders+orders)
+	} else {
+		b.Set(side, price, qty, orders)
+	}
+}
+
+// Clear removes all the levels and orders
+func (b *Book) Clear() {
+	b.levels[Bid] = b.levels[Bid][:0]
+	b.levels[Ask] = b.levels[Ask][:0]
+	b.orders = nil
+	b.touch()
+}
+
+// Depth returns the number of levels of the side
+func (b *Book) Depth(side Side) int { return len(b.levels[side]) }
+
+// Top returns a copy of the best levels of the side
+func (b *Book) Top(side Side, levels int) []Level {
+	if levels <= 0 || levels > len(b.levels[side]) {
+		levels = len(b.levels[side])
+	}
+	return append([]Level(nil), b.levels[side][:levels]...)
+}
+
+// FormatPrice returns the decimal representation of the scaled price
+func (b *Book) FormatPrice(price int64) string {
+	if b.Exponent >= 0 {
+		s := strconv.FormatInt(price, 10)
+		if price != 0 {
+			s += strings.Repeat("0", b.Exponent)
+		}
+		return s
+	}
+	neg := price < 0
+	if neg {
+		price = -price
+	}
+	s := strconv.FormatInt(price, 10)
+	decimals := -b.Exponent
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	s = s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// Render returns the best levels of both sides side by side
+func (b *Book) Render(levels int) string {
+	var sb strings.Builder
+	status := "ok"
+	if b.Stale {
+		status = "STALE"
+	}
+	fmt.Fprintf(&sb, "Book %d [%s] changes: %d, updated: %s, depth: %d/%d\n",
+		b.ID, status, b.Changes, b.Updated.Format("15:04:05.000000"), b.Depth(Bid), b.Depth(Ask))
+	fmt.Fprintf(&sb, "%8s %14s %16s | %-16s %14s %8s\n", "Orders", "Qty", "Bid", "Ask", "Qty", "Orders")
+	bids, asks := b.Top(Bid, levels), b.Top(Ask, levels)
+	for i := 0; i < len(bids) || i < len(asks); i++ {
+		if i < len(bids) {
+			fmt.Fprintf(&sb, "%8d %14d %16s | ", bids[i].Orders, bids[i].Qty, b.FormatPrice(bids[i].Price))
+		} else {
+			fmt.Fprintf(&sb, "%8s %14s %16s | ", "", "", "")
+		}
+		if i < len(asks) {
+			fmt.Fprintf(&sb, "%-16s %14d %8d", b.FormatPrice(asks[i].Price), asks[i].Qty, asks[i].Orders)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
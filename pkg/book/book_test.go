@@ -0,0 +1,143 @@
+package book
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func prices(b *Book, side Side) []int64 {
+	var p []int64
+	for _, l := range b.Top(side, 0) {
+		p = append(p, l.Price)
+	}
+	return p
+}
+
+func checkPrices(t *testing.T, b *Book, side Side, want ...int64) {
+	t.Helper()
+	if got := prices(b, side); !reflect.DeepEqual(got, want) {
+		t.Fatalf("%v prices %v, want %v", side, got, want)
+	}
+}
+
+func TestBookByPrice(t *testing.T) {
+	b := New(1, -2)
+	b.Set(Bid, 100, 5, 1)
+	b.Set(Bid, 102, 5, 1)
+	b.Set(Bid, 101, 5, 1)
+	b.Set(Ask, 105, 1, 1)
+	b.Set(Ask, 103, 1, 1)
+	checkPrices(t, b, Bid, 102, 101, 100)
+	checkPrices(t, b, Ask, 103, 105)
+
+	b.Set(Bid, 101, 7, 2)
+	if l := b.Top(Bid, 2)[1]; l != (Level{Price: 101, Qty: 7, Orders: 2}) {
+		t.Fatalf("updated level %+v", l)
+	}
+	b.Set(Bid, 101, 0, 0)
+	checkPrices(t, b, Bid, 102, 100)
+	b.Delete(Ask, 103)
+	b.Delete(Ask, 999)
+	checkPrices(t, b, Ask, 105)
+}
+
+func TestBookByPosition(t *testing.T) {
+	b := New(1, 0)
+	for i, p := range []int64{10, 9, 8, 7, 6} {
+		b.Insert(Bid, i+1, Level{Price: p, Qty: 1})
+	}
+	b.Insert(Bid, 1, Level{Price: 11, Qty: 1})
+	b.Insert(Bid, 99, Level{Price: 5, Qty: 1})
+	checkPrices(t, b, Bid, 11, 10, 9, 8, 7, 6, 5)
+
+	b.Update(Bid, 2, Level{Price: 10, Qty: 3})
+	if l := b.Top(Bid, 2)[1]; l.Qty != 3 {
+		t.Fatalf("updated level %+v", l)
+	}
+	b.Remove(Bid, 3)
+	checkPrices(t, b, Bid, 11, 10, 8, 7, 6, 5)
+	b.Remove(Bid, 0)
+	b.Remove(Bid, 7)
+	checkPrices(t, b, Bid, 11, 10, 8, 7, 6, 5)
+
+	// MDUpdateAction DeleteThru of the level 2
+	b.RemoveThru(Bid, 2)
+	checkPrices(t, b, Bid, 8, 7, 6, 5)
+	b.RemoveThru(Bid, 0)
+	checkPrices(t, b, Bid, 8, 7, 6, 5)
+	// DeleteFrom the level 3
+	b.Truncate(Bid, 2)
+	checkPrices(t, b, Bid, 8, 7)
+	b.RemoveThru(Bid, 10)
+	checkPrices(t, b, Bid)
+	if b.Depth(Bid) != 0 {
+		t.Fatalf("depth %d after RemoveThru past the last level", b.Depth(Bid))
+	}
+}
+
+func TestBookByOrder(t *testing.T) {
+	b := New(1, 0)
+	b.AddOrder(1, Bid, 100, 10)
+	b.AddOrder(2, Bid, 100, 5)
+	b.AddOrder(3, Bid, 99, 1)
+	b.AddOrder(4, Ask, 101, 2)
+	if l := b.Top(Bid, 1)[0]; l != (Level{Price: 100, Qty: 15, Orders: 2}) {
+		t.Fatalf("aggregated level %+v", l)
+	}
+	if !b.ModifyOrder(2, 99, 4) {
+		t.Fatal("ModifyOrder of a known order failed")
+	}
+	if got := b.Top(Bid, 0); !reflect.DeepEqual(got, []Level{{100, 10, 1}, {99, 5, 2}}) {
+		t.Fatalf("levels after modify %+v", got)
+	}
+	if !b.DeleteOrder(1) || b.DeleteOrder(1) || b.ModifyOrder(1, 1, 1) {
+		t.Fatal("unknown order modified or deleted")
+	}
+	checkPrices(t, b, Bid, 99)
+	// the same id again replaces the order
+	b.AddOrder(4, Ask, 102, 3)
+	if got := b.Top(Ask, 0); !reflect.DeepEqual(got, []Level{{102, 3, 1}}) {
+		t.Fatalf("asks after re-adding an order %+v", got)
+	}
+	b.Clear()
+	if b.Depth(Bid) != 0 || b.Depth(Ask) != 0 || b.DeleteOrder(3) {
+		t.Fatal("levels or orders left after Clear")
+	}
+}
+
+func TestFormatPrice(t *testing.T) {
+	tests := []struct {
+		exponent int
+		price    int64
+		want     string
+	}{
+		{-2, 12345, "123.45"},
+		{-4, 5, "0.0005"},
+		{-2, -5, "-0.05"},
+		{0, 42, "42"},
+		{2, 42, "4200"},
+		{2, 0, "0"},
+	}
+	for _, tt := range tests {
+		if got := New(1, tt.exponent).FormatPrice(tt.price); got != tt.want {
+			t.Errorf("FormatPrice(%d) with exponent %d = %s, want %s", tt.price, tt.exponent, got, tt.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	b := New(7, -1)
+	b.Set(Bid, 995, 10, 2)
+	b.Set(Ask, 1005, 3, 1)
+	b.Set(Ask, 1010, 4, 1)
+	b.Stale = true
+	out := b.Render(5)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[0], "Book 7 [STALE]") || !strings.Contains(lines[0], "depth: 1/2") {
+		t.Fatalf("render\n%s", out)
+	}
+	if !strings.Contains(lines[2], "99.5") || !strings.Contains(lines[2], "100.5") || !strings.Contains(lines[3], "101.0") {
+		t.Fatalf("render\n%s", out)
+	}
+}
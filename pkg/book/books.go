@@ -0,0 +1,229 @@
+package book
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Books are the books of the instruments of a feed. Books created while the
+// feed is not synchronized, and all of them after a gap, are stale until a
+// complete snapshot cycle (or a start of day) rebuilds them.
+// Books is safe for concurrent use.
+type Books struct {
+	mu       sync.RWMutex
+	exponent int
+	books    map[uint64]*Book
+	synced   bool
+	// refreshed are the books rebuilt by the snapshot cycle in progress
+	refreshed map[uint64]bool
+	cycle     bool
+	// optiq are the field names of the Optiq MDG messages
+	optiq OptiqFields
+}
+
+// NewBooks returns an empty, not synchronized, set of books whose prices
+// are scaled by 10^exponent
+func NewBooks(exponent int) *Books {
+	return &Books{
+		exponent: exponent,
+		books:    make(map[uint64]*Book),
+		optiq:    DefaultOptiqFields,
+	}
+}
+
+// book returns the book of the instrument creating it. The lock must be held.
+func (bs *Books) book(id uint64) *Book {
+	b, ok := bs.books[id]
+	if !ok {
+		b = New(id, bs.exponent)
+		b.Stale = !bs.synced
+		bs.books[id] = b
+	}
+	return b
+}
+
+// Update calls f with the book of the instrument, holding the lock
+func (bs *Books) Update(id uint64, f func(b *Book)) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	f(bs.book(id))
+}
+
+// Snapshot calls f with the book of the instrument, holding the lock, when
+// it's being rebuilt by the snapshot cycle in progress. The book is cleared
+// before its first snapshot message. Books which are not stale are already
+// up to date and left alone.
+func (bs *Books) Snapshot(id uint64, f func(b *Book)) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if !bs.cycle {
+		return
+	}
+	b := bs.book(id)
+	if !b.Stale {
+		return
+	}
+	if !bs.refreshed[id] {
+		b.Clear()
+		bs.refreshed[id] = true
+	}
+	f(b)
+}
+
+// View calls f with the book of the instrument, nil when unknown, holding
+// the read lock
+func (bs *Books) View(id uint64, f func(b *Book)) {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	f(bs.books[id])
+}
+
+// Len returns the number of books and of stale books
+func (bs *Books) Len() (int, int) {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	stale := 0
+	for _, b := range bs.books {
+		if b.Stale {
+			stale++
+		}
+	}
+	return len(bs.books), stale
+}
+
+// Synced returns true when the books are not stale
+func (bs *Books) Synced() bool {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	return bs.synced
+}
+
+// MarkStale flags all the books as stale after a loss of updates
+func (bs *Books) MarkStale() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.synced = false
+	for _, b := range bs.books {
+		b.Stale = true
+	}
+}
+
+// StartOfDay clears all the books: they are empty, and up to date, when the
+// trading day starts
+func (bs *Books) StartOfDay() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.synced = true
+	for _, b := range bs.books {
+		b.Clear()
+		b.Stale = false
+	}
+}
+
+// StartSnapshot begins a snapshot cycle, abandoning the one in progress
+func (bs *Books) StartSnapshot() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.cycle = true
+	bs.refreshed = make(map[uint64]bool)
+}
+
+// AbortSnapshot abandons the snapshot cycle in progress, e.g. after a gap
+// in the snapshot stream: the books it was rebuilding stay stale
+func (bs *Books) AbortSnapshot() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.cycle = false
+	bs.refreshed = nil
+}
+
+// EndSnapshot completes the snapshot cycle in progress: the rebuilt books
+// are up to date and the stale books missing from the snapshot are empty.
+// It returns the number of rebuilt books.
+func (bs *Books) EndSnapshot() int {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if !bs.cycle {
+		return 0
+	}
+	for id, b := range bs.books {
+		if !b.Stale {
+			continue
+		}
+		if !bs.refreshed[id] {
+			b.Clear()
+		}
+		b.Stale = false
+	}
+	n := len(bs.refreshed)
+	bs.synced = true
+	bs.cycle = false
+	bs.refreshed = nil
+	return n
+}
+
+type jsonLevel struct {
+	Price  string `json:"price"`
+	Qty    int64  `json:"qty"`
+	Orders int64  `json:"orders,omitempty"`
+}
+
+type jsonBook struct {
+	ID      uint64      `json:"id"`
+	Stale   bool        `json:"stale"`
+	Updated time.Time   `json:"updated"`
+	Changes uint64      `json:"changes"`
+	Bids    []jsonLevel `json:"bids"`
+	Asks    []jsonLevel `json:"asks"`
+}
+
+func (b *Book) toJSON() jsonBook {
+	jb := jsonBook{
+		ID:      b.ID,
+		Stale:   b.Stale,
+		Updated: b.Updated,
+		Changes: b.Changes,
+		Bids:    []jsonLevel{},
+		Asks:    []jsonLevel{},
+	}
+	for _, l := range b.levels[Bid] {
+		jb.Bids = append(jb.Bids, jsonLevel{Price: b.FormatPrice(l.Price), Qty: l.Qty, Orders: l.Orders})
+	}
+	for _, l := range b.levels[Ask] {
+		jb.Asks = append(jb.Asks, jsonLevel{Price: b.FormatPrice(l.Price), Qty: l.Qty, Orders: l.Orders})
+	}
+	return jb
+}
+
+// MarshalJSON returns the book with its decimal prices
+func (b *Book) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.toJSON())
+}
+
+// WriteJSON writes all the books, ordered by instrument, as a JSON array
+func (bs *Books) WriteJSON(w io.Writer) error {
+	bs.mu.RLock()
+	books := make([]jsonBook, 0, len(bs.books))
+	for _, b := range bs.books {
+		books = append(books, b.toJSON())
+	}
+	bs.mu.RUnlock()
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(books)
+}
+
+// Export writes the books as JSON to the file, replacing it atomically
+func (bs *Books) Export(path string) error {
+	if err := util.WriteFileAtomic(path, bs.WriteJSON); err != nil {
+		return fmt.Errorf("failed to export books: %w", err)
+	}
+	return nil
+}
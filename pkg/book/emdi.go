@@ -0,0 +1,313 @@
+package book
+
+import (
+	"github.com/coalescent-labs/mcastmkt/pkg/fast"
+	"strings"
+)
+
+// MDUpdateAction and MDEntryType values of the EMDI depth messages
+const (
+	emdiActionNew        = 0
+	emdiActionChange     = 1
+	emdiActionDelete     = 2
+	emdiActionDeleteThru = 3
+	emdiActionDeleteFrom = 4
+	emdiActionOverlay    = 5
+
+	emdiEntryBid   = 0
+	emdiEntryOffer = 1
+
+	// emdiMaxBuffered is the number of incremental entries buffered per
+	// instrument while waiting for its snapshot
+	emdiMaxBuffered = 10000
+)
+
+type emdiEntry struct {
+	seq   uint64
+	entry fast.Group
+}
+
+type emdiInstrument struct {
+	stream uint64
+	synced bool
+	// lastSeq is the MsgSeqNum of the last incremental applied to the book
+	lastSeq  uint64
+	buffered []emdiEntry
+	overflow bool
+}
+
+type emdiStream struct {
+	// since is the first MsgSeqNum received without gap up to next
+	since uint64
+	next  uint64
+}
+
+// EmdiStats are the EMDI synchronization counters since the previous SwapStats
+type EmdiStats struct {
+	// Synced is the number of books synchronized from a snapshot
+	Synced uint64
+	// Gaps is the number of MsgSeqNum gaps, each making the books of the stream stale
+	Gaps uint64
+	// Skipped is the number of snapshots too old to synchronize a book
+	Skipped uint64
+}
+
+// EmdiSync maintains the books per SecurityID from decoded Eurex EMDI
+// DepthSnapshot and DepthIncremental messages. The incrementals of a stale
+// book are buffered until a snapshot whose LastMsgSeqNumProcessed is covered
+// by the incrementals received without gap, then the snapshot and the
+// buffered incrementals after it are applied. A gap in the MsgSeqNum of a
+// stream (a product) makes all its books stale.
+// An EmdiSync is not safe for concurrent use, the books it maintains are.
+type EmdiSync struct {
+	Books       *Books
+	instruments map[uint64]*emdiInstrument
+	streams     map[uint64]*emdiStream
+	stats       EmdiStats
+}
+
+// NewEmdiSync returns a synchronizer of books whose prices are scaled by
+// 10^exponent
+func NewEmdiSync(exponent int) *EmdiSync {
+	return &EmdiSync{
+		Books:       NewBooks(exponent),
+		instruments: make(map[uint64]*emdiInstrument),
+		streams:     make(map[uint64]*emdiStream),
+	}
+}
+
+// SwapStats returns the counters and resets them
+func (s *EmdiSync) SwapStats() EmdiStats {
+	stats := s.stats
+	s.stats = EmdiStats{}
+	return stats
+}
+
+func (s *EmdiSync) instrument(id uint64, stream uint64) *emdiInstrument {
+	i, ok := s.instruments[id]
+	if !ok {
+		i = &emdiInstrument{stream: stream}
+		s.instruments[id] = i
+	}
+	return i
+}
+
+// Apply applies a DepthSnapshot or DepthIncremental message. The stream is
+// the scope of the MsgSeqNum of the incrementals, its MarketSegmentID when
+// the message has it. It returns the number of applied entries.
+func (s *EmdiSync) Apply(m *fast.Message, stream uint64) int {
+	if id, ok := m.Fields.Uint("MarketSegmentID"); ok {
+		stream = id
+	}
+	name := strings.ToLower(m.Name)
+	switch {
+	case strings.Contains(name, "depthsnapshot"):
+		return s.snapshot(m, stream)
+	case strings.Contains(name, "depthincremental"):
+		return s.incremental(m, stream)
+	}
+	return 0
+}
+
+func (s *EmdiSync) incremental(m *fast.Message, stream uint64) int {
+	seq, ok := m.Fields.Uint("MsgSeqNum")
+	if !ok {
+		return 0
+	}
+	st, ok := s.streams[stream]
+	if !ok {
+		st = &emdiStream{since: seq, next: seq}
+		s.streams[stream] = st
+	}
+	if seq < st.next {
+		// duplicate
+		return 0
+	}
+	if seq > st.next {
+		s.stats.Gaps++
+		s.staleStream(stream)
+		st.since = seq
+	}
+	st.next = seq + 1
+
+	applied := 0
+	securityID, _ := m.Fields.Uint("SecurityID")
+	for _, e := range emdiEntries(m.Fields) {
+		id, ok := e.Uint("SecurityID")
+		if !ok {
+			id = securityID
+		}
+		i := s.instrument(id, stream)
+		if !i.synced {
+			if len(i.buffered) < emdiMaxBuffered {
+				i.buffered = append(i.buffered, emdiEntry{seq: seq, entry: e})
+			} else {
+				i.overflow = true
+			}
+			continue
+		}
+		if seq <= i.lastSeq {
+			// already in the snapshot the book was synchronized from
+			continue
+		}
+		s.Books.Update(id, func(b *Book) {
+			if emdiApplyIncremental(b, e) {
+				applied++
+			}
+		})
+		i.lastSeq = seq
+	}
+	return applied
+}
+
+// staleStream marks the books of the stream stale, dropping their buffers
+func (s *EmdiSync) staleStream(stream uint64) {
+	for id, i := range s.instruments {
+		if i.stream != stream {
+			continue
+		}
+		i.synced = false
+		i.buffered = nil
+		i.overflow = false
+		s.Books.Update(id, func(b *Book) { b.Stale = true })
+	}
+}
+
+func (s *EmdiSync) snapshot(m *fast.Message, stream uint64) int {
+	id, ok := m.Fields.Uint("SecurityID")
+	if !ok {
+		return 0
+	}
+	i := s.instrument(id, stream)
+	if i.synced {
+		return 0
+	}
+	last, _ := m.Fields.Uint("LastMsgSeqNumProcessed")
+	// the incrementals following the snapshot must all have been received
+	st, ok := s.streams[i.stream]
+	if i.overflow || (ok && last+1 < st.since) {
+		s.stats.Skipped++
+		return 0
+	}
+
+	applied := 0
+	s.Books.Update(id, func(b *Book) {
+		b.Clear()
+		for _, e := range emdiEntries(m.Fields) {
+			if emdiApplySnapshot(b, e) {
+				applied++
+			}
+		}
+		for _, be := range i.buffered {
+			if be.seq > last && emdiApplyIncremental(b, be.entry) {
+				applied++
+			}
+		}
+		b.Stale = false
+	})
+	i.lastSeq = last
+	if n := len(i.buffered); n > 0 && i.buffered[n-1].seq > last {
+		i.lastSeq = i.buffered[n-1].seq
+	}
+	i.buffered = nil
+	i.synced = true
+	s.stats.Synced++
+	return applied
+}
+
+// emdiEntries returns the elements of the first sequence of the message
+func emdiEntries(g fast.Group) []fast.Group {
+	for _, v := range g {
+		if entries, ok := v.Value.([]fast.Group); ok {
+			return entries
+		}
+	}
+	return nil
+}
+
+func emdiApplySnapshot(b *Book, e fast.Group) bool {
+	side, l, ok := emdiLevel(b, e)
+	if !ok {
+		return false
+	}
+	if position, ok := e.Int("MDPriceLevel"); ok && position > 0 {
+		b.Insert(side, int(position), l)
+	} else {
+		b.Set(side, l.Price, l.Qty, l.Orders)
+	}
+	return true
+}
+
+func emdiApplyIncremental(b *Book, e fast.Group) bool {
+	side, l, ok := emdiLevel(b, e)
+	if !ok {
+		return false
+	}
+	action, _ := emdiInt(e, "MDUpdateAction")
+	position, hasPosition := e.Int("MDPriceLevel")
+	if !hasPosition {
+		// market by price without positions
+		switch action {
+		case emdiActionDelete:
+			b.Delete(side, l.Price)
+		default:
+			b.Set(side, l.Price, l.Qty, l.Orders)
+		}
+		return true
+	}
+
+	switch action {
+	case emdiActionNew:
+		b.Insert(side, int(position), l)
+	case emdiActionChange, emdiActionOverlay:
+		b.Update(side, int(position), l)
+	case emdiActionDelete:
+		b.Remove(side, int(position))
+	case emdiActionDeleteThru:
+		b.RemoveThru(side, int(position))
+	case emdiActionDeleteFrom:
+		b.Truncate(side, int(position)-1)
+	default:
+		return false
+	}
+	return true
+}
+
+// emdiLevel returns the side and the level of a bid or offer entry
+func emdiLevel(b *Book, e fast.Group) (Side, Level, bool) {
+	entryType, ok := emdiInt(e, "MDEntryType")
+	if !ok {
+		return Bid, Level{}, false
+	}
+	side := Bid
+	switch entryType {
+	case emdiEntryBid:
+	case emdiEntryOffer:
+		side = Ask
+	default:
+		// trades, implied levels, statistics...
+		return Bid, Level{}, false
+	}
+	var l Level
+	if px, ok := e.Decimal("MDEntryPx"); ok {
+		l.Price = rescale(px.Mantissa, int(px.Exponent), b.Exponent)
+	}
+	if size, ok := e.Decimal("MDEntrySize"); ok {
+		l.Qty = rescale(size.Mantissa, int(size.Exponent), 0)
+	} else {
+		l.Qty, _ = e.Int("MDEntrySize")
+	}
+	l.Orders, _ = e.Int("NumberOfOrders")
+	return side, l, true
+}
+
+// emdiInt returns an integer field, also when encoded as an ASCII digit
+func emdiInt(g fast.Group, name string) (int64, bool) {
+	if i, ok := g.Int(name); ok {
+		return i, true
+	}
+	if s, ok := g.String(name); ok && len(s) == 1 && s[0] >= '0' && s[0] <= '9' {
+		return int64(s[0] - '0'), true
+	}
+	return 0, false
+}
@@ -0,0 +1,111 @@
+package book
+
+import (
+	"github.com/coalescent-labs/mcastmkt/pkg/fast"
+	"testing"
+)
+
+// emdiLevelEntry returns a bid level entry: action, price (2 decimals), size and
+// position
+func emdiLevelEntry(securityID uint64, action uint64, price int64, size int64, position int64) fast.Group {
+	return fast.Group{
+		{Name: "SecurityID", Value: securityID},
+		{Name: "MDUpdateAction", Value: action},
+		{Name: "MDEntryType", Value: uint64(emdiEntryBid)},
+		{Name: "MDEntryPx", Value: fast.Decimal{Mantissa: price, Exponent: -2}},
+		{Name: "MDEntrySize", Value: fast.Decimal{Mantissa: size}},
+		{Name: "MDPriceLevel", Value: position},
+	}
+}
+
+func emdiIncremental(seq uint64, entries ...fast.Group) *fast.Message {
+	return &fast.Message{Name: "DepthIncremental", Fields: fast.Group{
+		{Name: "MsgSeqNum", Value: seq},
+		{Name: "MarketSegmentID", Value: uint64(5)},
+		{Name: "MDIncGrp", Value: entries},
+	}}
+}
+
+func emdiSnapshot(securityID uint64, last uint64, entries ...fast.Group) *fast.Message {
+	return &fast.Message{Name: "DepthSnapshot", Fields: fast.Group{
+		{Name: "SecurityID", Value: securityID},
+		{Name: "LastMsgSeqNumProcessed", Value: last},
+		{Name: "MarketSegmentID", Value: uint64(5)},
+		{Name: "MDSshGrp", Value: entries},
+	}}
+}
+
+func emdiBids(t *testing.T, s *EmdiSync, id uint64, want ...int64) {
+	t.Helper()
+	s.Books.View(id, func(b *Book) {
+		if b == nil {
+			t.Fatalf("book %d missing", id)
+		}
+		checkPrices(t, b, Bid, want...)
+	})
+}
+
+func TestEmdiSync(t *testing.T) {
+	s := NewEmdiSync(-2)
+	// buffered until the snapshot
+	s.Apply(emdiIncremental(10, emdiLevelEntry(1, emdiActionNew, 1000, 1, 1)), 0)
+	s.Apply(emdiIncremental(11, emdiLevelEntry(1, emdiActionNew, 1010, 1, 1)), 0)
+
+	// the snapshot has the incremental 10, the buffered 11 is applied on top
+	n := s.Apply(emdiSnapshot(1, 10, emdiLevelEntry(1, 0, 1000, 1, 1), emdiLevelEntry(1, 0, 990, 1, 2)), 0)
+	if n != 3 {
+		t.Fatalf("snapshot applied %d entries, want 3", n)
+	}
+	emdiBids(t, s, 1, 1010, 1000, 990)
+	if n := s.Apply(emdiSnapshot(1, 11, emdiLevelEntry(1, 0, 1, 1, 1)), 0); n != 0 {
+		t.Fatalf("snapshot of a synchronized book applied %d entries", n)
+	}
+
+	// a snapshot ahead of the incrementals, which are skipped up to its
+	// LastMsgSeqNumProcessed
+	s.Apply(emdiIncremental(12, emdiLevelEntry(2, emdiActionNew, 500, 1, 1)), 0)
+	s.Apply(emdiSnapshot(2, 14, emdiLevelEntry(2, 0, 520, 1, 1), emdiLevelEntry(2, 0, 510, 1, 2), emdiLevelEntry(2, 0, 500, 1, 3)), 0)
+	s.Apply(emdiIncremental(13, emdiLevelEntry(2, emdiActionNew, 510, 1, 2)), 0)
+	s.Apply(emdiIncremental(14, emdiLevelEntry(2, emdiActionNew, 520, 1, 1)), 0)
+	emdiBids(t, s, 2, 520, 510, 500)
+	s.Apply(emdiIncremental(15, emdiLevelEntry(2, emdiActionNew, 530, 1, 1)), 0)
+	emdiBids(t, s, 2, 530, 520, 510, 500)
+
+	// DeleteThru the level 2, DeleteFrom the level 2
+	s.Apply(emdiIncremental(16, emdiLevelEntry(2, emdiActionDeleteThru, 0, 0, 2)), 0)
+	emdiBids(t, s, 2, 510, 500)
+	s.Apply(emdiIncremental(17, emdiLevelEntry(2, emdiActionDeleteFrom, 0, 0, 2)), 0)
+	emdiBids(t, s, 2, 510)
+	// duplicate MsgSeqNum
+	if n := s.Apply(emdiIncremental(17, emdiLevelEntry(2, emdiActionDelete, 0, 0, 1)), 0); n != 0 {
+		t.Fatalf("duplicate applied %d entries", n)
+	}
+
+	stats := s.SwapStats()
+	if stats.Synced != 2 || stats.Gaps != 0 || stats.Skipped != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestEmdiSyncGap(t *testing.T) {
+	s := NewEmdiSync(-2)
+	s.Apply(emdiIncremental(1), 0)
+	s.Apply(emdiSnapshot(1, 1, emdiLevelEntry(1, 0, 1000, 1, 1)), 0)
+	// the gap makes the books of the stream stale
+	s.Apply(emdiIncremental(5, emdiLevelEntry(1, emdiActionNew, 1010, 1, 1)), 0)
+	s.Books.View(1, func(b *Book) {
+		if !b.Stale {
+			t.Fatal("book not stale after a gap")
+		}
+	})
+	// older than the incrementals received since the gap
+	if n := s.Apply(emdiSnapshot(1, 3, emdiLevelEntry(1, 0, 1, 1, 1)), 0); n != 0 {
+		t.Fatalf("snapshot older than the gap applied %d entries", n)
+	}
+	s.Apply(emdiSnapshot(1, 4, emdiLevelEntry(1, 0, 1000, 1, 1)), 0)
+	emdiBids(t, s, 1, 1010, 1000)
+	stats := s.SwapStats()
+	if stats.Synced != 2 || stats.Gaps != 1 || stats.Skipped != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
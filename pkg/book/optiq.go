@@ -0,0 +1,421 @@
+package book
+
+import (
+	"errors"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/sbe"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// OptiqFields are the names, as spelled by the loaded schema, of the fields
+// of the Optiq MDG MarketUpdate and OrderUpdate messages applied to the books.
+// The optional fields not found in the schema are empty.
+type OptiqFields struct {
+	SymbolIndex string
+	// SeqNum is the sequence number of the real-time messages, SnapshotSeqNum
+	// the last one included in a snapshot cycle (see OptiqRecovery)
+	SeqNum         string
+	SnapshotSeqNum string
+	// MarketUpdate entries
+	UpdateAction string
+	EntryType    string
+	EntryPrice   string
+	EntryQty     string
+	Orders       string
+	PriceLevel   string
+	// OrderUpdate entries
+	OrderID     string
+	OrderAction string
+	OrderSide   string
+	OrderPrice  string
+	OrderQty    string
+}
+
+// DefaultOptiqFields are the field names of the Euronext Optiq MDG schema
+var DefaultOptiqFields = OptiqFields{
+	SymbolIndex:    "SymbolIndex",
+	SeqNum:         "MDSeqNum",
+	SnapshotSeqNum: "LastMDSeqNum",
+	UpdateAction:   "MDUpdateAction",
+	EntryType:      "MDEntryType",
+	EntryPrice:     "MDEntryPx",
+	EntryQty:       "MDEntrySize",
+	Orders:         "NumberOfOrders",
+	PriceLevel:     "MDPriceLevel",
+	OrderID:        "OrderID",
+	OrderAction:    "ActionType",
+	OrderSide:      "OrderSide",
+	OrderPrice:     "OrderPx",
+	OrderQty:       "OrderQuantity",
+}
+
+// optiqField is a field of OptiqFields with its names in the different
+// versions of the schema, by order of preference
+type optiqField struct {
+	name     *string
+	aliases  []string
+	required bool
+}
+
+func (f *OptiqFields) marketFields() []optiqField {
+	return []optiqField{
+		{&f.SeqNum, []string{"MDSeqNum", "MsgSeqNum"}, true},
+		{&f.SymbolIndex, []string{"SymbolIndex"}, true},
+		{&f.UpdateAction, []string{"MDUpdateAction", "UpdateAction"}, true},
+		{&f.EntryType, []string{"MDEntryType", "EntryType"}, true},
+		{&f.EntryPrice, []string{"MDEntryPx", "MDEntryPrice", "Price"}, true},
+		{&f.EntryQty, []string{"MDEntrySize", "MDEntryQty", "Qty", "Quantity"}, true},
+		{&f.Orders, []string{"NumberOfOrders", "NumberOfOrder", "MDEntryNumberOfOrders"}, false},
+		{&f.PriceLevel, []string{"MDPriceLevel", "PriceLevel"}, false},
+	}
+}
+
+func (f *OptiqFields) orderFields() []optiqField {
+	return []optiqField{
+		{&f.OrderID, []string{"OrderID"}, true},
+		{&f.OrderAction, []string{"ActionType", "OrderActionType", "MDUpdateAction"}, true},
+		{&f.OrderSide, []string{"OrderSide", "Side"}, true},
+		{&f.OrderPrice, []string{"OrderPx", "OrderPrice", "Price"}, true},
+		{&f.OrderQty, []string{"OrderQuantity", "OrderQty", "Qty", "Quantity"}, true},
+	}
+}
+
+func (f *OptiqFields) snapshotFields() []optiqField {
+	return []optiqField{
+		{&f.SnapshotSeqNum, []string{"LastMDSeqNum", "LastMsgSeqNum", "LastSeqNum"}, false},
+	}
+}
+
+// ResolveOptiqFields returns the names of the fields applied to the books in
+// the MarketUpdate and, when defined, OrderUpdate and StartOfSnapshot messages
+// of the schema. It fails when a message lacks one of the fields required to
+// build its books.
+func ResolveOptiqFields(s *sbe.Schema) (OptiqFields, error) {
+	var f OptiqFields
+	var market, order, snapshot *sbe.MessageDef
+	for _, m := range s.Messages() {
+		switch {
+		case sameName(m.Name, "MarketUpdate"):
+			market = m
+		case sameName(m.Name, "OrderUpdate"):
+			order = m
+		case sameName(m.Name, "StartOfSnapshot"):
+			snapshot = m
+		}
+	}
+	if market == nil {
+		return f, errors.New("no MarketUpdate message in the Optiq MDG schema")
+	}
+	var missing []string
+	missing = resolveOptiqFields(market, f.marketFields(), missing)
+	if order != nil {
+		// the books of both messages are keyed by the same SymbolIndex,
+		// looked up whatever its spelling
+		var symbolIndex string
+		missing = resolveOptiqFields(order, append(f.orderFields(), optiqField{&symbolIndex, []string{"SymbolIndex"}, true}), missing)
+	}
+	if snapshot != nil {
+		missing = resolveOptiqFields(snapshot, f.snapshotFields(), missing)
+	}
+	if len(missing) > 0 {
+		return f, fmt.Errorf("fields required to build the books not found in the Optiq MDG schema: %s", strings.Join(missing, ", "))
+	}
+	return f, nil
+}
+
+// resolveOptiqFields sets the fields to the first of their aliases found in
+// the message, or its entries, appending the required ones not found to
+// missing as Message.Alias1|Alias2
+func resolveOptiqFields(m *sbe.MessageDef, fields []optiqField, missing []string) []string {
+	names := blockNames(&m.Block, nil)
+	for _, f := range fields {
+		*f.name = ""
+		for _, alias := range f.aliases {
+			for _, name := range names {
+				if sameName(name, alias) {
+					*f.name = name
+					break
+				}
+			}
+			if *f.name != "" {
+				break
+			}
+		}
+		if *f.name == "" && f.required {
+			missing = append(missing, m.Name+"."+strings.Join(f.aliases, "|"))
+		}
+	}
+	return missing
+}
+
+// blockNames appends the names of the fields of the block and its groups
+func blockNames(b *sbe.Block, names []string) []string {
+	for _, f := range b.Fields {
+		names = append(names, f.Name)
+	}
+	for _, g := range b.Groups {
+		names = blockNames(&g.Block, names)
+	}
+	return names
+}
+
+// sameName returns true when the names only differ by their case and
+// underscores, as sbe.Group.Lookup compares them
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.ReplaceAll(a, "_", ""), strings.ReplaceAll(b, "_", ""))
+}
+
+// SetOptiqFields sets the names of the fields of the Optiq MDG messages,
+// DefaultOptiqFields by default. It must be called before applying messages.
+func (bs *Books) SetOptiqFields(f OptiqFields) {
+	bs.optiq = f
+}
+
+// ApplyOptiq applies the entries of a decoded Optiq MDG MarketUpdate (market
+// by price) or OrderUpdate (market by order) message to the books of their
+// SymbolIndex. Messages of a snapshot cycle only rebuild the stale books (see
+// Snapshot). It returns the number of applied entries.
+func (bs *Books) ApplyOptiq(m *sbe.Message, snapshot bool) int {
+	name := strings.ToLower(m.Name)
+	isOrder := strings.Contains(name, "order")
+	if !isOrder && !strings.Contains(name, "market") {
+		return 0
+	}
+
+	// the updates are in a repeating group, or in the message itself
+	entries := []sbe.Group{m.Fields}
+	for _, v := range m.Fields {
+		if g, ok := v.Value.([]sbe.Group); ok {
+			entries = g
+			break
+		}
+	}
+
+	applied := 0
+	for _, e := range entries {
+		symbol, ok := optiqUint(e, bs.optiq.SymbolIndex)
+		if !ok {
+			continue
+		}
+		apply := func(b *Book) {
+			var done bool
+			if isOrder {
+				done = bs.applyOptiqOrder(b, e)
+			} else {
+				done = bs.applyOptiqLevel(b, e)
+			}
+			if done {
+				applied++
+			}
+		}
+		if snapshot {
+			bs.Snapshot(symbol, apply)
+		} else {
+			bs.Update(symbol, apply)
+		}
+	}
+	return applied
+}
+
+func (bs *Books) applyOptiqLevel(b *Book, e sbe.Group) bool {
+	side, ok := optiqSide(optiqGet(e, bs.optiq.EntryType), "0", "1")
+	if !ok {
+		// trades, statistics...
+		return false
+	}
+	action := optiqAction(optiqGet(e, bs.optiq.UpdateAction))
+	price, hasPrice := optiqPrice(optiqGet(e, bs.optiq.EntryPrice), bs.exponent)
+	qty, _ := optiqInt(e, bs.optiq.EntryQty)
+	orders, _ := optiqInt(e, bs.optiq.Orders)
+	position, _ := optiqInt(e, bs.optiq.PriceLevel)
+
+	switch action {
+	case "new", "change", "overlay":
+		if !hasPrice {
+			return false
+		}
+		b.Set(side, price, qty, orders)
+	case "delete":
+		if hasPrice {
+			b.Delete(side, price)
+		} else if position > 0 {
+			b.Remove(side, int(position))
+		}
+	case "deletethru":
+		b.RemoveThru(side, int(position))
+	case "deleteall":
+		b.Truncate(side, 0)
+	case "deletefrom":
+		b.Truncate(side, int(position)-1)
+	default:
+		return false
+	}
+	return true
+}
+
+func (bs *Books) applyOptiqOrder(b *Book, e sbe.Group) bool {
+	action := optiqAction(optiqGet(e, bs.optiq.OrderAction))
+	if action == "deleteall" {
+		b.Clear()
+		return true
+	}
+	id, ok := optiqUint(e, bs.optiq.OrderID)
+	if !ok {
+		return false
+	}
+	price, _ := optiqPrice(optiqGet(e, bs.optiq.OrderPrice), bs.exponent)
+	qty, _ := optiqInt(e, bs.optiq.OrderQty)
+
+	switch action {
+	case "new", "retransmission":
+		side, ok := optiqSide(optiqGet(e, bs.optiq.OrderSide), "1", "2")
+		if !ok {
+			return false
+		}
+		b.AddOrder(id, side, price, qty)
+	case "change", "modify":
+		return b.ModifyOrder(id, price, qty)
+	case "delete":
+		return b.DeleteOrder(id)
+	default:
+		return false
+	}
+	return true
+}
+
+// optiqGet returns the value of the field, nil when missing
+func optiqGet(g sbe.Group, name string) any {
+	v, _ := g.Lookup(name)
+	return v
+}
+
+// optiqInt returns the value of an integer or enum field
+func optiqInt(g sbe.Group, name string) (int64, bool) {
+	v := optiqGet(g, name)
+	if e, ok := v.(sbe.Enum); ok {
+		v = e.Raw
+	}
+	switch i := v.(type) {
+	case int64:
+		return i, true
+	case uint64:
+		return int64(i), true
+	}
+	return 0, false
+}
+
+func optiqUint(g sbe.Group, name string) (uint64, bool) {
+	i, ok := optiqInt(g, name)
+	return uint64(i), ok
+}
+
+// optiqAction returns the normalized name of an update action enum, or the
+// FIX MDUpdateAction (279) name of its raw value
+func optiqAction(v any) string {
+	e, ok := v.(sbe.Enum)
+	if !ok {
+		return ""
+	}
+	// Delete_All, DeleteAll...
+	name := strings.ToLower(strings.ReplaceAll(e.Name, "_", ""))
+	for _, a := range []string{"deletethru", "deletefrom", "deleteall", "delete", "overlay", "retransmission", "modify", "change", "new"} {
+		if strings.Contains(name, a) {
+			return a
+		}
+	}
+	if name != "" {
+		return name
+	}
+	switch rawString(e.Raw) {
+	case "0":
+		return "new"
+	case "1":
+		return "change"
+	case "2":
+		return "delete"
+	case "3":
+		return "deletethru"
+	case "4":
+		return "deletefrom"
+	case "5":
+		return "overlay"
+	}
+	return ""
+}
+
+// optiqSide returns the side of an entry type or order side enum, by name
+// or else by its raw bid and ask values
+func optiqSide(v any, bid, ask string) (Side, bool) {
+	e, ok := v.(sbe.Enum)
+	if !ok {
+		return Bid, false
+	}
+	name := strings.ToLower(e.Name)
+	switch {
+	case strings.Contains(name, "bid"), strings.Contains(name, "buy"):
+		return Bid, true
+	case strings.Contains(name, "offer"), strings.Contains(name, "ask"), strings.Contains(name, "sell"):
+		return Ask, true
+	case name != "":
+		return Bid, false
+	}
+	switch rawString(e.Raw) {
+	case bid:
+		return Bid, true
+	case ask:
+		return Ask, true
+	}
+	return Bid, false
+}
+
+func rawString(v any) string {
+	switch r := v.(type) {
+	case string:
+		return r
+	case int64:
+		return strconv.FormatInt(r, 10)
+	case uint64:
+		return strconv.FormatUint(r, 10)
+	}
+	return ""
+}
+
+// optiqPrice returns the price scaled by 10^exponent: integers are taken as
+// already scaled, mantissa/exponent composites and floats are rescaled
+func optiqPrice(v any, exponent int) (int64, bool) {
+	switch p := v.(type) {
+	case int64:
+		return p, true
+	case uint64:
+		return int64(p), true
+	case float64:
+		return int64(math.Round(p / math.Pow10(exponent))), true
+	case sbe.Group:
+		mantissa, ok := optiqInt(p, "mantissa")
+		if !ok {
+			return 0, false
+		}
+		exp, ok := optiqInt(p, "exponent")
+		if !ok {
+			// constant exponent of the composite
+			s, _ := p.String("exponent")
+			e, _ := strconv.Atoi(s)
+			exp = int64(e)
+		}
+		return rescale(mantissa, int(exp), exponent), true
+	}
+	return 0, false
+}
+
+// rescale converts mantissa * 10^from to an integer scaled by 10^to
+func rescale(mantissa int64, from, to int) int64 {
+	for ; from > to; from-- {
+		mantissa *= 10
+	}
+	for ; from < to; from++ {
+		mantissa /= 10
+	}
+	return mantissa
+}
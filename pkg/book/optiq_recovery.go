@@ -0,0 +1,225 @@
+package book
+
+import (
+	"github.com/coalescent-labs/mcastmkt/pkg/sbe"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBuffered is the default number of real-time messages buffered
+// while waiting for a snapshot cycle
+const DefaultMaxBuffered = 1000000
+
+type optiqBuffered struct {
+	seq uint64
+	m   *sbe.Message
+}
+
+// RecoveryStats are the state and the counters of an OptiqRecovery
+type RecoveryStats struct {
+	Synced bool
+	// TimeToSync is the time from the start, or the last loss of
+	// synchronization, to the synchronization
+	TimeToSync time.Duration
+	Buffered   int
+	// Cycles is the number of snapshot cycles seen, Skipped the ones unusable
+	// because older than the buffered messages, incomplete or while synced
+	Cycles  uint64
+	Skipped uint64
+	Losses  uint64
+}
+
+// OptiqRecovery synchronizes the books of an Optiq MDG channel joined late:
+// the real-time messages are buffered until a complete snapshot cycle whose
+// last sequence number (LastMDSeqNum of the Start Of Snapshot message) is
+// covered by the buffer, then the snapshot is applied and the buffered
+// messages after it are replayed. A gap in the real-time stream starts a new
+// recovery. An OptiqRecovery is safe for concurrent use.
+type OptiqRecovery struct {
+	mu          sync.Mutex
+	Books       *Books
+	maxBuffered int
+
+	synced  bool
+	lastSeq uint64
+	since   time.Time
+	buffer  []optiqBuffered
+	// first is the first sequence number of the buffer, 0 when unknown
+	first uint64
+
+	cycle     bool
+	cycleSeq  uint64
+	cycleSeen bool
+
+	stats RecoveryStats
+}
+
+// NewOptiqRecovery returns a recovery of books whose prices are scaled by
+// 10^exponent, buffering at most maxBuffered real-time messages
+func NewOptiqRecovery(exponent int, maxBuffered int) *OptiqRecovery {
+	if maxBuffered <= 0 {
+		maxBuffered = DefaultMaxBuffered
+	}
+	return &OptiqRecovery{
+		Books:       NewBooks(exponent),
+		maxBuffered: maxBuffered,
+		since:       time.Now(),
+	}
+}
+
+func optiqSeq(m *sbe.Message, name string) (uint64, bool) {
+	if m == nil {
+		return 0, false
+	}
+	return optiqUint(m.Fields, name)
+}
+
+// Incremental applies a real-time message once synchronized, buffers it
+// otherwise. It returns the number of applied entries.
+func (r *OptiqRecovery) Incremental(m *sbe.Message) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seq, ok := optiqSeq(m, r.Books.optiq.SeqNum)
+	if !ok {
+		// messages without sequence number follow the previous one
+		seq = r.lastSeq
+	}
+	if r.synced {
+		if ok && seq <= r.lastSeq {
+			// already in the snapshot
+			return 0
+		}
+		r.lastSeq = seq
+		return r.Books.ApplyOptiq(m, false)
+	}
+
+	if len(r.buffer) >= r.maxBuffered {
+		// the snapshot cycle is too long to wait for, start again
+		r.buffer = r.buffer[:0]
+		r.first = 0
+	}
+	if r.first == 0 && ok {
+		r.first = seq
+	}
+	r.lastSeq = seq
+	r.buffer = append(r.buffer, optiqBuffered{seq: seq, m: m})
+	return 0
+}
+
+// Gap restarts the recovery after real-time messages were lost
+func (r *OptiqRecovery) Gap() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.synced {
+		r.stats.Losses++
+		r.since = time.Now()
+	}
+	r.synced = false
+	r.buffer = r.buffer[:0]
+	r.first = 0
+	r.Books.MarkStale()
+}
+
+// StartSnapshot begins a snapshot cycle from its decoded Start Of Snapshot
+// message (nil when it couldn't be decoded). It returns false when the books
+// are synchronized and don't need the cycle.
+func (r *OptiqRecovery) StartSnapshot(m *sbe.Message) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats.Cycles++
+	if r.synced {
+		return false
+	}
+	r.cycle = true
+	r.cycleSeq, r.cycleSeen = optiqSeq(m, r.Books.optiq.SnapshotSeqNum)
+	r.Books.StartSnapshot()
+	return true
+}
+
+// Snapshot applies a message of the snapshot cycle in progress. It returns
+// the number of applied entries.
+func (r *OptiqRecovery) Snapshot(m *sbe.Message) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.cycle {
+		return 0
+	}
+	if !r.cycleSeen {
+		// without LastMDSeqNum the snapshot is as recent as its messages
+		if seq, ok := optiqSeq(m, r.Books.optiq.SeqNum); ok && seq > r.cycleSeq {
+			r.cycleSeq = seq
+		}
+	}
+	return r.Books.ApplyOptiq(m, true)
+}
+
+// AbortSnapshot abandons the snapshot cycle in progress, e.g. after a gap in
+// the snapshot stream
+func (r *OptiqRecovery) AbortSnapshot() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cycle {
+		r.stats.Skipped++
+		r.cycle = false
+		r.Books.AbortSnapshot()
+	}
+}
+
+// EndSnapshot completes the snapshot cycle in progress. When the buffer
+// covers the messages following the snapshot the books are synchronized and
+// the number of replayed buffered messages is returned with true.
+func (r *OptiqRecovery) EndSnapshot() (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.cycle {
+		return 0, false
+	}
+	r.cycle = false
+	if r.first != 0 && r.cycleSeq+1 < r.first {
+		// messages between the snapshot and the buffer are missing
+		r.stats.Skipped++
+		r.Books.AbortSnapshot()
+		return 0, false
+	}
+
+	r.Books.EndSnapshot()
+	replayed := 0
+	for _, b := range r.buffer {
+		if b.seq > r.cycleSeq {
+			r.Books.ApplyOptiq(b.m, false)
+			replayed++
+		}
+	}
+	if r.lastSeq < r.cycleSeq {
+		r.lastSeq = r.cycleSeq
+	}
+	r.buffer = r.buffer[:0]
+	r.first = 0
+	r.synced = true
+	r.stats.TimeToSync = time.Since(r.since)
+	return replayed, true
+}
+
+// StartOfDay synchronizes the books: they are all empty at the start of day
+func (r *OptiqRecovery) StartOfDay() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Books.StartOfDay()
+	r.buffer = r.buffer[:0]
+	r.first = 0
+	if !r.synced {
+		r.synced = true
+		r.stats.TimeToSync = time.Since(r.since)
+	}
+}
+
+// Stats returns the recovery state and counters
+func (r *OptiqRecovery) Stats() RecoveryStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.stats
+	s.Synced = r.synced
+	s.Buffered = len(r.buffer)
+	return s
+}
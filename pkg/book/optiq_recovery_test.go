@@ -0,0 +1,72 @@
+package book
+
+import (
+	"github.com/coalescent-labs/mcastmkt/pkg/sbe"
+	"testing"
+)
+
+// sequenced returns the MarketUpdate message with its MDSeqNum
+func sequenced(seq uint64, m *sbe.Message) *sbe.Message {
+	m.Fields = append(sbe.Group{{Name: "MDSeqNum", Value: seq}}, m.Fields...)
+	return m
+}
+
+func startOfSnapshot(lastSeq uint64) *sbe.Message {
+	return &sbe.Message{Name: "StartOfSnapshot", Fields: sbe.Group{{Name: "LastMDSeqNum", Value: lastSeq}}}
+}
+
+func TestOptiqRecovery(t *testing.T) {
+	r := NewOptiqRecovery(-2, 0)
+	r.Incremental(sequenced(11, marketUpdate([5]int64{0, 0, 100, 1, 1})))
+	r.Incremental(sequenced(12, marketUpdate([5]int64{0, 0, 110, 1, 1})))
+	r.Incremental(sequenced(13, marketUpdate([5]int64{0, 0, 120, 1, 1})))
+
+	// a snapshot older than the buffer can't be used
+	r.StartSnapshot(startOfSnapshot(5))
+	r.Snapshot(marketUpdate([5]int64{0, 0, 90, 1, 1}))
+	if _, ok := r.EndSnapshot(); ok {
+		t.Fatal("synchronized from a snapshot older than the buffer")
+	}
+
+	// the snapshot includes 11 and 12, 13 is replayed
+	r.StartSnapshot(startOfSnapshot(12))
+	r.Snapshot(marketUpdate([5]int64{0, 0, 110, 1, 1}, [5]int64{0, 0, 100, 1, 2}))
+	if replayed, ok := r.EndSnapshot(); !ok || replayed != 1 {
+		t.Fatalf("EndSnapshot() = %d, %v, want 1, true", replayed, ok)
+	}
+	r.Books.View(42, func(b *Book) { checkPrices(t, b, Bid, 120, 110, 100) })
+
+	// already applied
+	if n := r.Incremental(sequenced(13, marketUpdate([5]int64{0, 0, 130, 1, 1}))); n != 0 {
+		t.Fatalf("applied %d entries of a duplicate", n)
+	}
+	if r.StartSnapshot(startOfSnapshot(13)) {
+		t.Fatal("snapshot cycle used while synchronized")
+	}
+	r.Incremental(sequenced(14, marketUpdate([5]int64{2, 0, 100, 0, 0})))
+	r.Books.View(42, func(b *Book) { checkPrices(t, b, Bid, 120, 110) })
+
+	r.Gap()
+	s := r.Stats()
+	if s.Synced || s.Losses != 1 || s.Cycles != 3 || s.Skipped != 1 {
+		t.Fatalf("stats %+v", s)
+	}
+	if _, stale := r.Books.Len(); stale != 1 {
+		t.Fatal("book not stale after a gap")
+	}
+}
+
+func TestOptiqRecoveryMaxBuffered(t *testing.T) {
+	r := NewOptiqRecovery(-2, 2)
+	for seq := uint64(1); seq <= 3; seq++ {
+		r.Incremental(sequenced(seq, marketUpdate([5]int64{0, 0, 100, 1, 1})))
+	}
+	// the buffer restarted at 3
+	r.StartSnapshot(startOfSnapshot(1))
+	if _, ok := r.EndSnapshot(); ok {
+		t.Fatal("synchronized with the messages 2 missing")
+	}
+	if s := r.Stats(); s.Buffered != 1 {
+		t.Fatalf("%d messages buffered, want 1", s.Buffered)
+	}
+}
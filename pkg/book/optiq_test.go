@@ -0,0 +1,229 @@
+package book
+
+import (
+	"github.com/coalescent-labs/mcastmkt/pkg/sbe"
+	"strings"
+	"testing"
+)
+
+// marketUpdate returns a MarketUpdate message with an entry per level:
+// action, entry type, price (mantissa with 2 decimals), qty and position
+func marketUpdate(levels ...[5]int64) *sbe.Message {
+	var entries []sbe.Group
+	for _, l := range levels {
+		entries = append(entries, sbe.Group{
+			{Name: "SymbolIndex", Value: uint64(42)},
+			{Name: "MDUpdateAction", Value: sbe.Enum{Raw: uint64(l[0])}},
+			{Name: "MDEntryType", Value: sbe.Enum{Raw: uint64(l[1])}},
+			{Name: "MDEntryPx", Value: sbe.Group{{Name: "mantissa", Value: l[2]}, {Name: "exponent", Value: "-2"}}},
+			{Name: "MDEntrySize", Value: uint64(l[3])},
+			{Name: "MDPriceLevel", Value: uint64(l[4])},
+		})
+	}
+	return &sbe.Message{Name: "MarketUpdate", Fields: sbe.Group{{Name: "MarketDataUpdates", Value: entries}}}
+}
+
+func TestApplyOptiqLevels(t *testing.T) {
+	bs := NewBooks(-4)
+	bs.StartOfDay()
+	n := bs.ApplyOptiq(marketUpdate(
+		[5]int64{0, 0, 10050, 10, 1},
+		[5]int64{0, 0, 10040, 10, 2},
+		[5]int64{0, 0, 10030, 10, 3},
+		[5]int64{0, 0, 10020, 10, 4},
+		[5]int64{0, 1, 10060, 5, 1},
+		// trade, not a level
+		[5]int64{0, 2, 10055, 1, 0},
+	), false)
+	if n != 5 {
+		t.Fatalf("applied %d entries, want 5", n)
+	}
+	var b *Book
+	bs.View(42, func(v *Book) { b = v })
+	checkPrices(t, b, Bid, 1005000, 1004000, 1003000, 1002000)
+
+	// DeleteThru the level 2, then delete by price
+	bs.ApplyOptiq(marketUpdate([5]int64{3, 0, 0, 0, 2}, [5]int64{2, 0, 10020, 0, 0}), false)
+	checkPrices(t, b, Bid, 1003000)
+	checkPrices(t, b, Ask, 1006000)
+	// DeleteFrom the level 1
+	bs.ApplyOptiq(marketUpdate([5]int64{4, 1, 0, 0, 1}), false)
+	checkPrices(t, b, Ask)
+
+	if n := bs.ApplyOptiq(&sbe.Message{Name: "HealthStatus"}, false); n != 0 {
+		t.Fatalf("applied %d entries of a technical message", n)
+	}
+}
+
+func TestApplyOptiqOrders(t *testing.T) {
+	bs := NewBooks(-2)
+	bs.StartOfDay()
+	order := func(action string, id uint64, side uint64, price int64, qty int64) *sbe.Message {
+		return &sbe.Message{Name: "OrderUpdate", Fields: sbe.Group{
+			{Name: "SymbolIndex", Value: uint64(7)},
+			{Name: "ActionType", Value: sbe.Enum{Name: action}},
+			{Name: "OrderID", Value: id},
+			{Name: "OrderSide", Value: sbe.Enum{Raw: side}},
+			{Name: "OrderPx", Value: price},
+			{Name: "OrderQuantity", Value: qty},
+		}}
+	}
+	bs.ApplyOptiq(order("New_Order", 1, 1, 990, 10), false)
+	bs.ApplyOptiq(order("New_Order", 2, 1, 990, 5), false)
+	bs.ApplyOptiq(order("New_Order", 3, 2, 1000, 1), false)
+	bs.ApplyOptiq(order("Modify_Order", 2, 1, 980, 5), false)
+	bs.ApplyOptiq(order("Delete_Order", 3, 0, 0, 0), false)
+	bs.View(7, func(b *Book) {
+		if got := b.Top(Bid, 0); len(got) != 2 || got[0] != (Level{990, 10, 1}) || got[1] != (Level{980, 5, 1}) {
+			t.Fatalf("bids %+v", got)
+		}
+		if b.Depth(Ask) != 0 {
+			t.Fatalf("asks %+v", b.Top(Ask, 0))
+		}
+	})
+	bs.ApplyOptiq(order("Delete_All", 0, 0, 0, 0), false)
+	bs.View(7, func(b *Book) {
+		if b.Depth(Bid) != 0 {
+			t.Fatal("levels left after delete all")
+		}
+	})
+}
+
+func TestBooksSnapshotCycle(t *testing.T) {
+	bs := NewBooks(-2)
+	// joined late: the books are stale until a snapshot cycle
+	bs.ApplyOptiq(marketUpdate([5]int64{0, 0, 100, 1, 1}), false)
+	bs.Update(43, func(b *Book) { b.Set(Bid, 1, 1, 1) })
+	if n, stale := bs.Len(); n != 2 || stale != 2 || bs.Synced() {
+		t.Fatalf("%d books, %d stale, synced %v", n, stale, bs.Synced())
+	}
+	// snapshot messages out of a cycle are ignored
+	bs.ApplyOptiq(marketUpdate([5]int64{0, 0, 200, 1, 1}), true)
+	bs.StartSnapshot()
+	bs.ApplyOptiq(marketUpdate([5]int64{0, 0, 300, 1, 1}), true)
+	bs.ApplyOptiq(marketUpdate([5]int64{0, 0, 290, 1, 2}), true)
+	if n := bs.EndSnapshot(); n != 1 {
+		t.Fatalf("EndSnapshot rebuilt %d books, want 1", n)
+	}
+	if n, stale := bs.Len(); n != 2 || stale != 0 || !bs.Synced() {
+		t.Fatalf("%d books, %d stale, synced %v", n, stale, bs.Synced())
+	}
+	bs.View(42, func(b *Book) { checkPrices(t, b, Bid, 300, 290) })
+	// missing from the snapshot, so empty
+	bs.View(43, func(b *Book) { checkPrices(t, b, Bid) })
+
+	// books up to date are left alone by the next cycles
+	bs.StartSnapshot()
+	bs.ApplyOptiq(marketUpdate([5]int64{0, 0, 500, 1, 1}), true)
+	bs.EndSnapshot()
+	bs.View(42, func(b *Book) { checkPrices(t, b, Bid, 300, 290) })
+
+	bs.MarkStale()
+	bs.StartSnapshot()
+	bs.ApplyOptiq(marketUpdate([5]int64{0, 0, 500, 1, 1}), true)
+	bs.AbortSnapshot()
+	if _, stale := bs.Len(); stale != 2 || bs.EndSnapshot() != 0 {
+		t.Fatal("aborted snapshot cycle rebuilt the books")
+	}
+}
+
+// optiqSchema is an Optiq MDG like schema naming the fields with underscores
+const optiqSchema = `<?xml version="1.0" encoding="UTF-8"?>
+<sbe:messageSchema xmlns:sbe="http://fixprotocol.io/2016/sbe" package="mdg" id="1" version="1" byteOrder="littleEndian">
+  <types>
+    <composite name="messageHeader">
+      <type name="blockLength" primitiveType="uint16"/>
+      <type name="templateId" primitiveType="uint16"/>
+      <type name="schemaId" primitiveType="uint16"/>
+      <type name="version" primitiveType="uint16"/>
+    </composite>
+    <composite name="groupSizeEncoding">
+      <type name="blockLength" primitiveType="uint16"/>
+      <type name="numInGroup" primitiveType="uint16"/>
+    </composite>
+  </types>
+  <sbe:message name="Market_Update" id="1001">
+    <field name="MD_Seq_Num" id="1" type="uint64"/>
+    <group name="MarketDataUpdates" id="2" dimensionType="groupSizeEncoding">
+      <field name="Symbol_Index" id="3" type="uint32"/>
+      <field name="MD_Update_Action" id="4" type="uint8"/>
+      <field name="MD_Entry_Type" id="5" type="uint8"/>
+      <field name="MD_Entry_Px" id="6" type="int64"/>
+      <field name="MD_Entry_Size" id="7" type="uint64"/>
+    </group>
+  </sbe:message>
+  <sbe:message name="Start_Of_Snapshot" id="1004">
+    <field name="Last_MD_Seq_Num" id="1" type="uint64"/>
+  </sbe:message>
+</sbe:messageSchema>`
+
+func TestResolveOptiqFields(t *testing.T) {
+	s, err := sbe.LoadSchema(strings.NewReader(optiqSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ResolveOptiqFields(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := OptiqFields{
+		SymbolIndex:    "Symbol_Index",
+		SeqNum:         "MD_Seq_Num",
+		SnapshotSeqNum: "Last_MD_Seq_Num",
+		UpdateAction:   "MD_Update_Action",
+		EntryType:      "MD_Entry_Type",
+		EntryPrice:     "MD_Entry_Px",
+		EntryQty:       "MD_Entry_Size",
+	}
+	if f != want {
+		t.Fatalf("ResolveOptiqFields = %+v, want %+v", f, want)
+	}
+
+	// the decoded entries are applied with the names of the schema
+	bs := NewBooks(0)
+	bs.SetOptiqFields(f)
+	bs.StartOfDay()
+	n := bs.ApplyOptiq(&sbe.Message{Name: "Market_Update", Fields: sbe.Group{{Name: "MarketDataUpdates", Value: []sbe.Group{{
+		{Name: "Symbol_Index", Value: uint64(42)},
+		{Name: "MD_Update_Action", Value: sbe.Enum{Raw: uint64(0)}},
+		{Name: "MD_Entry_Type", Value: sbe.Enum{Raw: uint64(1)}},
+		{Name: "MD_Entry_Px", Value: int64(105)},
+		{Name: "MD_Entry_Size", Value: uint64(3)},
+	}}}}}, false)
+	if n != 1 {
+		t.Fatalf("applied %d entries, want 1", n)
+	}
+	bs.View(42, func(b *Book) {
+		if got := b.Top(Ask, 0); len(got) != 1 || got[0] != (Level{105, 3, 0}) {
+			t.Fatalf("asks %+v", got)
+		}
+	})
+}
+
+func TestResolveOptiqFieldsMissing(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{"no price", strings.Replace(optiqSchema, "MD_Entry_Px", "Last_Px", 1), "Market_Update.MDEntryPx|MDEntryPrice|Price"},
+		{"no market update", strings.Replace(optiqSchema, "Market_Update", "Trade", 1), "no MarketUpdate message in the Optiq MDG schema"},
+		{"order update without side", strings.Replace(optiqSchema, "</sbe:messageSchema>", `<sbe:message name="OrderUpdate" id="1002">
+    <field name="SymbolIndex" id="1" type="uint32"/>
+    <field name="OrderID" id="2" type="uint64"/>
+    <field name="ActionType" id="3" type="uint8"/>
+    <field name="OrderPx" id="4" type="int64"/>
+    <field name="OrderQuantity" id="5" type="uint64"/>
+  </sbe:message>
+</sbe:messageSchema>`, 1), "OrderUpdate.OrderSide|Side"},
+	}
+	for _, tt := range tests {
+		s, err := sbe.LoadSchema(strings.NewReader(tt.schema))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ResolveOptiqFields(s); err == nil || !strings.HasSuffix(err.Error(), tt.want) {
+			t.Errorf("%s: ResolveOptiqFields error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
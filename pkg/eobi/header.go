@@ -0,0 +1,74 @@
+package eobi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// MessageHeaderSize is the size of the header of every EOBI message
+	MessageHeaderSize = 8
+	// PacketHeaderSize is the size of the PacketHeader message starting each datagram
+	PacketHeaderSize = 32
+	// PacketHeaderTemplateID is the template id of the PacketHeader message
+	PacketHeaderTemplateID = 13005
+)
+
+// ErrShortPacket is returned for datagrams smaller than the packet header
+var ErrShortPacket = errors.New("eobi: packet shorter than the packet header")
+
+// MessageHeader is the header of every EOBI message
+type MessageHeader struct {
+	BodyLen    uint16
+	TemplateID uint16
+	MsgSeqNum  uint32
+}
+
+// PacketHeader is the first message of every EOBI datagram
+type PacketHeader struct {
+	MessageHeader
+	// ApplSeqNum is contiguous per MarketSegmentID, packets with the same
+	// ApplSeqNum belong to the same event until CompletionIndicator is set
+	ApplSeqNum            uint32
+	MarketSegmentID       int32
+	PartitionID           uint8
+	CompletionIndicator   uint8
+	ApplSeqResetIndicator uint8
+	TransactTime          uint64
+}
+
+// Complete returns true for the last packet of an ApplSeqNum
+func (h *PacketHeader) Complete() bool { return h.CompletionIndicator == 1 }
+
+// Reset returns true when the sender restarted the ApplSeqNum
+func (h *PacketHeader) Reset() bool { return h.ApplSeqResetIndicator == 1 }
+
+func parseMessageHeader(b []byte) MessageHeader {
+	return MessageHeader{
+		BodyLen:    binary.LittleEndian.Uint16(b[0:2]),
+		TemplateID: binary.LittleEndian.Uint16(b[2:4]),
+		MsgSeqNum:  binary.LittleEndian.Uint32(b[4:8]),
+	}
+}
+
+// ParsePacketHeader parses the packet header at the beginning of a datagram
+func ParsePacketHeader(b []byte) (PacketHeader, error) {
+	if len(b) < PacketHeaderSize {
+		return PacketHeader{}, ErrShortPacket
+	}
+	h := PacketHeader{
+		MessageHeader:         parseMessageHeader(b),
+		ApplSeqNum:            binary.LittleEndian.Uint32(b[8:12]),
+		MarketSegmentID:       int32(binary.LittleEndian.Uint32(b[12:16])),
+		PartitionID:           b[16],
+		CompletionIndicator:   b[17],
+		ApplSeqResetIndicator: b[18],
+		// 5 bytes padding
+		TransactTime: binary.LittleEndian.Uint64(b[24:32]),
+	}
+	if h.TemplateID != PacketHeaderTemplateID {
+		return h, fmt.Errorf("eobi: unexpected packet header template id %d", h.TemplateID)
+	}
+	return h, nil
+}
@@ -0,0 +1,328 @@
+package eobi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// kind is the wire type of a message field
+type kind int
+
+const (
+	kindUint8 kind = iota
+	kindUint16
+	kindUint32
+	kindUint64
+	kindInt32
+	kindInt64
+	// kindPrice is an int64 with 8 implied decimals
+	kindPrice
+	// kindQty is an int64 with 4 implied decimals
+	kindQty
+	kindPad
+)
+
+var kindSizes = [...]int{1, 2, 4, 8, 4, 8, 8, 8, 0}
+
+type fieldSpec struct {
+	name string
+	kind kind
+	// size of the padding fields
+	size int
+}
+
+type layout struct {
+	name   string
+	fields []fieldSpec
+}
+
+// orderDetails is the OrderDetails component shared by the order messages
+var orderDetails = []fieldSpec{
+	{name: "TrdRegTSTimePriority", kind: kindUint64},
+	{name: "DisplayQty", kind: kindQty},
+	{name: "Side", kind: kindUint8},
+	{name: "OrdType", kind: kindUint8},
+	{kind: kindPad, size: 6},
+	{name: "Price", kind: kindPrice},
+}
+
+func withOrderDetails(fields ...fieldSpec) []fieldSpec {
+	return append(fields, orderDetails...)
+}
+
+var orderExecution = []fieldSpec{
+	{name: "Side", kind: kindUint8},
+	{name: "OrdType", kind: kindUint8},
+	{name: "AlgorithmicTradeIndicator", kind: kindUint8},
+	{kind: kindPad, size: 1},
+	{name: "TrdMatchID", kind: kindUint32},
+	{name: "Price", kind: kindPrice},
+	{name: "TrdRegTSTimePriority", kind: kindUint64},
+	{name: "SecurityID", kind: kindInt64},
+	{name: "LastQty", kind: kindQty},
+	{name: "LastPx", kind: kindPrice},
+}
+
+// layouts are the fixed body layouts of the EOBI messages by template id
+var layouts = map[uint16]layout{
+	13001: {"Heartbeat", []fieldSpec{
+		{name: "LastMsgSeqNumProcessed", kind: kindUint32},
+	}},
+	13002: {"SnapshotOrder", withOrderDetails()},
+	13100: {"OrderAdd", withOrderDetails(
+		fieldSpec{name: "TrdRegTSTimeIn", kind: kindUint64},
+		fieldSpec{name: "SecurityID", kind: kindInt64},
+	)},
+	13101: {"OrderModify", withOrderDetails(
+		fieldSpec{name: "TrdRegTSTimeIn", kind: kindUint64},
+		fieldSpec{name: "TrdRegTSPrevTimePriority", kind: kindUint64},
+		fieldSpec{name: "PrevPrice", kind: kindPrice},
+		fieldSpec{name: "PrevDisplayQty", kind: kindQty},
+		fieldSpec{name: "SecurityID", kind: kindInt64},
+	)},
+	13102: {"OrderModifySamePrio", withOrderDetails(
+		fieldSpec{name: "TrdRegTSTimeIn", kind: kindUint64},
+		fieldSpec{name: "TransactTime", kind: kindUint64},
+		fieldSpec{name: "PrevDisplayQty", kind: kindQty},
+		fieldSpec{name: "SecurityID", kind: kindInt64},
+	)},
+	13103: {"OrderDelete", withOrderDetails(
+		fieldSpec{name: "TrdRegTSTimeIn", kind: kindUint64},
+		fieldSpec{name: "TransactTime", kind: kindUint64},
+		fieldSpec{name: "SecurityID", kind: kindInt64},
+	)},
+	13104: {"OrderMassDelete", []fieldSpec{
+		{name: "SecurityID", kind: kindInt64},
+		{name: "TransactTime", kind: kindUint64},
+	}},
+	13105: {"PartialOrderExecution", orderExecution},
+	13106: {"FullOrderExecution", orderExecution},
+	13200: {"AuctionBBO", []fieldSpec{
+		{name: "TransactTime", kind: kindUint64},
+		{name: "SecurityID", kind: kindInt64},
+		{name: "BidPx", kind: kindPrice},
+		{name: "OfferPx", kind: kindPrice},
+		{name: "MDBookType", kind: kindUint8},
+		{name: "PotentialSecurityTradingEvent", kind: kindUint8},
+		{name: "BidPxIsLocalIndicator", kind: kindUint8},
+		{name: "OfferPxIsLocalIndicator", kind: kindUint8},
+	}},
+	13201: {"AuctionClearingPrice", []fieldSpec{
+		{name: "TransactTime", kind: kindUint64},
+		{name: "SecurityID", kind: kindInt64},
+		{name: "LastPx", kind: kindPrice},
+		{name: "ImbalanceQty", kind: kindQty},
+		{name: "SideIndicator", kind: kindUint8},
+		{name: "PotentialSecurityTradingEvent", kind: kindUint8},
+	}},
+	13202: {"ExecutionSummary", []fieldSpec{
+		{name: "SecurityID", kind: kindInt64},
+		{name: "AggressorTime", kind: kindUint64},
+		{name: "RequestTime", kind: kindUint64},
+		{name: "ExecID", kind: kindUint64},
+		{name: "LastQty", kind: kindQty},
+		{name: "AggressorSide", kind: kindUint8},
+		{name: "TradeCondition", kind: kindUint8},
+		{kind: kindPad, size: 6},
+		{name: "LastPx", kind: kindPrice},
+		{name: "RestingHiddenQty", kind: kindQty},
+		{name: "RestingCxlQty", kind: kindQty},
+	}},
+	13203: {"TradeReport", []fieldSpec{
+		{name: "SecurityID", kind: kindInt64},
+		{name: "LastQty", kind: kindQty},
+		{name: "LastPx", kind: kindPrice},
+		{name: "TrdMatchID", kind: kindUint32},
+		{name: "MatchType", kind: kindUint8},
+		{name: "MatchSubType", kind: kindUint8},
+		{name: "AlgorithmicTradeIndicator", kind: kindUint8},
+		{name: "TradeCondition", kind: kindUint8},
+	}},
+	13300: {"ProductStateChange", []fieldSpec{
+		{name: "TradingSessionID", kind: kindUint8},
+		{name: "TradingSessionSubID", kind: kindUint8},
+		{name: "TradSesStatus", kind: kindUint8},
+		{name: "MarketCondition", kind: kindUint8},
+		{name: "FastMarketIndicator", kind: kindUint8},
+		{kind: kindPad, size: 3},
+		{name: "TransactTime", kind: kindUint64},
+	}},
+	13301: {"InstrumentStateChange", []fieldSpec{
+		{name: "SecurityID", kind: kindInt64},
+		{name: "SecurityStatus", kind: kindUint8},
+		{name: "SecurityTradingStatus", kind: kindUint8},
+		{name: "MarketCondition", kind: kindUint8},
+		{name: "FastMarketIndicator", kind: kindUint8},
+		{name: "SecurityTradingEvent", kind: kindUint8},
+		{name: "SoldOutIndicator", kind: kindUint8},
+		{kind: kindPad, size: 2},
+		{name: "TransactTime", kind: kindUint64},
+	}},
+	13400: {"QuoteRequest", []fieldSpec{
+		{name: "SecurityID", kind: kindInt64},
+		{name: "LastQty", kind: kindQty},
+		{name: "Side", kind: kindUint8},
+		{kind: kindPad, size: 7},
+		{name: "TransactTime", kind: kindUint64},
+	}},
+	13500: {"CrossRequest", []fieldSpec{
+		{name: "SecurityID", kind: kindInt64},
+		{name: "LastQty", kind: kindQty},
+		{name: "TransactTime", kind: kindUint64},
+	}},
+	13600: {"ProductSummary", []fieldSpec{
+		{name: "LastMsgSeqNumProcessed", kind: kindUint32},
+		{name: "TradingSessionID", kind: kindUint8},
+		{name: "TradingSessionSubID", kind: kindUint8},
+		{name: "TradSesStatus", kind: kindUint8},
+		{name: "MarketCondition", kind: kindUint8},
+		{name: "FastMarketIndicator", kind: kindUint8},
+	}},
+	13601: {"InstrumentSummary", []fieldSpec{
+		{name: "SecurityID", kind: kindInt64},
+		{name: "LastUpdateTime", kind: kindUint64},
+		{name: "TrdRegTSExecutionTime", kind: kindUint64},
+		{name: "TotNoOrders", kind: kindUint16},
+		{name: "SecurityStatus", kind: kindUint8},
+		{name: "SecurityTradingStatus", kind: kindUint8},
+		{name: "MarketCondition", kind: kindUint8},
+		{name: "FastMarketIndicator", kind: kindUint8},
+		{name: "SecurityTradingEvent", kind: kindUint8},
+		{name: "SoldOutIndicator", kind: kindUint8},
+		{name: "NoMDEntries", kind: kindUint8},
+	}},
+}
+
+// Field is a decoded message field. Value is uint64, int64 or, for prices
+// and quantities, a decimal string.
+type Field struct {
+	Name  string
+	Value any
+}
+
+// Message is a decoded EOBI message
+type Message struct {
+	MessageHeader
+	Name   string
+	Fields []Field
+	// Body is the raw message including its header
+	Body []byte
+}
+
+// Known returns false for templates without a known layout
+func (m *Message) Known() bool { return m.Name != "" }
+
+// Get returns the value of the field with the name
+func (m *Message) Get(name string) (any, bool) {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Int returns the value of an integer field
+func (m *Message) Int(name string) (int64, bool) {
+	v, ok := m.Get(name)
+	if !ok {
+		return 0, false
+	}
+	switch i := v.(type) {
+	case int64:
+		return i, true
+	case uint64:
+		return int64(i), true
+	}
+	return 0, false
+}
+
+func (m *Message) String() string {
+	var sb strings.Builder
+	name := m.Name
+	if name == "" {
+		name = "Unknown"
+	}
+	fmt.Fprintf(&sb, "%s [tid %d, msgSeqNum %d, bodyLen %d]", name, m.TemplateID, m.MsgSeqNum, m.BodyLen)
+	for _, f := range m.Fields {
+		fmt.Fprintf(&sb, " %s=%v", f.Name, f.Value)
+	}
+	return sb.String()
+}
+
+// DecodeMessages decodes the messages following the packet header of a datagram
+func DecodeMessages(b []byte) ([]Message, error) {
+	if len(b) < PacketHeaderSize {
+		return nil, ErrShortPacket
+	}
+	var msgs []Message
+	b = b[PacketHeaderSize:]
+	for len(b) >= MessageHeaderSize {
+		h := parseMessageHeader(b)
+		if int(h.BodyLen) < MessageHeaderSize || int(h.BodyLen) > len(b) {
+			return msgs, fmt.Errorf("eobi: invalid body length %d of template %d", h.BodyLen, h.TemplateID)
+		}
+		msgs = append(msgs, decodeMessage(h, b[:h.BodyLen]))
+		b = b[h.BodyLen:]
+	}
+	if len(b) > 0 {
+		return msgs, fmt.Errorf("eobi: %d trailing bytes", len(b))
+	}
+	return msgs, nil
+}
+
+func decodeMessage(h MessageHeader, body []byte) Message {
+	m := Message{MessageHeader: h, Body: body}
+	l, ok := layouts[h.TemplateID]
+	if !ok {
+		return m
+	}
+	m.Name = l.name
+	off := MessageHeaderSize
+	for _, f := range l.fields {
+		size := kindSizes[f.kind]
+		if f.kind == kindPad {
+			size = f.size
+		}
+		if off+size > len(body) {
+			// older layout version, stop at the end of the body
+			break
+		}
+		b := body[off : off+size]
+		off += size
+		switch f.kind {
+		case kindUint8:
+			m.Fields = append(m.Fields, Field{f.name, uint64(b[0])})
+		case kindUint16:
+			m.Fields = append(m.Fields, Field{f.name, uint64(binary.LittleEndian.Uint16(b))})
+		case kindUint32:
+			m.Fields = append(m.Fields, Field{f.name, uint64(binary.LittleEndian.Uint32(b))})
+		case kindUint64:
+			m.Fields = append(m.Fields, Field{f.name, binary.LittleEndian.Uint64(b)})
+		case kindInt32:
+			m.Fields = append(m.Fields, Field{f.name, int64(int32(binary.LittleEndian.Uint32(b)))})
+		case kindInt64:
+			m.Fields = append(m.Fields, Field{f.name, int64(binary.LittleEndian.Uint64(b))})
+		case kindPrice:
+			m.Fields = append(m.Fields, Field{f.name, scaled(int64(binary.LittleEndian.Uint64(b)), 8)})
+		case kindQty:
+			m.Fields = append(m.Fields, Field{f.name, scaled(int64(binary.LittleEndian.Uint64(b)), 4)})
+		}
+	}
+	return m
+}
+
+// scaled formats a fixed point number with the implied decimals
+func scaled(v int64, decimals int) string {
+	s := strconv.FormatInt(v, 10)
+	sign := ""
+	if v < 0 {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	return sign + s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
@@ -0,0 +1,142 @@
+package eobi
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// packet returns a datagram with the packet header and the messages
+func packet(applSeqNum uint32, segment int32, complete uint8, msgs ...[]byte) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, PacketHeaderSize)
+	b = binary.LittleEndian.AppendUint16(b, PacketHeaderTemplateID)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, applSeqNum)
+	b = binary.LittleEndian.AppendUint32(b, uint32(segment))
+	b = append(b, 3, complete, 0, 0, 0, 0, 0, 0)
+	b = binary.LittleEndian.AppendUint64(b, 1700000000123456789)
+	for _, m := range msgs {
+		b = append(b, m...)
+	}
+	return b
+}
+
+// message returns a message with its header and body fields
+func message(templateID uint16, msgSeqNum uint32, fields ...uint64) []byte {
+	var body []byte
+	for _, f := range fields {
+		body = binary.LittleEndian.AppendUint64(body, f)
+	}
+	b := binary.LittleEndian.AppendUint16(nil, uint16(MessageHeaderSize+len(body)))
+	b = binary.LittleEndian.AppendUint16(b, templateID)
+	b = binary.LittleEndian.AppendUint32(b, msgSeqNum)
+	return append(b, body...)
+}
+
+func TestParsePacketHeader(t *testing.T) {
+	h, err := ParsePacketHeader(packet(4242, -7, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PacketHeader{
+		MessageHeader:       MessageHeader{BodyLen: PacketHeaderSize, TemplateID: PacketHeaderTemplateID},
+		ApplSeqNum:          4242,
+		MarketSegmentID:     -7,
+		PartitionID:         3,
+		CompletionIndicator: 1,
+		TransactTime:        1700000000123456789,
+	}
+	if h != want {
+		t.Fatalf("ParsePacketHeader = %+v, want %+v", h, want)
+	}
+	if !h.Complete() || h.Reset() {
+		t.Fatalf("Complete() = %v, Reset() = %v", h.Complete(), h.Reset())
+	}
+	if _, err := ParsePacketHeader(make([]byte, PacketHeaderSize-1)); !errors.Is(err, ErrShortPacket) {
+		t.Fatalf("short packet error %v", err)
+	}
+	b := packet(1, 1, 1)
+	b[2] = 0xC9
+	if _, err := ParsePacketHeader(b); err == nil {
+		t.Fatal("no error for a wrong template id")
+	}
+}
+
+func TestDecodeMessages(t *testing.T) {
+	securityID := int64(-1234567)
+	orderAdd := message(13100, 1,
+		1700000000000000002,   // TrdRegTSTimeIn
+		uint64(securityID),    // SecurityID
+		1700000000000000001,   // TrdRegTSTimePriority
+		25_0000,               // DisplayQty 25
+		2|1<<8,                // Side 2, OrdType 1, padding
+		uint64(1234_50000000), // Price 1234.5
+	)
+	heartbeat := message(13001, 2)[:MessageHeaderSize]
+	heartbeat = binary.LittleEndian.AppendUint32(heartbeat, 99)
+	binary.LittleEndian.PutUint16(heartbeat, uint16(len(heartbeat)))
+	unknown := message(19999, 3, 1)
+
+	msgs, err := DecodeMessages(packet(1, 1, 1, orderAdd, heartbeat, unknown))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("decoded %d messages, want 3", len(msgs))
+	}
+	m := msgs[0]
+	if m.Name != "OrderAdd" || m.MsgSeqNum != 1 || len(m.Body) != 56 {
+		t.Fatalf("message %s, msgSeqNum %d, %d bytes", m.Name, m.MsgSeqNum, len(m.Body))
+	}
+	for name, want := range map[string]any{
+		"DisplayQty":     "25.0000",
+		"Side":           uint64(2),
+		"OrdType":        uint64(1),
+		"Price":          "1234.50000000",
+		"SecurityID":     int64(-1234567),
+		"TrdRegTSTimeIn": uint64(1700000000000000002),
+	} {
+		if v, _ := m.Get(name); v != want {
+			t.Errorf("%s = %v (%T), want %v (%T)", name, v, v, want, want)
+		}
+	}
+	if id, _ := m.Int("SecurityID"); id != -1234567 {
+		t.Errorf("Int(SecurityID) = %d", id)
+	}
+	if v, _ := msgs[1].Get("LastMsgSeqNumProcessed"); v != uint64(99) {
+		t.Errorf("LastMsgSeqNumProcessed = %v", v)
+	}
+	if msgs[2].Known() || len(msgs[2].Fields) != 0 {
+		t.Errorf("unknown template decoded as %s", msgs[2].Name)
+	}
+}
+
+func TestDecodeMessagesErrors(t *testing.T) {
+	m := message(13001, 1, 0)
+	binary.LittleEndian.PutUint16(m, 100)
+	if msgs, err := DecodeMessages(packet(1, 1, 1, message(13001, 1, 0), m)); err == nil || len(msgs) != 1 {
+		t.Fatalf("invalid body length: %d messages, error %v", len(msgs), err)
+	}
+	if _, err := DecodeMessages(packet(1, 1, 1, message(13001, 1, 0), []byte{1, 2})); err == nil {
+		t.Fatal("no error for trailing bytes")
+	}
+}
+
+func TestScaled(t *testing.T) {
+	tests := []struct {
+		v        int64
+		decimals int
+		want     string
+	}{
+		{123456789, 8, "1.23456789"},
+		{5, 4, "0.0005"},
+		{-5, 4, "-0.0005"},
+		{-120000, 4, "-12.0000"},
+		{0, 8, "0.00000000"},
+	}
+	for _, tt := range tests {
+		if got := scaled(tt.v, tt.decimals); got != tt.want {
+			t.Errorf("scaled(%d, %d) = %s, want %s", tt.v, tt.decimals, got, tt.want)
+		}
+	}
+}
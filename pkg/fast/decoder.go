@@ -0,0 +1,540 @@
+package fast
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// ErrEOF is returned when a message is truncated
+	ErrEOF = errors.New("fast: unexpected end of data")
+	// ErrOverflow is returned for integers longer than 64 bits
+	ErrOverflow = errors.New("fast: integer overflow")
+)
+
+// entry is a dictionary value, a missing entry is an undefined value
+type entry struct {
+	empty bool
+	value any
+}
+
+// Decoder decodes FAST 1.1 encoded messages. It keeps the dictionaries of
+// the previous values across messages until Reset. A Decoder is not safe for
+// concurrent use.
+type Decoder struct {
+	templates *Templates
+	dict      map[string]*entry
+	lastTID   uint32
+	hasTID    bool
+}
+
+// NewDecoder returns a decoder for the templates
+func NewDecoder(templates *Templates) *Decoder {
+	return &Decoder{
+		templates: templates,
+		dict:      make(map[string]*entry),
+	}
+}
+
+// Reset clears the dictionaries, as required by many feeds at each packet.
+func (d *Decoder) Reset() {
+	clear(d.dict)
+	d.hasTID = false
+}
+
+// Decode decodes a message at the beginning of b and returns it with the
+// number of bytes consumed.
+func (d *Decoder) Decode(b []byte) (*Message, int, error) {
+	r := &reader{buf: b}
+	m, err := d.decodeMessage(r)
+	return m, r.pos, err
+}
+
+// DecodeAll decodes all the messages of b, e.g. a datagram. The messages
+// decoded before an error are returned with it.
+func (d *Decoder) DecodeAll(b []byte) ([]*Message, error) {
+	var msgs []*Message
+	for len(b) > 0 {
+		m, n, err := d.Decode(b)
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, m)
+		b = b[n:]
+	}
+	return msgs, nil
+}
+
+func (d *Decoder) decodeMessage(r *reader) (*Message, error) {
+	pm, err := r.pmap()
+	if err != nil {
+		return nil, err
+	}
+	if pm.next() {
+		tid, err := r.uint()
+		if err != nil {
+			return nil, err
+		}
+		d.lastTID = uint32(tid)
+		d.hasTID = true
+	} else if !d.hasTID {
+		return nil, errors.New("fast: missing template id")
+	}
+	tpl := d.templates.ByID(d.lastTID)
+	if tpl == nil {
+		return nil, fmt.Errorf("fast: unknown template id %d", d.lastTID)
+	}
+	m := &Message{TemplateID: tpl.ID, Name: tpl.Name}
+	m.Fields, err = d.decodeFields(r, &pm, tpl, tpl.Fields, nil)
+	if err != nil {
+		return m, fmt.Errorf("%s: %w", tpl.Name, err)
+	}
+	return m, nil
+}
+
+func (d *Decoder) decodeFields(r *reader, pm *pmap, tpl *Template, fields []*Field, out Group) (Group, error) {
+	for _, f := range fields {
+		switch f.Type {
+		case TypeTemplateRef:
+			if f.Ref == "" {
+				m, err := d.decodeMessage(r)
+				if err != nil {
+					return out, err
+				}
+				out = append(out, Value{Name: m.Name, Value: m})
+				continue
+			}
+			var err error
+			out, err = d.decodeFields(r, pm, tpl, d.templates.ByName(f.Ref).Fields, out)
+			if err != nil {
+				return out, err
+			}
+		case TypeGroup:
+			if f.Optional && !pm.next() {
+				continue
+			}
+			g, err := d.decodeElement(r, tpl, f.Fields)
+			if err != nil {
+				return out, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			out = append(out, Value{Name: f.Name, ID: f.ID, Value: g})
+		case TypeSequence:
+			length, ok, err := d.decodeScalar(r, pm, tpl, f.Length)
+			if err != nil {
+				return out, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			if !ok {
+				continue
+			}
+			n := length.(uint64)
+			if n > uint64(len(r.buf)-r.pos) {
+				return out, fmt.Errorf("%s: invalid length %d", f.Name, n)
+			}
+			elements := make([]Group, 0, n)
+			for i := uint64(0); i < n; i++ {
+				g, err := d.decodeElement(r, tpl, f.Fields)
+				if err != nil {
+					return out, fmt.Errorf("%s[%d]: %w", f.Name, i, err)
+				}
+				elements = append(elements, g)
+			}
+			out = append(out, Value{Name: f.Name, ID: f.ID, Value: elements})
+		case TypeDecimal:
+			v, ok, err := d.decodeDecimal(r, pm, tpl, f)
+			if err != nil {
+				return out, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			if ok {
+				out = append(out, Value{Name: f.Name, ID: f.ID, Value: v})
+			}
+		default:
+			v, ok, err := d.decodeScalar(r, pm, tpl, f)
+			if err != nil {
+				return out, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			if ok {
+				out = append(out, Value{Name: f.Name, ID: f.ID, Value: external(f.Type, v)})
+			}
+		}
+	}
+	return out, nil
+}
+
+// decodeElement decodes a group or a sequence element, with its own
+// presence map when any of its fields needs it.
+func (d *Decoder) decodeElement(r *reader, tpl *Template, fields []*Field) (Group, error) {
+	var pm pmap
+	if d.needsPmap(fields) {
+		var err error
+		if pm, err = r.pmap(); err != nil {
+			return nil, err
+		}
+	}
+	return d.decodeFields(r, &pm, tpl, fields, nil)
+}
+
+func (d *Decoder) needsPmap(fields []*Field) bool {
+	for _, f := range fields {
+		switch f.Type {
+		case TypeTemplateRef:
+			if f.Ref != "" && d.needsPmap(d.templates.ByName(f.Ref).Fields) {
+				return true
+			}
+		case TypeGroup:
+			if f.Optional {
+				return true
+			}
+		case TypeSequence:
+			if usesBit(f.Length) {
+				return true
+			}
+		case TypeDecimal:
+			if f.Exponent != nil {
+				if usesBit(f.Exponent) || usesBit(f.Mantissa) {
+					return true
+				}
+			} else if usesBit(f) {
+				return true
+			}
+		default:
+			if usesBit(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usesBit returns true when the field operator uses a presence map bit
+func usesBit(f *Field) bool {
+	switch f.Operator {
+	case OpConstant:
+		return f.Optional
+	case OpDefault, OpCopy, OpIncrement, OpTail:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *Decoder) key(tpl *Template, f *Field) string {
+	switch f.Dictionary {
+	case "", "global":
+		return "g\x00" + f.Key
+	case "template", "type":
+		return "t" + strconv.FormatUint(uint64(tpl.ID), 10) + "\x00" + f.Key
+	default:
+		return "d" + f.Dictionary + "\x00" + f.Key
+	}
+}
+
+func (d *Decoder) set(tpl *Template, f *Field, v any) {
+	d.dict[d.key(tpl, f)] = &entry{value: v}
+}
+
+func (d *Decoder) setEmpty(tpl *Template, f *Field) {
+	d.dict[d.key(tpl, f)] = &entry{empty: true}
+}
+
+// decodeDecimal decodes a decimal with a single operator or with individual
+// operators on exponent and mantissa
+func (d *Decoder) decodeDecimal(r *reader, pm *pmap, tpl *Template, f *Field) (Decimal, bool, error) {
+	if f.Exponent != nil {
+		exp, ok, err := d.decodeScalar(r, pm, tpl, f.Exponent)
+		if err != nil || !ok {
+			return Decimal{}, false, err
+		}
+		mant, _, err := d.decodeScalar(r, pm, tpl, f.Mantissa)
+		if err != nil {
+			return Decimal{}, false, err
+		}
+		return Decimal{Mantissa: int64(mant.(uint64)), Exponent: int32(int64(exp.(uint64)))}, true, nil
+	}
+	v, ok, err := d.decodeScalar(r, pm, tpl, f)
+	if err != nil || !ok {
+		return Decimal{}, false, err
+	}
+	return v.(Decimal), true, nil
+}
+
+// decodeScalar decodes an integer, decimal, string or byte vector applying
+// the field operator. It returns false for absent optional fields.
+func (d *Decoder) decodeScalar(r *reader, pm *pmap, tpl *Template, f *Field) (any, bool, error) {
+	switch f.Operator {
+	case OpNone:
+		return d.read(r, f, f.Optional)
+	case OpConstant:
+		if f.Optional && !pm.next() {
+			return nil, false, nil
+		}
+		return f.Initial, true, nil
+	case OpDefault:
+		if pm.next() {
+			return d.read(r, f, f.Optional)
+		}
+		if f.Initial == nil {
+			if !f.Optional {
+				return nil, false, errors.New("fast: mandatory default field without initial value")
+			}
+			return nil, false, nil
+		}
+		return f.Initial, true, nil
+	case OpCopy, OpIncrement:
+		if pm.next() {
+			v, ok, err := d.read(r, f, f.Optional)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				d.setEmpty(tpl, f)
+				return nil, false, nil
+			}
+			d.set(tpl, f, v)
+			return v, true, nil
+		}
+		prev, defined := d.dict[d.key(tpl, f)]
+		switch {
+		case !defined:
+			if f.Initial == nil {
+				if !f.Optional {
+					return nil, false, errors.New("fast: mandatory field without previous value")
+				}
+				d.setEmpty(tpl, f)
+				return nil, false, nil
+			}
+			d.set(tpl, f, f.Initial)
+			return f.Initial, true, nil
+		case prev.empty:
+			if !f.Optional {
+				return nil, false, errors.New("fast: mandatory field with empty previous value")
+			}
+			return nil, false, nil
+		case f.Operator == OpIncrement:
+			v := prev.value.(uint64) + 1
+			if f.Type == TypeInt32 || f.Type == TypeUInt32 {
+				v = uint64(uint32(v))
+			}
+			d.set(tpl, f, v)
+			return v, true, nil
+		default:
+			return prev.value, true, nil
+		}
+	case OpDelta:
+		return d.decodeDelta(r, tpl, f)
+	case OpTail:
+		return d.decodeTail(r, pm, tpl, f)
+	}
+	return nil, false, fmt.Errorf("fast: unsupported operator %d", f.Operator)
+}
+
+// base returns the base value of delta and tail operators
+func (d *Decoder) base(tpl *Template, f *Field) (any, error) {
+	prev, defined := d.dict[d.key(tpl, f)]
+	switch {
+	case !defined:
+		if f.Initial != nil {
+			return f.Initial, nil
+		}
+		switch f.Type {
+		case TypeDecimal:
+			return Decimal{}, nil
+		case TypeASCII, TypeUnicode:
+			return "", nil
+		case TypeByteVector:
+			return []byte{}, nil
+		default:
+			return uint64(0), nil
+		}
+	case prev.empty:
+		return nil, errors.New("fast: delta or tail with empty previous value")
+	default:
+		return prev.value, nil
+	}
+}
+
+func (d *Decoder) decodeDelta(r *reader, tpl *Template, f *Field) (any, bool, error) {
+	switch f.Type {
+	case TypeInt32, TypeUInt32, TypeInt64, TypeUInt64:
+		delta, null, err := r.intNullable(f.Optional)
+		if err != nil || null {
+			return nil, false, err
+		}
+		base, err := d.base(tpl, f)
+		if err != nil {
+			return nil, false, err
+		}
+		v := base.(uint64) + uint64(delta)
+		d.set(tpl, f, v)
+		return v, true, nil
+	case TypeDecimal:
+		expDelta, null, err := r.intNullable(f.Optional)
+		if err != nil || null {
+			return nil, false, err
+		}
+		mantDelta, err := r.int()
+		if err != nil {
+			return nil, false, err
+		}
+		base, err := d.base(tpl, f)
+		if err != nil {
+			return nil, false, err
+		}
+		b := base.(Decimal)
+		v := Decimal{Mantissa: b.Mantissa + mantDelta, Exponent: b.Exponent + int32(expDelta)}
+		d.set(tpl, f, v)
+		return v, true, nil
+	default:
+		sub, null, err := r.intNullable(f.Optional)
+		if err != nil || null {
+			return nil, false, err
+		}
+		diff, _, err := d.readBytes(r, f, false)
+		if err != nil {
+			return nil, false, err
+		}
+		base, err := d.base(tpl, f)
+		if err != nil {
+			return nil, false, err
+		}
+		b := toBytes(base)
+		var v []byte
+		if sub >= 0 {
+			if sub > int64(len(b)) {
+				return nil, false, errors.New("fast: string delta subtraction too long")
+			}
+			v = append(append([]byte{}, b[:int64(len(b))-sub]...), diff...)
+		} else {
+			sub = -sub - 1
+			if sub > int64(len(b)) {
+				return nil, false, errors.New("fast: string delta subtraction too long")
+			}
+			v = append(append([]byte{}, diff...), b[sub:]...)
+		}
+		val := fromBytes(f.Type, v)
+		d.set(tpl, f, val)
+		return val, true, nil
+	}
+}
+
+func (d *Decoder) decodeTail(r *reader, pm *pmap, tpl *Template, f *Field) (any, bool, error) {
+	if !pm.next() {
+		prev, defined := d.dict[d.key(tpl, f)]
+		switch {
+		case !defined:
+			if f.Initial == nil {
+				if !f.Optional {
+					return nil, false, errors.New("fast: mandatory tail field without previous value")
+				}
+				d.setEmpty(tpl, f)
+				return nil, false, nil
+			}
+			d.set(tpl, f, f.Initial)
+			return f.Initial, true, nil
+		case prev.empty:
+			return nil, false, nil
+		default:
+			return prev.value, true, nil
+		}
+	}
+	tail, ok, err := d.readBytes(r, f, f.Optional)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		d.setEmpty(tpl, f)
+		return nil, false, nil
+	}
+	base, err := d.base(tpl, f)
+	if err != nil {
+		base = []byte{}
+	}
+	b := toBytes(base)
+	var v []byte
+	if len(tail) >= len(b) {
+		v = append([]byte{}, tail...)
+	} else {
+		v = append(append([]byte{}, b[:len(b)-len(tail)]...), tail...)
+	}
+	val := fromBytes(f.Type, v)
+	d.set(tpl, f, val)
+	return val, true, nil
+}
+
+// read reads a value of the field type from the stream
+func (d *Decoder) read(r *reader, f *Field, nullable bool) (any, bool, error) {
+	switch f.Type {
+	case TypeUInt32, TypeUInt64:
+		v, null, err := r.uintNullable(nullable)
+		if err != nil || null {
+			return nil, false, err
+		}
+		return v, true, nil
+	case TypeInt32, TypeInt64:
+		v, null, err := r.intNullable(nullable)
+		if err != nil || null {
+			return nil, false, err
+		}
+		return uint64(v), true, nil
+	case TypeDecimal:
+		exp, null, err := r.intNullable(nullable)
+		if err != nil || null {
+			return nil, false, err
+		}
+		mant, err := r.int()
+		if err != nil {
+			return nil, false, err
+		}
+		return Decimal{Mantissa: mant, Exponent: int32(exp)}, true, nil
+	default:
+		b, ok, err := d.readBytes(r, f, nullable)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		return fromBytes(f.Type, b), true, nil
+	}
+}
+
+// readBytes reads an ASCII string, or a length prefixed unicode string or byte vector
+func (d *Decoder) readBytes(r *reader, f *Field, nullable bool) ([]byte, bool, error) {
+	if f.Type == TypeASCII {
+		return r.ascii(nullable)
+	}
+	n, null, err := r.uintNullable(nullable)
+	if err != nil || null {
+		return nil, false, err
+	}
+	b, err := r.bytes(n)
+	return b, err == nil, err
+}
+
+func toBytes(v any) []byte {
+	switch b := v.(type) {
+	case string:
+		return []byte(b)
+	case []byte:
+		return b
+	}
+	return nil
+}
+
+func fromBytes(t Type, b []byte) any {
+	if t == TypeByteVector {
+		return append([]byte{}, b...)
+	}
+	return string(b)
+}
+
+// external converts the internal representation of integers to the Go type
+// of the field type
+func external(t Type, v any) any {
+	switch t {
+	case TypeInt32:
+		return int64(int32(v.(uint64)))
+	case TypeInt64:
+		return int64(v.(uint64))
+	case TypeUInt32:
+		return uint64(uint32(v.(uint64)))
+	}
+	return v
+}
@@ -0,0 +1,201 @@
+package fast
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testTemplates = `<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+  <template id="1" name="Quote">
+    <uInt32 name="MsgSeqNum" id="34"><increment/></uInt32>
+    <string name="Symbol" id="55"><copy/></string>
+    <decimal name="Price" id="44" presence="optional"><delta/></decimal>
+    <int32 name="Qty" id="38"/>
+    <sequence name="Entries">
+      <length name="NoEntries"/>
+      <uInt64 name="Id"/>
+    </sequence>
+    <string name="Text" presence="optional"/>
+  </template>
+  <template id="2" name="Heartbeat">
+    <uInt32 name="MsgType"><constant value="0"/></uInt32>
+    <decimal name="Ratio"><default value="1.50"/></decimal>
+  </template>
+</templates>`
+
+func loadTestTemplates(t *testing.T) *Templates {
+	t.Helper()
+	templates, err := LoadTemplates(strings.NewReader(testTemplates))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+func TestDecodeQuotes(t *testing.T) {
+	d := NewDecoder(loadTestTemplates(t))
+	packet := []byte{
+		// pmap: template id, MsgSeqNum and Symbol present
+		0xF0, 0x81, 0x85, 0x41, 0xC2,
+		// Price: exponent -2, mantissa 12345
+		0xFE, 0x00, 0x60, 0xB9,
+		// Qty -5, 2 entries with Id 1 and 300, Text null
+		0xFB, 0x82, 0x81, 0x02, 0xAC, 0x80,
+		// pmap: copied template id, increment MsgSeqNum, copied Symbol
+		0x80,
+		// Price: exponent +0, mantissa +5, Qty 7, no entries, Text "hi"
+		0x81, 0x85, 0x87, 0x80, 0x68, 0xE9,
+		// Price null, Qty 1, no entries, Text null
+		0x80, 0x80, 0x81, 0x80, 0x80,
+	}
+	msgs, err := d.DecodeAll(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("decoded %d messages, want 3", len(msgs))
+	}
+
+	m := msgs[0]
+	if m.TemplateID != 1 || m.Name != "Quote" {
+		t.Fatalf("template %d %s", m.TemplateID, m.Name)
+	}
+	if v, _ := m.Fields.Uint("MsgSeqNum"); v != 5 {
+		t.Errorf("MsgSeqNum = %d, want 5", v)
+	}
+	if v, _ := m.Fields.String("Symbol"); v != "AB" {
+		t.Errorf("Symbol = %q, want AB", v)
+	}
+	if v, _ := m.Fields.Decimal("Price"); v != (Decimal{Mantissa: 12345, Exponent: -2}) || v.String() != "123.45" {
+		t.Errorf("Price = %v", v)
+	}
+	if v, _ := m.Fields.Int("Qty"); v != -5 {
+		t.Errorf("Qty = %d, want -5", v)
+	}
+	entries := m.Fields.Sequence("Entries")
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	if id, _ := entries[1].Uint("Id"); id != 300 {
+		t.Errorf("Entries[1].Id = %d, want 300", id)
+	}
+	if _, ok := m.Fields.Get("Text"); ok {
+		t.Error("null Text decoded")
+	}
+
+	m = msgs[1]
+	if v, _ := m.Fields.Uint("MsgSeqNum"); v != 6 {
+		t.Errorf("incremented MsgSeqNum = %d, want 6", v)
+	}
+	if v, _ := m.Fields.String("Symbol"); v != "AB" {
+		t.Errorf("copied Symbol = %q, want AB", v)
+	}
+	if v, _ := m.Fields.Decimal("Price"); v.String() != "123.50" {
+		t.Errorf("delta Price = %v, want 123.50", v)
+	}
+	if v, _ := m.Fields.String("Text"); v != "hi" {
+		t.Errorf("Text = %q, want hi", v)
+	}
+
+	m = msgs[2]
+	if _, ok := m.Fields.Get("Price"); ok {
+		t.Error("null Price decoded")
+	}
+	if v, _ := m.Fields.Uint("MsgSeqNum"); v != 7 {
+		t.Errorf("incremented MsgSeqNum = %d, want 7", v)
+	}
+}
+
+func TestDecodeDefaultAndConstant(t *testing.T) {
+	d := NewDecoder(loadTestTemplates(t))
+	// pmap: template id present, Ratio absent, then Ratio present
+	msgs, err := d.DecodeAll([]byte{0xC0, 0x82, 0xA0, 0xFD, 0x87})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("decoded %d messages, want 2", len(msgs))
+	}
+	if v, _ := msgs[0].Fields.Uint("MsgType"); v != 0 {
+		t.Errorf("constant MsgType = %d", v)
+	}
+	if v, _ := msgs[0].Fields.Decimal("Ratio"); v != (Decimal{Mantissa: 15, Exponent: -1}) {
+		t.Errorf("default Ratio = %v, want 1.5", v)
+	}
+	if v, _ := msgs[1].Fields.Decimal("Ratio"); v.String() != "0.007" {
+		t.Errorf("Ratio = %v, want 0.007", v)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+		msg  string
+	}{
+		{"truncated pmap", []byte{0x40}, ErrEOF, ""},
+		{"truncated field", []byte{0xF0, 0x81, 0x85, 0x41}, ErrEOF, ""},
+		{"overflow", []byte{0xF0, 0x81, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x81}, ErrOverflow, ""},
+		{"unknown template", []byte{0xC0, 0x89}, nil, "unknown template id 9"},
+		{"missing template id", []byte{0x80}, nil, "missing template id"},
+		{"sequence too long", []byte{0xF0, 0x81, 0x85, 0x41, 0xC2, 0x80, 0x81, 0xFF}, nil, "invalid length 127"},
+	}
+	templates := loadTestTemplates(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := NewDecoder(templates).Decode(tt.data)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if tt.msg != "" && !strings.Contains(err.Error(), tt.msg) {
+				t.Fatalf("error %v, want %q", err, tt.msg)
+			}
+		})
+	}
+}
+
+func TestDecoderReset(t *testing.T) {
+	d := NewDecoder(loadTestTemplates(t))
+	if _, _, err := d.Decode([]byte{0xF0, 0x81, 0x85, 0x41, 0xC2, 0x80, 0x81, 0x80, 0x80}); err != nil {
+		t.Fatal(err)
+	}
+	d.Reset()
+	if _, _, err := d.Decode([]byte{0x80, 0x80, 0x81, 0x80, 0x80}); err == nil {
+		t.Fatal("template id and copied values kept across Reset")
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Decimal
+	}{
+		{"1.50", Decimal{15, -1}},
+		{"100", Decimal{1, 2}},
+		{"-0.25", Decimal{-25, -2}},
+		{"0", Decimal{0, 0}},
+	}
+	for _, tt := range tests {
+		got, err := parseDecimal(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("parseDecimal(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseDecimalInvalid(t *testing.T) {
+	// fractions never become integers when multiplied by 10
+	for _, s := range []string{"1/3", "1/2", "abc", "", "1e-64", "1e64", "99999999999999999999"} {
+		if got, err := parseDecimal(s); err == nil {
+			t.Errorf("parseDecimal(%q) = %v, want an error", s, got)
+		}
+	}
+	if got, err := parseDecimal("1.5e-62"); err != nil || got != (Decimal{15, -63}) {
+		t.Errorf("parseDecimal(1.5e-62) = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,161 @@
+package fast
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Decimal is a FAST scaled number: Mantissa * 10^Exponent
+type Decimal struct {
+	Mantissa int64
+	Exponent int32
+}
+
+// Float64 returns the decimal as a float
+func (d Decimal) Float64() float64 {
+	return float64(d.Mantissa) * math.Pow10(int(d.Exponent))
+}
+
+func (d Decimal) String() string {
+	if d.Exponent >= 0 {
+		return strconv.FormatInt(d.Mantissa, 10) + strings.Repeat("0", int(d.Exponent))
+	}
+	s := strconv.FormatInt(d.Mantissa, 10)
+	sign := ""
+	if d.Mantissa < 0 {
+		sign, s = "-", s[1:]
+	}
+	n := int(-d.Exponent)
+	if len(s) <= n {
+		s = strings.Repeat("0", n-len(s)+1) + s
+	}
+	return sign + s[:len(s)-n] + "." + s[len(s)-n:]
+}
+
+// Value is a decoded field. Value is one of int64, uint64, Decimal, string,
+// []byte, Group (group), []Group (sequence) or *Message (dynamic template
+// reference).
+type Value struct {
+	Name  string
+	ID    string
+	Value any
+}
+
+// Group is the list of the decoded fields of a message, group or sequence element
+type Group []Value
+
+// Get returns the value of the field with the name, looking into the fields
+// of static template references but not into groups and sequences.
+func (g Group) Get(name string) (any, bool) {
+	for _, v := range g {
+		if v.Name == name {
+			return v.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Int returns the value of an integer field
+func (g Group) Int(name string) (int64, bool) {
+	v, ok := g.Get(name)
+	if !ok {
+		return 0, false
+	}
+	switch i := v.(type) {
+	case int64:
+		return i, true
+	case uint64:
+		return int64(i), true
+	}
+	return 0, false
+}
+
+// Uint returns the value of an unsigned integer field
+func (g Group) Uint(name string) (uint64, bool) {
+	v, ok := g.Get(name)
+	if !ok {
+		return 0, false
+	}
+	switch i := v.(type) {
+	case int64:
+		return uint64(i), true
+	case uint64:
+		return i, true
+	}
+	return 0, false
+}
+
+// Decimal returns the value of a decimal field
+func (g Group) Decimal(name string) (Decimal, bool) {
+	v, ok := g.Get(name)
+	if !ok {
+		return Decimal{}, false
+	}
+	d, ok := v.(Decimal)
+	return d, ok
+}
+
+// String returns the value of a string field
+func (g Group) String(name string) (string, bool) {
+	v, ok := g.Get(name)
+	if !ok {
+		return "", false
+	}
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case []byte:
+		return string(s), true
+	}
+	return "", false
+}
+
+// Sequence returns the elements of a sequence field
+func (g Group) Sequence(name string) []Group {
+	v, _ := g.Get(name)
+	s, _ := v.([]Group)
+	return s
+}
+
+// Message is a decoded FAST message
+type Message struct {
+	TemplateID uint32
+	Name       string
+	Fields     Group
+}
+
+// String returns the message with one field per line
+func (m *Message) String() string {
+	var sb strings.Builder
+	m.write(&sb, "")
+	return sb.String()
+}
+
+func (m *Message) write(sb *strings.Builder, indent string) {
+	fmt.Fprintf(sb, "%s%s [tid %d]\n", indent, m.Name, m.TemplateID)
+	writeGroup(sb, m.Fields, indent+"  ")
+}
+
+func writeGroup(sb *strings.Builder, g Group, indent string) {
+	for _, v := range g {
+		switch val := v.Value.(type) {
+		case Group:
+			fmt.Fprintf(sb, "%s%s:\n", indent, v.Name)
+			writeGroup(sb, val, indent+"  ")
+		case []Group:
+			fmt.Fprintf(sb, "%s%s: [%d]\n", indent, v.Name, len(val))
+			for i, e := range val {
+				fmt.Fprintf(sb, "%s  [%d]\n", indent, i)
+				writeGroup(sb, e, indent+"    ")
+			}
+		case *Message:
+			val.write(sb, indent)
+		case []byte:
+			fmt.Fprintf(sb, "%s%s: %X\n", indent, v.Name, val)
+		default:
+			fmt.Fprintf(sb, "%s%s: %v\n", indent, v.Name, val)
+		}
+	}
+}
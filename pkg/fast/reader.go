@@ -0,0 +1,151 @@
+package fast
+
+// reader reads the FAST stop bit encoded primitives of a buffer
+type reader struct {
+	buf []byte
+	pos int
+}
+
+// pmap is a presence map, its bits are consumed in order
+type pmap struct {
+	bits []byte
+	i    int
+}
+
+// next returns the next bit of the presence map, false past its end
+func (p *pmap) next() bool {
+	byteIdx := p.i / 7
+	bit := 6 - p.i%7
+	p.i++
+	if byteIdx >= len(p.bits) {
+		return false
+	}
+	return p.bits[byteIdx]&(1<<bit) != 0
+}
+
+func (r *reader) pmap() (pmap, error) {
+	start := r.pos
+	for {
+		if r.pos >= len(r.buf) {
+			return pmap{}, ErrEOF
+		}
+		b := r.buf[r.pos]
+		r.pos++
+		if b&0x80 != 0 {
+			break
+		}
+	}
+	return pmap{bits: r.buf[start:r.pos]}, nil
+}
+
+func (r *reader) uint() (uint64, error) {
+	var v uint64
+	for i := 0; ; i++ {
+		if r.pos >= len(r.buf) {
+			return 0, ErrEOF
+		}
+		if i >= 10 {
+			return 0, ErrOverflow
+		}
+		b := r.buf[r.pos]
+		r.pos++
+		v = v<<7 | uint64(b&0x7f)
+		if b&0x80 != 0 {
+			return v, nil
+		}
+	}
+}
+
+func (r *reader) int() (int64, error) {
+	if r.pos >= len(r.buf) {
+		return 0, ErrEOF
+	}
+	var v int64
+	if r.buf[r.pos]&0x40 != 0 {
+		// negative number, sign extend
+		v = -1
+	}
+	for i := 0; ; i++ {
+		if r.pos >= len(r.buf) {
+			return 0, ErrEOF
+		}
+		if i >= 10 {
+			return 0, ErrOverflow
+		}
+		b := r.buf[r.pos]
+		r.pos++
+		v = v<<7 | int64(b&0x7f)
+		if b&0x80 != 0 {
+			return v, nil
+		}
+	}
+}
+
+// uintNullable reads an unsigned integer, when nullable 0 is null and the
+// other values are shifted by one
+func (r *reader) uintNullable(nullable bool) (uint64, bool, error) {
+	v, err := r.uint()
+	if err != nil || !nullable {
+		return v, false, err
+	}
+	if v == 0 {
+		return 0, true, nil
+	}
+	return v - 1, false, nil
+}
+
+// intNullable reads a signed integer, when nullable 0 is null and the
+// positive values are shifted by one
+func (r *reader) intNullable(nullable bool) (int64, bool, error) {
+	v, err := r.int()
+	if err != nil || !nullable {
+		return v, false, err
+	}
+	if v == 0 {
+		return 0, true, nil
+	}
+	if v > 0 {
+		v--
+	}
+	return v, false, nil
+}
+
+// ascii reads a stop bit terminated ASCII string
+func (r *reader) ascii(nullable bool) ([]byte, bool, error) {
+	start := r.pos
+	for {
+		if r.pos >= len(r.buf) {
+			return nil, false, ErrEOF
+		}
+		b := r.buf[r.pos]
+		r.pos++
+		if b&0x80 != 0 {
+			break
+		}
+	}
+	raw := r.buf[start:r.pos]
+	if len(raw) == 1 && raw[0] == 0x80 {
+		// null when nullable, empty string otherwise
+		return []byte{}, !nullable, nil
+	}
+	if len(raw) == 2 && raw[0] == 0 && raw[1] == 0x80 {
+		// empty string when nullable, NUL character otherwise
+		if nullable {
+			return []byte{}, true, nil
+		}
+		return []byte{0}, true, nil
+	}
+	s := make([]byte, len(raw))
+	copy(s, raw)
+	s[len(s)-1] &= 0x7f
+	return s, true, nil
+}
+
+func (r *reader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.buf)-r.pos) {
+		return nil, ErrEOF
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
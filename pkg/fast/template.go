@@ -0,0 +1,386 @@
+package fast
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Type is the FAST type of a template field
+type Type int
+
+const (
+	TypeInt32 Type = iota
+	TypeUInt32
+	TypeInt64
+	TypeUInt64
+	TypeDecimal
+	TypeASCII
+	TypeUnicode
+	TypeByteVector
+	TypeSequence
+	TypeGroup
+	TypeTemplateRef
+)
+
+// Operator is a FAST field operator
+type Operator int
+
+const (
+	OpNone Operator = iota
+	OpConstant
+	OpDefault
+	OpCopy
+	OpIncrement
+	OpDelta
+	OpTail
+)
+
+// Field is an instruction of a template
+type Field struct {
+	Name     string
+	ID       string
+	Type     Type
+	Optional bool
+
+	Operator Operator
+	// Initial is the parsed initial value of the operator, nil when not given
+	Initial any
+	// Key and Dictionary identify the previous value of copy, increment,
+	// delta and tail operators
+	Key        string
+	Dictionary string
+
+	// Exponent and Mantissa are set for decimals with individual operators
+	Exponent *Field
+	Mantissa *Field
+
+	// Length is the length field of a sequence
+	Length *Field
+	// Fields are the instructions of a sequence or group
+	Fields []*Field
+
+	// Ref is the name of the template of a static template reference,
+	// empty for a dynamic one
+	Ref string
+}
+
+// Template is a FAST message template
+type Template struct {
+	ID         uint32
+	Name       string
+	Dictionary string
+	Fields     []*Field
+}
+
+// Templates is a set of templates loaded from a FAST template definition XML
+type Templates struct {
+	byID   map[uint32]*Template
+	byName map[string]*Template
+}
+
+// ByID returns the template with the id or nil
+func (t *Templates) ByID(id uint32) *Template { return t.byID[id] }
+
+// ByName returns the template with the name or nil
+func (t *Templates) ByName(name string) *Template { return t.byName[name] }
+
+// Len returns the number of templates
+func (t *Templates) Len() int { return len(t.byID) }
+
+// xmlNode is a generic XML element used to walk the template definitions
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []xmlNode  `xml:",any"`
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// LoadTemplatesFile loads the FAST 1.1 template definitions of a file
+func LoadTemplatesFile(path string) (*Templates, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadTemplates(f)
+}
+
+// LoadTemplates loads FAST 1.1 template definitions
+func LoadTemplates(r io.Reader) (*Templates, error) {
+	var root xmlNode
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+
+	t := &Templates{
+		byID:   make(map[uint32]*Template),
+		byName: make(map[string]*Template),
+	}
+
+	var nodes []xmlNode
+	switch root.XMLName.Local {
+	case "templates":
+		nodes = root.Nodes
+	case "template":
+		nodes = []xmlNode{root}
+	default:
+		return nil, fmt.Errorf("unexpected root element %s", root.XMLName.Local)
+	}
+
+	for i := range nodes {
+		n := &nodes[i]
+		if n.XMLName.Local != "template" {
+			continue
+		}
+		id, err := strconv.ParseUint(n.attr("id"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: invalid id %q", n.attr("name"), n.attr("id"))
+		}
+		tpl := &Template{
+			ID:         uint32(id),
+			Name:       n.attr("name"),
+			Dictionary: n.attr("dictionary"),
+		}
+		tpl.Fields, err = parseFields(n.Nodes, tpl.Dictionary)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", tpl.Name, err)
+		}
+		t.byID[tpl.ID] = tpl
+		if tpl.Name != "" {
+			t.byName[tpl.Name] = tpl
+		}
+	}
+
+	// check the static references
+	for _, tpl := range t.byID {
+		if err := t.checkRefs(tpl.Fields); err != nil {
+			return nil, fmt.Errorf("template %s: %w", tpl.Name, err)
+		}
+	}
+	return t, nil
+}
+
+func (t *Templates) checkRefs(fields []*Field) error {
+	for _, f := range fields {
+		if f.Type == TypeTemplateRef && f.Ref != "" && t.byName[f.Ref] == nil {
+			return fmt.Errorf("unknown template reference %s", f.Ref)
+		}
+		if err := t.checkRefs(f.Fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var fieldTypes = map[string]Type{
+	"int32":       TypeInt32,
+	"uInt32":      TypeUInt32,
+	"int64":       TypeInt64,
+	"uInt64":      TypeUInt64,
+	"decimal":     TypeDecimal,
+	"string":      TypeASCII,
+	"byteVector":  TypeByteVector,
+	"sequence":    TypeSequence,
+	"group":       TypeGroup,
+	"templateRef": TypeTemplateRef,
+}
+
+var operators = map[string]Operator{
+	"constant":  OpConstant,
+	"default":   OpDefault,
+	"copy":      OpCopy,
+	"increment": OpIncrement,
+	"delta":     OpDelta,
+	"tail":      OpTail,
+}
+
+func parseFields(nodes []xmlNode, dictionary string) ([]*Field, error) {
+	var fields []*Field
+	for i := range nodes {
+		n := &nodes[i]
+		typ, ok := fieldTypes[n.XMLName.Local]
+		if !ok {
+			// typeRef, length of a sequence and any other unknown element
+			continue
+		}
+		f, err := parseField(n, typ, dictionary)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func parseField(n *xmlNode, typ Type, dictionary string) (*Field, error) {
+	f := &Field{
+		Name:       n.attr("name"),
+		ID:         n.attr("id"),
+		Type:       typ,
+		Optional:   n.attr("presence") == "optional",
+		Dictionary: dictionary,
+	}
+	if typ == TypeASCII && n.attr("charset") == "unicode" {
+		f.Type = TypeUnicode
+	}
+
+	switch f.Type {
+	case TypeTemplateRef:
+		f.Ref = n.attr("name")
+		return f, nil
+	case TypeSequence:
+		f.Length = &Field{Name: f.Name + "Length", Type: TypeUInt32, Optional: f.Optional, Dictionary: dictionary}
+		for i := range n.Nodes {
+			c := &n.Nodes[i]
+			if c.XMLName.Local == "length" {
+				f.Length.Name = c.attr("name")
+				f.Length.ID = c.attr("id")
+				if err := parseOperator(c, f.Length); err != nil {
+					return nil, err
+				}
+			}
+		}
+		fallthrough
+	case TypeGroup:
+		if d := n.attr("dictionary"); d != "" {
+			dictionary = d
+		}
+		var err error
+		f.Fields, err = parseFields(n.Nodes, dictionary)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		return f, nil
+	case TypeDecimal:
+		for i := range n.Nodes {
+			c := &n.Nodes[i]
+			switch c.XMLName.Local {
+			case "exponent":
+				f.Exponent = &Field{Name: f.Name + "Exponent", Type: TypeInt32, Optional: f.Optional, Dictionary: dictionary}
+				if err := parseOperator(c, f.Exponent); err != nil {
+					return nil, err
+				}
+			case "mantissa":
+				f.Mantissa = &Field{Name: f.Name + "Mantissa", Type: TypeInt64, Dictionary: dictionary}
+				if err := parseOperator(c, f.Mantissa); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if f.Exponent != nil || f.Mantissa != nil {
+			if f.Exponent == nil {
+				f.Exponent = &Field{Name: f.Name + "Exponent", Type: TypeInt32, Optional: f.Optional, Dictionary: dictionary}
+			}
+			if f.Mantissa == nil {
+				f.Mantissa = &Field{Name: f.Name + "Mantissa", Type: TypeInt64, Dictionary: dictionary}
+			}
+			return f, nil
+		}
+	}
+
+	if err := parseOperator(n, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parseOperator reads the operator child element of the node into f
+func parseOperator(n *xmlNode, f *Field) error {
+	for i := range n.Nodes {
+		c := &n.Nodes[i]
+		op, ok := operators[c.XMLName.Local]
+		if !ok {
+			continue
+		}
+		f.Operator = op
+		f.Key = c.attr("key")
+		if d := c.attr("dictionary"); d != "" {
+			f.Dictionary = d
+		}
+		for _, a := range c.Attrs {
+			if a.Name.Local == "value" {
+				v, err := parseValue(f.Type, a.Value)
+				if err != nil {
+					return fmt.Errorf("field %s: %w", f.Name, err)
+				}
+				f.Initial = v
+			}
+		}
+		if op == OpConstant && f.Initial == nil {
+			return fmt.Errorf("field %s: constant operator without value", f.Name)
+		}
+	}
+	if f.Key == "" {
+		f.Key = f.Name
+	}
+	return nil
+}
+
+// parseValue converts the initial value of an operator to the internal
+// representation of the type: uint64 for integers (two's complement for
+// signed ones), Decimal, string or []byte.
+func parseValue(typ Type, s string) (any, error) {
+	s = strings.TrimSpace(s)
+	switch typ {
+	case TypeInt32, TypeInt64:
+		v, err := strconv.ParseInt(s, 10, 64)
+		return uint64(v), err
+	case TypeUInt32, TypeUInt64:
+		return strconv.ParseUint(s, 10, 64)
+	case TypeDecimal:
+		return parseDecimal(s)
+	case TypeByteVector:
+		return []byte(s), nil
+	default:
+		return s, nil
+	}
+}
+
+// parseDecimal parses a decimal initial value. big.Rat also accepts the
+// fractions (1/3) that are rejected, and the exponent is bounded to the
+// -63..63 range of the FAST decimals.
+func parseDecimal(s string) (Decimal, error) {
+	if strings.Contains(s, "/") {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	var exp int32
+	for !r.IsInt() {
+		if exp == -63 {
+			return Decimal{}, fmt.Errorf("decimal %q out of range", s)
+		}
+		r.Mul(r, big.NewRat(10, 1))
+		exp--
+	}
+	m := r.Num()
+	ten := big.NewInt(10)
+	zero := big.NewInt(0)
+	for m.Sign() != 0 {
+		q, rem := new(big.Int).QuoRem(m, ten, new(big.Int))
+		if rem.Cmp(zero) != 0 {
+			break
+		}
+		m = q
+		exp++
+	}
+	if !m.IsInt64() || exp > 63 {
+		return Decimal{}, fmt.Errorf("decimal %q out of range", s)
+	}
+	return Decimal{Mantissa: m.Int64(), Exponent: exp}, nil
+}
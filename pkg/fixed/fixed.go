@@ -0,0 +1,141 @@
+package fixed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kind is the wire type of a message field
+type Kind int
+
+const (
+	// KindAlpha is a string padded on the right
+	KindAlpha Kind = iota
+	// KindUint is an unsigned integer of 1, 2, 4 or 8 bytes
+	KindUint
+	// KindPrice is an unsigned integer with implied decimals
+	KindPrice
+	// KindSignedPrice is a signed integer with implied decimals
+	KindSignedPrice
+)
+
+// Spec is a field of a layout
+type Spec struct {
+	Name string
+	Kind Kind
+	// Size is the size of the field in bytes
+	Size int
+	// Decimals is the number of implied decimals of the prices
+	Decimals int
+}
+
+// Alpha returns the spec of an alpha field
+func Alpha(name string, size int) Spec {
+	return Spec{Name: name, Kind: KindAlpha, Size: size}
+}
+
+// Uint returns the spec of an unsigned integer field
+func Uint(name string, size int) Spec {
+	return Spec{Name: name, Kind: KindUint, Size: size}
+}
+
+// Price returns the spec of an unsigned integer field with implied decimals
+func Price(name string, size int, decimals int) Spec {
+	return Spec{Name: name, Kind: KindPrice, Size: size, Decimals: decimals}
+}
+
+// SignedPrice returns the spec of a signed integer field with implied
+// decimals
+func SignedPrice(name string, size int, decimals int) Spec {
+	return Spec{Name: name, Kind: KindSignedPrice, Size: size, Decimals: decimals}
+}
+
+// Layout is the name and the fields of a message type
+type Layout struct {
+	Name   string
+	Fields []Spec
+}
+
+// Field is a decoded message field. Value is uint64, a string for the alpha
+// fields or, for prices, a decimal string.
+type Field struct {
+	Name  string
+	Value any
+}
+
+// Decoder decodes the fixed layout messages of a protocol
+type Decoder struct {
+	Order binary.ByteOrder
+	// Trim is the set of padding characters trimmed from the alpha fields
+	Trim string
+	// Offset is the position of the first field, after the message header
+	Offset int
+}
+
+// Decode appends the fields of the layout read from the message b to fields.
+// On error the fields read until then are returned.
+func (d *Decoder) Decode(fields []Field, l *Layout, b []byte) ([]Field, error) {
+	off := d.Offset
+	for _, f := range l.Fields {
+		if off+f.Size > len(b) {
+			return fields, fmt.Errorf("%s message of %d bytes truncated at %s", l.Name, len(b), f.Name)
+		}
+		v := b[off : off+f.Size]
+		off += f.Size
+		switch f.Kind {
+		case KindAlpha:
+			fields = append(fields, Field{f.Name, strings.TrimRight(string(v), d.Trim)})
+		case KindUint:
+			fields = append(fields, Field{f.Name, d.uint(v)})
+		case KindPrice:
+			fields = append(fields, Field{f.Name, Scaled(d.uint(v), f.Decimals)})
+		case KindSignedPrice:
+			fields = append(fields, Field{f.Name, ScaledSigned(d.int(v), f.Decimals)})
+		}
+	}
+	return fields, nil
+}
+
+func (d *Decoder) uint(v []byte) uint64 {
+	switch len(v) {
+	case 1:
+		return uint64(v[0])
+	case 2:
+		return uint64(d.Order.Uint16(v))
+	case 4:
+		return uint64(d.Order.Uint32(v))
+	}
+	return d.Order.Uint64(v)
+}
+
+// int sign extends the integer of its size
+func (d *Decoder) int(v []byte) int64 {
+	switch len(v) {
+	case 1:
+		return int64(int8(v[0]))
+	case 2:
+		return int64(int16(d.Order.Uint16(v)))
+	case 4:
+		return int64(int32(d.Order.Uint32(v)))
+	}
+	return int64(d.Order.Uint64(v))
+}
+
+// Scaled formats a fixed point number with the implied decimals
+func Scaled(v uint64, decimals int) string {
+	s := strconv.FormatUint(v, 10)
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	return s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
+
+// ScaledSigned formats a signed fixed point number with the implied decimals
+func ScaledSigned(v int64, decimals int) string {
+	if v < 0 {
+		return "-" + Scaled(-uint64(v), decimals)
+	}
+	return Scaled(uint64(v), decimals)
+}
@@ -0,0 +1,100 @@
+package fixed
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+var testLayout = Layout{Name: "Test", Fields: []Spec{
+	Alpha("Symbol", 6),
+	Uint("Small", 1),
+	Uint("Qty", 2),
+	Uint("ID", 4),
+	Uint("Big", 8),
+	Price("Px", 4, 4),
+	SignedPrice("Change", 8, 8),
+}}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		order binary.AppendByteOrder
+		trim  string
+	}{
+		{"big endian", binary.BigEndian, " "},
+		{"little endian", binary.LittleEndian, " \x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a 2 bytes header before the fields
+			b := append([]byte{0xAA, 0xBB}, "AB \x00  "...)
+			b = append(b, 7)
+			b = tt.order.AppendUint16(b, 300)
+			b = tt.order.AppendUint32(b, 70000)
+			b = tt.order.AppendUint64(b, 1<<40)
+			b = tt.order.AppendUint32(b, 1895000)
+			change := int64(-150000000)
+			b = tt.order.AppendUint64(b, uint64(change))
+			d := Decoder{Order: tt.order.(binary.ByteOrder), Trim: tt.trim, Offset: 2}
+
+			fields, err := d.Decode(nil, &testLayout, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			symbol := "AB \x00"
+			if tt.trim == " \x00" {
+				symbol = "AB"
+			}
+			want := []Field{
+				{"Symbol", symbol},
+				{"Small", uint64(7)},
+				{"Qty", uint64(300)},
+				{"ID", uint64(70000)},
+				{"Big", uint64(1 << 40)},
+				{"Px", "189.5000"},
+				{"Change", "-1.50000000"},
+			}
+			if len(fields) != len(want) {
+				t.Fatalf("fields %v", fields)
+			}
+			for i, f := range want {
+				if fields[i] != f {
+					t.Errorf("field %d = %q, want %q", i, fields[i], f)
+				}
+			}
+
+			fields, err = d.Decode(fields[:0], &testLayout, b[:len(b)-1])
+			if err == nil || len(fields) != len(want)-1 {
+				t.Fatalf("Decode of a truncated message = %v, %v", fields, err)
+			}
+			if err.Error() != "Test message of 34 bytes truncated at Change" {
+				t.Fatalf("error %v", err)
+			}
+		})
+	}
+}
+
+func TestScaled(t *testing.T) {
+	tests := []struct {
+		v        int64
+		decimals int
+		want     string
+	}{
+		{1895000, 4, "189.5000"},
+		{5, 4, "0.0005"},
+		{0, 4, "0.0000"},
+		{123456789012, 8, "1234.56789012"},
+		{-5, 2, "-0.05"},
+		{-1 << 63, 8, "-92233720368.54775808"},
+	}
+	for _, tt := range tests {
+		if got := ScaledSigned(tt.v, tt.decimals); got != tt.want {
+			t.Errorf("ScaledSigned(%d, %d) = %s, want %s", tt.v, tt.decimals, got, tt.want)
+		}
+		if tt.v >= 0 {
+			if got := Scaled(uint64(tt.v), tt.decimals); got != tt.want {
+				t.Errorf("Scaled(%d, %d) = %s, want %s", tt.v, tt.decimals, got, tt.want)
+			}
+		}
+	}
+}
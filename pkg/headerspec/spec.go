@@ -0,0 +1,168 @@
+package headerspec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Field is the position of an unsigned integer in the packet header
+type Field struct {
+	Offset int `mapstructure:"offset"`
+	// Size is the width in bytes: 1, 2, 4 or 8
+	Size int `mapstructure:"size"`
+	// ByteOrder is "big" or "little", the one of the spec when empty
+	ByteOrder string `mapstructure:"byte-order"`
+
+	order binary.ByteOrder
+}
+
+// Spec describes the packet header of a feed without a dedicated decoder,
+// e.g. loaded from the "header-specs" section of the config file:
+//
+//	header-specs:
+//	  myfeed:
+//	    byte-order: little
+//	    sequence: {offset: 4, size: 4}
+//	    count: {offset: 2, size: 1}
+//	    stream: {offset: 3, size: 1}
+//	    timestamp: {offset: 8, size: 8}
+//	    timestamp-unit: ns
+type Spec struct {
+	// ByteOrder is the default byte order of the fields, "big" or "little"
+	ByteOrder string `mapstructure:"byte-order"`
+	// Sequence is the sequence number of the packet, or of its first message
+	// when Count is set
+	Sequence *Field `mapstructure:"sequence"`
+	// Count is the number of messages of the packet, the ones without
+	// messages are heartbeats carrying the next sequence number
+	Count *Field `mapstructure:"count"`
+	// Stream is the key of the independent sequences, e.g. a channel or unit
+	Stream *Field `mapstructure:"stream"`
+	// Timestamp is the send time since the epoch in TimestampUnit
+	Timestamp     *Field `mapstructure:"timestamp"`
+	TimestampUnit string `mapstructure:"timestamp-unit"`
+
+	unit time.Duration
+	size int
+}
+
+// Header is a packet header decoded by a Spec
+type Header struct {
+	Sequence uint64
+	// Count is 1 when the spec has no message count
+	Count  uint64
+	Stream uint64
+	// Timestamp is zero when the spec has no timestamp
+	Timestamp time.Time
+}
+
+// Heartbeat returns true for the packets without messages
+func (h *Header) Heartbeat() bool { return h.Count == 0 }
+
+// NextSequence returns the sequence number expected after the packet
+func (h *Header) NextSequence() uint64 { return h.Sequence + h.Count }
+
+var units = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+func byteOrder(name string, def binary.ByteOrder) (binary.ByteOrder, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return def, nil
+	case "big":
+		return binary.BigEndian, nil
+	case "little":
+		return binary.LittleEndian, nil
+	}
+	return nil, fmt.Errorf("headerspec: invalid byte order %q", name)
+}
+
+// Validate checks the spec and prepares it for Parse. It must be called
+// once before any Parse.
+func (s *Spec) Validate() error {
+	if s.Sequence == nil {
+		return errors.New("headerspec: the sequence field is required")
+	}
+	order, err := byteOrder(s.ByteOrder, binary.BigEndian)
+	if err != nil {
+		return err
+	}
+	s.size = 0
+	fields := []struct {
+		name string
+		f    *Field
+	}{{"sequence", s.Sequence}, {"count", s.Count}, {"stream", s.Stream}, {"timestamp", s.Timestamp}}
+	for _, field := range fields {
+		name, f := field.name, field.f
+		if f == nil {
+			continue
+		}
+		switch f.Size {
+		case 1, 2, 4, 8:
+		default:
+			return fmt.Errorf("headerspec: invalid size %d of the %s field", f.Size, name)
+		}
+		if f.Offset < 0 {
+			return fmt.Errorf("headerspec: invalid offset %d of the %s field", f.Offset, name)
+		}
+		if f.order, err = byteOrder(f.ByteOrder, order); err != nil {
+			return err
+		}
+		s.size = max(s.size, f.Offset+f.Size)
+	}
+	if s.Timestamp != nil {
+		unit, ok := units[strings.ToLower(s.TimestampUnit)]
+		if !ok && s.TimestampUnit != "" {
+			return fmt.Errorf("headerspec: invalid timestamp unit %q (s, ms, us or ns)", s.TimestampUnit)
+		}
+		if !ok {
+			unit = time.Nanosecond
+		}
+		s.unit = unit
+	}
+	return nil
+}
+
+// Size returns the minimum size of a packet holding all the fields
+func (s *Spec) Size() int { return s.size }
+
+// Parse decodes the header at the beginning of a datagram
+func (s *Spec) Parse(b []byte) (Header, error) {
+	if len(b) < s.size {
+		return Header{}, fmt.Errorf("headerspec: packet of %d bytes shorter than the header of %d", len(b), s.size)
+	}
+	h := Header{
+		Sequence: s.Sequence.uint(b),
+		Count:    1,
+	}
+	if s.Count != nil {
+		h.Count = s.Count.uint(b)
+	}
+	if s.Stream != nil {
+		h.Stream = s.Stream.uint(b)
+	}
+	if s.Timestamp != nil {
+		h.Timestamp = time.Unix(0, int64(s.Timestamp.uint(b))*int64(s.unit))
+	}
+	return h, nil
+}
+
+func (f *Field) uint(b []byte) uint64 {
+	b = b[f.Offset : f.Offset+f.Size]
+	switch f.Size {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(f.order.Uint16(b))
+	case 4:
+		return uint64(f.order.Uint32(b))
+	}
+	return f.order.Uint64(b)
+}
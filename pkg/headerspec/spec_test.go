@@ -0,0 +1,84 @@
+package headerspec
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	s := Spec{
+		ByteOrder:     "little",
+		Sequence:      &Field{Offset: 4, Size: 4},
+		Count:         &Field{Offset: 2, Size: 1},
+		Stream:        &Field{Offset: 3, Size: 1},
+		Timestamp:     &Field{Offset: 8, Size: 8, ByteOrder: "big"},
+		TimestampUnit: "us",
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() != 16 {
+		t.Fatalf("Size() = %d, want 16", s.Size())
+	}
+	b := []byte{0, 0, 3, 9}
+	b = binary.LittleEndian.AppendUint32(b, 1000)
+	b = binary.BigEndian.AppendUint64(b, 1700000000123456)
+	h, err := s.Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Header{Sequence: 1000, Count: 3, Stream: 9, Timestamp: time.UnixMicro(1700000000123456)}
+	if h.Sequence != want.Sequence || h.Count != want.Count || h.Stream != want.Stream || !h.Timestamp.Equal(want.Timestamp) {
+		t.Fatalf("header %+v, want %+v", h, want)
+	}
+	if h.Heartbeat() || h.NextSequence() != 1003 {
+		t.Fatalf("heartbeat %v, next sequence %d", h.Heartbeat(), h.NextSequence())
+	}
+	if _, err := s.Parse(b[:15]); err == nil {
+		t.Fatal("no error for a packet shorter than the header")
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	// big endian, one message per packet, no stream nor timestamp
+	s := Spec{Sequence: &Field{Offset: 0, Size: 8}}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	h, err := s.Parse(binary.BigEndian.AppendUint64(nil, 1<<40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Sequence != 1<<40 || h.Count != 1 || h.Stream != 0 || !h.Timestamp.IsZero() {
+		t.Fatalf("header %+v", h)
+	}
+
+	s = Spec{Sequence: &Field{Size: 2}, Count: &Field{Offset: 2, Size: 2}}
+	s.Validate()
+	if h, _ := s.Parse([]byte{0, 5, 0, 0}); !h.Heartbeat() || h.NextSequence() != 5 {
+		t.Fatalf("heartbeat header %+v", h)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec Spec
+	}{
+		{"no sequence", Spec{}},
+		{"invalid byte order", Spec{ByteOrder: "middle", Sequence: &Field{Size: 4}}},
+		{"invalid field byte order", Spec{Sequence: &Field{Size: 4, ByteOrder: "native"}}},
+		{"invalid size", Spec{Sequence: &Field{Size: 3}}},
+		{"invalid offset", Spec{Sequence: &Field{Offset: -1, Size: 4}}},
+		{"invalid count size", Spec{Sequence: &Field{Size: 4}, Count: &Field{Size: 16}}},
+		{"invalid timestamp unit", Spec{Sequence: &Field{Size: 4}, Timestamp: &Field{Size: 8}, TimestampUnit: "h"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.spec.Validate(); err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package itch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/fixed"
+	"strings"
+	"time"
+)
+
+// HeaderSize is the size of the header shared by the ITCH 5.0 messages:
+// message type, stock locate, tracking number and timestamp
+const HeaderSize = 11
+
+var (
+	decoder = fixed.Decoder{Order: binary.BigEndian, Trim: " ", Offset: HeaderSize}
+	stock   = fixed.Alpha("Stock", 8)
+)
+
+// layouts are the ITCH 5.0 body layouts following the header by message type
+var layouts = map[byte]fixed.Layout{
+	'S': {Name: "SystemEvent", Fields: []fixed.Spec{
+		fixed.Alpha("EventCode", 1),
+	}},
+	'R': {Name: "StockDirectory", Fields: []fixed.Spec{
+		stock,
+		fixed.Alpha("MarketCategory", 1),
+		fixed.Alpha("FinancialStatusIndicator", 1),
+		fixed.Uint("RoundLotSize", 4),
+		fixed.Alpha("RoundLotsOnly", 1),
+		fixed.Alpha("IssueClassification", 1),
+		fixed.Alpha("IssueSubType", 2),
+		fixed.Alpha("Authenticity", 1),
+		fixed.Alpha("ShortSaleThresholdIndicator", 1),
+		fixed.Alpha("IPOFlag", 1),
+		fixed.Alpha("LULDReferencePriceTier", 1),
+		fixed.Alpha("ETPFlag", 1),
+		fixed.Uint("ETPLeverageFactor", 4),
+		fixed.Alpha("InverseIndicator", 1),
+	}},
+	'H': {Name: "StockTradingAction", Fields: []fixed.Spec{
+		stock,
+		fixed.Alpha("TradingState", 1),
+		fixed.Alpha("Reserved", 1),
+		fixed.Alpha("Reason", 4),
+	}},
+	'Y': {Name: "RegSHORestriction", Fields: []fixed.Spec{
+		stock,
+		fixed.Alpha("RegSHOAction", 1),
+	}},
+	'L': {Name: "MarketParticipantPosition", Fields: []fixed.Spec{
+		fixed.Alpha("MPID", 4),
+		stock,
+		fixed.Alpha("PrimaryMarketMaker", 1),
+		fixed.Alpha("MarketMakerMode", 1),
+		fixed.Alpha("MarketParticipantState", 1),
+	}},
+	'V': {Name: "MWCBDeclineLevel", Fields: []fixed.Spec{
+		fixed.Price("Level1", 8, 8),
+		fixed.Price("Level2", 8, 8),
+		fixed.Price("Level3", 8, 8),
+	}},
+	'W': {Name: "MWCBStatus", Fields: []fixed.Spec{
+		fixed.Alpha("BreachedLevel", 1),
+	}},
+	'K': {Name: "IPOQuotingPeriodUpdate", Fields: []fixed.Spec{
+		stock,
+		fixed.Uint("IPOQuotationReleaseTime", 4),
+		fixed.Alpha("IPOQuotationReleaseQualifier", 1),
+		fixed.Price("IPOPrice", 4, 4),
+	}},
+	'J': {Name: "LULDAuctionCollar", Fields: []fixed.Spec{
+		stock,
+		fixed.Price("AuctionCollarReferencePrice", 4, 4),
+		fixed.Price("UpperAuctionCollarPrice", 4, 4),
+		fixed.Price("LowerAuctionCollarPrice", 4, 4),
+		fixed.Uint("AuctionCollarExtension", 4),
+	}},
+	'h': {Name: "OperationalHalt", Fields: []fixed.Spec{
+		stock,
+		fixed.Alpha("MarketCode", 1),
+		fixed.Alpha("OperationalHaltAction", 1),
+	}},
+	'A': {Name: "AddOrder", Fields: []fixed.Spec{
+		fixed.Uint("OrderReferenceNumber", 8),
+		fixed.Alpha("BuySellIndicator", 1),
+		fixed.Uint("Shares", 4),
+		stock,
+		fixed.Price("Price", 4, 4),
+	}},
+	'F': {Name: "AddOrderMPID", Fields: []fixed.Spec{
+		fixed.Uint("OrderReferenceNumber", 8),
+		fixed.Alpha("BuySellIndicator", 1),
+		fixed.Uint("Shares", 4),
+		stock,
+		fixed.Price("Price", 4, 4),
+		fixed.Alpha("Attribution", 4),
+	}},
+	'E': {Name: "OrderExecuted", Fields: []fixed.Spec{
+		fixed.Uint("OrderReferenceNumber", 8),
+		fixed.Uint("ExecutedShares", 4),
+		fixed.Uint("MatchNumber", 8),
+	}},
+	'C': {Name: "OrderExecutedWithPrice", Fields: []fixed.Spec{
+		fixed.Uint("OrderReferenceNumber", 8),
+		fixed.Uint("ExecutedShares", 4),
+		fixed.Uint("MatchNumber", 8),
+		fixed.Alpha("Printable", 1),
+		fixed.Price("ExecutionPrice", 4, 4),
+	}},
+	'X': {Name: "OrderCancel", Fields: []fixed.Spec{
+		fixed.Uint("OrderReferenceNumber", 8),
+		fixed.Uint("CancelledShares", 4),
+	}},
+	'D': {Name: "OrderDelete", Fields: []fixed.Spec{
+		fixed.Uint("OrderReferenceNumber", 8),
+	}},
+	'U': {Name: "OrderReplace", Fields: []fixed.Spec{
+		fixed.Uint("OriginalOrderReferenceNumber", 8),
+		fixed.Uint("NewOrderReferenceNumber", 8),
+		fixed.Uint("Shares", 4),
+		fixed.Price("Price", 4, 4),
+	}},
+	'P': {Name: "Trade", Fields: []fixed.Spec{
+		fixed.Uint("OrderReferenceNumber", 8),
+		fixed.Alpha("BuySellIndicator", 1),
+		fixed.Uint("Shares", 4),
+		stock,
+		fixed.Price("Price", 4, 4),
+		fixed.Uint("MatchNumber", 8),
+	}},
+	'Q': {Name: "CrossTrade", Fields: []fixed.Spec{
+		fixed.Uint("Shares", 8),
+		stock,
+		fixed.Price("CrossPrice", 4, 4),
+		fixed.Uint("MatchNumber", 8),
+		fixed.Alpha("CrossType", 1),
+	}},
+	'B': {Name: "BrokenTrade", Fields: []fixed.Spec{
+		fixed.Uint("MatchNumber", 8),
+	}},
+	'I': {Name: "NOII", Fields: []fixed.Spec{
+		fixed.Uint("PairedShares", 8),
+		fixed.Uint("ImbalanceShares", 8),
+		fixed.Alpha("ImbalanceDirection", 1),
+		stock,
+		fixed.Price("FarPrice", 4, 4),
+		fixed.Price("NearPrice", 4, 4),
+		fixed.Price("CurrentReferencePrice", 4, 4),
+		fixed.Alpha("CrossType", 1),
+		fixed.Alpha("PriceVariationIndicator", 1),
+	}},
+	'N': {Name: "RetailPriceImprovementIndicator", Fields: []fixed.Spec{
+		stock,
+		fixed.Alpha("InterestFlag", 1),
+	}},
+	'O': {Name: "DirectListingWithCapitalRaisePriceDiscovery", Fields: []fixed.Spec{
+		stock,
+		fixed.Alpha("OpenEligibilityStatus", 1),
+		fixed.Price("MinimumAllowablePrice", 4, 4),
+		fixed.Price("MaximumAllowablePrice", 4, 4),
+		fixed.Price("NearExecutionPrice", 4, 4),
+		fixed.Uint("NearExecutionTime", 8),
+		fixed.Price("LowerPriceRangeCollar", 4, 4),
+		fixed.Price("UpperPriceRangeCollar", 4, 4),
+	}},
+}
+
+// Field is a decoded message field. Value is uint64, a string for the alpha
+// fields or, for prices, a decimal string.
+type Field = fixed.Field
+
+// Message is a decoded ITCH 5.0 message
+type Message struct {
+	Type           byte
+	StockLocate    uint16
+	TrackingNumber uint16
+	// Timestamp is the time since midnight
+	Timestamp time.Duration
+	Name      string
+	Fields    []Field
+	// Body is the raw message including its header
+	Body []byte
+}
+
+// Known returns false for message types without a known layout
+func (m *Message) Known() bool { return m.Name != "" }
+
+// Get returns the value of the field with the name
+func (m *Message) Get(name string) (any, bool) {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (m *Message) String() string {
+	var sb strings.Builder
+	name := m.Name
+	if name == "" {
+		name = "Unknown"
+	}
+	fmt.Fprintf(&sb, "%s [type %q, locate %d, tracking %d, time %v]", name, m.Type, m.StockLocate, m.TrackingNumber, m.Timestamp)
+	for _, f := range m.Fields {
+		fmt.Fprintf(&sb, " %s=%v", f.Name, f.Value)
+	}
+	return sb.String()
+}
+
+// Decode decodes a message, e.g. a MoldUDP64 message block
+func Decode(b []byte) (Message, error) {
+	if len(b) < HeaderSize {
+		return Message{Body: b}, fmt.Errorf("itch: message of %d bytes shorter than the header", len(b))
+	}
+	m := Message{
+		Type:           b[0],
+		StockLocate:    binary.BigEndian.Uint16(b[1:3]),
+		TrackingNumber: binary.BigEndian.Uint16(b[3:5]),
+		Timestamp:      time.Duration(uint48(b[5:11])),
+		Body:           b,
+	}
+	l, ok := layouts[m.Type]
+	if !ok {
+		return m, nil
+	}
+	m.Name = l.Name
+	var err error
+	if m.Fields, err = decoder.Decode(m.Fields, &l, b); err != nil {
+		return m, fmt.Errorf("itch: %w", err)
+	}
+	return m, nil
+}
+
+func uint48(b []byte) uint64 {
+	return uint64(b[0])<<40 | uint64(b[1])<<32 | uint64(binary.BigEndian.Uint32(b[2:6]))
+}
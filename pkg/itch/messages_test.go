@@ -0,0 +1,65 @@
+package itch
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// header returns the message header: type, stock locate 7, tracking number 3
+// and the timestamp
+func header(typ byte, ts time.Duration) []byte {
+	b := []byte{typ, 0, 7, 0, 3}
+	return append(b, byte(ts>>40), byte(ts>>32), byte(ts>>24), byte(ts>>16), byte(ts>>8), byte(ts))
+}
+
+func TestDecodeAddOrder(t *testing.T) {
+	ts := 10*time.Hour + 123456789
+	b := header('A', ts)
+	b = binary.BigEndian.AppendUint64(b, 987654321)
+	b = append(b, 'B')
+	b = binary.BigEndian.AppendUint32(b, 100)
+	b = append(b, "AAPL    "...)
+	b = binary.BigEndian.AppendUint32(b, 1895000)
+
+	m, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Known() || m.Name != "AddOrder" || m.Type != 'A' || m.StockLocate != 7 || m.TrackingNumber != 3 || m.Timestamp != ts {
+		t.Fatalf("message %v", m.String())
+	}
+	want := []Field{
+		{Name: "OrderReferenceNumber", Value: uint64(987654321)},
+		{Name: "BuySellIndicator", Value: "B"},
+		{Name: "Shares", Value: uint64(100)},
+		{Name: "Stock", Value: "AAPL"},
+		{Name: "Price", Value: "189.5000"},
+	}
+	if len(m.Fields) != len(want) {
+		t.Fatalf("fields %v", m.Fields)
+	}
+	for i, f := range want {
+		if m.Fields[i] != f {
+			t.Errorf("field %d = %v, want %v", i, m.Fields[i], f)
+		}
+	}
+	if v, ok := m.Get("Stock"); !ok || v != "AAPL" {
+		t.Errorf("Get(Stock) = %v, %v", v, ok)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode(header('A', 0)[:HeaderSize-1]); err == nil {
+		t.Error("no error for a message shorter than the header")
+	}
+	// the OrderReferenceNumber is truncated
+	b := append(header('D', 0), make([]byte, 7)...)
+	if m, err := Decode(b); err == nil || m.Name != "OrderDelete" {
+		t.Errorf("Decode of a truncated message = %v, %v", m.String(), err)
+	}
+	m, err := Decode(append(header('z', 0), 1, 2, 3))
+	if err != nil || m.Known() || len(m.Body) != HeaderSize+3 {
+		t.Errorf("Decode of an unknown type = %v, %v", m.String(), err)
+	}
+}
@@ -0,0 +1,122 @@
+package latency
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	// subBuckets per power of two, giving a relative precision of 1/64
+	subBits    = 6
+	subBuckets = 1 << subBits
+	numBuckets = (64 - subBits) * subBuckets
+)
+
+// Histogram counts durations in log-linear buckets with a relative error
+// below 1/64. Durations can be negative, e.g. when the clock of the sender is
+// ahead of the local one. A Histogram is not safe for concurrent use.
+type Histogram struct {
+	pos   [numBuckets]uint64
+	neg   [numBuckets]uint64
+	count uint64
+	sum   float64
+	min   time.Duration
+	max   time.Duration
+}
+
+func bucketOf(v uint64) int {
+	if v < subBuckets {
+		return int(v)
+	}
+	exp := bits.Len64(v) - subBits - 1
+	return (exp+1)*subBuckets + int(v>>exp) - subBuckets
+}
+
+// valueOf returns the middle of the bucket
+func valueOf(i int) uint64 {
+	if i < subBuckets {
+		return uint64(i)
+	}
+	exp := i/subBuckets - 1
+	sub := uint64(i%subBuckets + subBuckets)
+	return sub<<exp + (uint64(1)<<exp)/2
+}
+
+// Record adds a duration
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		h.neg[bucketOf(uint64(-d))]++
+	} else {
+		h.pos[bucketOf(uint64(d))]++
+	}
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if h.count == 0 || d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += float64(d)
+}
+
+// Count returns the number of recorded durations
+func (h *Histogram) Count() uint64 { return h.count }
+
+// Min returns the exact lowest recorded duration
+func (h *Histogram) Min() time.Duration { return h.min }
+
+// Max returns the exact highest recorded duration
+func (h *Histogram) Max() time.Duration { return h.max }
+
+// Mean returns the average of the recorded durations
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.count))
+}
+
+// Percentile returns the duration below which p percent (0-100) of the
+// recorded durations fall
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	d := h.max
+	// from the most negative to the most positive
+	for i := numBuckets - 1; i >= 0; i-- {
+		if seen += h.neg[i]; seen >= rank {
+			d = -time.Duration(valueOf(i))
+			return h.clamp(d)
+		}
+	}
+	for i := 0; i < numBuckets; i++ {
+		if seen += h.pos[i]; seen >= rank {
+			d = time.Duration(valueOf(i))
+			break
+		}
+	}
+	return h.clamp(d)
+}
+
+// clamp keeps the bucket approximations within the exact bounds
+func (h *Histogram) clamp(d time.Duration) time.Duration {
+	if d < h.min {
+		return h.min
+	}
+	if d > h.max {
+		return h.max
+	}
+	return d
+}
+
+// Reset forgets all the recorded durations
+func (h *Histogram) Reset() {
+	*h = Histogram{}
+}
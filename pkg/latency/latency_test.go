@@ -0,0 +1,105 @@
+package latency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuckets(t *testing.T) {
+	for _, v := range []uint64{0, 1, 63, 64, 65, 127, 128, 1000, 123456789, 1 << 40, 1<<63 - 1} {
+		mid := valueOf(bucketOf(v))
+		// the middle of the bucket is within 1/64 of the value
+		diff := int64(mid - v)
+		if diff < 0 {
+			diff = -diff
+		}
+		if uint64(diff)*subBuckets > v+1 {
+			t.Errorf("value %d in bucket %d of middle %d", v, bucketOf(v), mid)
+		}
+		if b := bucketOf(v); b < 0 || b >= numBuckets {
+			t.Errorf("value %d in bucket %d out of range", v, b)
+		}
+	}
+	for v := uint64(1); v < 1<<20; v = v*3/2 + 1 {
+		if bucketOf(v) < bucketOf(v-1) {
+			t.Fatalf("bucket of %d lower than the one of %d", v, v-1)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	if h.Percentile(50) != 0 || h.Mean() != 0 {
+		t.Fatal("empty histogram with values")
+	}
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	h.Record(-5 * time.Microsecond)
+	if h.Count() != 1001 || h.Min() != -5*time.Microsecond || h.Max() != time.Millisecond {
+		t.Fatalf("count %d, min %v, max %v", h.Count(), h.Min(), h.Max())
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, -5 * time.Microsecond},
+		{50, 500 * time.Microsecond},
+		{90, 900 * time.Microsecond},
+		{99, 990 * time.Microsecond},
+		{100, time.Millisecond},
+	}
+	for _, tt := range tests {
+		got := h.Percentile(tt.p)
+		diff, tolerance := got-tt.want, (tt.want/64).Abs()+1
+		if diff < -tolerance || diff > tolerance {
+			t.Errorf("Percentile(%v) = %v, want %v within 1/64", tt.p, got, tt.want)
+		}
+	}
+	if mean := h.Mean(); mean < 499*time.Microsecond || mean > 501*time.Microsecond {
+		t.Errorf("Mean() = %v, want about 500us", mean)
+	}
+	h.Reset()
+	if h.Count() != 0 || h.Max() != 0 {
+		t.Fatal("values after Reset")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(100 * time.Microsecond)
+	sent := time.Unix(1700000000, 0)
+	for i := 0; i < 10; i++ {
+		if _, outlier := r.Record(2, sent, sent.Add(10*time.Microsecond)); outlier {
+			t.Fatal("outlier at the floor")
+		}
+	}
+	if d, outlier := r.Record(2, sent, sent.Add(200*time.Microsecond)); !outlier || d != 200*time.Microsecond {
+		t.Fatalf("Record = %v, %v, want an outlier of 200us", d, outlier)
+	}
+	r.Record(1, sent, sent.Add(-time.Millisecond))
+
+	stats := r.SwapStats()
+	if len(stats) != 2 || stats[0].Stream != 1 || stats[1].Stream != 2 {
+		t.Fatalf("stats %+v", stats)
+	}
+	s := stats[1]
+	if s.Count != 11 || s.Min != 10*time.Microsecond || s.Max != 200*time.Microsecond || s.Outliers != 1 || s.Drift != 0 {
+		t.Fatalf("stream 2 stats %+v", s)
+	}
+	if stats[0].Min != -time.Millisecond {
+		t.Fatalf("stream 1 min %v", stats[0].Min)
+	}
+
+	// the floor is now the lowest latency of the previous interval
+	if _, outlier := r.Record(2, sent, sent.Add(115*time.Microsecond)); !outlier {
+		t.Fatal("latency above the previous floor by more than the threshold not an outlier")
+	}
+	r.Record(2, sent, sent.Add(5*time.Microsecond))
+	stats = r.SwapStats()
+	if len(stats) != 1 || stats[0].Drift != -5*time.Microsecond || stats[0].Outliers != 1 {
+		t.Fatalf("second interval stats %+v", stats)
+	}
+	if stats := r.SwapStats(); len(stats) != 0 {
+		t.Fatalf("stats of an empty interval %+v", stats)
+	}
+}
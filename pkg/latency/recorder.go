@@ -0,0 +1,125 @@
+package latency
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats are the latencies of a stream over an interval. As the sender and
+// the local clocks are not synchronized the absolute values include their
+// offset, while Drift shows how the lowest latency, i.e. the offset plus the
+// network path, moved since the first interval.
+type Stats struct {
+	Stream uint64
+	Count  uint64
+	Min    time.Duration
+	Mean   time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	P999   time.Duration
+	Max    time.Duration
+	// Drift is the change of the lowest latency since the first interval
+	Drift time.Duration
+	// Outliers is the number of latencies above the floor plus the threshold
+	Outliers uint64
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("samples %d, min %v, mean %v, p50 %v, p90 %v, p99 %v, p99.9 %v, max %v, drift %v, outliers %d",
+		s.Count, s.Min, s.Mean, s.P50, s.P90, s.P99, s.P999, s.Max, s.Drift, s.Outliers)
+}
+
+type stream struct {
+	hist     Histogram
+	outliers uint64
+	// floor is the lowest latency of the previous interval
+	floor    time.Duration
+	hasFloor bool
+	baseline time.Duration
+	hasBase  bool
+}
+
+// Recorder keeps a latency histogram per stream, e.g. per channel, reset at
+// every SwapStats. It's safe for concurrent use.
+type Recorder struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	streams   map[uint64]*stream
+}
+
+// NewRecorder returns a recorder counting as outliers the latencies higher
+// than the floor of the stream by more than threshold (0 disables them). The
+// floor is the lowest latency of the previous interval, or of the current one
+// until the first SwapStats.
+func NewRecorder(threshold time.Duration) *Recorder {
+	return &Recorder{
+		threshold: threshold,
+		streams:   make(map[uint64]*stream),
+	}
+}
+
+// Record adds the latency between the send time of a packet and its receive
+// time. It returns the latency and whether it is an outlier.
+func (r *Recorder) Record(id uint64, sent time.Time, received time.Time) (time.Duration, bool) {
+	d := received.Sub(sent)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.streams[id]
+	if !ok {
+		s = &stream{}
+		r.streams[id] = s
+	}
+	s.hist.Record(d)
+
+	floor := s.floor
+	if !s.hasFloor {
+		floor = s.hist.Min()
+	}
+	outlier := r.threshold > 0 && d-floor > r.threshold
+	if outlier {
+		s.outliers++
+	}
+	return d, outlier
+}
+
+// SwapStats returns the latencies of the streams, ordered by id, since the
+// previous call and resets them. Streams without packets are left out.
+func (r *Recorder) SwapStats() []Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]Stats, 0, len(r.streams))
+	for id, s := range r.streams {
+		if s.hist.Count() == 0 {
+			continue
+		}
+		min := s.hist.Min()
+		if !s.hasBase {
+			s.baseline = min
+			s.hasBase = true
+		}
+		stats = append(stats, Stats{
+			Stream:   id,
+			Count:    s.hist.Count(),
+			Min:      min,
+			Mean:     s.hist.Mean(),
+			P50:      s.hist.Percentile(50),
+			P90:      s.hist.Percentile(90),
+			P99:      s.hist.Percentile(99),
+			P999:     s.hist.Percentile(99.9),
+			Max:      s.hist.Max(),
+			Drift:    min - s.baseline,
+			Outliers: s.outliers,
+		})
+		s.floor = min
+		s.hasFloor = true
+		s.outliers = 0
+		s.hist.Reset()
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Stream < stats[j].Stream })
+	return stats
+}
@@ -0,0 +1,244 @@
+package mcast
+
+import (
+	"github.com/coalescent-labs/mcastmkt/pkg/ring"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"golang.org/x/net/ipv4"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxDatagramSize is the size of the buffer of each received datagram
+	MaxDatagramSize = 1024 * 8
+	// DefaultBatchSize is the default number of datagrams read by a single syscall
+	DefaultBatchSize = 64
+	// DefaultRingSize is the default number of datagrams buffered between the
+	// socket reader and the decoder
+	DefaultRingSize = 4096
+
+	// IdleSpins is the number of polls of an empty ring yielding the CPU
+	// before the decoder sleeps IdleSleep between polls
+	IdleSpins = 1000
+	// IdleSleep is the sleep between the polls of an empty ring after
+	// IdleSpins, the added latency of a datagram received after a quiet period
+	IdleSleep = 50 * time.Microsecond
+
+	oobSize = 256
+)
+
+// Packet is a datagram received by a Listener. Data and the other fields
+// are only valid until the handler returns.
+type Packet struct {
+	Data    []byte
+	Src     net.Addr
+	Dst     net.IP
+	IfIndex int
+	// Time is the receive timestamp: set by the kernel when the platform
+	// allows it (SO_TIMESTAMPNS on Linux), otherwise when the datagram is read
+	Time time.Time
+}
+
+// Stats are the counters of a Listener since the previous call to SwapStats.
+type Stats struct {
+	Syscalls uint64
+	Packets  uint64
+	// KernelDrops is the number of datagrams dropped by the kernel because the
+	// socket receive buffer was full. Always 0 when the platform can't report it.
+	KernelDrops uint64
+	// RingFull is the number of datagrams dropped because the decoder was too
+	// slow to consume the ring buffer.
+	RingFull uint64
+}
+
+// Options are the socket and reader settings of a Listener.
+type Options struct {
+	// ReceiveBufferSize is the socket receive buffer size, 0 for the system default
+	ReceiveBufferSize int
+	// BatchSize is the number of datagrams read by a single syscall, 0 for DefaultBatchSize
+	BatchSize int
+	// RingSize is the number of datagrams buffered between the socket reader
+	// goroutine and the handler. 0 runs the handler inline in the reader.
+	RingSize int
+	// PinCPU locks the socket reader goroutine on its OS thread bound to the
+	// CPU. -1 doesn't lock it. Only applies when RingSize > 0.
+	PinCPU int
+}
+
+// SyscallsPerPacket returns the average number of read syscalls per datagram.
+func (s Stats) SyscallsPerPacket() float64 {
+	if s.Packets == 0 {
+		return 0
+	}
+	return float64(s.Syscalls) / float64(s.Packets)
+}
+
+// receiveBufferCapped returns true when the effective receive buffer size
+// of the socket (SO_RCVBUF) is smaller than the requested one: the kernel
+// doubles the requested size to account for its bookkeeping overhead and
+// silently caps it to net.core.rmem_max.
+func receiveBufferCapped(requested, effective int) bool {
+	return requested > 0 && effective < 2*requested
+}
+
+// Listener is a socket joined to a multicast group reading datagrams in
+// batches where the platform allows it (recvmmsg on Linux).
+type Listener struct {
+	conn       net.PacketConn
+	packetConn *ipv4.PacketConn
+	group      *net.UDPAddr
+	intf       *net.Interface
+	opts       Options
+	ring       *ring.Ring
+
+	syscalls uint64
+	packets  uint64
+	// rxqOvfl is the last cumulative drop counter received with SO_RXQ_OVFL
+	rxqOvfl uint32
+	// inode of the socket to find its drop counter in /proc/net/udp
+	inode         uint64
+	reportedDrops uint64
+}
+
+// Listen opens a socket on the multicast address (ip:port) configured with
+// opts and joins the group on intf (nil for the default interface).
+func Listen(address string, intf *net.Interface, opts Options) (*Listener, error) {
+	addr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenPacket("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ReceiveBufferSize > 0 {
+		if err := util.SetReceiveBuffer(conn, opts.ReceiveBufferSize); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	packetConn := ipv4.NewPacketConn(conn)
+	if err := packetConn.JoinGroup(intf, addr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	err = packetConn.SetControlMessage(ipv4.FlagTTL|ipv4.FlagSrc|ipv4.FlagDst|ipv4.FlagInterface, true)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	l := &Listener{
+		conn:       conn,
+		packetConn: packetConn,
+		group:      addr,
+		intf:       intf,
+		opts:       opts,
+	}
+	if opts.RingSize > 0 {
+		l.ring = ring.New(opts.RingSize, MaxDatagramSize)
+	}
+	if err := l.setSocketOptions(opts.ReceiveBufferSize); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Group returns the joined multicast address.
+func (l *Listener) Group() *net.UDPAddr { return l.group }
+
+// Close leaves the multicast group and closes the socket.
+func (l *Listener) Close() error {
+	_ = l.packetConn.LeaveGroup(l.intf, l.group)
+	return l.conn.Close()
+}
+
+// SwapStats returns the counters accumulated since the previous call and
+// resets them. It must not be called concurrently with itself.
+func (l *Listener) SwapStats() Stats {
+	drops := l.kernelDrops()
+	s := Stats{
+		Syscalls:    atomic.SwapUint64(&l.syscalls, 0),
+		Packets:     atomic.SwapUint64(&l.packets, 0),
+		KernelDrops: dropsSince(l.reportedDrops, drops),
+	}
+	if l.ring != nil {
+		s.RingFull = l.ring.SwapFull()
+	}
+	l.reportedDrops = drops
+	return s
+}
+
+// dropsSince returns the number of drops between two readings of the
+// cumulative kernel drop counter, a 32 bits counter that wraps around.
+func dropsSince(prev, cur uint64) uint64 {
+	return uint64(uint32(cur - prev))
+}
+
+// Read loops forever reading datagrams from the socket and calling handle
+// for each of them, in order. It only returns on read errors.
+//
+// With a ring buffer the socket is read by a dedicated goroutine copying the
+// datagrams into the ring, and handle is called by the goroutine of Read, so
+// that a slow handler only fills the ring instead of the socket buffer. The
+// handler goroutine polls an empty ring IdleSpins times yielding the CPU,
+// then sleeping IdleSleep between polls.
+func (l *Listener) Read(handle func(p *Packet)) error {
+	if l.ring == nil {
+		return l.read(handle)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if l.opts.PinCPU >= 0 {
+			if err := pinThread(l.opts.PinCPU); err != nil {
+				errs <- err
+				return
+			}
+		}
+		errs <- l.read(func(p *Packet) {
+			l.ring.Put(p.Data, p.Src, p.Dst, p.IfIndex, p.Time)
+		})
+	}()
+
+	var p Packet
+	idle := 0
+	for {
+		s := l.ring.Peek()
+		if s == nil {
+			select {
+			case err := <-errs:
+				return err
+			default:
+			}
+			// yield the CPU a little before sleeping
+			idle++
+			if idle > IdleSpins {
+				time.Sleep(IdleSleep)
+			} else {
+				runtime.Gosched()
+			}
+			continue
+		}
+		idle = 0
+		p.Data = s.Data
+		p.Src = s.Src
+		p.Dst = s.Dst
+		p.IfIndex = s.IfIndex
+		p.Time = s.Time
+		handle(&p)
+		l.ring.Release()
+	}
+}
@@ -0,0 +1,149 @@
+package mcast
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/sysinfo"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+func (l *Listener) setSocketOptions(receiveBufferSize int) error {
+	rawConn, err := l.conn.(*net.UDPConn).SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	var effectiveSize int
+	err = rawConn.Control(func(fd uintptr) {
+		// ask the kernel to report the number of datagrams dropped for lack of buffer space
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RXQ_OVFL, 1)
+		if sockErr != nil {
+			return
+		}
+		// and to timestamp the datagrams when they are received
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1)
+		if sockErr != nil {
+			return
+		}
+		var st unix.Stat_t
+		if unix.Fstat(int(fd), &st) == nil {
+			l.inode = st.Ino
+		}
+		effectiveSize, _ = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return sockErr
+	}
+
+	if receiveBufferCapped(receiveBufferSize, effectiveSize) {
+		rmemMax, _ := sysinfo.ReadSysctlInt("net.core.rmem_max")
+		log.Printf("WARNING receive buffer size %d capped to %d by net.core.rmem_max (%d), "+
+			"raise it with: sysctl -w net.core.rmem_max=%d\n",
+			receiveBufferSize, effectiveSize/2, rmemMax, receiveBufferSize)
+	}
+	return nil
+}
+
+// kernelDrops returns the cumulative number of datagrams dropped by the
+// kernel on the socket, preferring /proc/net/udp that is updated even when
+// no datagram is received.
+func (l *Listener) kernelDrops() uint64 {
+	if l.inode != 0 {
+		if s, err := sysinfo.UDPSocketByInode(l.inode); err == nil {
+			return s.Drops
+		}
+	}
+	return uint64(atomic.LoadUint32(&l.rxqOvfl))
+}
+
+func (l *Listener) read(handle func(p *Packet)) error {
+	msgs := make([]ipv4.Message, l.opts.BatchSize)
+	for i := range msgs {
+		msgs[i].Buffers = [][]byte{make([]byte, MaxDatagramSize)}
+		msgs[i].OOB = make([]byte, oobSize)
+	}
+
+	var p Packet
+	var cm ipv4.ControlMessage
+	for {
+		n, err := l.packetConn.ReadBatch(msgs, 0)
+		if err != nil {
+			return err
+		}
+		atomic.AddUint64(&l.syscalls, 1)
+		atomic.AddUint64(&l.packets, uint64(n))
+		// fallback for the datagrams without a kernel timestamp
+		now := time.Now()
+
+		for i := 0; i < n; i++ {
+			m := &msgs[i]
+			cm = ipv4.ControlMessage{}
+			if err := cm.Parse(m.OOB[:m.NN]); err != nil {
+				return err
+			}
+			t, drops, hasDrops := parseSocketControlMessages(m.OOB[:m.NN])
+			if hasDrops {
+				atomic.StoreUint32(&l.rxqOvfl, drops)
+			}
+			p.Time = t
+			if p.Time.IsZero() {
+				p.Time = now
+			}
+
+			p.Data = m.Buffers[0][:m.N]
+			p.Src = m.Addr
+			p.Dst = cm.Dst
+			p.IfIndex = cm.IfIndex
+			handle(&p)
+		}
+	}
+}
+
+// parseSocketControlMessages extracts the SOL_SOCKET level control messages
+// ignored by ipv4.ControlMessage: the kernel receive timestamp, zero when
+// missing, and the cumulative drop counter of SO_RXQ_OVFL when present.
+func parseSocketControlMessages(oob []byte) (t time.Time, drops uint32, hasDrops bool) {
+	scms, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return t, 0, false
+	}
+	for _, scm := range scms {
+		if scm.Header.Level != unix.SOL_SOCKET {
+			continue
+		}
+		switch scm.Header.Type {
+		case unix.SO_RXQ_OVFL:
+			if len(scm.Data) >= 4 {
+				drops = binary.NativeEndian.Uint32(scm.Data)
+				hasDrops = true
+			}
+		case unix.SO_TIMESTAMPNS:
+			// native struct timespec, with 32 bits fields on 32 bits platforms
+			switch len(scm.Data) {
+			case 16:
+				t = time.Unix(int64(binary.NativeEndian.Uint64(scm.Data[0:8])), int64(binary.NativeEndian.Uint64(scm.Data[8:16])))
+			case 8:
+				t = time.Unix(int64(int32(binary.NativeEndian.Uint32(scm.Data[0:4]))), int64(binary.NativeEndian.Uint32(scm.Data[4:8])))
+			}
+		}
+	}
+	return t, drops, hasDrops
+}
+
+// pinThread binds the current OS thread to the cpu.
+func pinThread(cpu int) error {
+	var set unix.CPUSet
+	set.Set(cpu)
+	if err := unix.SchedSetaffinity(0, &set); err != nil {
+		return fmt.Errorf("failed to pin reader to cpu %d: %w", cpu, err)
+	}
+	return nil
+}
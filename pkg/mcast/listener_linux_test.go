@@ -0,0 +1,76 @@
+package mcast
+
+import (
+	"encoding/binary"
+	"golang.org/x/sys/unix"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// cmsg returns a control message of the level and type with the data
+func cmsg(level, typ int32, data []byte) []byte {
+	b := make([]byte, unix.CmsgSpace(len(data)))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level = level
+	h.Type = typ
+	h.SetLen(unix.CmsgLen(len(data)))
+	copy(b[unix.CmsgLen(0):], data)
+	return b
+}
+
+func timespec(t time.Time) []byte {
+	ts := unix.NsecToTimespec(t.UnixNano())
+	return unsafe.Slice((*byte)(unsafe.Pointer(&ts)), unsafe.Sizeof(ts))
+}
+
+func TestParseSocketControlMessages(t *testing.T) {
+	now := time.Unix(1700000000, 123456789)
+	drops := binary.NativeEndian.AppendUint32(nil, 42)
+	tests := []struct {
+		name     string
+		oob      []byte
+		time     time.Time
+		drops    uint32
+		hasDrops bool
+	}{
+		{"none", nil, time.Time{}, 0, false},
+		{"timestamp", cmsg(unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, timespec(now)), now, 0, false},
+		{"drops", cmsg(unix.SOL_SOCKET, unix.SO_RXQ_OVFL, drops), time.Time{}, 42, true},
+		{"both", append(cmsg(unix.SOL_SOCKET, unix.SO_RXQ_OVFL, drops), cmsg(unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, timespec(now))...), now, 42, true},
+		// the IP level messages are parsed by ipv4.ControlMessage
+		{"other level", cmsg(unix.IPPROTO_IP, unix.SO_RXQ_OVFL, drops), time.Time{}, 0, false},
+		{"short drops", cmsg(unix.SOL_SOCKET, unix.SO_RXQ_OVFL, drops[:2]), time.Time{}, 0, false},
+		{"truncated", cmsg(unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, timespec(now))[:unix.SizeofCmsghdr+4], time.Time{}, 0, false},
+	}
+	for _, tt := range tests {
+		got, drops, hasDrops := parseSocketControlMessages(tt.oob)
+		if !got.Equal(tt.time) || drops != tt.drops || hasDrops != tt.hasDrops {
+			t.Errorf("%s: %v, %d, %v, want %v, %d, %v", tt.name, got, drops, hasDrops, tt.time, tt.drops, tt.hasDrops)
+		}
+	}
+}
+
+func TestSwapStatsKernelDrops(t *testing.T) {
+	// without inode the drops are the SO_RXQ_OVFL ones
+	l := &Listener{}
+	for i, tt := range []struct {
+		counter uint32
+		want    uint64
+	}{
+		{0, 0},
+		{10, 10},
+		{10, 0},
+		{25, 15},
+		{0xFFFFFFFE, 0xFFFFFFFE - 25},
+		// the counter wraps around
+		{3, 5},
+	} {
+		l.rxqOvfl = tt.counter
+		l.packets = uint64(i)
+		s := l.SwapStats()
+		if s.KernelDrops != tt.want || s.Packets != uint64(i) {
+			t.Fatalf("step %d: counter %d: KernelDrops %d, Packets %d, want %d, %d", i, tt.counter, s.KernelDrops, s.Packets, tt.want, i)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build !linux
+
+package mcast
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+func (l *Listener) setSocketOptions(int) error {
+	return nil
+}
+
+func (l *Listener) kernelDrops() uint64 {
+	return 0
+}
+
+func (l *Listener) read(handle func(p *Packet)) error {
+	buffer := make([]byte, MaxDatagramSize)
+
+	var p Packet
+	for {
+		numBytes, cm, srcAddr, err := l.packetConn.ReadFrom(buffer)
+		if err != nil {
+			return err
+		}
+		atomic.AddUint64(&l.syscalls, 1)
+		atomic.AddUint64(&l.packets, 1)
+
+		p.Data = buffer[:numBytes]
+		p.Src = srcAddr
+		p.Time = time.Now()
+		if cm != nil {
+			p.Dst = cm.Dst
+			p.IfIndex = cm.IfIndex
+		} else {
+			// control messages are not available, assume the datagram is for the group
+			p.Dst = l.group.IP
+			p.IfIndex = 0
+		}
+		handle(&p)
+	}
+}
+
+func pinThread(cpu int) error {
+	return errors.New("pinning the reader to a cpu is only supported on Linux")
+}
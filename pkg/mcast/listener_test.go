@@ -0,0 +1,119 @@
+package mcast
+
+import (
+	"golang.org/x/net/ipv4"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReceiveBufferCapped(t *testing.T) {
+	tests := []struct {
+		requested, effective int
+		want                 bool
+	}{
+		{0, 212992, false},
+		{1 << 20, 2 << 20, false},
+		{1 << 20, 4 << 20, false},
+		// net.core.rmem_max of 208 KiB
+		{8 << 20, 425984, true},
+		{1 << 20, 2<<20 - 1, true},
+	}
+	for _, tt := range tests {
+		if got := receiveBufferCapped(tt.requested, tt.effective); got != tt.want {
+			t.Errorf("receiveBufferCapped(%d, %d) = %v, want %v", tt.requested, tt.effective, got, tt.want)
+		}
+	}
+}
+
+// loopbackListener returns a listener of a group joined on the loopback
+// interface and a socket sending to it, the test is skipped when the host
+// doesn't route multicast on the loopback interface.
+func loopbackListener(t *testing.T, opts Options) (*Listener, *net.UDPConn) {
+	t.Helper()
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+	l, err := Listen("239.255.77.1:0", lo, opts)
+	if err != nil {
+		t.Skipf("can't join a group on the loopback interface: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	dst := &net.UDPAddr{IP: l.Group().IP, Port: l.conn.LocalAddr().(*net.UDPAddr).Port}
+	conn, err := net.DialUDP("udp4", nil, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetMulticastInterface(lo); err != nil {
+		t.Skipf("can't send multicast on the loopback interface: %v", err)
+	}
+	_ = pc.SetMulticastLoopback(true)
+	return l, conn
+}
+
+func TestListenerRingFull(t *testing.T) {
+	const sent = 20
+	l, conn := loopbackListener(t, Options{RingSize: 4, PinCPU: -1})
+	received := make(chan []byte, sent)
+	release := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- l.Read(func(p *Packet) {
+			received <- append([]byte(nil), p.Data...)
+			// the handler is stuck until all the datagrams are read
+			<-release
+		})
+	}()
+	for i := 0; i < sent; i++ {
+		if _, err := conn.Write([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadUint64(&l.packets) < sent {
+		if time.Now().After(deadline) {
+			t.Skipf("%d datagrams of %d received on the loopback interface", atomic.LoadUint64(&l.packets), sent)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the datagram being handled holds its slot until the handler returns
+	s := l.SwapStats()
+	if s.Packets != sent || s.RingFull != sent-4 || s.Syscalls == 0 || s.Syscalls > sent {
+		t.Fatalf("stats %+v, want %d packets, %d ring full", s, sent, sent-4)
+	}
+	close(release)
+	for i := 0; i < 4; i++ {
+		select {
+		case b := <-received:
+			if len(b) != 1 || b[0] != byte(i) {
+				t.Fatalf("datagram %d = %v", i, b)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("datagram %d not handled", i)
+		}
+	}
+	if s := l.SwapStats(); s.Packets != 0 || s.RingFull != 0 {
+		t.Fatalf("stats after a swap %+v", s)
+	}
+
+	// closing the socket ends Read with the error of the reader
+	l.Close()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("Read returned without error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read still running after Close")
+	}
+	select {
+	case b := <-received:
+		t.Fatalf("datagram %v handled after a full ring", b)
+	default:
+	}
+}
@@ -0,0 +1,71 @@
+package mdp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// PacketHeaderSize is the size of the binary packet header
+	PacketHeaderSize = 12
+	// MessageSizeSize is the size of the length prefixed to every message
+	MessageSizeSize = 2
+)
+
+// ErrShortPacket is returned for datagrams smaller than the packet header
+var ErrShortPacket = errors.New("mdp3: packet shorter than the packet header")
+
+// PacketHeader is the binary packet header of every MDP 3.0 datagram
+type PacketHeader struct {
+	// MsgSeqNum is the packet sequence number, contiguous per channel and
+	// feed (incremental A/B, snapshot...)
+	MsgSeqNum uint32
+	// SendingTime is the send time in nanoseconds since the epoch
+	SendingTime uint64
+}
+
+// ParsePacketHeader parses the header at the beginning of a datagram
+func ParsePacketHeader(b []byte) (PacketHeader, error) {
+	if len(b) < PacketHeaderSize {
+		return PacketHeader{}, ErrShortPacket
+	}
+	return PacketHeader{
+		MsgSeqNum:   binary.LittleEndian.Uint32(b[0:4]),
+		SendingTime: binary.LittleEndian.Uint64(b[4:12]),
+	}, nil
+}
+
+// Message is a message of a packet
+type Message struct {
+	TemplateID uint16
+	// Data is the SBE message, header included
+	Data []byte
+}
+
+// Messages splits the packet following its header into its messages. Each
+// message is prefixed by its size, including the size field itself.
+func Messages(b []byte) ([]Message, error) {
+	if len(b) < PacketHeaderSize {
+		return nil, ErrShortPacket
+	}
+	var msgs []Message
+	b = b[PacketHeaderSize:]
+	for len(b) > 0 {
+		if len(b) < MessageSizeSize+4 {
+			return msgs, fmt.Errorf("mdp3: %d trailing bytes", len(b))
+		}
+		size := int(binary.LittleEndian.Uint16(b[0:2]))
+		if size < MessageSizeSize+4 || size > len(b) {
+			return msgs, fmt.Errorf("mdp3: invalid message size %d", size)
+		}
+		data := b[MessageSizeSize:size]
+		msgs = append(msgs, Message{
+			// the template id follows the block length in the SBE message header
+			TemplateID: binary.LittleEndian.Uint16(data[2:4]),
+			Data:       data,
+		})
+		b = b[size:]
+	}
+	return msgs, nil
+}
@@ -0,0 +1,62 @@
+package mdp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// message returns a message of the template prefixed by its size, with an
+// SBE header of block length 2 and the body
+func message(templateID uint16, body ...byte) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, uint16(MessageSizeSize+8+len(body)))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(body)))
+	b = binary.LittleEndian.AppendUint16(b, templateID)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint16(b, 9)
+	return append(b, body...)
+}
+
+func TestPacket(t *testing.T) {
+	b := binary.LittleEndian.AppendUint32(nil, 123456)
+	b = binary.LittleEndian.AppendUint64(b, 1700000000123456789)
+	b = append(b, message(46, 1, 2)...)
+	b = append(b, message(32)...)
+
+	h, err := ParsePacketHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.MsgSeqNum != 123456 || h.SendingTime != 1700000000123456789 {
+		t.Fatalf("header %+v", h)
+	}
+	msgs, err := Messages(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].TemplateID != 46 || msgs[1].TemplateID != 32 {
+		t.Fatalf("messages %+v", msgs)
+	}
+	if len(msgs[0].Data) != 10 || msgs[0].Data[8] != 1 || len(msgs[1].Data) != 8 {
+		t.Fatalf("message data %v, %v", msgs[0].Data, msgs[1].Data)
+	}
+
+	if _, err := ParsePacketHeader(b[:PacketHeaderSize-1]); !errors.Is(err, ErrShortPacket) {
+		t.Fatalf("ParsePacketHeader of a short packet: %v", err)
+	}
+	if _, err := Messages(b[:PacketHeaderSize-1]); !errors.Is(err, ErrShortPacket) {
+		t.Fatalf("Messages of a short packet: %v", err)
+	}
+	// the second message is truncated
+	if msgs, err := Messages(b[:len(b)-1]); err == nil || len(msgs) != 1 {
+		t.Fatalf("Messages of a truncated packet = %+v, %v", msgs, err)
+	}
+	if msgs, err := Messages(b[:PacketHeaderSize+3]); err == nil || len(msgs) != 0 {
+		t.Fatalf("Messages with trailing bytes = %+v, %v", msgs, err)
+	}
+	// a size shorter than the SBE header
+	bad := append(b[:PacketHeaderSize:PacketHeaderSize], 4, 0, 0, 0, 0, 0)
+	if _, err := Messages(bad); err == nil {
+		t.Fatal("no error for an invalid message size")
+	}
+}
@@ -0,0 +1,53 @@
+package mitch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// HeaderSize is the size of the unit header
+const HeaderSize = 8
+
+// ErrShortPacket is returned for datagrams smaller than the header
+var ErrShortPacket = errors.New("mitch: packet shorter than the unit header")
+
+// Header is the unit header starting every datagram. Each market data group
+// has its own sequence, several groups may share a multicast channel.
+type Header struct {
+	// Length is the size of the datagram, header included
+	Length uint16
+	Count  uint8
+	// Group is the market data group identifier
+	Group byte
+	// Sequence is the sequence number of the first message, of the next one
+	// for heartbeats and 0 for the unsequenced packets
+	Sequence uint32
+}
+
+// Heartbeat returns true for the packets without messages
+func (h *Header) Heartbeat() bool { return h.Count == 0 }
+
+// Sequenced returns false for the unsequenced packets, e.g. the
+// administrative messages of the recovery channels
+func (h *Header) Sequenced() bool { return h.Sequence != 0 }
+
+// NextSequence returns the sequence number expected after the packet
+func (h *Header) NextSequence() uint32 { return h.Sequence + uint32(h.Count) }
+
+// ParseHeader parses the header at the beginning of a datagram
+func ParseHeader(b []byte) (Header, error) {
+	if len(b) < HeaderSize {
+		return Header{}, ErrShortPacket
+	}
+	h := Header{
+		Length:   binary.LittleEndian.Uint16(b[0:2]),
+		Count:    b[2],
+		Group:    b[3],
+		Sequence: binary.LittleEndian.Uint32(b[4:8]),
+	}
+	if int(h.Length) < HeaderSize || int(h.Length) > len(b) {
+		return h, fmt.Errorf("mitch: header length %d of a %d bytes datagram", h.Length, len(b))
+	}
+	return h, nil
+}
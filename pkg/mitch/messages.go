@@ -0,0 +1,234 @@
+package mitch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/fixed"
+	"strings"
+)
+
+// Message types of the Millennium MITCH messages, and of the replay and
+// snapshot recovery channels
+const (
+	TypeTime             = 'T'
+	TypeSystemEvent      = 'S'
+	TypeOrderBookClear   = 'y'
+	TypeLoginResponse    = 0x02
+	TypeReplayResponse   = 0x04
+	TypeLogout           = 0x05
+	TypeSnapshotResponse = 0x82
+	TypeSnapshotComplete = 0x83
+)
+
+var (
+	decoder      = fixed.Decoder{Order: binary.LittleEndian, Trim: " \x00", Offset: 2}
+	nanosecond   = fixed.Uint("Nanosecond", 4)
+	orderID      = fixed.Uint("OrderID", 8)
+	instrumentID = fixed.Uint("InstrumentID", 4)
+	tradeID      = fixed.Uint("TradeID", 8)
+	reserved1    = fixed.Uint("Reserved1", 1)
+	reserved2    = fixed.Uint("Reserved2", 1)
+	flags        = fixed.Uint("Flags", 1)
+)
+
+// layouts are the body layouts following the length and the type by
+// message type
+var layouts = map[byte]fixed.Layout{
+	TypeTime: {Name: "Time", Fields: []fixed.Spec{
+		fixed.Uint("Seconds", 4),
+	}},
+	TypeSystemEvent: {Name: "SystemEvent", Fields: []fixed.Spec{
+		nanosecond,
+		fixed.Alpha("EventCode", 1),
+	}},
+	'R': {Name: "SymbolDirectory", Fields: []fixed.Spec{
+		nanosecond, instrumentID, reserved1, reserved2,
+		fixed.Alpha("SymbolStatus", 1),
+		fixed.Alpha("ISIN", 12),
+	}},
+	'H': {Name: "SymbolStatus", Fields: []fixed.Spec{
+		nanosecond, instrumentID, reserved1, reserved2,
+		fixed.Alpha("TradingStatus", 1),
+		flags,
+		fixed.Alpha("HaltReason", 4),
+		fixed.Uint("SessionChangeReason", 1),
+		fixed.Alpha("NewEndTime", 8),
+	}},
+	'A': {Name: "AddOrder", Fields: []fixed.Spec{
+		nanosecond, orderID,
+		fixed.Alpha("Side", 1),
+		fixed.Uint("Quantity", 4),
+		instrumentID, reserved1, reserved2,
+		fixed.SignedPrice("Price", 8, 8),
+		flags,
+	}},
+	'F': {Name: "AddAttributedOrder", Fields: []fixed.Spec{
+		nanosecond, orderID,
+		fixed.Alpha("Side", 1),
+		fixed.Uint("Quantity", 4),
+		instrumentID, reserved1, reserved2,
+		fixed.SignedPrice("Price", 8, 8),
+		fixed.Alpha("Attribution", 11),
+		flags,
+	}},
+	'D': {Name: "OrderDeleted", Fields: []fixed.Spec{
+		nanosecond, orderID, flags, instrumentID,
+	}},
+	'U': {Name: "OrderModified", Fields: []fixed.Spec{
+		nanosecond, orderID,
+		fixed.Uint("NewQuantity", 4),
+		fixed.SignedPrice("NewPrice", 8, 8),
+		flags,
+	}},
+	TypeOrderBookClear: {Name: "OrderBookClear", Fields: []fixed.Spec{
+		nanosecond, instrumentID, reserved1, reserved2, flags,
+	}},
+	'E': {Name: "OrderExecuted", Fields: []fixed.Spec{
+		nanosecond, orderID,
+		fixed.Uint("ExecutedQuantity", 4),
+		tradeID,
+	}},
+	'C': {Name: "OrderExecutedWithPriceSize", Fields: []fixed.Spec{
+		nanosecond, orderID,
+		fixed.Uint("ExecutedQuantity", 4),
+		fixed.Uint("DisplayQuantity", 4),
+		tradeID,
+		fixed.Alpha("Printable", 1),
+		fixed.SignedPrice("Price", 8, 8),
+	}},
+	'P': {Name: "Trade", Fields: []fixed.Spec{
+		nanosecond,
+		fixed.Uint("ExecutedQuantity", 4),
+		instrumentID, reserved1, reserved2,
+		fixed.SignedPrice("Price", 8, 8),
+		tradeID,
+	}},
+	'Q': {Name: "AuctionTrade", Fields: []fixed.Spec{
+		nanosecond,
+		fixed.Uint("Quantity", 4),
+		instrumentID, reserved1, reserved2,
+		fixed.SignedPrice("Price", 8, 8),
+		tradeID,
+		fixed.Alpha("AuctionType", 1),
+	}},
+	'B': {Name: "TradeBreak", Fields: []fixed.Spec{
+		nanosecond, tradeID,
+		fixed.Alpha("TradeType", 1),
+	}},
+	'w': {Name: "Statistics", Fields: []fixed.Spec{
+		nanosecond, instrumentID, reserved1, reserved2,
+		fixed.Alpha("StatisticType", 1),
+		fixed.SignedPrice("Price", 8, 8),
+		fixed.Alpha("OpenCloseIndicator", 1),
+	}},
+	TypeLoginResponse: {Name: "LoginResponse", Fields: []fixed.Spec{
+		fixed.Alpha("Status", 1),
+	}},
+	TypeReplayResponse: {Name: "ReplayResponse", Fields: []fixed.Spec{
+		fixed.Alpha("MarketDataGroup", 1),
+		fixed.Uint("FirstMessage", 4),
+		fixed.Uint("Count", 2),
+		fixed.Alpha("Status", 1),
+	}},
+	TypeLogout: {Name: "Logout", Fields: []fixed.Spec{
+		fixed.Alpha("Reason", 1),
+	}},
+	TypeSnapshotResponse: {Name: "SnapshotResponse", Fields: []fixed.Spec{
+		fixed.Uint("SequenceNumber", 4),
+		fixed.Uint("OrderCount", 4),
+		fixed.Alpha("Status", 1),
+	}},
+	TypeSnapshotComplete: {Name: "SnapshotComplete", Fields: []fixed.Spec{
+		fixed.Uint("SequenceNumber", 4),
+		fixed.Alpha("Segment", 6),
+		instrumentID,
+		flags,
+	}},
+}
+
+// Field is a decoded message field. Value is uint64, a string for the alpha
+// fields or, for prices, a decimal string.
+type Field = fixed.Field
+
+// Message is a message of a unit header packet
+type Message struct {
+	Type   byte
+	Name   string
+	Fields []Field
+	// Body is the raw message including its length and type
+	Body []byte
+}
+
+// Known returns false for message types without a known layout
+func (m *Message) Known() bool { return m.Name != "" }
+
+// Recovery returns true for the messages of the replay and snapshot channels
+func (m *Message) Recovery() bool {
+	switch m.Type {
+	case TypeLoginResponse, TypeReplayResponse, TypeLogout, TypeSnapshotResponse, TypeSnapshotComplete:
+		return true
+	}
+	return false
+}
+
+// Uint returns the value of the unsigned integer field, false when the
+// message has no such field or it's not decoded yet
+func (m *Message) Uint(name string) (uint64, bool) {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			v, ok := f.Value.(uint64)
+			return v, ok
+		}
+	}
+	return 0, false
+}
+
+func (m *Message) String() string {
+	var sb strings.Builder
+	name := m.Name
+	if name == "" {
+		name = "Unknown"
+	}
+	fmt.Fprintf(&sb, "%s [type 0x%02X, length %d]", name, m.Type, len(m.Body))
+	for _, f := range m.Fields {
+		fmt.Fprintf(&sb, " %s=%v", f.Name, f.Value)
+	}
+	return sb.String()
+}
+
+// Messages splits the datagram following its header into its messages,
+// without decoding their fields. Each message starts with its length,
+// including the length field itself, and its type.
+func Messages(b []byte, h *Header) ([]Message, error) {
+	if len(b) < HeaderSize {
+		return nil, ErrShortPacket
+	}
+	msgs := make([]Message, 0, h.Count)
+	b = b[HeaderSize:h.Length]
+	for i := 0; i < int(h.Count); i++ {
+		if len(b) < 2 {
+			return msgs, fmt.Errorf("mitch: %d messages out of %d", i, h.Count)
+		}
+		size := int(b[0])
+		if size < 2 || size > len(b) {
+			return msgs, fmt.Errorf("mitch: invalid message length %d", size)
+		}
+		msgs = append(msgs, Message{Type: b[1], Body: b[:size]})
+		b = b[size:]
+	}
+	return msgs, nil
+}
+
+// Decode decodes the fields of the message
+func (m *Message) Decode() error {
+	l, ok := layouts[m.Type]
+	if !ok {
+		return nil
+	}
+	m.Name = l.Name
+	var err error
+	if m.Fields, err = decoder.Decode(m.Fields[:0], &l, m.Body); err != nil {
+		return fmt.Errorf("mitch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package mitch
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// packet returns a datagram of the market data group with the messages,
+// each one prefixed by its length and type
+func packet(group byte, sequence uint32, msgs ...[]byte) []byte {
+	var body []byte
+	for _, m := range msgs {
+		body = append(body, byte(len(m)+1))
+		body = append(body, m...)
+	}
+	b := binary.LittleEndian.AppendUint16(nil, uint16(HeaderSize+len(body)))
+	b = append(b, uint8(len(msgs)), group)
+	b = binary.LittleEndian.AppendUint32(b, sequence)
+	return append(b, body...)
+}
+
+func addOrder(price int64) []byte {
+	b := []byte{'A'}
+	b = binary.LittleEndian.AppendUint32(b, 123456789)
+	b = binary.LittleEndian.AppendUint64(b, 42)
+	b = append(b, 'S')
+	b = binary.LittleEndian.AppendUint32(b, 500)
+	b = binary.LittleEndian.AppendUint32(b, 7001)
+	b = append(b, 0, 0)
+	b = binary.LittleEndian.AppendUint64(b, uint64(price))
+	return append(b, 1)
+}
+
+func snapshotComplete(seq uint32) []byte {
+	b := []byte{TypeSnapshotComplete}
+	b = binary.LittleEndian.AppendUint32(b, seq)
+	b = append(b, "SET1\x00\x00"...)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	return append(b, 0)
+}
+
+func TestPacket(t *testing.T) {
+	b := packet('A', 900, addOrder(-250000000), snapshotComplete(1234))
+	h, err := ParseHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(h.Length) != len(b) || h.Count != 2 || h.Group != 'A' || h.Sequence != 900 || h.NextSequence() != 902 ||
+		h.Heartbeat() || !h.Sequenced() {
+		t.Fatalf("header %+v", h)
+	}
+	msgs, err := Messages(b, &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Recovery() || !msgs[1].Recovery() {
+		t.Fatalf("messages %v", msgs)
+	}
+
+	m := msgs[0]
+	if err := m.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	want := []Field{
+		{Name: "Nanosecond", Value: uint64(123456789)},
+		{Name: "OrderID", Value: uint64(42)},
+		{Name: "Side", Value: "S"},
+		{Name: "Quantity", Value: uint64(500)},
+		{Name: "InstrumentID", Value: uint64(7001)},
+		{Name: "Reserved1", Value: uint64(0)},
+		{Name: "Reserved2", Value: uint64(0)},
+		{Name: "Price", Value: "-2.50000000"},
+		{Name: "Flags", Value: uint64(1)},
+	}
+	if !m.Known() || m.Name != "AddOrder" || len(m.Fields) != len(want) {
+		t.Fatalf("message %v", m.String())
+	}
+	for i, f := range want {
+		if m.Fields[i] != f {
+			t.Errorf("field %d = %v, want %v", i, m.Fields[i], f)
+		}
+	}
+
+	m = msgs[1]
+	if v, ok := m.Uint("SequenceNumber"); ok {
+		t.Fatalf("SequenceNumber %d before decoding", v)
+	}
+	if err := m.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := m.Uint("SequenceNumber"); !ok || v != 1234 {
+		t.Fatalf("SequenceNumber = %d, %v, want 1234", v, ok)
+	}
+	if _, ok := m.Uint("Segment"); ok {
+		t.Fatal("alpha field read as an integer")
+	}
+}
+
+func TestPacketErrors(t *testing.T) {
+	if _, err := ParseHeader(make([]byte, HeaderSize-1)); !errors.Is(err, ErrShortPacket) {
+		t.Fatalf("ParseHeader of a short packet: %v", err)
+	}
+	b := packet('B', 1, addOrder(100))
+	if _, err := ParseHeader(b[:len(b)-1]); err == nil {
+		t.Fatal("no error for a length beyond the datagram")
+	}
+	h := Header{Length: uint16(len(b)), Count: 2, Sequence: 1}
+	if msgs, err := Messages(b, &h); err == nil || len(msgs) != 1 {
+		t.Fatalf("Messages of a short packet = %v, %v", msgs, err)
+	}
+	b[HeaderSize] = 1
+	h, _ = ParseHeader(b)
+	if msgs, err := Messages(b, &h); err == nil || len(msgs) != 0 {
+		t.Fatalf("Messages with an invalid length = %v, %v", msgs, err)
+	}
+
+	m := Message{Type: 'A', Body: append([]byte{20}, addOrder(100)[:19]...)}
+	if err := m.Decode(); err == nil || m.Name != "AddOrder" {
+		t.Fatalf("Decode of a truncated message: %v", err)
+	}
+	m = Message{Type: 0xF0, Body: []byte{2, 0xF0}}
+	if err := m.Decode(); err != nil || m.Known() {
+		t.Fatalf("Decode of an unknown type: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package moldudp64
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// HeaderSize is the size of the downstream packet header
+	HeaderSize = 20
+	// SessionSize is the size of the session name, padded with spaces
+	SessionSize = 10
+	// BlockHeaderSize is the size of the length prefixed to every message
+	BlockHeaderSize = 2
+	// EndOfSession is the message count of the end of session packets
+	EndOfSession = 0xFFFF
+)
+
+// ErrShortPacket is returned for datagrams smaller than the packet header
+var ErrShortPacket = errors.New("moldudp64: packet shorter than the packet header")
+
+// Header is the header of every MoldUDP64 downstream packet
+type Header struct {
+	Session [SessionSize]byte
+	// SeqNum is the sequence number of the first message of the packet, or
+	// of the next message for heartbeats and end of session
+	SeqNum uint64
+	Count  uint16
+}
+
+// SessionName returns the session without its padding
+func (h *Header) SessionName() string {
+	return strings.TrimRight(string(h.Session[:]), " \x00")
+}
+
+// Heartbeat returns true for packets without messages
+func (h *Header) Heartbeat() bool { return h.Count == 0 }
+
+// EndOfSession returns true for the packets closing the session
+func (h *Header) EndOfSession() bool { return h.Count == EndOfSession }
+
+// Messages returns the number of messages of the packet
+func (h *Header) Messages() uint16 {
+	if h.EndOfSession() {
+		return 0
+	}
+	return h.Count
+}
+
+// NextSeqNum returns the sequence number expected after the packet
+func (h *Header) NextSeqNum() uint64 { return h.SeqNum + uint64(h.Messages()) }
+
+// ParseHeader parses the header at the beginning of a datagram
+func ParseHeader(b []byte) (Header, error) {
+	if len(b) < HeaderSize {
+		return Header{}, ErrShortPacket
+	}
+	var h Header
+	copy(h.Session[:], b[:SessionSize])
+	h.SeqNum = binary.BigEndian.Uint64(b[10:18])
+	h.Count = binary.BigEndian.Uint16(b[18:20])
+	return h, nil
+}
+
+// Blocks returns the messages of the packet following the header. On error
+// the messages read until then are returned.
+func Blocks(b []byte, h *Header) ([][]byte, error) {
+	if len(b) < HeaderSize {
+		return nil, ErrShortPacket
+	}
+	n := int(h.Messages())
+	blocks := make([][]byte, 0, n)
+	b = b[HeaderSize:]
+	for i := 0; i < n; i++ {
+		if len(b) < BlockHeaderSize {
+			return blocks, fmt.Errorf("moldudp64: %d messages out of %d", i, n)
+		}
+		size := int(binary.BigEndian.Uint16(b))
+		if BlockHeaderSize+size > len(b) {
+			return blocks, fmt.Errorf("moldudp64: message length %d beyond the packet end", size)
+		}
+		blocks = append(blocks, b[BlockHeaderSize:BlockHeaderSize+size])
+		b = b[BlockHeaderSize+size:]
+	}
+	return blocks, nil
+}
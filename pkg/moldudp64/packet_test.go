@@ -0,0 +1,123 @@
+package moldudp64
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	b := []byte{
+		'S', 'E', 'S', 'S', '1', ' ', ' ', ' ', ' ', ' ',
+		0, 0, 0, 0, 0, 0, 0x01, 0x02,
+		0, 2,
+		0, 3, 'a', 'b', 'c',
+		0, 1, 'd',
+	}
+	h, err := ParseHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.SessionName() != "SESS1" || h.SeqNum != 0x102 || h.Count != 2 || h.NextSeqNum() != 0x104 {
+		t.Fatalf("header %+v", h)
+	}
+	if h.Heartbeat() || h.EndOfSession() {
+		t.Fatal("packet with messages taken for a heartbeat or an end of session")
+	}
+	blocks, err := Blocks(b, &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || string(blocks[0]) != "abc" || string(blocks[1]) != "d" {
+		t.Fatalf("blocks %q", blocks)
+	}
+
+	if _, err := ParseHeader(b[:HeaderSize-1]); !errors.Is(err, ErrShortPacket) {
+		t.Fatalf("ParseHeader of a short packet: %v", err)
+	}
+	// the second message is truncated
+	if blocks, err := Blocks(b[:len(b)-1], &h); err == nil || len(blocks) != 1 {
+		t.Fatalf("Blocks of a truncated packet = %q, %v", blocks, err)
+	}
+	if blocks, err := Blocks(b[:HeaderSize+3], &h); err == nil || len(blocks) != 0 {
+		t.Fatalf("Blocks of a message beyond the packet = %q, %v", blocks, err)
+	}
+}
+
+func TestHeaderCount(t *testing.T) {
+	tests := []struct {
+		count     uint16
+		heartbeat bool
+		end       bool
+		next      uint64
+	}{
+		{0, true, false, 10},
+		{3, false, false, 13},
+		{EndOfSession, false, true, 10},
+	}
+	for _, tt := range tests {
+		h := Header{SeqNum: 10, Count: tt.count}
+		if h.Heartbeat() != tt.heartbeat || h.EndOfSession() != tt.end || h.NextSeqNum() != tt.next {
+			t.Errorf("count %d: heartbeat %v, end of session %v, next %d", tt.count, h.Heartbeat(), h.EndOfSession(), h.NextSeqNum())
+		}
+	}
+}
+
+func TestRequest(t *testing.T) {
+	r := Request{Session: NewSession("ABC"), SeqNum: 1 << 40, Count: 25}
+	b := AppendRequest(nil, &r)
+	want := []byte{'A', 'B', 'C', ' ', ' ', ' ', ' ', ' ', ' ', ' ', 0, 0, 1, 0, 0, 0, 0, 0, 0, 25}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("AppendRequest = %v, want %v", b, want)
+	}
+	got, err := ParseRequest(b)
+	if err != nil || got != r {
+		t.Fatalf("ParseRequest = %+v, %v, want %+v", got, err, r)
+	}
+	if _, err := ParseRequest(b[:RequestSize-1]); !errors.Is(err, ErrShortRequest) {
+		t.Fatalf("ParseRequest of a short request: %v", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := NewStore()
+	session := NewSession("S")
+	if n, err := s.Add(AppendPacket(nil, session, 5, [][]byte{[]byte("five"), []byte("six")})); n != 2 || err != nil {
+		t.Fatalf("Add = %d, %v", n, err)
+	}
+	packet := AppendPacket(nil, session, 6, [][]byte{[]byte("six"), []byte("seven")})
+	if n, err := s.Add(packet); n != 1 || err != nil {
+		t.Fatalf("Add of a stored message = %d, %v", n, err)
+	}
+	// the store keeps copies
+	copy(packet[HeaderSize+BlockHeaderSize+3+BlockHeaderSize:], "XXXXX")
+	if sessions, messages := s.Len(); sessions != 1 || messages != 3 {
+		t.Fatalf("Len() = %d, %d", sessions, messages)
+	}
+
+	tests := []struct {
+		seq     uint64
+		count   int
+		maxSize int
+		want    []string
+	}{
+		{5, 10, 1500, []string{"five", "six", "seven"}},
+		{6, 1, 1500, []string{"six"}},
+		{4, 10, 1500, nil},
+		// the first message is returned even when too large
+		{5, 10, HeaderSize + 2, []string{"five"}},
+		{5, 10, HeaderSize + 2*BlockHeaderSize + 7, []string{"five", "six"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, b := range s.Get(session, tt.seq, tt.count, tt.maxSize) {
+			got = append(got, string(b))
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && got[len(got)-1] != tt.want[len(tt.want)-1]) {
+			t.Errorf("Get(%d, %d, %d) = %q, want %q", tt.seq, tt.count, tt.maxSize, got, tt.want)
+		}
+	}
+	if got := s.Get(NewSession("OTHER"), 5, 10, 1500); len(got) != 0 {
+		t.Fatalf("messages of an unknown session %q", got)
+	}
+}
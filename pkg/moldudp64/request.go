@@ -0,0 +1,54 @@
+package moldudp64
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// RequestSize is the size of a re-request packet
+const RequestSize = 20
+
+// ErrShortRequest is returned for re-request packets smaller than RequestSize
+var ErrShortRequest = errors.New("moldudp64: re-request shorter than 20 bytes")
+
+// Request asks the re-request server for Count messages of the session from
+// SeqNum, its layout is the one of the downstream packet header
+type Request = Header
+
+// NewSession returns the session name padded with spaces
+func NewSession(name string) [SessionSize]byte {
+	var s [SessionSize]byte
+	n := copy(s[:], name)
+	for i := n; i < SessionSize; i++ {
+		s[i] = ' '
+	}
+	return s
+}
+
+// AppendRequest appends the encoded re-request to b
+func AppendRequest(b []byte, r *Request) []byte {
+	b = append(b, r.Session[:]...)
+	b = binary.BigEndian.AppendUint64(b, r.SeqNum)
+	return binary.BigEndian.AppendUint16(b, r.Count)
+}
+
+// ParseRequest parses a re-request packet
+func ParseRequest(b []byte) (Request, error) {
+	if len(b) < RequestSize {
+		return Request{}, ErrShortRequest
+	}
+	return ParseHeader(b)
+}
+
+// AppendPacket appends a downstream packet with the messages to b, the
+// sequence number being the one of the first message
+func AppendPacket(b []byte, session [SessionSize]byte, seqNum uint64, msgs [][]byte) []byte {
+	b = append(b, session[:]...)
+	b = binary.BigEndian.AppendUint64(b, seqNum)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(msgs)))
+	for _, m := range msgs {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(m)))
+		b = append(b, m...)
+	}
+	return b
+}
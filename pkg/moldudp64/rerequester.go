@@ -0,0 +1,229 @@
+package moldudp64
+
+import (
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/latency"
+	"net"
+	"sync"
+	"time"
+)
+
+// MaxRequestCount is the highest message count of a re-request, 0xFFFF
+// being reserved to the end of session
+const MaxRequestCount = EndOfSession - 1
+
+// RerequestStats are the re-request counters since the previous SwapStats
+type RerequestStats struct {
+	// Requests is the number of re-request packets sent
+	Requests uint64
+	// Recovered is the number of missing messages received, Gaps the number
+	// of gaps fully recovered
+	Recovered uint64
+	Gaps      uint64
+	// Unrecovered is the number of messages given up after the retries
+	Unrecovered uint64
+	// Pending is the number of messages still awaited
+	Pending uint64
+	// Latency is the time from the detection of a gap to its recovery
+	Latency latency.Stats
+}
+
+type pendingGap struct {
+	session [SessionSize]byte
+	// from and to are the first and the last plus one missing messages
+	from, to uint64
+	// next is the first message not yet recovered, requested the end of the
+	// last request
+	next, requested uint64
+	remaining       uint64
+	detected, sent  time.Time
+	retries         int
+	// progress is set when messages were recovered since the last request
+	progress bool
+}
+
+// Rerequester asks a MoldUDP64 re-request server for the messages of the
+// gaps, in requests of at most maxCount messages sent again after timeout up
+// to retries times. The responses are downstream packets read by Read.
+// A Rerequester is safe for concurrent use.
+type Rerequester struct {
+	mu       sync.Mutex
+	conn     *net.UDPConn
+	timeout  time.Duration
+	retries  int
+	maxCount uint64
+	pending  []*pendingGap
+	buffer   []byte
+	latency  latency.Histogram
+	stats    RerequestStats
+}
+
+// DialRerequester returns a re-requester of the server address (host:port)
+func DialRerequester(address string, timeout time.Duration, retries int, maxCount int) (*Rerequester, error) {
+	addr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	if maxCount <= 0 || maxCount > MaxRequestCount {
+		maxCount = MaxRequestCount
+	}
+	return &Rerequester{
+		conn:     conn,
+		timeout:  timeout,
+		retries:  retries,
+		maxCount: uint64(maxCount),
+	}, nil
+}
+
+// Close closes the connection to the server
+func (r *Rerequester) Close() error { return r.conn.Close() }
+
+// Gap requests the count messages of the session missing from seqNum
+func (r *Rerequester) Gap(session [SessionSize]byte, seqNum uint64, count uint64, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g := &pendingGap{
+		session:   session,
+		from:      seqNum,
+		to:        seqNum + count,
+		next:      seqNum,
+		remaining: count,
+		detected:  now,
+	}
+	r.pending = append(r.pending, g)
+	return r.request(g, now)
+}
+
+// request sends the re-request of the next messages of the gap
+func (r *Rerequester) request(g *pendingGap, now time.Time) error {
+	count := min(g.to-g.next, r.maxCount)
+	g.requested = g.next + count
+	g.sent = now
+	g.progress = false
+	r.stats.Requests++
+	r.buffer = AppendRequest(r.buffer[:0], &Request{Session: g.session, SeqNum: g.next, Count: uint16(count)})
+	if _, err := r.conn.Write(r.buffer); err != nil {
+		return fmt.Errorf("moldudp64: re-request of %d messages from %d: %w", count, g.next, err)
+	}
+	return nil
+}
+
+// Recovered marks a missing message as received, from the re-request server
+// or late from the feed. It returns the recovery latency of the gap when it
+// was its last missing message.
+func (r *Rerequester) Recovered(session [SessionSize]byte, seqNum uint64, now time.Time) (time.Duration, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, g := range r.pending {
+		if g.session != session || seqNum < g.from || seqNum >= g.to {
+			continue
+		}
+		r.stats.Recovered++
+		g.remaining--
+		if seqNum >= g.next {
+			g.next = seqNum + 1
+			g.progress = true
+			g.retries = 0
+		}
+		if g.remaining == 0 {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			elapsed := now.Sub(g.detected)
+			r.latency.Record(elapsed)
+			r.stats.Gaps++
+			return elapsed, true, nil
+		}
+		if g.next >= g.requested && g.next < g.to {
+			// the request was served, ask for the following messages
+			return 0, false, r.request(g, now)
+		}
+		return 0, false, nil
+	}
+	return 0, false, nil
+}
+
+// Served re-requests at once the rest of the gaps of the session on which a
+// response packet made progress: the server answers a request with a single
+// packet, holding fewer messages than requested when they don't fit in it.
+func (r *Rerequester) Served(session [SessionSize]byte, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	for _, g := range r.pending {
+		if g.session != session || !g.progress || g.next >= g.to {
+			continue
+		}
+		if e := r.request(g, now); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Retry sends again the requests not served within the timeout and gives up
+// the gaps after the retries. It returns the number of messages given up.
+func (r *Rerequester) Retry(now time.Time) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var lost uint64
+	var err error
+	pending := r.pending[:0]
+	for _, g := range r.pending {
+		if now.Sub(g.sent) < r.timeout {
+			pending = append(pending, g)
+			continue
+		}
+		if g.retries >= r.retries {
+			lost += g.remaining
+			continue
+		}
+		g.retries++
+		if e := r.request(g, now); e != nil && err == nil {
+			err = e
+		}
+		pending = append(pending, g)
+	}
+	clear(r.pending[len(pending):])
+	r.pending = pending
+	r.stats.Unrecovered += lost
+	return lost, err
+}
+
+// Read calls f with the packets received from the server until an error
+func (r *Rerequester) Read(f func(packet []byte)) error {
+	buffer := make([]byte, 65536)
+	for {
+		n, err := r.conn.Read(buffer)
+		if err != nil {
+			return err
+		}
+		f(buffer[:n])
+	}
+}
+
+// SwapStats returns the counters and the recovery latencies and resets them
+func (r *Rerequester) SwapStats() RerequestStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.stats
+	for _, g := range r.pending {
+		s.Pending += g.remaining
+	}
+	h := &r.latency
+	s.Latency = latency.Stats{
+		Count: h.Count(),
+		Min:   h.Min(),
+		Mean:  h.Mean(),
+		P50:   h.Percentile(50),
+		P90:   h.Percentile(90),
+		P99:   h.Percentile(99),
+		P999:  h.Percentile(99.9),
+		Max:   h.Max(),
+	}
+	h.Reset()
+	r.stats = RerequestStats{}
+	return s
+}
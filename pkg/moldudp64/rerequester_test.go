@@ -0,0 +1,121 @@
+package moldudp64
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// server returns a re-request server on the loopback and a function reading
+// its next request
+func server(t *testing.T) (string, func() Request) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("no loopback UDP: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn.LocalAddr().String(), func() Request {
+		t.Helper()
+		b := make([]byte, 64)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(b)
+		if err != nil {
+			t.Fatalf("no request: %v", err)
+		}
+		r, err := ParseRequest(b[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+}
+
+func TestRerequester(t *testing.T) {
+	address, next := server(t)
+	r, err := DialRerequester(address, time.Second, 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	session := NewSession("S")
+	now := time.Unix(1700000000, 0)
+
+	if err := r.Gap(session, 100, 10, now); err != nil {
+		t.Fatal(err)
+	}
+	if req := next(); req.SeqNum != 100 || req.Count != 4 {
+		t.Fatalf("request %+v, want 4 messages from 100", req)
+	}
+
+	// a response with 2 of the 4 messages: the rest is requested at once
+	r.Recovered(session, 100, now)
+	r.Recovered(session, 101, now)
+	if err := r.Served(session, now); err != nil {
+		t.Fatal(err)
+	}
+	if req := next(); req.SeqNum != 102 || req.Count != 4 {
+		t.Fatalf("request %+v, want 4 messages from 102", req)
+	}
+	// without progress nothing is requested
+	r.Served(session, now)
+
+	// the request served entirely asks for the following messages
+	for seq := uint64(102); seq < 106; seq++ {
+		r.Recovered(session, seq, now)
+	}
+	if req := next(); req.SeqNum != 106 || req.Count != 4 {
+		t.Fatalf("request %+v, want 4 messages from 106", req)
+	}
+
+	// no response: retried once, then given up
+	now = now.Add(time.Second)
+	if lost, err := r.Retry(now); lost != 0 || err != nil {
+		t.Fatalf("Retry() = %d, %v", lost, err)
+	}
+	if req := next(); req.SeqNum != 106 {
+		t.Fatalf("retry %+v, want from 106", req)
+	}
+	// a late message resets the retries
+	r.Recovered(session, 106, now)
+	now = now.Add(time.Second)
+	r.Retry(now)
+	if req := next(); req.SeqNum != 107 || req.Count != 3 {
+		t.Fatalf("retry %+v, want 3 messages from 107", req)
+	}
+	now = now.Add(time.Second)
+	if lost, _ := r.Retry(now); lost != 3 {
+		t.Fatalf("Retry() gave up %d messages, want 3", lost)
+	}
+
+	s := r.SwapStats()
+	if s.Requests != 5 || s.Recovered != 7 || s.Unrecovered != 3 || s.Pending != 0 || s.Gaps != 0 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestRerequesterRecovered(t *testing.T) {
+	address, next := server(t)
+	r, err := DialRerequester(address, time.Second, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	session := NewSession("S")
+	now := time.Unix(1700000000, 0)
+	r.Gap(session, 5, 2, now)
+	if req := next(); req.Count != 2 {
+		t.Fatalf("request %+v", req)
+	}
+	if _, done, _ := r.Recovered(NewSession("OTHER"), 5, now); done {
+		t.Fatal("gap recovered by another session")
+	}
+	r.Recovered(session, 6, now)
+	elapsed, done, err := r.Recovered(session, 5, now.Add(time.Millisecond))
+	if !done || err != nil || elapsed != time.Millisecond {
+		t.Fatalf("Recovered() = %v, %v, %v", elapsed, done, err)
+	}
+	if s := r.SwapStats(); s.Gaps != 1 || s.Latency.Count != 1 {
+		t.Fatalf("stats %+v", s)
+	}
+}
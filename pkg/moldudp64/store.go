@@ -0,0 +1,59 @@
+package moldudp64
+
+// Store keeps the messages of the downstream packets by session and sequence
+// number, e.g. to serve re-requests. A Store is not safe for concurrent use.
+type Store struct {
+	sessions map[[SessionSize]byte]map[uint64][]byte
+	messages int
+}
+
+// NewStore returns an empty store
+func NewStore() *Store {
+	return &Store{sessions: make(map[[SessionSize]byte]map[uint64][]byte)}
+}
+
+// Add stores the messages of a downstream packet, copying them. It returns
+// the number of messages not already stored.
+func (s *Store) Add(packet []byte) (int, error) {
+	h, err := ParseHeader(packet)
+	if err != nil {
+		return 0, err
+	}
+	blocks, err := Blocks(packet, &h)
+	msgs, ok := s.sessions[h.Session]
+	if !ok {
+		msgs = make(map[uint64][]byte)
+		s.sessions[h.Session] = msgs
+	}
+	added := 0
+	for i, b := range blocks {
+		seq := h.SeqNum + uint64(i)
+		if _, ok := msgs[seq]; ok {
+			continue
+		}
+		msgs[seq] = append([]byte(nil), b...)
+		added++
+	}
+	s.messages += added
+	return added, err
+}
+
+// Len returns the number of sessions and messages stored
+func (s *Store) Len() (int, int) { return len(s.sessions), s.messages }
+
+// Get returns the consecutive stored messages of the session from seqNum, at
+// most count of them and fitting in a downstream packet of maxSize bytes.
+func (s *Store) Get(session [SessionSize]byte, seqNum uint64, count int, maxSize int) [][]byte {
+	msgs := s.sessions[session]
+	var blocks [][]byte
+	size := HeaderSize
+	for seq := seqNum; len(blocks) < count; seq++ {
+		m, ok := msgs[seq]
+		if !ok || (len(blocks) > 0 && size+BlockHeaderSize+len(m) > maxSize) {
+			break
+		}
+		size += BlockHeaderSize + len(m)
+		blocks = append(blocks, m)
+	}
+	return blocks
+}
@@ -0,0 +1,136 @@
+package optiq
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Compression codecs of the packet body
+const (
+	CodecZlib  = "zlib"
+	CodecFlate = "flate"
+	CodecLZ4   = "lz4"
+)
+
+// Decompressor decompresses packet bodies reusing its buffers. A
+// Decompressor is not safe for concurrent use.
+type Decompressor struct {
+	codec string
+	buf   bytes.Buffer
+	src   bytes.Reader
+	zr    io.ReadCloser
+	fr    io.ReadCloser
+}
+
+// NewDecompressor returns a decompressor for the codec: zlib, flate (raw
+// deflate) or lz4 (block format)
+func NewDecompressor(codec string) (*Decompressor, error) {
+	switch codec {
+	case CodecZlib, CodecFlate, CodecLZ4:
+		return &Decompressor{codec: codec}, nil
+	}
+	return nil, fmt.Errorf("optiq: unknown compression codec %q", codec)
+}
+
+// Decompress returns the decompressed body, valid until the next call
+func (d *Decompressor) Decompress(body []byte) ([]byte, error) {
+	d.buf.Reset()
+	d.src.Reset(body)
+	var err error
+	switch d.codec {
+	case CodecZlib:
+		if d.zr == nil {
+			d.zr, err = zlib.NewReader(&d.src)
+		} else {
+			err = d.zr.(zlib.Resetter).Reset(&d.src, nil)
+		}
+		if err == nil {
+			_, err = d.buf.ReadFrom(d.zr)
+		}
+	case CodecFlate:
+		if d.fr == nil {
+			d.fr = flate.NewReader(&d.src)
+		} else {
+			err = d.fr.(flate.Resetter).Reset(&d.src, nil)
+		}
+		if err == nil {
+			_, err = d.buf.ReadFrom(d.fr)
+		}
+	case CodecLZ4:
+		return d.lz4Block(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("optiq: %s decompression failed: %w", d.codec, err)
+	}
+	return d.buf.Bytes(), nil
+}
+
+var errLZ4Corrupt = errors.New("optiq: lz4 decompression failed: corrupted block")
+
+// lz4Block decodes an LZ4 block: sequences of literals and back references
+func (d *Decompressor) lz4Block(src []byte) ([]byte, error) {
+	dst := d.buf.AvailableBuffer()[:0]
+	i := 0
+	for i < len(src) {
+		token := src[i]
+		i++
+
+		literals := int(token >> 4)
+		if literals == 15 {
+			for {
+				if i >= len(src) {
+					return nil, errLZ4Corrupt
+				}
+				b := src[i]
+				i++
+				literals += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		if i+literals > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		if i == len(src) {
+			// the last sequence has only literals
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errLZ4Corrupt
+		}
+		matchLen := int(token&0xf) + 4
+		if token&0xf == 15 {
+			for {
+				if i >= len(src) {
+					return nil, errLZ4Corrupt
+				}
+				b := src[i]
+				i++
+				matchLen += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		// the match can overlap the bytes it produces
+		start := len(dst) - offset
+		for k := 0; k < matchLen; k++ {
+			dst = append(dst, dst[start+k])
+		}
+	}
+	d.buf.Write(dst)
+	return d.buf.Bytes(), nil
+}
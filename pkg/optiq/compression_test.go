@@ -0,0 +1,84 @@
+package optiq
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+var compressedText = bytes.Repeat([]byte("Euronext Optiq MDG packet body, Euronext Optiq MDG packet body repeated; "), 5)
+
+// known vectors, LZ4 blocks extracted from the frames of the lz4 command
+// line tool, zlib and raw deflate streams from the zlib library
+var codecVectors = []struct {
+	codec      string
+	compressed string
+	want       []byte
+}{
+	{CodecLZ4, "3f6162630300ffffffff99506263616263", bytes.Repeat([]byte("abc"), 400)},
+	{CodecLZ4, "ff114575726f6e657874204f70746971204d4447207061636b657420626f64792c2020000bbf2072657065617465643b204900ff0d507465643b20", compressedText},
+	{CodecZlib, "78da732d2dcacf4bad2851f02f28c92c54f075715728484cce4e2d5148ca4fa9d45170c52baf50945a909a58929a624d40e1a8412083009e238148", compressedText},
+	{CodecFlate, "732d2dcacf4bad2851f02f28c92c54f075715728484cce4e2d5148ca4fa9d45170c52baf50945a909a58929a624d40e1a841208300", compressedText},
+}
+
+func TestDecompress(t *testing.T) {
+	for _, v := range codecVectors {
+		d, err := NewDecompressor(v.codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, _ := hex.DecodeString(v.compressed)
+		// twice, reusing the buffers and readers
+		for i := 0; i < 2; i++ {
+			got, err := d.Decompress(src)
+			if err != nil {
+				t.Fatalf("%s: %v", v.codec, err)
+			}
+			if !bytes.Equal(got, v.want) {
+				t.Fatalf("%s: decompressed %q, want %q", v.codec, got, v.want)
+			}
+		}
+	}
+}
+
+// TestDecompressLZ4Literals decodes a block of 300 literals, extended by two
+// length bytes, followed by a match of 100 and 20 bytes
+func TestDecompressLZ4Literals(t *testing.T) {
+	src, _ := hex.DecodeString("ffff1ea54dca182530bb1d6d132cded6237b2ed91e3f721fcb1971174494d6493c9d5c3460be31201e69fedaa0eee8b9997f5c7c2999fdafe593253cd654af4dfad71427a0aeb3fee9232f8af2211f9ee491c5b10becb5563bfc1e6f93427ecbc8fe2955e5cd8e46dc8ed4b7c2764d2a5a4d767706f85d8690024ad6bda3401be9c8cbccc935f6cd1f61226ae15338ae1a34004d33ba0d246ac04c81b1baf23e3bf9eef5f79f2b4934af87f5520b69b94b0d982e85bb55b672a872637acd7466fcb60e0e8ff18463b0e4b2ba29703474f064ac68f700f5b02b3dc666f45bdeaa2ccaedcd2b5157410e4dee4af2b34f430a073447de636c0e806c957ba684d6431fb5ead7424d09e15d024c5848f23d1fa6f7361d7f618d1532e70e20e2a6668de7f47e8467e546d53ec8e2a1257bdb2c01511a7a0100507a7a7a7a7a")
+	literals := src[3:303]
+	want := append(append(append([]byte{}, literals...), literals[:100]...), bytes.Repeat([]byte("z"), 20)...)
+	d, _ := NewDecompressor(CodecLZ4)
+	got, err := d.Decompress(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("decompressed %d bytes %x, want %d bytes %x", len(got), got, len(want), want)
+	}
+}
+
+func TestDecompressCorrupted(t *testing.T) {
+	tests := []struct {
+		codec string
+		src   string
+	}{
+		{CodecLZ4, "f0"},            // literals length extension missing
+		{CodecLZ4, "5061626364"},    // 5 literals, 4 given
+		{CodecLZ4, "106100"},        // offset truncated
+		{CodecLZ4, "1061000000"},    // offset 0
+		{CodecLZ4, "1061050000"},    // offset past the output
+		{CodecLZ4, "1f610100"},      // match length extension missing
+		{CodecZlib, "78da732d2dca"}, // truncated stream
+		{CodecFlate, "ffffffff"},
+	}
+	for _, tt := range tests {
+		d, _ := NewDecompressor(tt.codec)
+		src, _ := hex.DecodeString(tt.src)
+		if got, err := d.Decompress(src); err == nil {
+			t.Errorf("%s %s: no error, decompressed %x", tt.codec, tt.src, got)
+		}
+	}
+	if _, err := NewDecompressor("zstd"); err == nil {
+		t.Error("no error for an unknown codec")
+	}
+}
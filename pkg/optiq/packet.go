@@ -0,0 +1,133 @@
+package optiq
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// PacketHeaderSize is the size of the MDG packet header
+	PacketHeaderSize = 16
+	// FrameSize is the size of the length prefixed to every message of a packet
+	FrameSize = 2
+)
+
+/*
+Packet flags (Little-Endian):
+  - Bit 0: Compression
+  - 0 = body of the packet is not compressed (the body is the packet without the packet header)
+  - 1 = body of the packet is compressed
+  - Bit 1 to 3: will be set to 0 every morning and incremented for each restart of MDG in the same day (wrapping to 0 if the field overflows
+  - Bit 4 to 6: used if the Packet Sequence Number (PSN) goes over (2^32)-1. They are PSN high weight bits
+  - Bit 7: is set to 1 when in the packet there is a Start Of Snapshot (2101) message, 0 otherwise
+  - Bit 8: is set to 1 when in the packet there is an End Of Snapshot (2102) message, 0 otherwise
+  - Bit 9: is set to 1 when in the packet there is a Health Status (1103) message, Start Of Day (1101) message or End Of Day (1102) message, 0 otherwise
+  - Bit 10 to 15: for future use
+*/
+const (
+	FlagCompressed      uint16 = 1 << 0
+	FlagStartOfSnapshot uint16 = 1 << 7
+	FlagEndOfSnapshot   uint16 = 1 << 8
+	FlagSessionStatus   uint16 = 1 << 9
+
+	flagRestartShift = 1
+	flagRestartMask  = 0x7
+	flagPSNHighShift = 4
+	flagPSNHighMask  = 0x7
+)
+
+// Template IDs of the MDG technical messages
+const (
+	TemplateStartOfDay      = 1101
+	TemplateEndOfDay        = 1102
+	TemplateHealthStatus    = 1103
+	TemplateStartOfSnapshot = 2101
+	TemplateEndOfSnapshot   = 2102
+)
+
+// ErrShortPacket is returned for datagrams smaller than the packet header
+var ErrShortPacket = errors.New("optiq: packet shorter than the packet header")
+
+// PacketHeader is the header of every MDG datagram
+type PacketHeader struct {
+	// PacketTime is the exchange send time in nanoseconds since the epoch
+	PacketTime uint64
+	// SeqNum is the packet sequence number including its high weight bits
+	SeqNum    uint64
+	Flags     uint16
+	ChannelID uint16
+}
+
+// Compressed returns true when the packet body is compressed
+func (h *PacketHeader) Compressed() bool { return h.Flags&FlagCompressed != 0 }
+
+// Restarts returns the number of MDG restarts of the day (wrapping at 8)
+func (h *PacketHeader) Restarts() uint8 {
+	return uint8(h.Flags >> flagRestartShift & flagRestartMask)
+}
+
+// StartOfSnapshot returns true when the packet has a Start Of Snapshot message
+func (h *PacketHeader) StartOfSnapshot() bool { return h.Flags&FlagStartOfSnapshot != 0 }
+
+// EndOfSnapshot returns true when the packet has an End Of Snapshot message
+func (h *PacketHeader) EndOfSnapshot() bool { return h.Flags&FlagEndOfSnapshot != 0 }
+
+// SessionStatus returns true when the packet has a Health Status, Start Of
+// Day or End Of Day message
+func (h *PacketHeader) SessionStatus() bool { return h.Flags&FlagSessionStatus != 0 }
+
+// ParsePacketHeader parses the header at the beginning of a datagram
+func ParsePacketHeader(b []byte) (PacketHeader, error) {
+	if len(b) < PacketHeaderSize {
+		return PacketHeader{}, ErrShortPacket
+	}
+	h := PacketHeader{
+		PacketTime: binary.LittleEndian.Uint64(b[0:8]),
+		SeqNum:     uint64(binary.LittleEndian.Uint32(b[8:12])),
+		Flags:      binary.LittleEndian.Uint16(b[12:14]),
+		ChannelID:  binary.LittleEndian.Uint16(b[14:16]),
+	}
+	h.SeqNum |= uint64(h.Flags>>flagPSNHighShift&flagPSNHighMask) << 32
+	return h, nil
+}
+
+// Frame is a message of a packet body
+type Frame struct {
+	TemplateID uint16
+	// Data is the SBE message, header included
+	Data []byte
+}
+
+// Technical returns true for the session and snapshot cycle messages,
+// which carry no market data
+func (f Frame) Technical() bool {
+	switch f.TemplateID {
+	case TemplateStartOfDay, TemplateEndOfDay, TemplateHealthStatus, TemplateStartOfSnapshot, TemplateEndOfSnapshot:
+		return true
+	}
+	return false
+}
+
+// Frames splits the (uncompressed) packet body into its messages. Each
+// message is prefixed by its size, excluding the size field itself.
+func Frames(body []byte) ([]Frame, error) {
+	var frames []Frame
+	for len(body) > 0 {
+		if len(body) < FrameSize+4 {
+			return frames, fmt.Errorf("optiq: %d trailing bytes", len(body))
+		}
+		size := int(binary.LittleEndian.Uint16(body[0:2]))
+		if size < 4 || FrameSize+size > len(body) {
+			return frames, fmt.Errorf("optiq: invalid message size %d", size)
+		}
+		data := body[FrameSize : FrameSize+size]
+		frames = append(frames, Frame{
+			// the template id follows the block length in the SBE message header
+			TemplateID: binary.LittleEndian.Uint16(data[2:4]),
+			Data:       data,
+		})
+		body = body[FrameSize+size:]
+	}
+	return frames, nil
+}
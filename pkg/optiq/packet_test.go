@@ -0,0 +1,64 @@
+package optiq
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestParsePacketHeader(t *testing.T) {
+	b := binary.LittleEndian.AppendUint64(nil, 1700000000123456789)
+	b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFE)
+	// compressed, 2 restarts, PSN high bits 5, end of snapshot
+	b = binary.LittleEndian.AppendUint16(b, FlagCompressed|2<<1|5<<4|FlagEndOfSnapshot)
+	b = binary.LittleEndian.AppendUint16(b, 42)
+	h, err := ParsePacketHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.PacketTime != 1700000000123456789 || h.SeqNum != 5<<32|0xFFFFFFFE || h.ChannelID != 42 {
+		t.Fatalf("header %+v", h)
+	}
+	if !h.Compressed() || h.Restarts() != 2 || h.StartOfSnapshot() || !h.EndOfSnapshot() || h.SessionStatus() {
+		t.Fatalf("flags %#x: compressed %v, restarts %d, start %v, end %v, status %v", h.Flags,
+			h.Compressed(), h.Restarts(), h.StartOfSnapshot(), h.EndOfSnapshot(), h.SessionStatus())
+	}
+	if _, err := ParsePacketHeader(b[:PacketHeaderSize-1]); !errors.Is(err, ErrShortPacket) {
+		t.Fatalf("short packet error %v", err)
+	}
+}
+
+// frame returns a size prefixed message with the SBE header of the template
+func frame(templateID uint16, body ...byte) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, uint16(8+len(body)))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(body)))
+	b = binary.LittleEndian.AppendUint16(b, templateID)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	return append(b, body...)
+}
+
+func TestFrames(t *testing.T) {
+	body := append(frame(TemplateHealthStatus), frame(1001, 1, 2, 3)...)
+	frames, err := Frames(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("%d frames, want 2", len(frames))
+	}
+	if frames[0].TemplateID != TemplateHealthStatus || !frames[0].Technical() || len(frames[0].Data) != 8 {
+		t.Errorf("frame 0: template %d, technical %v, %d bytes", frames[0].TemplateID, frames[0].Technical(), len(frames[0].Data))
+	}
+	if frames[1].TemplateID != 1001 || frames[1].Technical() || len(frames[1].Data) != 11 {
+		t.Errorf("frame 1: template %d, technical %v, %d bytes", frames[1].TemplateID, frames[1].Technical(), len(frames[1].Data))
+	}
+
+	if frames, err := Frames(append(frame(1001), 0, 0)); err == nil || len(frames) != 1 {
+		t.Errorf("trailing bytes: %d frames, error %v", len(frames), err)
+	}
+	bad := frame(1001, 1, 2, 3)
+	binary.LittleEndian.PutUint16(bad, 100)
+	if _, err := Frames(bad); err == nil {
+		t.Error("no error for a size past the body")
+	}
+}
@@ -0,0 +1,225 @@
+package optiq
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventKind is the kind of a channel session event
+type EventKind int
+
+const (
+	EventStartOfDay EventKind = iota
+	EventEndOfDay
+	EventSnapshotStart
+	EventSnapshotEnd
+	// EventSnapshotIncomplete is a snapshot cycle restarted before its end
+	// or with packets lost in the middle
+	EventSnapshotIncomplete
+	EventHeartbeatMissed
+	EventHeartbeatResumed
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventStartOfDay:
+		return "Start of day"
+	case EventEndOfDay:
+		return "End of day"
+	case EventSnapshotStart:
+		return "Snapshot start"
+	case EventSnapshotEnd:
+		return "Snapshot end"
+	case EventSnapshotIncomplete:
+		return "Snapshot incomplete"
+	case EventHeartbeatMissed:
+		return "Heartbeat missed"
+	case EventHeartbeatResumed:
+		return "Heartbeat resumed"
+	}
+	return fmt.Sprintf("Event(%d)", int(k))
+}
+
+// Cycle is a snapshot cycle of a channel, timed with the packet times
+type Cycle struct {
+	Start   time.Time
+	End     time.Time
+	Packets uint64
+	// Gaps is the number of sequence gaps seen during the cycle
+	Gaps uint64
+}
+
+// Duration returns the time elapsed between the first and the last packet
+func (c Cycle) Duration() time.Duration { return c.End.Sub(c.Start) }
+
+// Event is a session event of a channel
+type Event struct {
+	Kind      EventKind
+	ChannelID uint16
+	// Time is the packet time, or the local time for the heartbeat events
+	Time time.Time
+	// Cycle is set for the snapshot end and incomplete events
+	Cycle *Cycle
+	// Silence is the time elapsed since the last heartbeat
+	Silence time.Duration
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case EventSnapshotEnd, EventSnapshotIncomplete:
+		return fmt.Sprintf("%s on channel %d: %d packets in %v, %d gaps", e.Kind, e.ChannelID,
+			e.Cycle.Packets, e.Cycle.Duration(), e.Cycle.Gaps)
+	case EventHeartbeatMissed, EventHeartbeatResumed:
+		return fmt.Sprintf("%s on channel %d: %v since the last one", e.Kind, e.ChannelID, e.Silence.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s on channel %d at %s", e.Kind, e.ChannelID, e.Time.Format(time.RFC3339Nano))
+}
+
+// SessionStats are the session counters since the last SwapStats
+type SessionStats struct {
+	Cycles           uint64
+	IncompleteCycles uint64
+	// LastCycle is the last completed cycle, of any channel
+	LastCycle        Cycle
+	Heartbeats       uint64
+	MissedHeartbeats uint64
+}
+
+type channelSession struct {
+	cycle         *Cycle
+	lastHeartbeat time.Time
+	missed        bool
+	endOfDay      bool
+}
+
+// Session tracks the snapshot cycles, the health status heartbeats and the
+// start/end of day of the channels of a stream. It's safe for concurrent use.
+type Session struct {
+	mu               sync.Mutex
+	heartbeatTimeout time.Duration
+	channels         map[uint16]*channelSession
+	stats            SessionStats
+}
+
+// NewSession returns a session tracker alerting when a channel doesn't send
+// a health status for longer than heartbeatTimeout (0 disables the alerts)
+func NewSession(heartbeatTimeout time.Duration) *Session {
+	return &Session{
+		heartbeatTimeout: heartbeatTimeout,
+		channels:         make(map[uint16]*channelSession),
+	}
+}
+
+func (s *Session) channel(id uint16) *channelSession {
+	c, ok := s.channels[id]
+	if !ok {
+		c = &channelSession{}
+		s.channels[id] = c
+	}
+	return c
+}
+
+// Packet tracks a packet received at now. Frames are needed only for the
+// packets flagged with a session status message.
+func (s *Session) Packet(h *PacketHeader, frames []Frame, now time.Time) []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []Event
+	c := s.channel(h.ChannelID)
+	packetTime := time.Unix(0, int64(h.PacketTime))
+
+	if h.StartOfSnapshot() {
+		if c.cycle != nil {
+			s.stats.IncompleteCycles++
+			events = append(events, Event{Kind: EventSnapshotIncomplete, ChannelID: h.ChannelID, Time: packetTime, Cycle: c.cycle})
+		}
+		c.cycle = &Cycle{Start: packetTime}
+		events = append(events, Event{Kind: EventSnapshotStart, ChannelID: h.ChannelID, Time: packetTime})
+	}
+	if c.cycle != nil {
+		c.cycle.Packets++
+		c.cycle.End = packetTime
+	}
+	if h.EndOfSnapshot() && c.cycle != nil {
+		kind := EventSnapshotEnd
+		if c.cycle.Gaps > 0 {
+			kind = EventSnapshotIncomplete
+			s.stats.IncompleteCycles++
+		} else {
+			s.stats.Cycles++
+			s.stats.LastCycle = *c.cycle
+		}
+		events = append(events, Event{Kind: kind, ChannelID: h.ChannelID, Time: packetTime, Cycle: c.cycle})
+		c.cycle = nil
+	}
+
+	if h.SessionStatus() {
+		for _, f := range frames {
+			switch f.TemplateID {
+			case TemplateHealthStatus:
+				s.stats.Heartbeats++
+				if c.missed {
+					events = append(events, Event{Kind: EventHeartbeatResumed, ChannelID: h.ChannelID, Time: now, Silence: now.Sub(c.lastHeartbeat)})
+					c.missed = false
+				}
+				c.lastHeartbeat = now
+				c.endOfDay = false
+			case TemplateStartOfDay:
+				c.endOfDay = false
+				events = append(events, Event{Kind: EventStartOfDay, ChannelID: h.ChannelID, Time: packetTime})
+			case TemplateEndOfDay:
+				// no more heartbeats are expected until the next day
+				c.endOfDay = true
+				events = append(events, Event{Kind: EventEndOfDay, ChannelID: h.ChannelID, Time: packetTime})
+			}
+		}
+	}
+	return events
+}
+
+// Gap records lost packets on the channel, making its current snapshot
+// cycle incomplete
+func (s *Session) Gap(channelID uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.channel(channelID); c.cycle != nil {
+		c.cycle.Gaps++
+	}
+}
+
+// CheckHeartbeats returns an event for every channel which has stopped
+// sending health status messages since the last check. Channels never seen
+// sending one, or after their end of day, are not checked.
+func (s *Session) CheckHeartbeats(now time.Time) []Event {
+	if s.heartbeatTimeout <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []Event
+	for id, c := range s.channels {
+		if c.missed || c.endOfDay || c.lastHeartbeat.IsZero() {
+			continue
+		}
+		if silence := now.Sub(c.lastHeartbeat); silence > s.heartbeatTimeout {
+			c.missed = true
+			s.stats.MissedHeartbeats++
+			events = append(events, Event{Kind: EventHeartbeatMissed, ChannelID: id, Time: now, Silence: silence})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ChannelID < events[j].ChannelID })
+	return events
+}
+
+// SwapStats returns the counters and resets them, but the last cycle
+func (s *Session) SwapStats() SessionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	s.stats = SessionStats{LastCycle: stats.LastCycle}
+	return stats
+}
@@ -0,0 +1,204 @@
+package optiq
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clock is the fake local time of the session tests
+type clock struct{ now time.Time }
+
+func (c *clock) advance(d time.Duration) time.Time {
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+func header(channelID uint16, flags uint16, packetTime time.Time) *PacketHeader {
+	return &PacketHeader{PacketTime: uint64(packetTime.UnixNano()), Flags: flags, ChannelID: channelID}
+}
+
+func statusFrames(templateIDs ...uint16) []Frame {
+	frames := make([]Frame, 0, len(templateIDs))
+	for _, id := range templateIDs {
+		frames = append(frames, Frame{TemplateID: id})
+	}
+	return frames
+}
+
+func kinds(events []Event) []EventKind {
+	k := make([]EventKind, 0, len(events))
+	for _, e := range events {
+		k = append(k, e.Kind)
+	}
+	return k
+}
+
+func TestSessionSnapshotCycle(t *testing.T) {
+	s := NewSession(0)
+	c := &clock{now: time.Unix(1700000000, 0)}
+	start := c.now
+	if got := kinds(s.Packet(header(1, FlagStartOfSnapshot, c.now), nil, c.now)); !reflect.DeepEqual(got, []EventKind{EventSnapshotStart}) {
+		t.Fatalf("start events %v", got)
+	}
+	s.Packet(header(1, 0, c.advance(time.Second)), nil, c.now)
+	// the cycles of the channels are independent
+	s.Packet(header(2, FlagStartOfSnapshot, c.now), nil, c.now)
+	events := s.Packet(header(1, FlagEndOfSnapshot, c.advance(time.Second)), nil, c.now)
+	if len(events) != 1 || events[0].Kind != EventSnapshotEnd || events[0].ChannelID != 1 {
+		t.Fatalf("end events %+v", events)
+	}
+	want := Cycle{Start: start, End: c.now, Packets: 3}
+	if cycle := *events[0].Cycle; !cycle.Start.Equal(want.Start) || !cycle.End.Equal(want.End) || cycle.Packets != 3 || cycle.Gaps != 0 {
+		t.Fatalf("cycle %+v, want %+v", cycle, want)
+	}
+	if d := events[0].Cycle.Duration(); d != 2*time.Second {
+		t.Fatalf("cycle duration %v", d)
+	}
+	// an end without start is not a cycle
+	if events := s.Packet(header(1, FlagEndOfSnapshot, c.advance(time.Second)), nil, c.now); len(events) != 0 {
+		t.Fatalf("events of an end without start %+v", events)
+	}
+
+	stats := s.SwapStats()
+	if stats.Cycles != 1 || stats.IncompleteCycles != 0 || stats.LastCycle.Packets != 3 {
+		t.Fatalf("stats %+v", stats)
+	}
+	// the last cycle is kept across the swaps
+	if stats := s.SwapStats(); stats.Cycles != 0 || stats.LastCycle.Packets != 3 {
+		t.Fatalf("stats after a swap %+v", stats)
+	}
+}
+
+func TestSessionSnapshotIncomplete(t *testing.T) {
+	s := NewSession(0)
+	c := &clock{now: time.Unix(1700000000, 0)}
+
+	// restarted before its end
+	s.Packet(header(1, FlagStartOfSnapshot, c.now), nil, c.now)
+	s.Packet(header(1, 0, c.advance(time.Millisecond)), nil, c.now)
+	events := s.Packet(header(1, FlagStartOfSnapshot, c.advance(time.Millisecond)), nil, c.now)
+	if got := kinds(events); !reflect.DeepEqual(got, []EventKind{EventSnapshotIncomplete, EventSnapshotStart}) {
+		t.Fatalf("restart events %v", got)
+	}
+	if events[0].Cycle.Packets != 2 {
+		t.Fatalf("interrupted cycle %+v", events[0].Cycle)
+	}
+
+	// packets lost in the middle
+	s.Gap(1)
+	s.Gap(1)
+	events = s.Packet(header(1, FlagEndOfSnapshot, c.advance(time.Millisecond)), nil, c.now)
+	if len(events) != 1 || events[0].Kind != EventSnapshotIncomplete || events[0].Cycle.Gaps != 2 || events[0].Cycle.Packets != 2 {
+		t.Fatalf("end events of a cycle with gaps %+v", events)
+	}
+	// gaps out of a cycle are ignored
+	s.Gap(1)
+	s.Packet(header(1, FlagStartOfSnapshot|FlagEndOfSnapshot, c.advance(time.Millisecond)), nil, c.now)
+
+	stats := s.SwapStats()
+	if stats.Cycles != 1 || stats.IncompleteCycles != 2 || stats.LastCycle.Packets != 1 || stats.LastCycle.Gaps != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestSessionHeartbeats(t *testing.T) {
+	s := NewSession(3 * time.Second)
+	c := &clock{now: time.Unix(1700000000, 0)}
+	heartbeat := func(channelID uint16) []Event {
+		return s.Packet(header(channelID, FlagSessionStatus, c.now), statusFrames(TemplateHealthStatus), c.now)
+	}
+	heartbeat(1)
+	heartbeat(2)
+	// channels never seen sending a heartbeat are not checked
+	s.Packet(header(3, 0, c.now), nil, c.now)
+	// heartbeats without the session status flag are not looked for
+	s.Packet(header(2, 0, c.now), statusFrames(TemplateHealthStatus), c.now)
+
+	if events := s.CheckHeartbeats(c.advance(2 * time.Second)); len(events) != 0 {
+		t.Fatalf("events before the timeout %+v", events)
+	}
+	heartbeat(2)
+	events := s.CheckHeartbeats(c.advance(2 * time.Second))
+	if len(events) != 1 || events[0].Kind != EventHeartbeatMissed || events[0].ChannelID != 1 || events[0].Silence != 4*time.Second {
+		t.Fatalf("missed events %+v", events)
+	}
+	// reported once, and in the channel order
+	events = s.CheckHeartbeats(c.advance(2 * time.Second))
+	if len(events) != 1 || events[0].ChannelID != 2 {
+		t.Fatalf("second check events %+v", events)
+	}
+
+	// the stream resumes
+	events = heartbeat(1)
+	if len(events) != 1 || events[0].Kind != EventHeartbeatResumed || events[0].Silence != 6*time.Second || !events[0].Time.Equal(c.now) {
+		t.Fatalf("resumed events %+v", events)
+	}
+	if events := heartbeat(1); len(events) != 0 {
+		t.Fatalf("events of a regular heartbeat %+v", events)
+	}
+	if events := s.CheckHeartbeats(c.advance(time.Second)); len(events) != 0 {
+		t.Fatalf("events after the resume %+v", events)
+	}
+	// and stops again
+	if events := s.CheckHeartbeats(c.advance(3 * time.Second)); len(events) != 1 || events[0].ChannelID != 1 {
+		t.Fatalf("events of the second silence %+v", events)
+	}
+
+	stats := s.SwapStats()
+	if stats.Heartbeats != 5 || stats.MissedHeartbeats != 3 {
+		t.Fatalf("stats %+v", stats)
+	}
+	if events := NewSession(0).CheckHeartbeats(c.now); events != nil {
+		t.Fatalf("events with the alerts disabled %+v", events)
+	}
+}
+
+func TestSessionStartEndOfDay(t *testing.T) {
+	s := NewSession(3 * time.Second)
+	c := &clock{now: time.Unix(1700000000, 0)}
+	status := func(templateIDs ...uint16) []Event {
+		return s.Packet(header(1, FlagSessionStatus, c.now), statusFrames(templateIDs...), c.now)
+	}
+
+	events := status(TemplateStartOfDay, TemplateHealthStatus)
+	if got := kinds(events); !reflect.DeepEqual(got, []EventKind{EventStartOfDay}) || !events[0].Time.Equal(c.now) {
+		t.Fatalf("start of day events %+v", events)
+	}
+	events = status(TemplateEndOfDay)
+	if got := kinds(events); !reflect.DeepEqual(got, []EventKind{EventEndOfDay}) {
+		t.Fatalf("end of day events %v", got)
+	}
+	// no heartbeat is expected after the end of day
+	if events := s.CheckHeartbeats(c.advance(time.Hour)); len(events) != 0 {
+		t.Fatalf("heartbeat events after the end of day %+v", events)
+	}
+
+	// the next day starts again the checks
+	if got := kinds(status(TemplateStartOfDay)); !reflect.DeepEqual(got, []EventKind{EventStartOfDay}) {
+		t.Fatalf("next start of day events %v", got)
+	}
+	status(TemplateHealthStatus)
+	if events := s.CheckHeartbeats(c.advance(4 * time.Second)); len(events) != 1 || events[0].Kind != EventHeartbeatMissed {
+		t.Fatalf("heartbeat events of the next day %+v", events)
+	}
+}
+
+func TestEventString(t *testing.T) {
+	at := time.Unix(1700000000, 0).UTC()
+	tests := []struct {
+		e    Event
+		want string
+	}{
+		{Event{Kind: EventStartOfDay, ChannelID: 1, Time: at}, "Start of day on channel 1 at 2023-11-14T22:13:20Z"},
+		{Event{Kind: EventSnapshotEnd, ChannelID: 2, Cycle: &Cycle{Start: at, End: at.Add(1500 * time.Millisecond), Packets: 10}},
+			"Snapshot end on channel 2: 10 packets in 1.5s, 0 gaps"},
+		{Event{Kind: EventHeartbeatMissed, ChannelID: 3, Silence: 4200400 * time.Microsecond}, "Heartbeat missed on channel 3: 4.2s since the last one"},
+		{Event{Kind: EventKind(42), ChannelID: 4, Time: at}, "Event(42) on channel 4 at 2023-11-14T22:13:20Z"},
+	}
+	for _, tt := range tests {
+		if got := tt.e.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Magic numbers of the classic pcap file header, microsecond and nanosecond
+// resolution
+const (
+	magicMicros = 0xa1b2c3d4
+	magicNanos  = 0xa1b23c4d
+
+	fileHeaderSize   = 24
+	recordHeaderSize = 16
+)
+
+// Link types of the captured frames
+const (
+	LinkNull     = 0
+	LinkEthernet = 1
+	LinkRaw      = 101
+	LinkLinuxSLL = 113
+	LinkIPv4     = 228
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+	protocolUDP   = 17
+)
+
+// ErrNotPcap is returned for files which aren't classic pcap captures, e.g.
+// pcapng ones
+var ErrNotPcap = errors.New("pcap: not a classic pcap file")
+
+// Datagram is an UDP datagram of a capture
+type Datagram struct {
+	Time    time.Time
+	Src     *net.UDPAddr
+	Dst     *net.UDPAddr
+	Payload []byte
+}
+
+// Reader reads the UDP over IPv4 datagrams of a classic pcap capture, the
+// other frames are skipped. A Reader is not safe for concurrent use.
+type Reader struct {
+	r        *bufio.Reader
+	order    binary.ByteOrder
+	nanos    bool
+	linkType uint32
+	header   [recordHeaderSize]byte
+	frame    []byte
+}
+
+// NewReader returns a reader of the capture, after reading its file header
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{r: bufio.NewReaderSize(r, 1<<16)}
+	var h [fileHeaderSize]byte
+	if _, err := io.ReadFull(pr.r, h[:]); err != nil {
+		return nil, fmt.Errorf("pcap: reading the file header: %w", err)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(h[0:4]) == magicMicros:
+		pr.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(h[0:4]) == magicMicros:
+		pr.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(h[0:4]) == magicNanos:
+		pr.order, pr.nanos = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(h[0:4]) == magicNanos:
+		pr.order, pr.nanos = binary.BigEndian, true
+	default:
+		return nil, ErrNotPcap
+	}
+	pr.linkType = pr.order.Uint32(h[20:24]) & 0x0fffffff
+	switch pr.linkType {
+	case LinkNull, LinkEthernet, LinkRaw, LinkLinuxSLL, LinkIPv4:
+	default:
+		return nil, fmt.Errorf("pcap: unsupported link type %d", pr.linkType)
+	}
+	return pr, nil
+}
+
+// Next returns the next UDP datagram of the capture, io.EOF at its end.
+// The datagram is only valid until the next call.
+func (r *Reader) Next() (Datagram, error) {
+	for {
+		if _, err := io.ReadFull(r.r, r.header[:]); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return Datagram{}, fmt.Errorf("pcap: truncated record header: %w", err)
+			}
+			return Datagram{}, err
+		}
+		sec := r.order.Uint32(r.header[0:4])
+		frac := r.order.Uint32(r.header[4:8])
+		capLen := r.order.Uint32(r.header[8:12])
+		if capLen > 1<<18 {
+			return Datagram{}, fmt.Errorf("pcap: record of %d bytes", capLen)
+		}
+		if cap(r.frame) < int(capLen) {
+			r.frame = make([]byte, capLen)
+		}
+		r.frame = r.frame[:capLen]
+		if _, err := io.ReadFull(r.r, r.frame); err != nil {
+			return Datagram{}, fmt.Errorf("pcap: truncated record: %w", err)
+		}
+		if !r.nanos {
+			frac *= 1000
+		}
+		if d, ok := r.udp(r.frame); ok {
+			d.Time = time.Unix(int64(sec), int64(frac))
+			return d, nil
+		}
+	}
+}
+
+// udp extracts the UDP datagram of a captured frame
+func (r *Reader) udp(b []byte) (Datagram, bool) {
+	switch r.linkType {
+	case LinkNull:
+		if len(b) < 4 {
+			return Datagram{}, false
+		}
+		b = b[4:]
+	case LinkEthernet:
+		if len(b) < 14 {
+			return Datagram{}, false
+		}
+		etherType := binary.BigEndian.Uint16(b[12:14])
+		b = b[14:]
+		for (etherType == etherTypeVLAN || etherType == etherTypeQinQ) && len(b) >= 4 {
+			etherType = binary.BigEndian.Uint16(b[2:4])
+			b = b[4:]
+		}
+		if etherType != etherTypeIPv4 {
+			return Datagram{}, false
+		}
+	case LinkLinuxSLL:
+		if len(b) < 16 || binary.BigEndian.Uint16(b[14:16]) != etherTypeIPv4 {
+			return Datagram{}, false
+		}
+		b = b[16:]
+	}
+
+	// IPv4 header, not fragmented
+	if len(b) < 20 || b[0]>>4 != 4 || b[9] != protocolUDP {
+		return Datagram{}, false
+	}
+	ihl := int(b[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(b[2:4]))
+	if ihl < 20 || total < ihl+8 || total > len(b) || binary.BigEndian.Uint16(b[6:8])&0x3fff != 0 {
+		return Datagram{}, false
+	}
+	src, dst := net.IP(b[12:16]), net.IP(b[16:20])
+	u := b[ihl:total]
+	length := int(binary.BigEndian.Uint16(u[4:6]))
+	if length < 8 || length > len(u) {
+		return Datagram{}, false
+	}
+	return Datagram{
+		Src:     &net.UDPAddr{IP: src, Port: int(binary.BigEndian.Uint16(u[0:2]))},
+		Dst:     &net.UDPAddr{IP: dst, Port: int(binary.BigEndian.Uint16(u[2:4]))},
+		Payload: u[8:length],
+	}, true
+}
+
+// ReadFile calls f for every UDP datagram of the capture file
+func ReadFile(path string, f func(d *Datagram)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r, err := NewReader(file)
+	if err != nil {
+		return err
+	}
+	for {
+		d, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f(&d)
+	}
+}
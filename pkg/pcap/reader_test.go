@@ -0,0 +1,147 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fileHeader returns a pcap file header, version 2.4 and snaplen 65535
+func fileHeader(order binary.AppendByteOrder, magic uint32, linkType uint32) []byte {
+	b := order.AppendUint32(nil, magic)
+	b = order.AppendUint16(b, 2)
+	b = order.AppendUint16(b, 4)
+	b = append(b, make([]byte, 8)...)
+	b = order.AppendUint32(b, 65535)
+	return order.AppendUint32(b, linkType)
+}
+
+func record(order binary.AppendByteOrder, sec, frac uint32, frame []byte) []byte {
+	b := order.AppendUint32(nil, sec)
+	b = order.AppendUint32(b, frac)
+	b = order.AppendUint32(b, uint32(len(frame)))
+	b = order.AppendUint32(b, uint32(len(frame)))
+	return append(b, frame...)
+}
+
+// ipv4 returns an IPv4 packet of the protocol from 10.0.0.1 to 239.1.1.1
+// with the payload
+func ipv4(protocol byte, fragment uint16, payload []byte) []byte {
+	b := []byte{0x45, 0}
+	b = binary.BigEndian.AppendUint16(b, uint16(20+len(payload)))
+	b = append(b, 0, 0)
+	b = binary.BigEndian.AppendUint16(b, fragment)
+	b = append(b, 64, protocol, 0, 0, 10, 0, 0, 1, 239, 1, 1, 1)
+	return append(b, payload...)
+}
+
+func udp(payload string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, 5000)
+	b = binary.BigEndian.AppendUint16(b, 6000)
+	b = binary.BigEndian.AppendUint16(b, uint16(8+len(payload)))
+	b = append(b, 0, 0)
+	return append(b, payload...)
+}
+
+func ethernet(etherType uint16, vlan bool, payload []byte) []byte {
+	b := make([]byte, 12)
+	if vlan {
+		b = binary.BigEndian.AppendUint16(b, etherTypeVLAN)
+		b = append(b, 0, 100)
+	}
+	b = binary.BigEndian.AppendUint16(b, etherType)
+	return append(b, payload...)
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    binary.AppendByteOrder
+		magic    uint32
+		linkType uint32
+		frame    func(packet []byte) []byte
+	}{
+		{"ethernet", binary.LittleEndian, magicMicros, LinkEthernet, func(p []byte) []byte { return ethernet(etherTypeIPv4, false, p) }},
+		{"vlan", binary.LittleEndian, magicMicros, LinkEthernet, func(p []byte) []byte { return ethernet(etherTypeIPv4, true, p) }},
+		{"big endian nanos", binary.BigEndian, magicNanos, LinkRaw, func(p []byte) []byte { return p }},
+		{"null", binary.LittleEndian, magicNanos, LinkNull, func(p []byte) []byte { return append([]byte{2, 0, 0, 0}, p...) }},
+		{"linux sll", binary.BigEndian, magicMicros, LinkLinuxSLL, func(p []byte) []byte {
+			return append(append(make([]byte, 14), 0x08, 0x00), p...)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture := fileHeader(tt.order, tt.magic, tt.linkType)
+			// skipped: TCP, a fragment, then an ARP frame on ethernet
+			capture = append(capture, record(tt.order, 1, 0, tt.frame(ipv4(6, 0, udp("tcp"))))...)
+			capture = append(capture, record(tt.order, 1, 0, tt.frame(ipv4(protocolUDP, 0x2000, udp("frag"))))...)
+			if tt.linkType == LinkEthernet {
+				capture = append(capture, record(tt.order, 1, 0, ethernet(0x0806, false, make([]byte, 28)))...)
+			}
+			capture = append(capture, record(tt.order, 1700000000, 250, tt.frame(ipv4(protocolUDP, 0, udp("hello"))))...)
+
+			r, err := NewReader(bytes.NewReader(capture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := r.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			frac := time.Duration(250)
+			if tt.magic == magicMicros {
+				frac *= time.Microsecond
+			}
+			if string(d.Payload) != "hello" || !d.Time.Equal(time.Unix(1700000000, int64(frac))) ||
+				d.Src.String() != "10.0.0.1:5000" || d.Dst.String() != "239.1.1.1:6000" {
+				t.Fatalf("datagram %v %v -> %v %q", d.Time, d.Src, d.Dst, d.Payload)
+			}
+			if _, err := r.Next(); err != io.EOF {
+				t.Fatalf("Next() at the end = %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte{0x0a, 0x0d, 0x0d, 0x0a})); err == nil {
+		t.Error("no error for a short file header")
+	}
+	pcapng := append([]byte{0x0a, 0x0d, 0x0d, 0x0a}, make([]byte, 20)...)
+	if _, err := NewReader(bytes.NewReader(pcapng)); !errors.Is(err, ErrNotPcap) {
+		t.Errorf("NewReader of a pcapng file: %v", err)
+	}
+	if _, err := NewReader(bytes.NewReader(fileHeader(binary.LittleEndian, magicMicros, 105))); err == nil {
+		t.Error("no error for an unsupported link type")
+	}
+
+	capture := fileHeader(binary.LittleEndian, magicMicros, LinkRaw)
+	capture = append(capture, record(binary.LittleEndian, 1, 0, ipv4(protocolUDP, 0, udp("x")))...)
+	r, _ := NewReader(bytes.NewReader(capture[:len(capture)-3]))
+	if _, err := r.Next(); err == nil || err == io.EOF {
+		t.Errorf("Next() of a truncated record = %v", err)
+	}
+	r, _ = NewReader(bytes.NewReader(capture[:fileHeaderSize+5]))
+	if _, err := r.Next(); err == nil || err == io.EOF {
+		t.Errorf("Next() of a truncated record header = %v", err)
+	}
+}
+
+func TestReaderDatagramAddresses(t *testing.T) {
+	capture := fileHeader(binary.LittleEndian, magicMicros, LinkIPv4)
+	capture = append(capture, record(binary.LittleEndian, 1, 0, ipv4(protocolUDP, 0, udp("a")))...)
+	capture = append(capture, record(binary.LittleEndian, 1, 0, ipv4(protocolUDP, 0, udp("b")))...)
+	r, _ := NewReader(bytes.NewReader(capture))
+	d1, _ := r.Next()
+	if !d1.Dst.IP.Equal(net.IPv4(239, 1, 1, 1)) {
+		t.Fatalf("destination %v", d1.Dst)
+	}
+	d2, err := r.Next()
+	if err != nil || string(d2.Payload) != "b" {
+		t.Fatalf("second datagram %q, %v", d2.Payload, err)
+	}
+}
@@ -0,0 +1,52 @@
+package pitch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// HeaderSize is the size of the Sequenced Unit Header
+const HeaderSize = 8
+
+// ErrShortPacket is returned for datagrams smaller than the header
+var ErrShortPacket = errors.New("pitch: packet shorter than the sequenced unit header")
+
+// Header is the Sequenced Unit Header starting every datagram. Each unit
+// (e.g. a matching unit) has its own sequence, several units may share a
+// multicast group.
+type Header struct {
+	// Length is the size of the datagram, header included
+	Length uint16
+	Count  uint8
+	Unit   uint8
+	// Sequence is the sequence number of the first message, of the next one
+	// for heartbeats and 0 for the unsequenced packets
+	Sequence uint32
+}
+
+// Heartbeat returns true for the packets without messages
+func (h *Header) Heartbeat() bool { return h.Count == 0 }
+
+// Sequenced returns false for the unsequenced packets
+func (h *Header) Sequenced() bool { return h.Sequence != 0 }
+
+// NextSequence returns the sequence number expected after the packet
+func (h *Header) NextSequence() uint32 { return h.Sequence + uint32(h.Count) }
+
+// ParseHeader parses the header at the beginning of a datagram
+func ParseHeader(b []byte) (Header, error) {
+	if len(b) < HeaderSize {
+		return Header{}, ErrShortPacket
+	}
+	h := Header{
+		Length:   binary.LittleEndian.Uint16(b[0:2]),
+		Count:    b[2],
+		Unit:     b[3],
+		Sequence: binary.LittleEndian.Uint32(b[4:8]),
+	}
+	if int(h.Length) < HeaderSize || int(h.Length) > len(b) {
+		return h, fmt.Errorf("pitch: header length %d of a %d bytes datagram", h.Length, len(b))
+	}
+	return h, nil
+}
@@ -0,0 +1,210 @@
+package pitch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/fixed"
+	"strings"
+)
+
+// Message types of the Cboe binary PITCH messages
+const (
+	TypeTime         = 0x20
+	TypeEndOfSession = 0x2D
+	TypeUnitClear    = 0x97
+)
+
+var (
+	decoder    = fixed.Decoder{Order: binary.LittleEndian, Trim: " \x00", Offset: 2}
+	timeOffset = fixed.Uint("TimeOffset", 4)
+	orderID    = fixed.Uint("OrderID", 8)
+	side       = fixed.Alpha("SideIndicator", 1)
+	symbol     = fixed.Alpha("Symbol", 6)
+	executedID = fixed.Uint("ExecutionID", 8)
+)
+
+// layouts are the body layouts following the length and the type by
+// message type
+var layouts = map[byte]fixed.Layout{
+	TypeTime: {Name: "Time", Fields: []fixed.Spec{
+		fixed.Uint("Time", 4),
+	}},
+	0x21: {Name: "AddOrderLong", Fields: []fixed.Spec{
+		timeOffset, orderID, side,
+		fixed.Uint("Quantity", 4),
+		symbol,
+		fixed.Price("Price", 8, 4),
+		fixed.Alpha("AddFlags", 1),
+	}},
+	0x22: {Name: "AddOrderShort", Fields: []fixed.Spec{
+		timeOffset, orderID, side,
+		fixed.Uint("Quantity", 2),
+		symbol,
+		fixed.Price("Price", 2, 2),
+		fixed.Alpha("AddFlags", 1),
+	}},
+	0x2F: {Name: "AddOrderExpanded", Fields: []fixed.Spec{
+		timeOffset, orderID, side,
+		fixed.Uint("Quantity", 4),
+		fixed.Alpha("Symbol", 8),
+		fixed.Price("Price", 8, 4),
+		fixed.Alpha("AddFlags", 1),
+		fixed.Alpha("ParticipantID", 4),
+	}},
+	0x23: {Name: "OrderExecuted", Fields: []fixed.Spec{
+		timeOffset, orderID,
+		fixed.Uint("ExecutedQuantity", 4),
+		executedID,
+	}},
+	0x24: {Name: "OrderExecutedAtPriceSize", Fields: []fixed.Spec{
+		timeOffset, orderID,
+		fixed.Uint("ExecutedQuantity", 4),
+		fixed.Uint("RemainingQuantity", 4),
+		executedID,
+		fixed.Price("Price", 8, 4),
+	}},
+	0x25: {Name: "ReduceSizeLong", Fields: []fixed.Spec{
+		timeOffset, orderID,
+		fixed.Uint("CanceledQuantity", 4),
+	}},
+	0x26: {Name: "ReduceSizeShort", Fields: []fixed.Spec{
+		timeOffset, orderID,
+		fixed.Uint("CanceledQuantity", 2),
+	}},
+	0x27: {Name: "ModifyOrderLong", Fields: []fixed.Spec{
+		timeOffset, orderID,
+		fixed.Uint("Quantity", 4),
+		fixed.Price("Price", 8, 4),
+		fixed.Alpha("ModifyFlags", 1),
+	}},
+	0x28: {Name: "ModifyOrderShort", Fields: []fixed.Spec{
+		timeOffset, orderID,
+		fixed.Uint("Quantity", 2),
+		fixed.Price("Price", 2, 2),
+		fixed.Alpha("ModifyFlags", 1),
+	}},
+	0x29: {Name: "DeleteOrder", Fields: []fixed.Spec{
+		timeOffset, orderID,
+	}},
+	0x2A: {Name: "TradeLong", Fields: []fixed.Spec{
+		timeOffset, orderID, side,
+		fixed.Uint("Quantity", 4),
+		symbol,
+		fixed.Price("Price", 8, 4),
+		executedID,
+	}},
+	0x2B: {Name: "TradeShort", Fields: []fixed.Spec{
+		timeOffset, orderID, side,
+		fixed.Uint("Quantity", 2),
+		symbol,
+		fixed.Price("Price", 2, 2),
+		executedID,
+	}},
+	0x30: {Name: "TradeExpanded", Fields: []fixed.Spec{
+		timeOffset, orderID, side,
+		fixed.Uint("Quantity", 4),
+		fixed.Alpha("Symbol", 8),
+		fixed.Price("Price", 8, 4),
+		executedID,
+	}},
+	0x2C: {Name: "TradeBreak", Fields: []fixed.Spec{
+		timeOffset, executedID,
+	}},
+	TypeEndOfSession: {Name: "EndOfSession", Fields: []fixed.Spec{
+		timeOffset,
+	}},
+	0x31: {Name: "TradingStatus", Fields: []fixed.Spec{
+		timeOffset,
+		fixed.Alpha("Symbol", 8),
+		fixed.Alpha("HaltStatus", 1),
+		fixed.Alpha("RegSHOAction", 1),
+		fixed.Alpha("Reserved1", 1),
+		fixed.Alpha("Reserved2", 1),
+	}},
+	0x95: {Name: "AuctionUpdate", Fields: []fixed.Spec{
+		timeOffset,
+		fixed.Alpha("Symbol", 8),
+		fixed.Alpha("AuctionType", 1),
+		fixed.Price("ReferencePrice", 8, 4),
+		fixed.Uint("BuyShares", 4),
+		fixed.Uint("SellShares", 4),
+		fixed.Price("IndicativePrice", 8, 4),
+		fixed.Price("AuctionOnlyPrice", 8, 4),
+	}},
+	0x96: {Name: "AuctionSummary", Fields: []fixed.Spec{
+		timeOffset,
+		fixed.Alpha("Symbol", 8),
+		fixed.Alpha("AuctionType", 1),
+		fixed.Price("Price", 8, 4),
+		fixed.Uint("Shares", 4),
+	}},
+	TypeUnitClear: {Name: "UnitClear", Fields: []fixed.Spec{
+		timeOffset,
+	}},
+}
+
+// Field is a decoded message field. Value is uint64, a string for the alpha
+// fields or, for prices, a decimal string.
+type Field = fixed.Field
+
+// Message is a message of a sequenced unit packet
+type Message struct {
+	Type   byte
+	Name   string
+	Fields []Field
+	// Body is the raw message including its length and type
+	Body []byte
+}
+
+// Known returns false for message types without a known layout
+func (m *Message) Known() bool { return m.Name != "" }
+
+func (m *Message) String() string {
+	var sb strings.Builder
+	name := m.Name
+	if name == "" {
+		name = "Unknown"
+	}
+	fmt.Fprintf(&sb, "%s [type 0x%02X, length %d]", name, m.Type, len(m.Body))
+	for _, f := range m.Fields {
+		fmt.Fprintf(&sb, " %s=%v", f.Name, f.Value)
+	}
+	return sb.String()
+}
+
+// Messages splits the datagram following its header into its messages,
+// without decoding their fields. Each message starts with its length,
+// including the length field itself, and its type.
+func Messages(b []byte, h *Header) ([]Message, error) {
+	if len(b) < HeaderSize {
+		return nil, ErrShortPacket
+	}
+	msgs := make([]Message, 0, h.Count)
+	b = b[HeaderSize:h.Length]
+	for i := 0; i < int(h.Count); i++ {
+		if len(b) < 2 {
+			return msgs, fmt.Errorf("pitch: %d messages out of %d", i, h.Count)
+		}
+		size := int(b[0])
+		if size < 2 || size > len(b) {
+			return msgs, fmt.Errorf("pitch: invalid message length %d", size)
+		}
+		msgs = append(msgs, Message{Type: b[1], Body: b[:size]})
+		b = b[size:]
+	}
+	return msgs, nil
+}
+
+// Decode decodes the fields of the message
+func (m *Message) Decode() error {
+	l, ok := layouts[m.Type]
+	if !ok {
+		return nil
+	}
+	m.Name = l.Name
+	var err error
+	if m.Fields, err = decoder.Decode(m.Fields[:0], &l, m.Body); err != nil {
+		return fmt.Errorf("pitch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package pitch
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// packet returns a datagram of the unit with the messages, each one prefixed
+// by its length and type
+func packet(unit uint8, sequence uint32, msgs ...[]byte) []byte {
+	var body []byte
+	for _, m := range msgs {
+		body = append(body, byte(len(m)+1))
+		body = append(body, m...)
+	}
+	b := binary.LittleEndian.AppendUint16(nil, uint16(HeaderSize+len(body)))
+	b = append(b, uint8(len(msgs)), unit)
+	b = binary.LittleEndian.AppendUint32(b, sequence)
+	return append(b, body...)
+}
+
+func addOrderShort() []byte {
+	b := []byte{0x22}
+	b = binary.LittleEndian.AppendUint32(b, 1000)
+	b = binary.LittleEndian.AppendUint64(b, 0x1122334455)
+	b = append(b, 'B')
+	b = binary.LittleEndian.AppendUint16(b, 300)
+	b = append(b, "ABC   "...)
+	b = binary.LittleEndian.AppendUint16(b, 1234)
+	return append(b, 'X')
+}
+
+func TestPacket(t *testing.T) {
+	b := packet(3, 500, addOrderShort(), []byte{TypeUnitClear, 1, 0, 0, 0})
+	h, err := ParseHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(h.Length) != len(b) || h.Count != 2 || h.Unit != 3 || h.Sequence != 500 || h.NextSequence() != 502 ||
+		h.Heartbeat() || !h.Sequenced() {
+		t.Fatalf("header %+v", h)
+	}
+	msgs, err := Messages(b, &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Type != 0x22 || msgs[1].Type != TypeUnitClear {
+		t.Fatalf("messages %v", msgs)
+	}
+
+	m := msgs[0]
+	if err := m.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	want := []Field{
+		{Name: "TimeOffset", Value: uint64(1000)},
+		{Name: "OrderID", Value: uint64(0x1122334455)},
+		{Name: "SideIndicator", Value: "B"},
+		{Name: "Quantity", Value: uint64(300)},
+		{Name: "Symbol", Value: "ABC"},
+		{Name: "Price", Value: "12.34"},
+		{Name: "AddFlags", Value: "X"},
+	}
+	if !m.Known() || m.Name != "AddOrderShort" || len(m.Fields) != len(want) {
+		t.Fatalf("message %v", m.String())
+	}
+	for i, f := range want {
+		if m.Fields[i] != f {
+			t.Errorf("field %d = %v, want %v", i, m.Fields[i], f)
+		}
+	}
+	// decoding again doesn't append the fields twice
+	if m.Decode(); len(m.Fields) != len(want) {
+		t.Fatalf("%d fields after decoding twice", len(m.Fields))
+	}
+}
+
+func TestPacketErrors(t *testing.T) {
+	if _, err := ParseHeader(make([]byte, HeaderSize-1)); !errors.Is(err, ErrShortPacket) {
+		t.Fatalf("ParseHeader of a short packet: %v", err)
+	}
+	b := packet(1, 1, addOrderShort())
+	if _, err := ParseHeader(b[:len(b)-1]); err == nil {
+		t.Fatal("no error for a length beyond the datagram")
+	}
+
+	// the second message is missing
+	h := Header{Length: uint16(len(b)), Count: 2, Sequence: 1}
+	if msgs, err := Messages(b, &h); err == nil || len(msgs) != 1 {
+		t.Fatalf("Messages of a short packet = %v, %v", msgs, err)
+	}
+	// a message length beyond the packet
+	bad := packet(1, 1, []byte{TypeTime, 0, 0, 0, 0})
+	bad[HeaderSize] = 50
+	h, _ = ParseHeader(bad)
+	if msgs, err := Messages(bad, &h); err == nil || len(msgs) != 0 {
+		t.Fatalf("Messages with an invalid length = %v, %v", msgs, err)
+	}
+
+	m := Message{Type: 0x22, Body: append([]byte{20}, addOrderShort()[:19]...)}
+	if err := m.Decode(); err == nil || m.Name != "AddOrderShort" {
+		t.Fatalf("Decode of a truncated message: %v", err)
+	}
+	m = Message{Type: 0xF0, Body: []byte{2, 0xF0}}
+	if err := m.Decode(); err != nil || m.Known() {
+		t.Fatalf("Decode of an unknown type: %v", err)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	b := packet(2, 77)
+	h, err := ParseHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Heartbeat() || h.NextSequence() != 77 {
+		t.Fatalf("header %+v", h)
+	}
+	if msgs, err := Messages(b, &h); err != nil || len(msgs) != 0 {
+		t.Fatalf("Messages of a heartbeat = %v, %v", msgs, err)
+	}
+	if h := (Header{Count: 1}); h.Sequenced() {
+		t.Fatal("sequence 0 is sequenced")
+	}
+}
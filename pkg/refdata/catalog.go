@@ -0,0 +1,262 @@
+package refdata
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/util"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Product is a tradable product, identified by its market segment
+type Product struct {
+	MarketSegmentID int64             `json:"marketSegmentId"`
+	MarketSegment   string            `json:"marketSegment,omitempty"`
+	Attributes      map[string]string `json:"attributes,omitempty"`
+}
+
+// Instrument is a tradable instrument of a product
+type Instrument struct {
+	SecurityID      int64             `json:"securityId"`
+	MarketSegmentID int64             `json:"marketSegmentId,omitempty"`
+	Symbol          string            `json:"symbol,omitempty"`
+	SecurityDesc    string            `json:"securityDesc,omitempty"`
+	Attributes      map[string]string `json:"attributes,omitempty"`
+}
+
+// Name returns the best human readable name of the instrument
+func (i *Instrument) Name() string {
+	switch {
+	case i.SecurityDesc != "":
+		return i.SecurityDesc
+	case i.Symbol != "":
+		return i.Symbol
+	default:
+		return strconv.FormatInt(i.SecurityID, 10)
+	}
+}
+
+// Catalog is an in-memory instrument and product catalog keyed by SecurityID
+// and MarketSegmentID. A Catalog is safe for concurrent use.
+type Catalog struct {
+	mu          sync.RWMutex
+	products    map[int64]*Product
+	instruments map[int64]*Instrument
+}
+
+// NewCatalog returns an empty catalog
+func NewCatalog() *Catalog {
+	return &Catalog{
+		products:    make(map[int64]*Product),
+		instruments: make(map[int64]*Instrument),
+	}
+}
+
+// Len returns the number of products and instruments of the catalog
+func (c *Catalog) Len() (products int, instruments int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.products), len(c.instruments)
+}
+
+// Instrument returns a copy of the instrument with the SecurityID
+func (c *Catalog) Instrument(securityID int64) (Instrument, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i, ok := c.instruments[securityID]
+	if !ok {
+		return Instrument{}, false
+	}
+	return *i, true
+}
+
+// Product returns a copy of the product with the MarketSegmentID
+func (c *Catalog) Product(marketSegmentID int64) (Product, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	p, ok := c.products[marketSegmentID]
+	if !ok {
+		return Product{}, false
+	}
+	return *p, true
+}
+
+// Describe returns the name of the instrument with the SecurityID, prefixed
+// by its product, or an empty string for unknown instruments
+func (c *Catalog) Describe(securityID int64) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i, ok := c.instruments[securityID]
+	if !ok {
+		return ""
+	}
+	name := i.Name()
+	if p, ok := c.products[i.MarketSegmentID]; ok && p.MarketSegment != "" && !strings.HasPrefix(name, p.MarketSegment) {
+		name = p.MarketSegment + " " + name
+	}
+	return name
+}
+
+// UpsertProduct adds or updates a product, the attributes are merged
+func (c *Catalog) UpsertProduct(p Product) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old, ok := c.products[p.MarketSegmentID]
+	if !ok {
+		c.products[p.MarketSegmentID] = &p
+		return
+	}
+	if p.MarketSegment != "" {
+		old.MarketSegment = p.MarketSegment
+	}
+	old.Attributes = merge(old.Attributes, p.Attributes)
+}
+
+// UpsertInstrument adds or updates an instrument, the attributes are merged
+func (c *Catalog) UpsertInstrument(i Instrument) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old, ok := c.instruments[i.SecurityID]
+	if !ok {
+		c.instruments[i.SecurityID] = &i
+		return
+	}
+	if i.MarketSegmentID != 0 {
+		old.MarketSegmentID = i.MarketSegmentID
+	}
+	if i.Symbol != "" {
+		old.Symbol = i.Symbol
+	}
+	if i.SecurityDesc != "" {
+		old.SecurityDesc = i.SecurityDesc
+	}
+	old.Attributes = merge(old.Attributes, i.Attributes)
+}
+
+// DeleteInstrument removes an instrument
+func (c *Catalog) DeleteInstrument(securityID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.instruments, securityID)
+}
+
+func merge(dst, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// catalogFile is the JSON representation of a catalog
+type catalogFile struct {
+	Products    []*Product    `json:"products"`
+	Instruments []*Instrument `json:"instruments"`
+}
+
+func (c *Catalog) sorted() catalogFile {
+	var f catalogFile
+	for _, p := range c.products {
+		f.Products = append(f.Products, p)
+	}
+	for _, i := range c.instruments {
+		f.Instruments = append(f.Instruments, i)
+	}
+	sort.Slice(f.Products, func(a, b int) bool { return f.Products[a].MarketSegmentID < f.Products[b].MarketSegmentID })
+	sort.Slice(f.Instruments, func(a, b int) bool { return f.Instruments[a].SecurityID < f.Instruments[b].SecurityID })
+	return f
+}
+
+// WriteJSON writes the catalog as JSON
+func (c *Catalog) WriteJSON(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c.sorted())
+}
+
+// WriteCSV writes the instruments of the catalog as CSV, one column per
+// attribute found in any instrument
+func (c *Catalog) WriteCSV(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	f := c.sorted()
+
+	attrSet := make(map[string]bool)
+	for _, i := range f.Instruments {
+		for k := range i.Attributes {
+			attrSet[k] = true
+		}
+	}
+	attrs := make([]string, 0, len(attrSet))
+	for k := range attrSet {
+		attrs = append(attrs, k)
+	}
+	sort.Strings(attrs)
+
+	cw := csv.NewWriter(w)
+	header := append([]string{"SecurityID", "MarketSegmentID", "MarketSegment", "Symbol", "SecurityDesc"}, attrs...)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, i := range f.Instruments {
+		segment := ""
+		if p, ok := c.products[i.MarketSegmentID]; ok {
+			segment = p.MarketSegment
+		}
+		record := []string{strconv.FormatInt(i.SecurityID, 10), strconv.FormatInt(i.MarketSegmentID, 10), segment, i.Symbol, i.SecurityDesc}
+		for _, k := range attrs {
+			record = append(record, i.Attributes[k])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Export writes the catalog to a file, as CSV when its extension is .csv and
+// JSON otherwise. The file is replaced atomically.
+func (c *Catalog) Export(path string) error {
+	write := c.WriteJSON
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		write = c.WriteCSV
+	}
+	if err := util.WriteFileAtomic(path, write); err != nil {
+		return fmt.Errorf("failed to export catalog: %w", err)
+	}
+	return nil
+}
+
+// LoadFile loads a catalog exported as JSON
+func LoadFile(path string) (*Catalog, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f catalogFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("failed to load catalog %s: %w", path, err)
+	}
+	c := NewCatalog()
+	for _, p := range f.Products {
+		c.products[p.MarketSegmentID] = p
+	}
+	for _, i := range f.Instruments {
+		c.instruments[i.SecurityID] = i
+	}
+	return c, nil
+}
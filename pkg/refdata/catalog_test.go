@@ -0,0 +1,92 @@
+package refdata
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testCatalog() *Catalog {
+	c := NewCatalog()
+	c.UpsertProduct(Product{MarketSegmentID: 5, MarketSegment: "FDAX", Attributes: map[string]string{"Currency": "EUR"}})
+	c.UpsertInstrument(Instrument{SecurityID: 101, MarketSegmentID: 5, Symbol: "FDAX H7", SecurityDesc: `DAX "Mar", 2027`,
+		Attributes: map[string]string{"ContractMultiplier": "25"}})
+	c.UpsertInstrument(Instrument{SecurityID: 100, MarketSegmentID: 5, Symbol: "FDAX Z6",
+		Attributes: map[string]string{"CFICode": "FFICSX"}})
+	c.UpsertInstrument(Instrument{SecurityID: 300, MarketSegmentID: 9, SecurityDesc: "line\nbreak"})
+	return c
+}
+
+func TestCatalogExportLoad(t *testing.T) {
+	c := testCatalog()
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := c.Export(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.sorted(), c.sorted()) {
+		t.Fatalf("loaded catalog %+v, want %+v", loaded.sorted(), c.sorted())
+	}
+	var want, got bytes.Buffer
+	_ = c.WriteJSON(&want)
+	_ = loaded.WriteJSON(&got)
+	if got.String() != want.String() {
+		t.Fatalf("loaded catalog JSON\n%s\nwant\n%s", got.String(), want.String())
+	}
+
+	// exported again over the previous file
+	c.DeleteInstrument(300)
+	if err := c.Export(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if products, instruments := loaded.Len(); products != 1 || instruments != 2 {
+		t.Fatalf("%d products, %d instruments after the second export", products, instruments)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil {
+		t.Fatal("no error loading an invalid catalog")
+	}
+}
+
+const wantCSV = `SecurityID,MarketSegmentID,MarketSegment,Symbol,SecurityDesc,CFICode,ContractMultiplier
+100,5,FDAX,FDAX Z6,,FFICSX,
+101,5,FDAX,FDAX H7,"DAX ""Mar"", 2027",,25
+300,9,,,"line
+break",,
+`
+
+func TestCatalogWriteCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := testCatalog().WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != wantCSV {
+		t.Fatalf("CSV\n%s\nwant\n%s", b.String(), wantCSV)
+	}
+
+	// the extension selects the format of the export
+	path := filepath.Join(t.TempDir(), "catalog.CSV")
+	if err := testCatalog().Export(path); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != wantCSV {
+		t.Fatalf("exported CSV\n%s", got)
+	}
+}
+
+func TestCatalogExportError(t *testing.T) {
+	if err := testCatalog().Export(filepath.Join(t.TempDir(), "missing", "catalog.json")); err == nil {
+		t.Fatal("no error exporting to a missing directory")
+	}
+}
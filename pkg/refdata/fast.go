@@ -0,0 +1,83 @@
+package refdata
+
+import (
+	"fmt"
+	"github.com/coalescent-labs/mcastmkt/pkg/fast"
+)
+
+// MDUpdateAction values of the incremental reference data messages
+const (
+	updateActionDelete = 2
+)
+
+// ApplyFast updates the catalog with a FAST decoded reference data message
+// (e.g. Eurex RDI ProductSnapshot, InstrumentSnapshot, InstrumentIncremental).
+// Every group or sequence element carrying a SecurityID is an instrument and
+// every one carrying a MarketSegmentID without SecurityID is a product; the
+// MarketSegmentID is inherited from the enclosing groups. It returns the
+// number of products and instruments updated.
+func (c *Catalog) ApplyFast(m *fast.Message) (products int, instruments int) {
+	return c.applyGroup(m.Fields, 0)
+}
+
+func (c *Catalog) applyGroup(g fast.Group, marketSegmentID int64) (products int, instruments int) {
+	if id, ok := g.Int("MarketSegmentID"); ok {
+		marketSegmentID = id
+	}
+
+	if securityID, ok := g.Int("SecurityID"); ok {
+		if action, ok := g.Uint("MDUpdateAction"); ok && action == updateActionDelete {
+			c.DeleteInstrument(securityID)
+		} else {
+			i := Instrument{SecurityID: securityID, MarketSegmentID: marketSegmentID, Attributes: attributes(g)}
+			i.Symbol, _ = g.String("Symbol")
+			i.SecurityDesc, _ = g.String("SecurityDesc")
+			c.UpsertInstrument(i)
+		}
+		instruments++
+	} else if marketSegmentID != 0 {
+		if _, ok := g.Get("MarketSegmentID"); ok {
+			p := Product{MarketSegmentID: marketSegmentID, Attributes: attributes(g)}
+			p.MarketSegment, _ = g.String("MarketSegment")
+			c.UpsertProduct(p)
+			products++
+		}
+	}
+
+	for _, v := range g {
+		switch val := v.Value.(type) {
+		case fast.Group:
+			p, i := c.applyGroup(val, marketSegmentID)
+			products, instruments = products+p, instruments+i
+		case []fast.Group:
+			for _, e := range val {
+				p, i := c.applyGroup(e, marketSegmentID)
+				products, instruments = products+p, instruments+i
+			}
+		case *fast.Message:
+			p, i := c.applyGroup(val.Fields, marketSegmentID)
+			products, instruments = products+p, instruments+i
+		}
+	}
+	return products, instruments
+}
+
+// attributes returns the scalar fields of the group as strings
+func attributes(g fast.Group) map[string]string {
+	attrs := make(map[string]string)
+	for _, v := range g {
+		switch v.Name {
+		case "SecurityID", "MarketSegmentID", "Symbol", "SecurityDesc", "MarketSegment", "MsgSeqNum", "MsgType", "MDUpdateAction":
+			continue
+		}
+		switch val := v.Value.(type) {
+		case fast.Group, []fast.Group, *fast.Message:
+			continue
+		case []byte:
+			attrs[v.Name] = string(val)
+		default:
+			attrs[v.Name] = fmt.Sprint(val)
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,130 @@
+package refdata
+
+import (
+	"github.com/coalescent-labs/mcastmkt/pkg/fast"
+	"reflect"
+	"testing"
+)
+
+func productSnapshot(segmentID int64, segment string) *fast.Message {
+	return &fast.Message{Name: "ProductSnapshot", Fields: fast.Group{
+		{Name: "MsgType", Value: "BU"},
+		{Name: "MsgSeqNum", Value: uint64(1)},
+		{Name: "MarketSegmentID", Value: segmentID},
+		{Name: "MarketSegment", Value: segment},
+		{Name: "Currency", Value: "EUR"},
+	}}
+}
+
+func instrumentSnapshot(securityID, segmentID int64, symbol string) *fast.Message {
+	return &fast.Message{Name: "InstrumentSnapshot", Fields: fast.Group{
+		{Name: "MsgType", Value: "d"},
+		{Name: "SecurityID", Value: securityID},
+		{Name: "MarketSegmentID", Value: segmentID},
+		{Name: "Symbol", Value: symbol},
+		{Name: "ContractMultiplier", Value: fast.Decimal{Mantissa: 25, Exponent: 0}},
+		{Name: "CFICode", Value: []byte("FFICSX")},
+		{Name: "Events", Value: []fast.Group{{{Name: "EventDate", Value: uint64(20261218)}}}},
+	}}
+}
+
+func instrumentIncremental(securityID int64, action uint64, desc string) *fast.Message {
+	return &fast.Message{Name: "InstrumentIncremental", Fields: fast.Group{
+		{Name: "MsgType", Value: "X"},
+		{Name: "Entries", Value: []fast.Group{{
+			{Name: "MDUpdateAction", Value: action},
+			{Name: "SecurityID", Value: securityID},
+			{Name: "SecurityDesc", Value: desc},
+		}}},
+	}}
+}
+
+func TestApplyFast(t *testing.T) {
+	tests := []struct {
+		name                  string
+		messages              []*fast.Message
+		products, instruments int
+		want                  map[int64]Instrument
+	}{
+		{
+			name:     "product",
+			messages: []*fast.Message{productSnapshot(5, "FDAX")},
+			products: 1,
+			want:     map[int64]Instrument{},
+		},
+		{
+			name:        "instrument snapshot",
+			messages:    []*fast.Message{instrumentSnapshot(100, 5, "FDAX Z6")},
+			instruments: 1,
+			want: map[int64]Instrument{100: {SecurityID: 100, MarketSegmentID: 5, Symbol: "FDAX Z6",
+				Attributes: map[string]string{"ContractMultiplier": "25", "CFICode": "FFICSX"}}},
+		},
+		{
+			name: "instruments inherit the segment",
+			messages: []*fast.Message{{Name: "ProductSnapshot", Fields: fast.Group{
+				{Name: "MarketSegmentID", Value: int64(7)},
+				{Name: "Instruments", Value: []fast.Group{
+					{{Name: "SecurityID", Value: int64(200)}},
+					{{Name: "SecurityID", Value: uint64(201)}, {Name: "MarketSegmentID", Value: int64(8)}},
+				}},
+			}}},
+			products:    1,
+			instruments: 2,
+			want: map[int64]Instrument{
+				200: {SecurityID: 200, MarketSegmentID: 7, Attributes: map[string]string{}},
+				201: {SecurityID: 201, MarketSegmentID: 8, Attributes: map[string]string{}},
+			},
+		},
+		{
+			name:        "incremental update merges",
+			messages:    []*fast.Message{instrumentSnapshot(100, 5, "FDAX Z6"), instrumentIncremental(100, 1, "DAX Dec 26")},
+			instruments: 2,
+			want: map[int64]Instrument{100: {SecurityID: 100, MarketSegmentID: 5, Symbol: "FDAX Z6", SecurityDesc: "DAX Dec 26",
+				Attributes: map[string]string{"ContractMultiplier": "25", "CFICode": "FFICSX"}}},
+		},
+		{
+			name:        "incremental delete",
+			messages:    []*fast.Message{instrumentSnapshot(100, 5, "FDAX Z6"), instrumentSnapshot(101, 5, "FDAX H7"), instrumentIncremental(100, 2, "")},
+			instruments: 3,
+			want: map[int64]Instrument{101: {SecurityID: 101, MarketSegmentID: 5, Symbol: "FDAX H7",
+				Attributes: map[string]string{"ContractMultiplier": "25", "CFICode": "FFICSX"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCatalog()
+			var products, instruments int
+			for _, m := range tt.messages {
+				p, i := c.ApplyFast(m)
+				products, instruments = products+p, instruments+i
+			}
+			if products != tt.products || instruments != tt.instruments {
+				t.Fatalf("ApplyFast updated %d products, %d instruments, want %d, %d", products, instruments, tt.products, tt.instruments)
+			}
+			if _, n := c.Len(); n != len(tt.want) {
+				t.Fatalf("%d instruments, want %d", n, len(tt.want))
+			}
+			for id, want := range tt.want {
+				if got, ok := c.Instrument(id); !ok || !reflect.DeepEqual(got, want) {
+					t.Errorf("Instrument(%d) = %+v, want %+v", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyFastProduct(t *testing.T) {
+	c := NewCatalog()
+	c.ApplyFast(productSnapshot(5, "FDAX"))
+	c.ApplyFast(instrumentSnapshot(100, 5, "Z6"))
+	p, ok := c.Product(5)
+	if !ok || p.MarketSegment != "FDAX" || !reflect.DeepEqual(p.Attributes, map[string]string{"Currency": "EUR"}) {
+		t.Fatalf("Product(5) = %+v, %v", p, ok)
+	}
+	if got := c.Describe(100); got != "FDAX Z6" {
+		t.Fatalf("Describe(100) = %q, want FDAX Z6", got)
+	}
+	if got := c.Describe(1); got != "" {
+		t.Fatalf("Describe of an unknown instrument = %q", got)
+	}
+}
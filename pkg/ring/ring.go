@@ -0,0 +1,98 @@
+package ring
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Slot is a preallocated entry of the ring holding a copy of a datagram.
+type Slot struct {
+	Data    []byte
+	Src     net.Addr
+	Dst     net.IP
+	IfIndex int
+	Time    time.Time
+}
+
+// Ring is a lock-free single producer / single consumer ring buffer of
+// datagrams. All the slots are allocated once by New so that the producer
+// never allocates nor blocks: when the ring is full the datagram is dropped
+// and counted.
+type Ring struct {
+	slots []Slot
+	mask  uint64
+
+	// head is the next slot written by the producer, tail the next slot read
+	// by the consumer. They are on separate cache lines to avoid false sharing.
+	_    [56]byte
+	head uint64
+	_    [56]byte
+	tail uint64
+	_    [56]byte
+	full uint64
+}
+
+// New returns a ring of at least size slots (rounded up to a power of two)
+// each able to hold slotSize bytes.
+func New(size int, slotSize int) *Ring {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	r := &Ring{
+		slots: make([]Slot, n),
+		mask:  uint64(n - 1),
+	}
+	for i := range r.slots {
+		r.slots[i].Data = make([]byte, 0, slotSize)
+	}
+	return r
+}
+
+// Put copies a datagram in the next free slot. It returns false, and counts
+// the datagram as dropped, when the ring is full. Only the producer can call it.
+func (r *Ring) Put(data []byte, src net.Addr, dst net.IP, ifIndex int, t time.Time) bool {
+	head := r.head
+	if head-atomic.LoadUint64(&r.tail) > r.mask {
+		atomic.AddUint64(&r.full, 1)
+		return false
+	}
+	s := &r.slots[head&r.mask]
+	s.Data = append(s.Data[:0], data...)
+	s.Src = src
+	s.Dst = append(s.Dst[:0], dst...)
+	s.IfIndex = ifIndex
+	s.Time = t
+	atomic.StoreUint64(&r.head, head+1)
+	return true
+}
+
+// Peek returns the oldest datagram of the ring or nil when it's empty.
+// The slot is owned by the consumer until Release. Only the consumer can call it.
+func (r *Ring) Peek() *Slot {
+	tail := r.tail
+	if tail == atomic.LoadUint64(&r.head) {
+		return nil
+	}
+	return &r.slots[tail&r.mask]
+}
+
+// Release gives back to the producer the slot returned by Peek.
+func (r *Ring) Release() {
+	atomic.StoreUint64(&r.tail, r.tail+1)
+}
+
+// Len returns the number of datagrams waiting in the ring.
+func (r *Ring) Len() int {
+	return int(atomic.LoadUint64(&r.head) - atomic.LoadUint64(&r.tail))
+}
+
+// Cap returns the number of slots of the ring.
+func (r *Ring) Cap() int { return len(r.slots) }
+
+// SwapFull returns the number of datagrams dropped because the ring was full
+// since the previous call and resets it.
+func (r *Ring) SwapFull() uint64 {
+	return atomic.SwapUint64(&r.full, 0)
+}
@@ -0,0 +1,98 @@
+package ring
+
+import (
+	"bytes"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRingPutPeek(t *testing.T) {
+	r := New(3, 16)
+	if r.Cap() != 4 {
+		t.Fatalf("Cap() = %d, want 4", r.Cap())
+	}
+	if r.Peek() != nil {
+		t.Fatal("Peek() of an empty ring is not nil")
+	}
+	src := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}
+	dst := net.IPv4(239, 1, 1, 1)
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 4; i++ {
+		if !r.Put([]byte{byte(i), 1, 2}, src, dst, 7, now.Add(time.Duration(i))) {
+			t.Fatalf("Put %d failed on a ring with free slots", i)
+		}
+	}
+	if r.Put([]byte{9}, src, dst, 7, now) || r.Put([]byte{9}, src, dst, 7, now) {
+		t.Fatal("Put succeeded on a full ring")
+	}
+	if full := r.SwapFull(); full != 2 {
+		t.Fatalf("SwapFull() = %d, want 2", full)
+	}
+	if full := r.SwapFull(); full != 0 {
+		t.Fatalf("SwapFull() after a swap = %d, want 0", full)
+	}
+	if r.Len() != 4 {
+		t.Fatalf("Len() = %d, want 4", r.Len())
+	}
+	for i := 0; i < 4; i++ {
+		s := r.Peek()
+		if s == nil {
+			t.Fatalf("Peek() %d is nil", i)
+		}
+		if !bytes.Equal(s.Data, []byte{byte(i), 1, 2}) || s.Src != src || !s.Dst.Equal(dst) || s.IfIndex != 7 ||
+			!s.Time.Equal(now.Add(time.Duration(i))) {
+			t.Fatalf("slot %d = %+v", i, s)
+		}
+		r.Release()
+	}
+	if r.Peek() != nil || r.Len() != 0 {
+		t.Fatal("ring not empty after releasing all the slots")
+	}
+}
+
+func TestRingReusesSlots(t *testing.T) {
+	r := New(2, 8)
+	dst := net.IPv4(239, 1, 1, 1)
+	for i := 0; i < 10; i++ {
+		data := bytes.Repeat([]byte{byte(i)}, i%3+1)
+		if !r.Put(data, nil, dst, 0, time.Time{}) {
+			t.Fatalf("Put %d failed", i)
+		}
+		s := r.Peek()
+		if !bytes.Equal(s.Data, data) {
+			t.Fatalf("slot %d = %v, want %v", i, s.Data, data)
+		}
+		r.Release()
+	}
+}
+
+func TestRingConcurrent(t *testing.T) {
+	const n = 10000
+	r := New(64, 8)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; {
+			if r.Put([]byte{byte(i), byte(i >> 8), byte(i >> 16)}, nil, nil, 0, time.Time{}) {
+				i++
+			} else {
+				runtime.Gosched()
+			}
+		}
+	}()
+	for i := 0; i < n; {
+		s := r.Peek()
+		if s == nil {
+			runtime.Gosched()
+			continue
+		}
+		if got := int(s.Data[0]) | int(s.Data[1])<<8 | int(s.Data[2])<<16; got != i {
+			t.Fatalf("datagram %d read as %d", i, got)
+		}
+		r.Release()
+		i++
+	}
+	<-done
+}
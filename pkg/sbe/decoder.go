@@ -0,0 +1,332 @@
+package sbe
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrShortBuffer is returned when a message is truncated
+var ErrShortBuffer = errors.New("sbe: message truncated")
+
+// Header is a decoded message header
+type Header struct {
+	BlockLength uint16
+	TemplateID  uint16
+	SchemaID    uint16
+	Version     uint16
+}
+
+// HeaderSize returns the encoded size of the message header
+func (s *Schema) HeaderSize() int { return s.Header.Size() }
+
+// DecodeHeader decodes the message header at the beginning of b
+func (s *Schema) DecodeHeader(b []byte) (Header, error) {
+	if len(b) < s.HeaderSize() {
+		return Header{}, ErrShortBuffer
+	}
+	var h Header
+	offset := 0
+	for _, m := range s.Header.Members {
+		if m.Offset >= 0 {
+			offset = m.Offset
+		}
+		size := m.Size()
+		v := s.uint(b[offset : offset+size])
+		switch normalize(m.Name) {
+		case "blocklength":
+			h.BlockLength = uint16(v)
+		case "templateid":
+			h.TemplateID = uint16(v)
+		case "schemaid":
+			h.SchemaID = uint16(v)
+		case "version":
+			h.Version = uint16(v)
+		}
+		offset += size
+	}
+	if h.SchemaID == 0 {
+		h.SchemaID = s.ID
+	}
+	return h, nil
+}
+
+// Decode decodes the message (header included) at the beginning of b and
+// returns it with the number of bytes consumed.
+func (s *Schema) Decode(b []byte) (*Message, int, error) {
+	h, err := s.DecodeHeader(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	def := s.messages[h.TemplateID]
+	if def == nil {
+		return nil, 0, fmt.Errorf("sbe: unknown template id %d", h.TemplateID)
+	}
+	m := &Message{TemplateID: h.TemplateID, SchemaID: h.SchemaID, Version: h.Version, Name: def.Name}
+	d := &decoder{schema: s, buf: b, pos: s.HeaderSize(), version: h.Version}
+	m.Fields, err = d.block(&def.Block, int(h.BlockLength))
+	if err != nil {
+		return m, d.pos, fmt.Errorf("%s: %w", def.Name, err)
+	}
+	return m, d.pos, nil
+}
+
+type decoder struct {
+	schema  *Schema
+	buf     []byte
+	pos     int
+	version uint16
+}
+
+// block decodes the fixed fields, the repeating groups and the var data of
+// a message or group entry. The blockLength of the wire is used to skip
+// fields added in newer versions of the schema.
+func (d *decoder) block(b *Block, blockLength int) (Group, error) {
+	if d.pos+blockLength > len(d.buf) {
+		return nil, ErrShortBuffer
+	}
+	root := d.buf[d.pos : d.pos+blockLength]
+	g := make(Group, 0, len(b.Fields)+len(b.Groups))
+	for _, f := range b.Fields {
+		if f.SinceVersion > d.version {
+			continue
+		}
+		if f.Presence == PresenceConstant {
+			g = append(g, Value{Name: f.Name, Value: d.constant(f)})
+			continue
+		}
+		size := f.Type.Size()
+		if f.Offset+size > len(root) {
+			// field of a newer version than the sender one
+			continue
+		}
+		g = append(g, Value{Name: f.Name, Value: d.value(f.Type, f.Presence, root[f.Offset:f.Offset+size])})
+	}
+	d.pos += blockLength
+
+	for _, gr := range b.Groups {
+		if gr.SinceVersion > d.version {
+			continue
+		}
+		entries, err := d.group(gr)
+		if err != nil {
+			return g, fmt.Errorf("%s: %w", gr.Name, err)
+		}
+		g = append(g, Value{Name: gr.Name, Value: entries})
+	}
+
+	for _, f := range b.Data {
+		if f.SinceVersion > d.version {
+			continue
+		}
+		v, err := d.data(f.Type)
+		if err != nil {
+			return g, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		g = append(g, Value{Name: f.Name, Value: v})
+	}
+	return g, nil
+}
+
+// data decodes a var data field: its length followed by the bytes. The
+// value is a string for the text encodings, []byte otherwise.
+func (d *decoder) data(t *Type) (any, error) {
+	length := t.Member("length")
+	varData := t.Member("varData")
+	if length == nil || varData == nil {
+		return nil, fmt.Errorf("invalid var data type %s", t.Name)
+	}
+	offset := max(length.Offset, 0)
+	size := length.Size()
+	if d.pos+offset+size > len(d.buf) {
+		return nil, ErrShortBuffer
+	}
+	n := int(d.schema.uint(d.buf[d.pos+offset : d.pos+offset+size]))
+	start := d.pos + max(varData.Offset, offset+size)
+	if n < 0 || start+n > len(d.buf) {
+		return nil, fmt.Errorf("invalid var data length %d", n)
+	}
+	b := d.buf[start : start+n]
+	d.pos = start + n
+	if varData.CharacterEncoding != "" || t.CharacterEncoding != "" || varData.Primitive == "char" {
+		return string(b), nil
+	}
+	return b, nil
+}
+
+func (d *decoder) group(gr *GroupDef) ([]Group, error) {
+	dimSize := gr.Dimension.Size()
+	if d.pos+dimSize > len(d.buf) {
+		return nil, ErrShortBuffer
+	}
+	dim := d.value(gr.Dimension, PresenceRequired, d.buf[d.pos:d.pos+dimSize]).(Group)
+	d.pos += dimSize
+	blockLength, ok := dim.Int(gr.Dimension.Member("blockLength").Name)
+	if !ok {
+		blockLength = int64(gr.BlockLength)
+	}
+	numInGroup, _ := dim.Int(gr.Dimension.Member("numInGroup").Name)
+	// entries without fixed fields count as a byte, so that a corrupted
+	// numInGroup can't allocate more entries than the remaining bytes
+	if numInGroup < 0 || blockLength < 0 || numInGroup > int64((len(d.buf)-d.pos)/max(int(blockLength), 1)) {
+		return nil, fmt.Errorf("invalid dimension %d x %d", numInGroup, blockLength)
+	}
+	entries := make([]Group, 0, numInGroup)
+	for i := 0; i < int(numInGroup); i++ {
+		e, err := d.block(&gr.Block, int(blockLength))
+		if err != nil {
+			return entries, fmt.Errorf("[%d]: %w", i, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// value decodes b as a value of the type, nil for optional null values
+func (d *decoder) value(t *Type, presence string, b []byte) any {
+	switch t.Kind {
+	case KindComposite:
+		g := make(Group, 0, len(t.Members))
+		offset := 0
+		for _, m := range t.Members {
+			if m.Presence == PresenceConstant {
+				g = append(g, Value{Name: m.Name, Value: m.ConstValue})
+				continue
+			}
+			if m.Offset >= 0 {
+				offset = m.Offset
+			}
+			size := m.Size()
+			if offset+size > len(b) {
+				break
+			}
+			g = append(g, Value{Name: m.Name, Value: d.value(m, m.Presence, b[offset:offset+size])})
+			offset += size
+		}
+		return g
+	case KindEnum:
+		raw := d.value(t.Encoding, PresenceRequired, b)
+		key := fmt.Sprint(raw)
+		if s, ok := raw.(string); ok && len(s) == 1 {
+			key = strconv.Itoa(int(s[0]))
+		} else if ok && s == "" {
+			key = "0"
+		}
+		name, ok := t.Values[key]
+		if !ok && presence == PresenceOptional {
+			// unknown values of optional enums are the null value
+			return nil
+		}
+		return Enum{Name: name, Raw: raw}
+	case KindSet:
+		raw := d.schema.uint(b)
+		s := Set{Raw: raw}
+		for bit := uint(0); bit < 64; bit++ {
+			if raw&(1<<bit) != 0 {
+				name, ok := t.Choices[bit]
+				if !ok {
+					name = "bit" + strconv.Itoa(int(bit))
+				}
+				s.Choices = append(s.Choices, name)
+			}
+		}
+		return s
+	}
+
+	if t.Primitive == "char" {
+		// strings are padded with NUL or spaces
+		return strings.TrimRight(string(b), "\x00 ")
+	}
+	size := primitiveSizes[t.Primitive]
+	if t.Length > 1 {
+		values := make([]any, 0, t.Length)
+		for i := 0; i+size <= len(b); i += size {
+			values = append(values, d.primitive(t, presence, b[i:i+size]))
+		}
+		return values
+	}
+	return d.primitive(t, presence, b)
+}
+
+func (d *decoder) primitive(t *Type, presence string, b []byte) any {
+	var v any
+	switch t.Primitive {
+	case "float":
+		v = float64(math.Float32frombits(uint32(d.schema.uint(b))))
+	case "double":
+		v = math.Float64frombits(d.schema.uint(b))
+	case "int8", "int16", "int32", "int64":
+		u := d.schema.uint(b)
+		bits := uint(len(b) * 8)
+		v = int64(u<<(64-bits)) >> (64 - bits)
+	default:
+		v = d.schema.uint(b)
+	}
+	if presence == PresenceOptional && isNull(t, v) {
+		return nil
+	}
+	return v
+}
+
+// constant returns the value of a constant field
+func (d *decoder) constant(f *Field) any {
+	if f.Type.Kind == KindEnum && strings.Contains(f.ConstValue, ".") {
+		// valueRef is EnumType.ValueName
+		return Enum{Name: f.ConstValue[strings.LastIndex(f.ConstValue, ".")+1:]}
+	}
+	return f.ConstValue
+}
+
+// uint decodes an unsigned integer of the size of b in the schema byte order
+func (s *Schema) uint(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(s.ByteOrder.Uint16(b))
+	case 4:
+		return uint64(s.ByteOrder.Uint32(b))
+	case 8:
+		return s.ByteOrder.Uint64(b)
+	}
+	return 0
+}
+
+// isNull compares v with the null value of the type, explicit or the
+// default one of its primitive type
+func isNull(t *Type, v any) bool {
+	if t.NullValue != "" {
+		return fmt.Sprint(v) == t.NullValue
+	}
+	switch val := v.(type) {
+	case uint64:
+		switch t.Primitive {
+		case "uint8":
+			return val == math.MaxUint8
+		case "uint16":
+			return val == math.MaxUint16
+		case "uint32":
+			return val == math.MaxUint32
+		case "char":
+			return val == 0
+		default:
+			return val == math.MaxUint64
+		}
+	case int64:
+		switch t.Primitive {
+		case "int8":
+			return val == math.MinInt8
+		case "int16":
+			return val == math.MinInt16
+		case "int32":
+			return val == math.MinInt32
+		default:
+			return val == math.MinInt64
+		}
+	case float64:
+		return math.IsNaN(val)
+	}
+	return false
+}
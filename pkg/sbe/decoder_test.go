@@ -0,0 +1,273 @@
+package sbe
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSchema = `<?xml version="1.0" encoding="UTF-8"?>
+<sbe:messageSchema xmlns:sbe="http://fixprotocol.io/2016/sbe" package="test" id="1" version="2" byteOrder="littleEndian">
+  <types>
+    <composite name="messageHeader">
+      <type name="blockLength" primitiveType="uint16"/>
+      <type name="templateId" primitiveType="uint16"/>
+      <type name="schemaId" primitiveType="uint16"/>
+      <type name="version" primitiveType="uint16"/>
+    </composite>
+    <composite name="groupSizeEncoding">
+      <type name="blockLength" primitiveType="uint16"/>
+      <type name="numInGroup" primitiveType="uint16"/>
+    </composite>
+    <composite name="PRICE9">
+      <type name="mantissa" primitiveType="int64"/>
+      <type name="exponent" primitiveType="int8" presence="constant">-9</type>
+    </composite>
+    <type name="Symbol" primitiveType="char" length="8"/>
+    <type name="QtyOpt" primitiveType="int32" presence="optional"/>
+    <enum name="Side" encodingType="uint8">
+      <validValue name="Buy">1</validValue>
+      <validValue name="Sell">2</validValue>
+    </enum>
+    <enum name="Status" encodingType="char">
+      <validValue name="Open">O</validValue>
+    </enum>
+    <composite name="varStringEncoding">
+      <type name="length" primitiveType="uint16"/>
+      <type name="varData" primitiveType="uint8" length="0" characterEncoding="UTF-8"/>
+    </composite>
+    <composite name="varDataEncoding">
+      <type name="length" primitiveType="uint16"/>
+      <type name="varData" primitiveType="uint8" length="0"/>
+    </composite>
+    <set name="Flags" encodingType="uint8">
+      <choice name="Last">0</choice>
+      <choice name="Implied">2</choice>
+    </set>
+  </types>
+  <sbe:message name="Trade" id="10" blockLength="24">
+    <field name="SecurityID" id="48" type="int32"/>
+    <field name="Symbol" id="55" type="Symbol"/>
+    <field name="Side" id="54" type="Side"/>
+    <field name="Status" id="326" type="Status"/>
+    <field name="Flags" id="5" type="Flags"/>
+    <field name="Qty" id="38" type="QtyOpt" offset="16"/>
+    <field name="Count" id="6" type="uint32" sinceVersion="2"/>
+    <group name="Entries" id="100" dimensionType="groupSizeEncoding">
+      <field name="Px" id="270" type="PRICE9"/>
+    </group>
+  </sbe:message>
+  <sbe:message name="News" id="20" blockLength="4">
+    <field name="SecurityID" id="48" type="int32"/>
+    <data name="Headline" id="1" type="varStringEncoding"/>
+    <data name="Payload" id="2" type="varDataEncoding"/>
+  </sbe:message>
+</sbe:messageSchema>`
+
+func loadTestSchema(t *testing.T, xml string) *Schema {
+	t.Helper()
+	s, err := LoadSchema(strings.NewReader(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// trade returns an encoded Trade message with the entries prices
+func trade(version uint16, blockLength uint16, prices ...int64) []byte {
+	le := binary.LittleEndian
+	b := le.AppendUint16(nil, blockLength)
+	b = le.AppendUint16(b, 10)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, version)
+	body := le.AppendUint32(nil, 123456)
+	body = append(body, "ESZ4\x00\x00\x00\x00"...)
+	body = append(body, 2, 'O', 0b101, 0)
+	body = le.AppendUint32(body, 0x80000000)
+	body = le.AppendUint32(body, 7)
+	b = append(b, body[:blockLength]...)
+	b = le.AppendUint16(b, 8)
+	b = le.AppendUint16(b, uint16(len(prices)))
+	for _, p := range prices {
+		b = le.AppendUint64(b, uint64(p))
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	s := loadTestSchema(t, testSchema)
+	b := trade(2, 24, 4500250000000, -1)
+	m, n, err := s.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(b) {
+		t.Fatalf("consumed %d bytes of %d", n, len(b))
+	}
+	if m.Name != "Trade" || m.TemplateID != 10 || m.SchemaID != 1 || m.Version != 2 {
+		t.Fatalf("message %s tid %d schema %d v%d", m.Name, m.TemplateID, m.SchemaID, m.Version)
+	}
+	want := Group{
+		{Name: "SecurityID", Value: int64(123456)},
+		{Name: "Symbol", Value: "ESZ4"},
+		{Name: "Side", Value: Enum{Name: "Sell", Raw: uint64(2)}},
+		{Name: "Status", Value: Enum{Name: "Open", Raw: "O"}},
+		{Name: "Flags", Value: Set{Choices: []string{"Last", "Implied"}, Raw: 5}},
+		{Name: "Qty", Value: nil},
+		{Name: "Count", Value: uint64(7)},
+		{Name: "Entries", Value: []Group{
+			{{Name: "Px", Value: Group{{Name: "mantissa", Value: int64(4500250000000)}, {Name: "exponent", Value: "-9"}}}},
+			{{Name: "Px", Value: Group{{Name: "mantissa", Value: int64(-1)}, {Name: "exponent", Value: "-9"}}}},
+		}},
+	}
+	if !reflect.DeepEqual(m.Fields, want) {
+		t.Fatalf("fields\n%#v\nwant\n%#v", m.Fields, want)
+	}
+	if side, _ := m.Fields.Int("Side"); side != 2 {
+		t.Errorf("Int(Side) = %d, want 2", side)
+	}
+	if _, ok := m.Fields.Get("Qty"); ok {
+		t.Error("null Qty is present")
+	}
+	if len(m.Fields.Groups("Entries")) != 2 {
+		t.Error("Groups(Entries) has not 2 entries")
+	}
+}
+
+// news returns an encoded News message with its var data fields
+func news(headline string, payload []byte) []byte {
+	le := binary.LittleEndian
+	b := le.AppendUint16(nil, 4)
+	b = le.AppendUint16(b, 20)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, 2)
+	b = le.AppendUint32(b, 42)
+	b = le.AppendUint16(b, uint16(len(headline)))
+	b = append(b, headline...)
+	b = le.AppendUint16(b, uint16(len(payload)))
+	return append(b, payload...)
+}
+
+func TestDecodeVarData(t *testing.T) {
+	s := loadTestSchema(t, testSchema)
+	b := news("Halted", []byte{0xCA, 0xFE})
+	m, n, err := s.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(b) {
+		t.Fatalf("consumed %d bytes of %d", n, len(b))
+	}
+	want := Group{
+		{Name: "SecurityID", Value: int64(42)},
+		{Name: "Headline", Value: "Halted"},
+		{Name: "Payload", Value: []byte{0xCA, 0xFE}},
+	}
+	if !reflect.DeepEqual(m.Fields, want) {
+		t.Fatalf("fields\n%#v\nwant\n%#v", m.Fields, want)
+	}
+
+	// empty var data
+	m, _, err = s.Decode(news("", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := m.Fields.String("Headline"); h != "" {
+		t.Errorf("empty Headline = %q", h)
+	}
+
+	// length past the end of the message
+	if _, _, err := s.Decode(b[:len(b)-1]); err == nil || !strings.Contains(err.Error(), "Payload: invalid var data length 2") {
+		t.Errorf("truncated var data: error %v", err)
+	}
+	if _, _, err := s.Decode(b[:len(b)-3]); !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("truncated var data length: error %v", err)
+	}
+}
+
+func TestDecodeOlderVersion(t *testing.T) {
+	s := loadTestSchema(t, testSchema)
+	for _, version := range []uint16{1, 2} {
+		// the sender of version 1 has no Count, a shorter block too
+		m, _, err := s.Decode(trade(version, 20, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m.Fields.Get("Count"); ok {
+			t.Errorf("v%d: Count decoded past the block length", version)
+		}
+		if px := m.Fields.Groups("Entries"); len(px) != 1 {
+			t.Errorf("v%d: %d entries, want 1", version, len(px))
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	s := loadTestSchema(t, testSchema)
+	b := trade(2, 24, 1, 2)
+	if _, _, err := s.Decode(b[:len(b)-1]); err == nil || !strings.Contains(err.Error(), "invalid dimension 2 x 8") {
+		t.Errorf("truncated entry: error %v", err)
+	}
+	if _, _, err := s.Decode(b[:20]); !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("truncated block: error %v", err)
+	}
+	if _, _, err := s.Decode(b[:5]); !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("truncated header: error %v", err)
+	}
+	unknown := append([]byte{}, b...)
+	unknown[2] = 11
+	if _, _, err := s.Decode(unknown); err == nil || !strings.Contains(err.Error(), "unknown template id 11") {
+		t.Errorf("unknown template: error %v", err)
+	}
+	// numInGroup of 65535 empty entries
+	huge := trade(2, 24)
+	binary.LittleEndian.PutUint16(huge[len(huge)-4:], 0)
+	binary.LittleEndian.PutUint16(huge[len(huge)-2:], 0xFFFF)
+	if _, _, err := s.Decode(huge); err == nil || !strings.Contains(err.Error(), "invalid dimension 65535 x 0") {
+		t.Errorf("numInGroup larger than the remaining bytes: error %v", err)
+	}
+}
+
+func TestSchemaMessages(t *testing.T) {
+	s := loadTestSchema(t, testSchema)
+	var names []string
+	for _, m := range s.Messages() {
+		names = append(names, m.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Trade", "News"}) {
+		t.Fatalf("Messages() = %v", names)
+	}
+}
+
+func TestLoadSchemaDimension(t *testing.T) {
+	xml := strings.Replace(testSchema, `<type name="blockLength" primitiveType="uint16"/>
+      <type name="numInGroup"`, `<type name="numInGroup"`, 1)
+	if xml == testSchema {
+		t.Fatal("dimension type not replaced")
+	}
+	_, err := LoadSchema(strings.NewReader(xml))
+	if err == nil || !strings.Contains(err.Error(), "invalid dimension type groupSizeEncoding") {
+		t.Fatalf("dimension without blockLength: error %v", err)
+	}
+}
+
+func TestDecodeBigEndian(t *testing.T) {
+	s := loadTestSchema(t, strings.Replace(testSchema, "littleEndian", "bigEndian", 1))
+	be := binary.BigEndian
+	b := be.AppendUint16(nil, 4)
+	b = be.AppendUint16(b, 10)
+	b = be.AppendUint16(b, 1)
+	b = be.AppendUint16(b, 2)
+	b = be.AppendUint32(b, 0xFFFFFFFE)
+	b = be.AppendUint16(b, 8)
+	b = be.AppendUint16(b, 0)
+	m, _, err := s.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := m.Fields.Int("SecurityID"); id != -2 {
+		t.Fatalf("SecurityID = %d, want -2", id)
+	}
+}
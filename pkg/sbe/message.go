@@ -0,0 +1,244 @@
+package sbe
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Enum is a decoded enum value
+type Enum struct {
+	Name string
+	Raw  any
+}
+
+func (e Enum) String() string {
+	if e.Name == "" {
+		return fmt.Sprintf("?(%v)", e.Raw)
+	}
+	return fmt.Sprintf("%s(%v)", e.Name, e.Raw)
+}
+
+// Set is a decoded bit set value
+type Set struct {
+	Choices []string
+	Raw     uint64
+}
+
+func (s Set) String() string {
+	return fmt.Sprintf("%s(%#x)", strings.Join(s.Choices, "|"), s.Raw)
+}
+
+// Value is a decoded field. Value is one of int64, uint64, float64, string,
+// []any (primitive arrays), Enum, Set, Group (composite), []Group (repeating
+// group) or []byte (var data without character encoding), nil for optional
+// fields with the null value.
+type Value struct {
+	Name  string
+	Value any
+}
+
+// Group is the list of decoded fields of a message, composite or group entry
+type Group []Value
+
+// Get returns the value of the field with the name
+func (g Group) Get(name string) (any, bool) {
+	for _, v := range g {
+		if v.Name == name {
+			return v.Value, v.Value != nil
+		}
+	}
+	return nil, false
+}
+
+// Lookup returns the value of the field with the name ignoring the case and
+// the underscores, as the schemas name the same fields differently
+// (OrderID, OrderId, Order_ID)
+func (g Group) Lookup(name string) (any, bool) {
+	if v, ok := g.Get(name); ok {
+		return v, true
+	}
+	for _, v := range g {
+		if sameName(v.Name, name) {
+			return v.Value, v.Value != nil
+		}
+	}
+	return nil, false
+}
+
+// sameName returns true when the names are equal once normalized, without
+// allocating as normalize does
+func sameName(a, b string) bool {
+	i, j := 0, 0
+	for {
+		for i < len(a) && a[i] == '_' {
+			i++
+		}
+		for j < len(b) && b[j] == '_' {
+			j++
+		}
+		if i == len(a) || j == len(b) {
+			return i == len(a) && j == len(b)
+		}
+		if lower(a[i]) != lower(b[j]) {
+			return false
+		}
+		i++
+		j++
+	}
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// Int returns the value of an integer or enum field
+func (g Group) Int(name string) (int64, bool) {
+	v, ok := g.Get(name)
+	if !ok {
+		return 0, false
+	}
+	if e, isEnum := v.(Enum); isEnum {
+		v = e.Raw
+	}
+	switch i := v.(type) {
+	case int64:
+		return i, true
+	case uint64:
+		return int64(i), true
+	}
+	return 0, false
+}
+
+// Uint returns the value of an unsigned integer or enum field
+func (g Group) Uint(name string) (uint64, bool) {
+	i, ok := g.Int(name)
+	return uint64(i), ok
+}
+
+// String returns the value of a string field
+func (g Group) String(name string) (string, bool) {
+	v, ok := g.Get(name)
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+// Groups returns the entries of a repeating group
+func (g Group) Groups(name string) []Group {
+	v, _ := g.Get(name)
+	entries, _ := v.([]Group)
+	return entries
+}
+
+// Message is a decoded SBE message
+type Message struct {
+	TemplateID uint16
+	SchemaID   uint16
+	Version    uint16
+	Name       string
+	Fields     Group
+}
+
+// String returns the message with one field per line
+func (m *Message) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s [tid %d, schema %d v%d]\n", m.Name, m.TemplateID, m.SchemaID, m.Version)
+	writeGroup(&sb, m.Fields, "  ")
+	return sb.String()
+}
+
+func writeGroup(sb *strings.Builder, g Group, indent string) {
+	for _, v := range g {
+		switch val := v.Value.(type) {
+		case nil:
+			continue
+		case Group:
+			fmt.Fprintf(sb, "%s%s:\n", indent, v.Name)
+			writeGroup(sb, val, indent+"  ")
+		case []Group:
+			fmt.Fprintf(sb, "%s%s: [%d]\n", indent, v.Name, len(val))
+			for i, e := range val {
+				fmt.Fprintf(sb, "%s  [%d]\n", indent, i)
+				writeGroup(sb, e, indent+"    ")
+			}
+		case []byte:
+			fmt.Fprintf(sb, "%s%s: %x\n", indent, v.Name, val)
+		default:
+			fmt.Fprintf(sb, "%s%s: %v\n", indent, v.Name, val)
+		}
+	}
+}
+
+// MarshalJSON renders the enum as its name, or its raw value when unknown
+func (e Enum) MarshalJSON() ([]byte, error) {
+	if e.Name == "" {
+		return json.Marshal(e.Raw)
+	}
+	return json.Marshal(e.Name)
+}
+
+// MarshalJSON renders the set as the list of its choices
+func (s Set) MarshalJSON() ([]byte, error) {
+	if s.Choices == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(s.Choices)
+}
+
+// MarshalJSON renders the group as an object keeping the order of the
+// fields. The var data bytes are rendered as hex strings and the floats
+// not representable in JSON as null.
+func (g Group) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, v := range g {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(v.Name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		var value []byte
+		switch val := v.Value.(type) {
+		case []byte:
+			value, err = json.Marshal(hex.EncodeToString(val))
+		case float64:
+			if math.IsNaN(val) || math.IsInf(val, 0) {
+				value = []byte("null")
+				break
+			}
+			value, err = json.Marshal(val)
+		default:
+			value, err = json.Marshal(val)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", v.Name, err)
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// JSON renders the message as a JSON object on a single line
+func (m *Message) JSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name       string `json:"name"`
+		TemplateID uint16 `json:"templateId"`
+		SchemaID   uint16 `json:"schemaId"`
+		Version    uint16 `json:"version"`
+		Fields     Group  `json:"fields"`
+	}{m.Name, m.TemplateID, m.SchemaID, m.Version, m.Fields})
+}
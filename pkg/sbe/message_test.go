@@ -0,0 +1,82 @@
+package sbe
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMessageJSON(t *testing.T) {
+	s := loadTestSchema(t, testSchema)
+	m, _, err := s.Decode(trade(2, 24, 4500250000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"name":"Trade","templateId":10,"schemaId":1,"version":2,"fields":{"SecurityID":123456,"Symbol":"ESZ4","Side":"Sell","Status":"Open","Flags":["Last","Implied"],"Qty":null,"Count":7,"Entries":[{"Px":{"mantissa":4500250000000,"exponent":"-9"}}]}}`
+	if string(got) != want {
+		t.Fatalf("JSON\n%s\nwant\n%s", got, want)
+	}
+
+	m, _, err = s.Decode(news("Halted", []byte{0xCA, 0xFE}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = m.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"name":"News","templateId":20,"schemaId":1,"version":2,"fields":{"SecurityID":42,"Headline":"Halted","Payload":"cafe"}}`
+	if string(got) != want {
+		t.Fatalf("JSON\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGroupJSONValues(t *testing.T) {
+	g := Group{
+		{Name: "Unknown", Value: Enum{Raw: uint64(9)}},
+		{Name: "NoFlags", Value: Set{}},
+		{Name: "NaN", Value: math.NaN()},
+		{Name: "Inf", Value: math.Inf(1)},
+		{Name: "Px", Value: 1.5},
+		{Name: "Empty", Value: []Group{}},
+	}
+	got, err := g.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Unknown":9,"NoFlags":[],"NaN":null,"Inf":null,"Px":1.5,"Empty":[]}`
+	if string(got) != want {
+		t.Fatalf("JSON %s, want %s", got, want)
+	}
+}
+
+func TestGroupLookup(t *testing.T) {
+	g := Group{
+		{Name: "Symbol_Index", Value: uint64(42)},
+		{Name: "OrderId", Value: uint64(7)},
+		{Name: "Qty", Value: nil},
+	}
+	tests := []struct {
+		name string
+		want any
+		ok   bool
+	}{
+		{"Symbol_Index", uint64(42), true},
+		{"SymbolIndex", uint64(42), true},
+		{"symbolindex", uint64(42), true},
+		{"OrderID", uint64(7), true},
+		{"Order_ID", uint64(7), true},
+		{"Order", nil, false},
+		{"OrderIDs", nil, false},
+		{"Qty", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		if got, ok := g.Lookup(tt.name); got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package sbe
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of an SBE type
+type Kind int
+
+const (
+	KindPrimitive Kind = iota
+	KindComposite
+	KindEnum
+	KindSet
+)
+
+// Presence of a type or field
+const (
+	PresenceRequired = "required"
+	PresenceOptional = "optional"
+	PresenceConstant = "constant"
+)
+
+var primitiveSizes = map[string]int{
+	"char":   1,
+	"int8":   1,
+	"uint8":  1,
+	"int16":  2,
+	"uint16": 2,
+	"int32":  4,
+	"uint32": 4,
+	"int64":  8,
+	"uint64": 8,
+	"float":  4,
+	"double": 8,
+}
+
+// Type is an encoding type of the schema
+type Type struct {
+	Name      string
+	Kind      Kind
+	Primitive string
+	// Length is the number of elements of a primitive array (e.g. a char string)
+	Length     int
+	Presence   string
+	NullValue  string
+	ConstValue string
+	// Offset is the offset of a composite member, -1 when not given
+	Offset int
+	// CharacterEncoding is set for the text types, e.g. the var data ones
+	CharacterEncoding string
+
+	// Members are the types of a composite
+	Members []*Type
+	// Encoding is the encoding type of an enum or set
+	Encoding *Type
+	// Values are the valid values of an enum by raw value
+	Values map[string]string
+	// Choices are the choices of a set by bit number
+	Choices map[uint]string
+}
+
+// Size returns the encoded size of the type
+func (t *Type) Size() int {
+	switch t.Kind {
+	case KindComposite:
+		size := 0
+		for _, m := range t.Members {
+			if m.Presence == PresenceConstant {
+				continue
+			}
+			if m.Offset >= 0 && m.Offset > size {
+				size = m.Offset
+			}
+			size += m.Size()
+		}
+		return size
+	case KindEnum, KindSet:
+		return t.Encoding.Size()
+	default:
+		if t.Presence == PresenceConstant {
+			return 0
+		}
+		return primitiveSizes[t.Primitive] * max(t.Length, 1)
+	}
+}
+
+// Member returns the member of a composite by its normalized name
+func (t *Type) Member(name string) *Type {
+	for _, m := range t.Members {
+		if normalize(m.Name) == normalize(name) {
+			return m
+		}
+	}
+	return nil
+}
+
+// Field is a field of a message or repeating group
+type Field struct {
+	Name         string
+	ID           uint16
+	Type         *Type
+	Offset       int
+	SinceVersion uint16
+	Presence     string
+	ConstValue   string
+}
+
+// Block is the body of a message or of a repeating group entry
+type Block struct {
+	BlockLength int
+	Fields      []*Field
+	Groups      []*GroupDef
+	Data        []*Field
+}
+
+// GroupDef is a repeating group definition
+type GroupDef struct {
+	Block
+	Name         string
+	ID           uint16
+	Dimension    *Type
+	SinceVersion uint16
+}
+
+// MessageDef is a message definition
+type MessageDef struct {
+	Block
+	Name string
+	ID   uint16
+}
+
+// Schema is an SBE message schema loaded from its XML definition
+type Schema struct {
+	ID        uint16
+	Version   uint16
+	Package   string
+	ByteOrder binary.ByteOrder
+	Header    *Type
+
+	types    map[string]*Type
+	messages map[uint16]*MessageDef
+}
+
+// Message returns the definition of the message with the template id or nil
+func (s *Schema) Message(templateID uint16) *MessageDef { return s.messages[templateID] }
+
+// Messages returns the definitions of the messages ordered by template id
+func (s *Schema) Messages() []*MessageDef {
+	messages := make([]*MessageDef, 0, len(s.messages))
+	for _, m := range s.messages {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages
+}
+
+// Len returns the number of messages of the schema
+func (s *Schema) Len() int { return len(s.messages) }
+
+// Type returns the type with the name or nil
+func (s *Schema) Type(name string) *Type { return s.types[name] }
+
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Nodes    []xmlNode  `xml:",any"`
+	CharData string     `xml:",chardata"`
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *xmlNode) intAttr(name string, def int) int {
+	v, err := strconv.Atoi(n.attr(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// normalize makes names comparable across schemas naming styles
+// (templateId, TemplateID, Template_ID)
+func normalize(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// LoadSchemaFile loads an SBE XML message schema file
+func LoadSchemaFile(path string) (*Schema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadSchema(f)
+}
+
+// LoadSchema loads an SBE XML message schema
+func LoadSchema(r io.Reader) (*Schema, error) {
+	var root xmlNode
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	if root.XMLName.Local != "messageSchema" {
+		return nil, fmt.Errorf("unexpected root element %s", root.XMLName.Local)
+	}
+
+	s := &Schema{
+		ID:        uint16(root.intAttr("id", 0)),
+		Version:   uint16(root.intAttr("version", 0)),
+		Package:   root.attr("package"),
+		ByteOrder: binary.LittleEndian,
+		types:     make(map[string]*Type),
+		messages:  make(map[uint16]*MessageDef),
+	}
+	if root.attr("byteOrder") == "bigEndian" {
+		s.ByteOrder = binary.BigEndian
+	}
+	for _, p := range []string{"char", "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64", "float", "double"} {
+		s.types[p] = &Type{Name: p, Kind: KindPrimitive, Primitive: p, Length: 1, Presence: PresenceRequired, Offset: -1}
+	}
+
+	// types can reference types declared later, parse them in two passes
+	var typeNodes []*xmlNode
+	for i := range root.Nodes {
+		if root.Nodes[i].XMLName.Local == "types" {
+			for j := range root.Nodes[i].Nodes {
+				typeNodes = append(typeNodes, &root.Nodes[i].Nodes[j])
+			}
+		}
+	}
+	pending := typeNodes
+	for len(pending) > 0 {
+		var next []*xmlNode
+		var lastErr error
+		for _, n := range pending {
+			t, err := s.parseType(n)
+			if err != nil {
+				lastErr = err
+				next = append(next, n)
+				continue
+			}
+			s.types[t.Name] = t
+		}
+		if len(next) == len(pending) {
+			return nil, lastErr
+		}
+		pending = next
+	}
+
+	headerType := root.attr("headerType")
+	if headerType == "" {
+		headerType = "messageHeader"
+	}
+	s.Header = s.types[headerType]
+	if s.Header == nil || s.Header.Kind != KindComposite {
+		return nil, fmt.Errorf("message header composite %s not found", headerType)
+	}
+	for _, name := range []string{"blockLength", "templateId"} {
+		if s.Header.Member(name) == nil {
+			return nil, fmt.Errorf("message header %s has no %s", headerType, name)
+		}
+	}
+
+	for i := range root.Nodes {
+		n := &root.Nodes[i]
+		if n.XMLName.Local != "message" {
+			continue
+		}
+		m := &MessageDef{Name: n.attr("name"), ID: uint16(n.intAttr("id", 0))}
+		if err := s.parseBlock(n, &m.Block); err != nil {
+			return nil, fmt.Errorf("message %s: %w", m.Name, err)
+		}
+		s.messages[m.ID] = m
+	}
+	return s, nil
+}
+
+func (s *Schema) parseType(n *xmlNode) (*Type, error) {
+	t := &Type{
+		Name:              n.attr("name"),
+		Presence:          n.attr("presence"),
+		NullValue:         n.attr("nullValue"),
+		ConstValue:        strings.TrimSpace(n.CharData),
+		Offset:            n.intAttr("offset", -1),
+		CharacterEncoding: n.attr("characterEncoding"),
+	}
+	if t.Presence == "" {
+		t.Presence = PresenceRequired
+	}
+	switch n.XMLName.Local {
+	case "type":
+		t.Kind = KindPrimitive
+		t.Primitive = n.attr("primitiveType")
+		if _, ok := primitiveSizes[t.Primitive]; !ok {
+			return nil, fmt.Errorf("type %s: unknown primitive type %q", t.Name, t.Primitive)
+		}
+		t.Length = n.intAttr("length", 1)
+	case "composite":
+		t.Kind = KindComposite
+		for i := range n.Nodes {
+			c := &n.Nodes[i]
+			if c.XMLName.Local == "ref" {
+				ref := s.types[c.attr("type")]
+				if ref == nil {
+					return nil, fmt.Errorf("composite %s: unknown type %s", t.Name, c.attr("type"))
+				}
+				m := *ref
+				m.Name = c.attr("name")
+				m.Offset = c.intAttr("offset", -1)
+				t.Members = append(t.Members, &m)
+				continue
+			}
+			m, err := s.parseType(c)
+			if err != nil {
+				return nil, fmt.Errorf("composite %s: %w", t.Name, err)
+			}
+			t.Members = append(t.Members, m)
+		}
+	case "enum", "set":
+		t.Kind = KindEnum
+		if n.XMLName.Local == "set" {
+			t.Kind = KindSet
+		}
+		enc := n.attr("encodingType")
+		t.Encoding = s.types[enc]
+		if t.Encoding == nil {
+			return nil, fmt.Errorf("%s %s: unknown encoding type %s", n.XMLName.Local, t.Name, enc)
+		}
+		t.Values = make(map[string]string)
+		t.Choices = make(map[uint]string)
+		for i := range n.Nodes {
+			c := &n.Nodes[i]
+			v := strings.TrimSpace(c.CharData)
+			switch c.XMLName.Local {
+			case "validValue":
+				if t.Encoding.Primitive == "char" && len(v) == 1 {
+					// char enums are compared on their numeric value
+					v = strconv.Itoa(int(v[0]))
+				}
+				t.Values[v] = c.attr("name")
+			case "choice":
+				bit, err := strconv.ParseUint(v, 10, 8)
+				if err != nil {
+					return nil, fmt.Errorf("set %s: invalid choice %q", t.Name, v)
+				}
+				t.Choices[uint(bit)] = c.attr("name")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown type element %s", n.XMLName.Local)
+	}
+	return t, nil
+}
+
+func (s *Schema) parseBlock(n *xmlNode, b *Block) error {
+	b.BlockLength = n.intAttr("blockLength", -1)
+	offset := 0
+	for i := range n.Nodes {
+		c := &n.Nodes[i]
+		switch c.XMLName.Local {
+		case "field":
+			f, err := s.parseField(c)
+			if err != nil {
+				return err
+			}
+			if f.Offset < 0 {
+				f.Offset = offset
+			}
+			if f.Presence != PresenceConstant {
+				offset = f.Offset + f.Type.Size()
+			}
+			b.Fields = append(b.Fields, f)
+		case "group":
+			g := &GroupDef{
+				Name:         c.attr("name"),
+				ID:           uint16(c.intAttr("id", 0)),
+				SinceVersion: uint16(c.intAttr("sinceVersion", 0)),
+			}
+			dim := c.attr("dimensionType")
+			if dim == "" {
+				dim = "groupSizeEncoding"
+			}
+			g.Dimension = s.types[dim]
+			if g.Dimension == nil || g.Dimension.Member("blockLength") == nil || g.Dimension.Member("numInGroup") == nil {
+				return fmt.Errorf("group %s: invalid dimension type %s, blockLength and numInGroup required", g.Name, dim)
+			}
+			if err := s.parseBlock(c, &g.Block); err != nil {
+				return fmt.Errorf("group %s: %w", g.Name, err)
+			}
+			b.Groups = append(b.Groups, g)
+		case "data":
+			f, err := s.parseField(c)
+			if err != nil {
+				return err
+			}
+			b.Data = append(b.Data, f)
+		}
+	}
+	if b.BlockLength < 0 {
+		b.BlockLength = offset
+	}
+	return nil
+}
+
+func (s *Schema) parseField(n *xmlNode) (*Field, error) {
+	f := &Field{
+		Name:         n.attr("name"),
+		ID:           uint16(n.intAttr("id", 0)),
+		Offset:       n.intAttr("offset", -1),
+		SinceVersion: uint16(n.intAttr("sinceVersion", 0)),
+		Presence:     n.attr("presence"),
+		ConstValue:   n.attr("valueRef"),
+	}
+	f.Type = s.types[n.attr("type")]
+	if f.Type == nil {
+		return nil, fmt.Errorf("field %s: unknown type %s", f.Name, n.attr("type"))
+	}
+	if f.Presence == "" {
+		f.Presence = f.Type.Presence
+	}
+	if f.Presence == PresenceConstant && f.ConstValue == "" {
+		f.ConstValue = f.Type.ConstValue
+	}
+	return f, nil
+}
@@ -0,0 +1,140 @@
+package sequence
+
+import "time"
+
+// ArbiterStats are the counters of an Arbiter since the previous SwapStats,
+// indexed by feed for the per feed ones.
+type ArbiterStats struct {
+	// Won is the number of sequence numbers received first on the feed
+	Won []uint64
+	// Gaps is the number of sequence numbers missing on the feed, recovered
+	// or not by the other feeds
+	Gaps []uint64
+	// Duplicates is the number of sequence numbers received twice on the feed
+	Duplicates []uint64
+	// Recovered is the number of sequence numbers filling a gap of the merged
+	// stream, received late e.g. on a lagging feed, before the gap was lost
+	Recovered uint64
+	// Lost is the number of sequence numbers missing on all the feeds
+	Lost uint64
+}
+
+// Loss is a range of sequence numbers lost on all the feeds
+type Loss struct {
+	// From and To are the first and the last sequence numbers of the range
+	From, To uint64
+	// Missing is the number of sequence numbers of the range never received
+	Missing uint64
+}
+
+type arbiterGap struct {
+	from, to uint64
+	since    time.Time
+	// recovered counts the sequence numbers of the gap received late
+	recovered uint64
+}
+
+// Arbiter merges the redundant feeds (e.g. A and B) of a stream by sequence
+// number: the first copy wins and the gaps of the merged stream are lost
+// once all the feeds moved past them, or after the timeout when a feed
+// lags or is down. An Arbiter is not safe for concurrent use.
+type Arbiter struct {
+	window  *Window
+	feeds   []*Window
+	timeout time.Duration
+	pending []arbiterGap
+	stats   ArbiterStats
+}
+
+// NewArbiter returns an arbiter of the feeds whose windows remember size
+// sequence numbers.
+func NewArbiter(size int, feeds int, timeout time.Duration) *Arbiter {
+	a := &Arbiter{
+		window:  NewWindow(size),
+		feeds:   make([]*Window, feeds),
+		timeout: timeout,
+	}
+	for i := range a.feeds {
+		a.feeds[i] = NewWindow(size)
+	}
+	a.resetStats()
+	return a
+}
+
+func (a *Arbiter) resetStats() {
+	n := len(a.feeds)
+	a.stats = ArbiterStats{Won: make([]uint64, n), Gaps: make([]uint64, n), Duplicates: make([]uint64, n)}
+}
+
+// Add records seq received on the feed and classifies it on the merged
+// stream: a Duplicate is a copy already received on any feed. For Gap the
+// second value is the number of missing sequence numbers, which are not lost
+// yet: see Losses.
+func (a *Arbiter) Add(feed int, seq uint64, now time.Time) (Result, uint64) {
+	switch r, missing := a.feeds[feed].Add(seq); r {
+	case Gap:
+		a.stats.Gaps[feed] += missing
+	case Duplicate:
+		a.stats.Duplicates[feed]++
+	}
+	r, missing := a.window.Add(seq)
+	switch r {
+	case First, Next:
+		a.stats.Won[feed]++
+	case Gap:
+		a.stats.Won[feed]++
+		a.pending = append(a.pending, arbiterGap{from: seq - missing, to: seq - 1, since: now})
+	case Late:
+		a.stats.Won[feed]++
+		// too late when its gap was already counted as lost
+		for i := range a.pending {
+			if g := &a.pending[i]; seq >= g.from && seq <= g.to {
+				g.recovered++
+				a.stats.Recovered++
+				break
+			}
+		}
+	}
+	return r, missing
+}
+
+// Losses returns the ranges of the merged stream lost on all the feeds: all
+// of them moved past the range, or the timeout elapsed since its detection.
+// The cost depends on the number of pending gaps, not on their size.
+func (a *Arbiter) Losses(now time.Time) []Loss {
+	var losses []Loss
+	pending := a.pending[:0]
+	for _, g := range a.pending {
+		if now.Sub(g.since) < a.timeout && !a.passed(g.to) {
+			pending = append(pending, g)
+			continue
+		}
+		// the recovered ones were counted on arrival
+		if missing := g.to - g.from + 1 - g.recovered; missing > 0 {
+			a.stats.Lost += missing
+			losses = append(losses, Loss{From: g.from, To: g.to, Missing: missing})
+		}
+	}
+	a.pending = pending
+	return losses
+}
+
+// passed returns true when all the feeds received a sequence number after seq
+func (a *Arbiter) passed(seq uint64) bool {
+	for _, w := range a.feeds {
+		if w.Last() <= seq {
+			return false
+		}
+	}
+	return true
+}
+
+// Last returns the highest sequence number of the merged stream.
+func (a *Arbiter) Last() uint64 { return a.window.Last() }
+
+// SwapStats returns the counters and resets them.
+func (a *Arbiter) SwapStats() ArbiterStats {
+	s := a.stats
+	a.resetStats()
+	return s
+}
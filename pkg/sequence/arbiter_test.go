@@ -0,0 +1,112 @@
+package sequence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArbiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a := NewArbiter(64, 2, time.Second)
+	steps := []struct {
+		feed    int
+		seq     uint64
+		want    Result
+		missing uint64
+	}{
+		{0, 1, First, 0},
+		{1, 1, Duplicate, 0},
+		{0, 2, Next, 0},
+		// 3 and 4 lost on A, received on B
+		{0, 5, Gap, 2},
+		{1, 2, Duplicate, 0},
+		{1, 3, Late, 0},
+		{1, 4, Late, 0},
+		{1, 5, Duplicate, 0},
+		{1, 5, Duplicate, 0},
+		// 6..8 lost on both feeds, 7 late on A
+		{0, 9, Gap, 3},
+		{0, 7, Late, 0},
+	}
+	for i, s := range steps {
+		if got, missing := a.Add(s.feed, s.seq, now); got != s.want || missing != s.missing {
+			t.Fatalf("step %d: Add(%d, %d) = %v, %d, want %v, %d", i, s.feed, s.seq, got, missing, s.want, s.missing)
+		}
+	}
+	if a.Last() != 9 {
+		t.Fatalf("Last() = %d, want 9", a.Last())
+	}
+	// B didn't move past 9 yet
+	if losses := a.Losses(now); len(losses) != 0 {
+		t.Fatalf("losses %+v before the feeds moved past the gaps", losses)
+	}
+	a.Add(0, 10, now)
+	a.Add(1, 10, now)
+	losses := a.Losses(now)
+	if len(losses) != 1 || losses[0] != (Loss{From: 6, To: 8, Missing: 2}) {
+		t.Fatalf("losses %+v, want 6..8 with 2 missing", losses)
+	}
+	if losses := a.Losses(now); len(losses) != 0 {
+		t.Fatalf("losses %+v reported twice", losses)
+	}
+
+	s := a.SwapStats()
+	if s.Won[0] != 6 || s.Won[1] != 2 || s.Gaps[0] != 5 || s.Gaps[1] != 4 ||
+		s.Duplicates[0] != 0 || s.Duplicates[1] != 1 || s.Recovered != 3 || s.Lost != 2 {
+		t.Fatalf("stats %+v", s)
+	}
+	if s := a.SwapStats(); s.Won[0] != 0 || s.Lost != 0 {
+		t.Fatalf("stats not reset %+v", s)
+	}
+}
+
+func TestArbiterTimeout(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a := NewArbiter(64, 2, time.Second)
+	a.Add(0, 1, now)
+	a.Add(0, 5, now)
+	// B is down: the gap is lost after the timeout
+	if losses := a.Losses(now.Add(time.Second - 1)); len(losses) != 0 {
+		t.Fatalf("losses %+v before the timeout", losses)
+	}
+	losses := a.Losses(now.Add(time.Second))
+	if len(losses) != 1 || losses[0] != (Loss{From: 2, To: 4, Missing: 3}) {
+		t.Fatalf("losses %+v, want 2..4", losses)
+	}
+}
+
+func TestArbiterLateAfterLoss(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a := NewArbiter(64, 2, time.Second)
+	a.Add(0, 1, now)
+	a.Add(0, 5, now)
+	a.Add(1, 3, now)
+	losses := a.Losses(now.Add(time.Second))
+	if len(losses) != 1 || losses[0] != (Loss{From: 2, To: 4, Missing: 2}) {
+		t.Fatalf("losses %+v, want 2..4 with 2 missing", losses)
+	}
+	// B lagging past the timeout: the lost ones arrive too late
+	if r, _ := a.Add(1, 2, now.Add(2*time.Second)); r != Late {
+		t.Fatalf("Add of a lost sequence number = %v, want Late", r)
+	}
+	a.Add(1, 4, now.Add(2*time.Second))
+	if s := a.SwapStats(); s.Recovered != 1 || s.Lost != 2 {
+		t.Fatalf("Recovered %d, Lost %d, want 1 and 2", s.Recovered, s.Lost)
+	}
+	if losses := a.Losses(now.Add(3 * time.Second)); len(losses) != 0 {
+		t.Fatalf("losses %+v reported twice", losses)
+	}
+}
+
+func TestArbiterLargeGap(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a := NewArbiter(64, 1, time.Second)
+	a.Add(0, 1, now)
+	a.Add(0, 1<<60, now)
+	a.Add(0, 1<<60-10, now)
+	a.Add(0, 1<<60+1, now)
+	losses := a.Losses(now)
+	if len(losses) != 1 || losses[0] != (Loss{From: 2, To: 1<<60 - 1, Missing: 1<<60 - 3}) {
+		t.Fatalf("losses %+v", losses)
+	}
+}
@@ -0,0 +1,35 @@
+package sequence
+
+// Tracker keeps one Window per stream, e.g. per sender or channel, so that
+// sequence numbers of different streams sharing a multicast group are not
+// mixed. A Tracker is not safe for concurrent use.
+type Tracker struct {
+	size    int
+	windows map[uint64]*Window
+}
+
+// NewTracker returns a tracker whose windows remember size sequence numbers.
+func NewTracker(size int) *Tracker {
+	return &Tracker{
+		size:    size,
+		windows: make(map[uint64]*Window),
+	}
+}
+
+// Window returns the window of the stream, creating it on first use.
+func (t *Tracker) Window(stream uint64) *Window {
+	w, ok := t.windows[stream]
+	if !ok {
+		w = NewWindow(t.size)
+		t.windows[stream] = w
+	}
+	return w
+}
+
+// Add records seq for the stream. See Window.Add.
+func (t *Tracker) Add(stream uint64, seq uint64) (Result, uint64) {
+	return t.Window(stream).Add(seq)
+}
+
+// Streams returns the number of streams seen so far.
+func (t *Tracker) Streams() int { return len(t.windows) }
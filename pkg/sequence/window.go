@@ -0,0 +1,228 @@
+package sequence
+
+// Result is the classification of a sequence number offered to a Window.
+type Result int
+
+const (
+	// First is returned for the very first sequence number seen by the window.
+	First Result = iota
+	// Next is returned when the sequence number is exactly the expected one.
+	Next
+	// Gap is returned when the sequence number is ahead of the expected one,
+	// the number of skipped sequence numbers is returned alongside.
+	Gap
+	// Late is returned for a sequence number older than the highest seen that
+	// was still missing (a gap filled by a reordered or retransmitted packet).
+	Late
+	// Duplicate is returned for a sequence number already seen inside the window.
+	Duplicate
+	// TooOld is returned for a sequence number behind the window: it can't be
+	// told apart between a duplicate and a late packet.
+	TooOld
+)
+
+func (r Result) String() string {
+	switch r {
+	case First:
+		return "first"
+	case Next:
+		return "next"
+	case Gap:
+		return "gap"
+	case Late:
+		return "late"
+	case Duplicate:
+		return "duplicate"
+	case TooOld:
+		return "too old"
+	default:
+		return "unknown"
+	}
+}
+
+// Window is a sliding bitmap over the last sequence numbers received on a
+// single stream. It detects duplicates and gaps without allocating after
+// construction: O(1) per sequence number, plus one word operation per 64
+// sequence numbers skipped by a gap, at most Size()/64. A Window is not safe
+// for concurrent use.
+type Window struct {
+	bits    []uint64
+	mask    uint64
+	last    uint64
+	started bool
+}
+
+// NewWindow returns a window remembering at least size sequence numbers.
+// The size is rounded up to a power of two and to a minimum of 64.
+func NewWindow(size int) *Window {
+	n := uint64(64)
+	for n < uint64(size) {
+		n <<= 1
+	}
+	return &Window{
+		bits: make([]uint64, n/64),
+		mask: n - 1,
+	}
+}
+
+// Size returns the number of sequence numbers remembered by the window.
+func (w *Window) Size() uint64 { return w.mask + 1 }
+
+// Last returns the highest sequence number seen so far.
+func (w *Window) Last() uint64 { return w.last }
+
+// Reset forgets all the sequence numbers seen so far.
+func (w *Window) Reset() {
+	clear(w.bits)
+	w.last = 0
+	w.started = false
+}
+
+// Add records seq and classifies it. For Gap the second value is the number
+// of missing sequence numbers between the previous highest and seq.
+func (w *Window) Add(seq uint64) (Result, uint64) {
+	if !w.started {
+		w.started = true
+		w.last = seq
+		w.set(seq)
+		return First, 0
+	}
+	if seq > w.last {
+		missing := seq - w.last - 1
+		w.advance(seq)
+		if missing > 0 {
+			return Gap, missing
+		}
+		return Next, 0
+	}
+	if w.last-seq > w.mask {
+		return TooOld, 0
+	}
+	if w.isSet(seq) {
+		return Duplicate, 0
+	}
+	w.set(seq)
+	return Late, 0
+}
+
+// Seen returns true when seq was recorded and is still inside the window.
+func (w *Window) Seen(seq uint64) bool {
+	if !w.started || seq > w.last || w.last-seq > w.mask {
+		return false
+	}
+	return w.isSet(seq)
+}
+
+// Skip moves the head of the window to seq without recording it, e.g. when a
+// heartbeat announces the next sequence number. The sequence numbers skipped
+// over, seq included, are Late when they arrive. It returns their number.
+func (w *Window) Skip(seq uint64) uint64 {
+	if !w.started || seq <= w.last {
+		return 0
+	}
+	missing := seq - w.last
+	w.advance(seq)
+	w.clearBit(seq)
+	return missing
+}
+
+// AddRange records the count consecutive sequence numbers starting at seq,
+// e.g. the messages of a packet, and classifies them by seq as Add does.
+// Duplicate and TooOld ranges are not recorded. The cost does not depend on
+// count, the numbers behind the window are not remembered.
+func (w *Window) AddRange(seq, count uint64) (Result, uint64) {
+	result, missing := w.Add(seq)
+	if count <= 1 || result == Duplicate || result == TooOld {
+		return result, missing
+	}
+	end := seq + count - 1
+	if end < seq {
+		end = ^uint64(0)
+	}
+	if end > w.last {
+		if end-w.last > w.mask {
+			clear(w.bits)
+		} else {
+			w.fill(w.last+1, end, false)
+		}
+		w.last = end
+	}
+	from := seq + 1
+	if end-from > w.mask {
+		from = end - w.mask
+	}
+	w.fill(from, end, true)
+	return result, missing
+}
+
+// AddPacket records a packet of a unit header, e.g. the Cboe Sequenced Unit
+// Header or the MITCH one: the sequence number of its first message and
+// their count. A packet without messages is a heartbeat carrying the next
+// sequence number, Gap when it reveals missing sequence numbers and Next
+// otherwise. The other packets are classified as by AddRange. A packet
+// restarting the sequence from 1 resets the window first, reset is then true.
+func (w *Window) AddPacket(seq, count uint64) (result Result, missing uint64, reset bool) {
+	if seq == 1 && w.last > 1 {
+		w.Reset()
+		reset = true
+	}
+	if count == 0 {
+		if seq > 1 {
+			missing = w.Skip(seq - 1)
+		}
+		if missing > 0 {
+			return Gap, missing, reset
+		}
+		return Next, 0, reset
+	}
+	result, missing = w.AddRange(seq, count)
+	return result, missing, reset
+}
+
+// advance moves the head of the window to seq clearing the bits of the
+// sequence numbers that were skipped over, a word at a time.
+func (w *Window) advance(seq uint64) {
+	if seq-w.last > w.mask {
+		clear(w.bits)
+	} else if seq-w.last > 1 {
+		w.fill(w.last+1, seq-1, false)
+	}
+	w.last = seq
+	w.set(seq)
+}
+
+// fill sets or clears the bits of the sequence numbers from..to, both
+// included, at most Size() of them.
+func (w *Window) fill(from, to uint64, set bool) {
+	for n := to - from + 1; n > 0; {
+		i := from & w.mask
+		bit := i & 63
+		k := min(64-bit, n)
+		m := ^uint64(0)
+		if k < 64 {
+			m = (1<<k - 1) << bit
+		}
+		if set {
+			w.bits[i>>6] |= m
+		} else {
+			w.bits[i>>6] &^= m
+		}
+		from += k
+		n -= k
+	}
+}
+
+func (w *Window) set(seq uint64) {
+	i := seq & w.mask
+	w.bits[i>>6] |= 1 << (i & 63)
+}
+
+func (w *Window) clearBit(seq uint64) {
+	i := seq & w.mask
+	w.bits[i>>6] &^= 1 << (i & 63)
+}
+
+func (w *Window) isSet(seq uint64) bool {
+	i := seq & w.mask
+	return w.bits[i>>6]&(1<<(i&63)) != 0
+}
@@ -0,0 +1,226 @@
+package sequence
+
+import (
+	"github.com/hashicorp/golang-lru"
+	"math/rand"
+	"testing"
+)
+
+type step struct {
+	seq     uint64
+	want    Result
+	missing uint64
+}
+
+func TestWindowAdd(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		seed  uint64
+		steps []step
+	}{
+		{"in sequence", 64, 0, []step{{1, First, 0}, {2, Next, 0}, {3, Next, 0}}},
+		{"gap filled", 64, 0, []step{{1, First, 0}, {5, Gap, 3}, {3, Late, 0}, {3, Duplicate, 0}, {5, Duplicate, 0}, {4, Late, 0}}},
+		{"first is not 1", 64, 0, []step{{1000, First, 0}, {1001, Next, 0}, {999, Late, 0}, {1000, Duplicate, 0}}},
+		{"window edge", 64, 0, []step{{1, First, 0}, {100, Gap, 98}, {36, TooOld, 0}, {37, Late, 0}, {37, Duplicate, 0}, {1, TooOld, 0}}},
+		{"across a word", 64, 0, []step{{60, First, 0}, {70, Gap, 9}, {64, Late, 0}, {63, Late, 0}, {64, Duplicate, 0}, {61, Late, 0}, {60, Duplicate, 0}}},
+		{"gap over words", 256, 0, []step{{10, First, 0}, {200, Gap, 189}, {128, Late, 0}, {64, Late, 0}, {11, Late, 0}, {10, Duplicate, 0}}},
+		// 1..64 seen, the skipped numbers reuse their bits
+		{"partial wrap", 64, 64, []step{{100, Gap, 35}, {36, TooOld, 0}, {37, Duplicate, 0}, {64, Duplicate, 0}, {65, Late, 0}, {70, Late, 0}, {99, Late, 0}, {99, Duplicate, 0}}},
+		{"full wrap", 64, 64, []step{{129, Gap, 64}, {66, Late, 0}, {127, Late, 0}, {65, TooOld, 0}}},
+		{"gap of a word", 128, 64, []step{{129, Gap, 64}, {65, Late, 0}, {128, Late, 0}, {64, Duplicate, 0}, {2, Duplicate, 0}, {1, TooOld, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWindow(tt.size)
+			for seq := uint64(1); seq <= tt.seed; seq++ {
+				w.Add(seq)
+			}
+			for i, s := range tt.steps {
+				got, missing := w.Add(s.seq)
+				if got != s.want || missing != s.missing {
+					t.Fatalf("step %d: Add(%d) = %v, %d, want %v, %d", i, s.seq, got, missing, s.want, s.missing)
+				}
+			}
+		})
+	}
+}
+
+func TestWindowSkip(t *testing.T) {
+	w := NewWindow(64)
+	if missing := w.Skip(10); missing != 0 {
+		t.Fatalf("Skip before the first sequence number = %d, want 0", missing)
+	}
+	w.Add(1)
+	if missing := w.Skip(10); missing != 9 {
+		t.Fatalf("Skip(10) = %d, want 9", missing)
+	}
+	if w.Last() != 10 || w.Seen(10) {
+		t.Fatalf("Last() = %d, Seen(10) = %v after Skip(10)", w.Last(), w.Seen(10))
+	}
+	if missing := w.Skip(5); missing != 0 {
+		t.Fatalf("Skip(5) behind the head = %d, want 0", missing)
+	}
+	for _, s := range []step{{10, Late, 0}, {5, Late, 0}, {10, Duplicate, 0}, {11, Next, 0}} {
+		if got, missing := w.Add(s.seq); got != s.want || missing != s.missing {
+			t.Fatalf("Add(%d) = %v, %d, want %v, %d", s.seq, got, missing, s.want, s.missing)
+		}
+	}
+	if missing := w.Skip(200); missing != 189 {
+		t.Fatalf("Skip(200) = %d, want 189", missing)
+	}
+	for _, s := range []step{{150, Late, 0}, {136, TooOld, 0}, {201, Next, 0}} {
+		if got, missing := w.Add(s.seq); got != s.want || missing != s.missing {
+			t.Fatalf("Add(%d) = %v, %d, want %v, %d", s.seq, got, missing, s.want, s.missing)
+		}
+	}
+}
+
+func TestWindowAddRange(t *testing.T) {
+	w := NewWindow(64)
+	tests := []struct {
+		seq, count uint64
+		want       Result
+		missing    uint64
+		last       uint64
+	}{
+		{1, 10, First, 0, 10},
+		{5, 1, Duplicate, 0, 10},
+		{11, 5, Next, 0, 15},
+		{20, 3, Gap, 4, 22},
+		{17, 2, Late, 0, 22},
+		{18, 1, Duplicate, 0, 22},
+		{16, 0, Late, 0, 22},
+		{60, 10, Gap, 37, 69},
+		{64, 3, Duplicate, 0, 69},
+		{100, 1000, Gap, 30, 1099},
+		{1036, 1, Duplicate, 0, 1099},
+		{1035, 1, TooOld, 0, 1099},
+		{1090, 20, Duplicate, 0, 1099},
+		{^uint64(0) - 1, 5, Gap, ^uint64(0) - 1 - 1100, ^uint64(0)},
+	}
+	for i, tt := range tests {
+		got, missing := w.AddRange(tt.seq, tt.count)
+		if got != tt.want || missing != tt.missing || w.Last() != tt.last {
+			t.Fatalf("step %d: AddRange(%d, %d) = %v, %d, last %d, want %v, %d, last %d",
+				i, tt.seq, tt.count, got, missing, w.Last(), tt.want, tt.missing, tt.last)
+		}
+	}
+	if !w.Seen(^uint64(0)-1) || !w.Seen(^uint64(0)) || w.Seen(^uint64(0)-2) {
+		t.Fatal("range overflowing the sequence numbers not recorded up to the last one")
+	}
+}
+
+// TestWindowModel compares the window with a set of every sequence number
+// seen on a shuffled stream with duplicates and gaps.
+func TestWindowModel(t *testing.T) {
+	const size = 256
+	rnd := rand.New(rand.NewSource(1))
+	w := NewWindow(size)
+	seen := make(map[uint64]bool)
+	var last uint64
+	next := uint64(1)
+	for i := 0; i < 200000; i++ {
+		var seq uint64
+		switch r := rnd.Intn(100); {
+		case r < 80:
+			seq = next
+			next++
+		case r < 85:
+			next += uint64(rnd.Intn(300))
+			seq = next
+			next++
+		default:
+			seq = next - 1 - uint64(rnd.Intn(int(min(next, 400))))
+		}
+		var want Result
+		switch {
+		case i == 0:
+			want = First
+		case seq == last+1:
+			want = Next
+		case seq > last:
+			want = Gap
+		case last-seq >= size:
+			want = TooOld
+		case seen[seq]:
+			want = Duplicate
+		default:
+			want = Late
+		}
+		got, _ := w.Add(seq)
+		if got != want {
+			t.Fatalf("Add(%d) after %d = %v, want %v", seq, last, got, want)
+		}
+		if want != TooOld {
+			seen[seq] = true
+		}
+		last = max(last, seq)
+	}
+}
+
+// BenchmarkWindow and BenchmarkLRU compare the window with the golang-lru
+// cache it replaces, on an in sequence stream.
+func BenchmarkWindow(b *testing.B) {
+	w := NewWindow(2048)
+	for i := 0; i < b.N; i++ {
+		if r, _ := w.Add(uint64(i)); r == Duplicate {
+			b.Fatal("duplicate")
+		}
+	}
+}
+
+func BenchmarkLRU(b *testing.B) {
+	cache, _ := lru.New(2048)
+	for i := 0; i < b.N; i++ {
+		seqNum := uint64(i)
+		if _, ok := cache.Get(seqNum); ok {
+			b.Fatal("duplicate")
+		}
+		cache.Add(seqNum, true)
+	}
+}
+
+// BenchmarkWindowGap measures the clearing of the gaps of 1000 numbers.
+func BenchmarkWindowGap(b *testing.B) {
+	w := NewWindow(2048)
+	for i := 0; i < b.N; i++ {
+		w.Add(uint64(i) * 1000)
+	}
+}
+
+func TestWindowAddPacket(t *testing.T) {
+	w := NewWindow(64)
+	tests := []struct {
+		seq, count uint64
+		want       Result
+		missing    uint64
+		reset      bool
+		last       uint64
+	}{
+		// heartbeats before the first packet
+		{0, 0, Next, 0, false, 0},
+		{1, 0, Next, 0, false, 0},
+		{1, 3, First, 0, false, 3},
+		{4, 0, Next, 0, false, 3},
+		{4, 2, Next, 0, false, 5},
+		// the heartbeat reveals 6 and 7 lost
+		{8, 0, Gap, 2, false, 7},
+		{6, 2, Late, 0, false, 7},
+		{6, 1, Duplicate, 0, false, 7},
+		{8, 1, Next, 0, false, 8},
+		{12, 2, Gap, 3, false, 13},
+		{1, 2, First, 0, true, 2},
+		{3, 1, Next, 0, false, 3},
+		// a heartbeat announcing 1 restarts the sequence too
+		{1, 0, Next, 0, true, 0},
+		{1, 1, First, 0, false, 1},
+	}
+	for i, tt := range tests {
+		got, missing, reset := w.AddPacket(tt.seq, tt.count)
+		if got != tt.want || missing != tt.missing || reset != tt.reset || w.Last() != tt.last {
+			t.Fatalf("step %d: AddPacket(%d, %d) = %v, %d, %v, last %d, want %v, %d, %v, last %d",
+				i, tt.seq, tt.count, got, missing, reset, w.Last(), tt.want, tt.missing, tt.reset, tt.last)
+		}
+	}
+}
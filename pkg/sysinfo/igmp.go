@@ -0,0 +1,95 @@
+package sysinfo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Membership is a multicast group joined on an interface
+type Membership struct {
+	IfIndex int
+	Device  string
+	Group   net.IP
+	Users   int
+	// Querier is the IGMP version of the interface (V1, V2, V3), empty for IPv6
+	Querier string
+}
+
+// IGMPMemberships parses the IPv4 multicast memberships of /proc/net/igmp
+func IGMPMemberships() ([]Membership, error) {
+	f, err := os.Open(ProcRoot + "/net/igmp")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var memberships []Membership
+	var current Membership
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(line, "\t") {
+			// interface line: Idx Device : Count Querier
+			current = Membership{}
+			current.IfIndex, _ = strconv.Atoi(fields[0])
+			current.Device = fields[1]
+			if len(fields) >= 5 {
+				current.Querier = fields[4]
+			}
+			continue
+		}
+		// group line: Group Users Timer Reporter, the group is in host byte order
+		b, err := hex.DecodeString(fields[0])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		m := current
+		m.Group = make(net.IP, 4)
+		binary.BigEndian.PutUint32(m.Group, binary.LittleEndian.Uint32(b))
+		if len(fields) > 1 {
+			m.Users, _ = strconv.Atoi(fields[1])
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, scanner.Err()
+}
+
+// IGMP6Memberships parses the IPv6 multicast memberships of /proc/net/igmp6
+func IGMP6Memberships() ([]Membership, error) {
+	f, err := os.Open(ProcRoot + "/net/igmp6")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var memberships []Membership
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Idx Device Group Users Flags Timer
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != net.IPv6len {
+			continue
+		}
+		var m Membership
+		m.IfIndex, _ = strconv.Atoi(fields[0])
+		m.Device = fields[1]
+		m.Group = b
+		m.Users, _ = strconv.Atoi(fields[3])
+		memberships = append(memberships, m)
+	}
+	return memberships, scanner.Err()
+}
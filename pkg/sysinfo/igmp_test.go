@@ -0,0 +1,76 @@
+package sysinfo
+
+import (
+	"net"
+	"testing"
+)
+
+const procNetIGMP = "Idx\tDevice    : Count Querier\tGroup    Users Timer\tReporter\n" +
+	"1\tlo        :     1      V3\n" +
+	"\t\t\t\t030201EF     1 0:00000000\t\t0\n" +
+	"2\teth0      :     2      V2\n" +
+	"\t\t\t\t0A0B0CEF     3 0:00000000\t\t1\n" +
+	"\t\t\t\tZZ\n" +
+	"\t\t\t\t030201EF     1 0:00000000\t\t0\n" +
+	"3\teth1      :     0      V3\n"
+
+func TestIGMPMemberships(t *testing.T) {
+	fakeProc(t, map[string]string{"net/igmp": procNetIGMP})
+	memberships, err := IGMPMemberships()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Membership{
+		{IfIndex: 1, Device: "lo", Group: net.IPv4(239, 1, 2, 3), Users: 1, Querier: "V3"},
+		{IfIndex: 2, Device: "eth0", Group: net.IPv4(239, 12, 11, 10), Users: 3, Querier: "V2"},
+		{IfIndex: 2, Device: "eth0", Group: net.IPv4(239, 1, 2, 3), Users: 1, Querier: "V2"},
+	}
+	if len(memberships) != len(want) {
+		t.Fatalf("%d memberships, want %d: %+v", len(memberships), len(want), memberships)
+	}
+	for i, m := range memberships {
+		w := want[i]
+		if m.IfIndex != w.IfIndex || m.Device != w.Device || !m.Group.Equal(w.Group) || m.Users != w.Users || m.Querier != w.Querier {
+			t.Errorf("membership %d = %+v, want %+v", i, m, w)
+		}
+	}
+}
+
+func TestIGMP6Memberships(t *testing.T) {
+	fakeProc(t, map[string]string{"net/igmp6": "" +
+		"1    lo              ff020000000000000000000000000001     1 0000000C 0\n" +
+		"2    eth0            ff0200000000000000000001ff00abcd     2 00000004 0\n" +
+		"2    eth0            ff02\n"})
+	memberships, err := IGMP6Memberships()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(memberships) != 2 {
+		t.Fatalf("%d memberships, want 2: %+v", len(memberships), memberships)
+	}
+	if m := memberships[1]; m.IfIndex != 2 || m.Device != "eth0" || !m.Group.Equal(net.ParseIP("ff02::1:ff00:abcd")) || m.Users != 2 {
+		t.Fatalf("membership 1 = %+v", m)
+	}
+}
+
+// TestIGMPGroupByteOrder checks the groups listed by the interfaces command:
+// /proc/net/igmp prints them as little endian hex.
+func TestIGMPGroupByteOrder(t *testing.T) {
+	fakeProc(t, map[string]string{"net/igmp": "Idx\tDevice    : Count Querier\tGroup    Users Timer\tReporter\n" +
+		"2\teth0      :     2      V3\n" +
+		"\t\t\t\t010000E0     1 0:00000000\t\t0\n" +
+		"\t\t\t\tFB0000E0     1 0:00000000\t\t0\n"})
+	memberships, err := IGMPMemberships()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"224.0.0.1", "224.0.0.251"}
+	if len(memberships) != len(want) {
+		t.Fatalf("%d memberships, want %d", len(memberships), len(want))
+	}
+	for i, m := range memberships {
+		if m.Group.String() != want[i] {
+			t.Errorf("group %d = %s, want %s", i, m.Group, want[i])
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package sysinfo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Route is an IPv4 entry of the kernel main routing table
+type Route struct {
+	Iface       string
+	Destination net.IP
+	Gateway     net.IP
+	Mask        net.IPMask
+	Metric      int
+}
+
+// Routes parses /proc/net/route
+func Routes() ([]Route, error) {
+	f, err := os.Open(ProcRoot + "/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var routes []Route
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask MTU Window IRTT
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		r := Route{
+			Iface:       fields[0],
+			Destination: procIPv4(fields[1]),
+			Gateway:     procIPv4(fields[2]),
+			Mask:        net.IPMask(procIPv4(fields[7])),
+		}
+		r.Metric, _ = strconv.Atoi(fields[6])
+		routes = append(routes, r)
+	}
+	return routes, scanner.Err()
+}
+
+// RouteFor returns the most specific route matching the ip
+func RouteFor(ip net.IP) (Route, error) {
+	routes, err := Routes()
+	if err != nil {
+		return Route{}, err
+	}
+	ip = ip.To4()
+	best := -1
+	bestOnes := -1
+	for i, r := range routes {
+		if !ip.Mask(r.Mask).Equal(r.Destination) {
+			continue
+		}
+		ones, _ := r.Mask.Size()
+		if ones > bestOnes || (ones == bestOnes && r.Metric < routes[best].Metric) {
+			best, bestOnes = i, ones
+		}
+	}
+	if best < 0 {
+		return Route{}, errors.New("no route to " + ip.String())
+	}
+	return routes[best], nil
+}
+
+// procIPv4 decodes an IPv4 address in host byte order hex as found in /proc/net files
+func procIPv4(s string) net.IP {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return net.IPv4zero.To4()
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+	return ip
+}
@@ -0,0 +1,54 @@
+package sysinfo
+
+import (
+	"net"
+	"testing"
+)
+
+const procNetRoute = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+	"eth0\t00000000\t0100A8C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+	"wlan0\t00000000\t0101A8C0\t0003\t0\t0\t600\t00000000\t0\t0\t0\n" +
+	"eth0\t0000A8C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n" +
+	"eth1\t000000E0\t00000000\t0001\t0\t0\t0\t000000F0\t0\t0\t0\n" +
+	"eth1\t0000\n"
+
+func TestRoutes(t *testing.T) {
+	fakeProc(t, map[string]string{"net/route": procNetRoute})
+	routes, err := Routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 4 {
+		t.Fatalf("%d routes, want 4: %+v", len(routes), routes)
+	}
+	r := routes[0]
+	if r.Iface != "eth0" || !r.Destination.Equal(net.IPv4zero) || !r.Gateway.Equal(net.IPv4(192, 168, 0, 1)) || r.Metric != 100 {
+		t.Fatalf("route 0 = %+v", r)
+	}
+	if ones, bits := routes[3].Mask.Size(); ones != 4 || bits != 32 || !routes[3].Destination.Equal(net.IPv4(224, 0, 0, 0)) {
+		t.Fatalf("route 3 = %+v", routes[3])
+	}
+
+	tests := []struct {
+		ip    string
+		iface string
+	}{
+		{"239.1.2.3", "eth1"},
+		{"192.168.0.7", "eth0"},
+		// the default route of the lowest metric
+		{"8.8.8.8", "eth0"},
+	}
+	for _, tt := range tests {
+		r, err := RouteFor(net.ParseIP(tt.ip))
+		if err != nil || r.Iface != tt.iface {
+			t.Errorf("RouteFor(%s) = %+v, %v, want %s", tt.ip, r, err, tt.iface)
+		}
+	}
+}
+
+func TestRouteForNoRoute(t *testing.T) {
+	fakeProc(t, map[string]string{"net/route": procNetRoute[:len("Iface")] + "\n"})
+	if _, err := RouteFor(net.IPv4(239, 1, 2, 3)); err == nil {
+		t.Fatal("no error without routes")
+	}
+}
@@ -0,0 +1,44 @@
+package sysinfo
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SNMPCounters returns the counters of a protocol (e.g. Udp) of /proc/net/snmp
+func SNMPCounters(protocol string) (map[string]uint64, error) {
+	f, err := os.Open(ProcRoot + "/net/snmp")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// each protocol has a line with the names followed by a line with the values
+	prefix := protocol + ":"
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != prefix {
+			continue
+		}
+		if names == nil {
+			names = fields[1:]
+			continue
+		}
+		counters := make(map[string]uint64, len(names))
+		for i, name := range names {
+			if i+1 < len(fields) {
+				counters[name], _ = strconv.ParseUint(fields[i+1], 10, 64)
+			}
+		}
+		return counters, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("protocol %s not found in snmp counters", protocol)
+}
@@ -0,0 +1,29 @@
+package sysinfo
+
+import "testing"
+
+const procNetSNMP = `Ip: Forwarding DefaultTTL InReceives
+Ip: 1 64 12345
+Udp: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors SndbufErrors InCsumErrors IgnoredMulti MemErrors
+Udp: 1000 5 7 900 7 0 0 42
+UdpLite: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors SndbufErrors InCsumErrors IgnoredMulti MemErrors
+UdpLite: 1 2 3 4 5 6 7 8 9
+`
+
+func TestSNMPCounters(t *testing.T) {
+	fakeProc(t, map[string]string{"net/snmp": procNetSNMP})
+	udp, err := SNMPCounters("Udp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MemErrors has no value, UdpLite is another protocol
+	if len(udp) != 8 || udp["InDatagrams"] != 1000 || udp["RcvbufErrors"] != 7 || udp["IgnoredMulti"] != 42 {
+		t.Fatalf("Udp counters %v", udp)
+	}
+	if _, ok := udp["MemErrors"]; ok {
+		t.Fatal("counter without value")
+	}
+	if _, err := SNMPCounters("Tcp"); err == nil {
+		t.Fatal("no error for a missing protocol")
+	}
+}
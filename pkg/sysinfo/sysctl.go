@@ -0,0 +1,35 @@
+package sysinfo
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcRoot is the mount point of the proc filesystem
+var ProcRoot = "/proc"
+
+// ReadSysctl returns the trimmed value of a kernel parameter given in the
+// dotted sysctl notation (e.g. net.core.rmem_max).
+func ReadSysctl(name string) (string, error) {
+	path := ProcRoot + "/sys/" + strings.ReplaceAll(name, ".", "/")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read sysctl %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// ReadSysctlInt returns the value of a numeric kernel parameter.
+func ReadSysctlInt(name string) (int64, error) {
+	s, err := ReadSysctl(name)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("sysctl %s is not a number: %w", name, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,22 @@
+package sysinfo
+
+import "testing"
+
+func TestReadSysctl(t *testing.T) {
+	fakeProc(t, map[string]string{
+		"sys/net/core/rmem_max":           "212992\n",
+		"sys/net/ipv4/conf/all/rp_filter": "not a number\n",
+	})
+	if v, err := ReadSysctlInt("net.core.rmem_max"); err != nil || v != 212992 {
+		t.Fatalf("ReadSysctlInt(net.core.rmem_max) = %d, %v", v, err)
+	}
+	if v, err := ReadSysctl("net.ipv4.conf.all.rp_filter"); err != nil || v != "not a number" {
+		t.Fatalf("ReadSysctl(net.ipv4.conf.all.rp_filter) = %q, %v", v, err)
+	}
+	if _, err := ReadSysctlInt("net.ipv4.conf.all.rp_filter"); err == nil {
+		t.Fatal("no error for a value that is not a number")
+	}
+	if _, err := ReadSysctlInt("net.core.wmem_max"); err == nil {
+		t.Fatal("no error for a missing parameter")
+	}
+}
@@ -0,0 +1,63 @@
+package sysinfo
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// UDPSocket is an entry of /proc/net/udp
+type UDPSocket struct {
+	LocalPort int
+	RxQueue   uint64
+	Inode     uint64
+	Drops     uint64
+}
+
+// UDPSockets parses /proc/net/udp
+func UDPSockets() ([]UDPSocket, error) {
+	f, err := os.Open(ProcRoot + "/net/udp")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sockets []UDPSocket
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ref pointer drops
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 {
+			continue
+		}
+		var s UDPSocket
+		if i := strings.IndexByte(fields[1], ':'); i >= 0 {
+			port, _ := strconv.ParseUint(fields[1][i+1:], 16, 16)
+			s.LocalPort = int(port)
+		}
+		if i := strings.IndexByte(fields[4], ':'); i >= 0 {
+			s.RxQueue, _ = strconv.ParseUint(fields[4][i+1:], 16, 64)
+		}
+		s.Inode, _ = strconv.ParseUint(fields[9], 10, 64)
+		s.Drops, _ = strconv.ParseUint(fields[12], 10, 64)
+		sockets = append(sockets, s)
+	}
+	return sockets, scanner.Err()
+}
+
+// UDPSocketByInode returns the /proc/net/udp entry of the socket with the inode
+func UDPSocketByInode(inode uint64) (UDPSocket, error) {
+	sockets, err := UDPSockets()
+	if err != nil {
+		return UDPSocket{}, err
+	}
+	for _, s := range sockets {
+		if s.Inode == inode {
+			return s, nil
+		}
+	}
+	return UDPSocket{}, fmt.Errorf("no udp socket with inode %d", inode)
+}
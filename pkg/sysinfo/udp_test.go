@@ -0,0 +1,58 @@
+package sysinfo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeProc points ProcRoot to a temporary directory with the files
+func fakeProc(t *testing.T, files map[string]string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := ProcRoot
+	ProcRoot = root
+	t.Cleanup(func() { ProcRoot = old })
+}
+
+const procNetUDP = `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  257: 00000000:14E9 00000000:0000 07 00000000:00000000 00:00000000 00000000   104        0 19536 2 0000000000000000 0
+  482: 0100007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 12345 2 0000000000000000 0
+  999: 00000000:1F90 00000000:0000 07
+ 1234: 010101EF:30D4 00000000:0000 07 00000000:00000A00 00:00000000 00000000  1000        0 99887 2 0000000000000000 4294967295
+`
+
+func TestUDPSockets(t *testing.T) {
+	fakeProc(t, map[string]string{"net/udp": procNetUDP})
+	sockets, err := UDPSockets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the short line is skipped
+	want := []UDPSocket{
+		{LocalPort: 5353, Inode: 19536},
+		{LocalPort: 53, Inode: 12345},
+		{LocalPort: 12500, RxQueue: 2560, Inode: 99887, Drops: 4294967295},
+	}
+	if !reflect.DeepEqual(sockets, want) {
+		t.Fatalf("UDPSockets() = %+v, want %+v", sockets, want)
+	}
+
+	s, err := UDPSocketByInode(99887)
+	if err != nil || s != want[2] {
+		t.Fatalf("UDPSocketByInode(99887) = %+v, %v", s, err)
+	}
+	if _, err := UDPSocketByInode(1); err == nil {
+		t.Fatal("no error for an unknown inode")
+	}
+}
@@ -0,0 +1,87 @@
+package umdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// PacketHeaderSize is the size of the packet header
+	PacketHeaderSize = 16
+	// FramingHeaderSize is the size of the framing header of every message
+	FramingHeaderSize = 4
+	// EncodingType is the SBE little-endian encoding of the framing header
+	EncodingType = 0xEB50
+)
+
+// ErrShortPacket is returned for datagrams smaller than the packet header
+var ErrShortPacket = errors.New("umdf: packet shorter than the packet header")
+
+// PacketHeader is the header of every UMDF binary datagram
+type PacketHeader struct {
+	Channel uint8
+	// SequenceVersion changes when the sequence numbers of the channel
+	// restart, e.g. after a failover of the publisher
+	SequenceVersion uint16
+	// SequenceNumber is the packet sequence number, contiguous per channel
+	// and feed within a sequence version
+	SequenceNumber uint32
+	// SendingTime is the send time in nanoseconds since the epoch
+	SendingTime uint64
+}
+
+// NewerVersion returns true when the sequence version v follows than, the
+// versions wrapping around after 65535
+func NewerVersion(v, than uint16) bool { return int16(v-than) > 0 }
+
+// ParsePacketHeader parses the header at the beginning of a datagram
+func ParsePacketHeader(b []byte) (PacketHeader, error) {
+	if len(b) < PacketHeaderSize {
+		return PacketHeader{}, ErrShortPacket
+	}
+	return PacketHeader{
+		Channel:         b[0],
+		SequenceVersion: binary.LittleEndian.Uint16(b[2:4]),
+		SequenceNumber:  binary.LittleEndian.Uint32(b[4:8]),
+		SendingTime:     binary.LittleEndian.Uint64(b[8:16]),
+	}, nil
+}
+
+// Message is a message of a packet
+type Message struct {
+	TemplateID uint16
+	// Data is the SBE message, header included
+	Data []byte
+}
+
+// Messages splits the packet following its header into its messages. Each
+// message is prefixed by its framing header: its size, including the framing
+// header itself, and the encoding type.
+func Messages(b []byte) ([]Message, error) {
+	if len(b) < PacketHeaderSize {
+		return nil, ErrShortPacket
+	}
+	var msgs []Message
+	b = b[PacketHeaderSize:]
+	for len(b) > 0 {
+		if len(b) < FramingHeaderSize+4 {
+			return msgs, fmt.Errorf("umdf: %d trailing bytes", len(b))
+		}
+		size := int(binary.LittleEndian.Uint16(b[0:2]))
+		if size < FramingHeaderSize+4 || size > len(b) {
+			return msgs, fmt.Errorf("umdf: invalid message size %d", size)
+		}
+		if encoding := binary.LittleEndian.Uint16(b[2:4]); encoding != EncodingType {
+			return msgs, fmt.Errorf("umdf: unexpected encoding type 0x%04X", encoding)
+		}
+		data := b[FramingHeaderSize:size]
+		msgs = append(msgs, Message{
+			// the template id follows the block length in the SBE message header
+			TemplateID: binary.LittleEndian.Uint16(data[2:4]),
+			Data:       data,
+		})
+		b = b[size:]
+	}
+	return msgs, nil
+}
@@ -0,0 +1,77 @@
+package umdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// message returns a message of the template with its framing header and an
+// SBE header of block length 2
+func message(templateID uint16, body ...byte) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, uint16(FramingHeaderSize+8+len(body)))
+	b = binary.LittleEndian.AppendUint16(b, EncodingType)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(body)))
+	b = binary.LittleEndian.AppendUint16(b, templateID)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 9)
+	return append(b, body...)
+}
+
+func TestPacket(t *testing.T) {
+	b := []byte{7, 0}
+	b = binary.LittleEndian.AppendUint16(b, 3)
+	b = binary.LittleEndian.AppendUint32(b, 123456)
+	b = binary.LittleEndian.AppendUint64(b, 1700000000123456789)
+	b = append(b, message(50, 1, 2)...)
+	b = append(b, message(1)...)
+
+	h, err := ParsePacketHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != (PacketHeader{Channel: 7, SequenceVersion: 3, SequenceNumber: 123456, SendingTime: 1700000000123456789}) {
+		t.Fatalf("header %+v", h)
+	}
+	msgs, err := Messages(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].TemplateID != 50 || len(msgs[0].Data) != 10 || msgs[1].TemplateID != 1 {
+		t.Fatalf("messages %+v", msgs)
+	}
+
+	if _, err := ParsePacketHeader(b[:PacketHeaderSize-1]); !errors.Is(err, ErrShortPacket) {
+		t.Fatalf("ParsePacketHeader of a short packet: %v", err)
+	}
+	if msgs, err := Messages(b[:len(b)-1]); err == nil || len(msgs) != 1 {
+		t.Fatalf("Messages of a truncated packet = %+v, %v", msgs, err)
+	}
+	if msgs, err := Messages(b[:PacketHeaderSize+5]); err == nil || len(msgs) != 0 {
+		t.Fatalf("Messages with trailing bytes = %+v, %v", msgs, err)
+	}
+	bad := append([]byte(nil), b...)
+	binary.LittleEndian.PutUint16(bad[PacketHeaderSize+2:], 0x1234)
+	if _, err := Messages(bad); err == nil {
+		t.Fatal("no error for an unexpected encoding type")
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		v, than uint16
+		want    bool
+	}{
+		{2, 1, true},
+		{1, 2, false},
+		{1, 1, false},
+		{0, 65535, true},
+		{65535, 0, false},
+		{10, 65530, true},
+	}
+	for _, tt := range tests {
+		if got := NewerVersion(tt.v, tt.than); got != tt.want {
+			t.Errorf("NewerVersion(%d, %d) = %v, want %v", tt.v, tt.than, got, tt.want)
+		}
+	}
+}
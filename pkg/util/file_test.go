@@ -0,0 +1,48 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.json")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed write leaves the file untouched and no temporary file behind
+	failed := errors.New("write failed")
+	err := WriteFileAtomic(path, func(w io.Writer) error {
+		_, _ = io.WriteString(w, "partial")
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WriteFileAtomic error %v, want %v", err, failed)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "old" {
+		t.Fatalf("file %q after a failed write", b)
+	}
+
+	err = WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "new" {
+		t.Fatalf("file %q, want new", b)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("%d files in the directory, want 1", len(entries))
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "out.json"), func(io.Writer) error { return nil }); err == nil {
+		t.Fatal("no error for a missing directory")
+	}
+}
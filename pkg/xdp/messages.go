@@ -0,0 +1,44 @@
+package xdp
+
+import "fmt"
+
+// Message types of the XDP common messages
+const (
+	TypeSequenceNumberReset = 1
+	TypeSourceTimeReference = 2
+	TypeSymbolIndexMapping  = 3
+)
+
+var messageNames = map[uint16]string{
+	TypeSequenceNumberReset: "SequenceNumberReset",
+	TypeSourceTimeReference: "SourceTimeReference",
+	TypeSymbolIndexMapping:  "SymbolIndexMapping",
+	10:                      "RetransmissionRequest",
+	11:                      "RequestResponse",
+	12:                      "HeartbeatResponse",
+	13:                      "SymbolIndexMappingRequest",
+	15:                      "RefreshRequest",
+	31:                      "MessageUnavailable",
+	32:                      "SymbolClear",
+	34:                      "SecurityStatus",
+	35:                      "RefreshHeader",
+	100:                     "AddOrder",
+	101:                     "ModifyOrder",
+	102:                     "DeleteOrder",
+	103:                     "OrderExecution",
+	104:                     "ReplaceOrder",
+	105:                     "Imbalance",
+	106:                     "AddOrderRefresh",
+	220:                     "Trade",
+	221:                     "TradeCancel",
+	222:                     "TradeCorrection",
+	223:                     "StockSummary",
+}
+
+// MessageName returns the name of a message type
+func MessageName(t uint16) string {
+	if name, ok := messageNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown(%d)", t)
+}
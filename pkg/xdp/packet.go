@@ -0,0 +1,145 @@
+package xdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// PacketHeaderSize is the size of the packet header
+	PacketHeaderSize = 16
+	// MessageHeaderSize is the size of the header of every message
+	MessageHeaderSize = 4
+)
+
+// Delivery flags of the packet header
+const (
+	FlagHeartbeat            = 1
+	FlagFailover             = 10
+	FlagOriginal             = 11
+	FlagSequenceReset        = 12
+	FlagRetransmissionSingle = 13
+	FlagRetransmissionPart   = 15
+	FlagRefreshSingle        = 17
+	FlagRefreshStart         = 18
+	FlagRefreshPart          = 19
+	FlagRefreshEnd           = 20
+	FlagMessageUnavailable   = 21
+)
+
+var flagNames = map[uint8]string{
+	FlagHeartbeat:            "Heartbeat",
+	FlagFailover:             "Failover",
+	FlagOriginal:             "Original",
+	FlagSequenceReset:        "SequenceReset",
+	FlagRetransmissionSingle: "RetransmissionSingle",
+	FlagRetransmissionPart:   "RetransmissionPart",
+	FlagRefreshSingle:        "RefreshSingle",
+	FlagRefreshStart:         "RefreshStart",
+	FlagRefreshPart:          "RefreshPart",
+	FlagRefreshEnd:           "RefreshEnd",
+	FlagMessageUnavailable:   "MessageUnavailable",
+}
+
+// FlagName returns the name of a delivery flag
+func FlagName(flag uint8) string {
+	if name, ok := flagNames[flag]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown(%d)", flag)
+}
+
+// ErrShortPacket is returned for datagrams smaller than the packet header
+var ErrShortPacket = errors.New("xdp: packet shorter than the packet header")
+
+// PacketHeader is the header of every XDP datagram
+type PacketHeader struct {
+	// Size is the size of the datagram, header included
+	Size         uint16
+	DeliveryFlag uint8
+	Count        uint8
+	// SeqNum is the sequence number of the first message, or of the last one
+	// sent for heartbeats
+	SeqNum     uint32
+	SendTime   uint32
+	SendTimeNS uint32
+}
+
+// Heartbeat returns true for the heartbeat packets
+func (h *PacketHeader) Heartbeat() bool { return h.DeliveryFlag == FlagHeartbeat }
+
+// Retransmission returns true for the packets re-sent by the retransmission
+// service, with their original sequence numbers
+func (h *PacketHeader) Retransmission() bool {
+	switch h.DeliveryFlag {
+	case FlagRetransmissionSingle, FlagRetransmissionPart, FlagMessageUnavailable:
+		return true
+	}
+	return false
+}
+
+// Refresh returns true for the packets of a refresh (snapshot) sequence
+func (h *PacketHeader) Refresh() bool {
+	return h.DeliveryFlag >= FlagRefreshSingle && h.DeliveryFlag <= FlagRefreshEnd
+}
+
+// NextSeqNum returns the sequence number expected after the packet
+func (h *PacketHeader) NextSeqNum() uint32 { return h.SeqNum + uint32(h.Count) }
+
+// SendTimestamp returns the send time of the packet
+func (h *PacketHeader) SendTimestamp() time.Time {
+	return time.Unix(int64(h.SendTime), int64(h.SendTimeNS))
+}
+
+// ParsePacketHeader parses the header at the beginning of a datagram
+func ParsePacketHeader(b []byte) (PacketHeader, error) {
+	if len(b) < PacketHeaderSize {
+		return PacketHeader{}, ErrShortPacket
+	}
+	h := PacketHeader{
+		Size:         binary.LittleEndian.Uint16(b[0:2]),
+		DeliveryFlag: b[2],
+		Count:        b[3],
+		SeqNum:       binary.LittleEndian.Uint32(b[4:8]),
+		SendTime:     binary.LittleEndian.Uint32(b[8:12]),
+		SendTimeNS:   binary.LittleEndian.Uint32(b[12:16]),
+	}
+	if int(h.Size) < PacketHeaderSize || int(h.Size) > len(b) {
+		return h, fmt.Errorf("xdp: packet size %d of a %d bytes datagram", h.Size, len(b))
+	}
+	return h, nil
+}
+
+// Message is a message of a packet
+type Message struct {
+	Type uint16
+	// Data is the message, header included
+	Data []byte
+}
+
+// Name returns the name of the message type
+func (m *Message) Name() string { return MessageName(m.Type) }
+
+// Messages splits the packet following its header into its messages. Each
+// message starts with its size, including the message header, and its type.
+func Messages(b []byte, h *PacketHeader) ([]Message, error) {
+	if len(b) < PacketHeaderSize {
+		return nil, ErrShortPacket
+	}
+	msgs := make([]Message, 0, h.Count)
+	b = b[PacketHeaderSize:h.Size]
+	for i := 0; i < int(h.Count); i++ {
+		if len(b) < MessageHeaderSize {
+			return msgs, fmt.Errorf("xdp: %d messages out of %d", i, h.Count)
+		}
+		size := int(binary.LittleEndian.Uint16(b[0:2]))
+		if size < MessageHeaderSize || size > len(b) {
+			return msgs, fmt.Errorf("xdp: invalid message size %d", size)
+		}
+		msgs = append(msgs, Message{Type: binary.LittleEndian.Uint16(b[2:4]), Data: b[:size]})
+		b = b[size:]
+	}
+	return msgs, nil
+}
@@ -0,0 +1,97 @@
+package xdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// packet returns a datagram with the delivery flag and the messages, each
+// one prefixed by its size and type
+func packet(flag uint8, seqNum uint32, msgs ...[]byte) []byte {
+	var body []byte
+	for _, m := range msgs {
+		body = binary.LittleEndian.AppendUint16(body, uint16(MessageHeaderSize+len(m)-2))
+		body = append(body, m...)
+	}
+	b := binary.LittleEndian.AppendUint16(nil, uint16(PacketHeaderSize+len(body)))
+	b = append(b, flag, uint8(len(msgs)))
+	b = binary.LittleEndian.AppendUint32(b, seqNum)
+	b = binary.LittleEndian.AppendUint32(b, 1700000000)
+	b = binary.LittleEndian.AppendUint32(b, 500)
+	return append(b, body...)
+}
+
+// message returns a message of the type with the body
+func message(t uint16, body ...byte) []byte {
+	return append(binary.LittleEndian.AppendUint16(nil, t), body...)
+}
+
+func TestPacket(t *testing.T) {
+	b := packet(FlagOriginal, 1000, message(100, 1, 2, 3), message(9999))
+	h, err := ParsePacketHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(h.Size) != len(b) || h.Count != 2 || h.SeqNum != 1000 || h.NextSeqNum() != 1002 ||
+		!h.SendTimestamp().Equal(time.Unix(1700000000, 500)) {
+		t.Fatalf("header %+v", h)
+	}
+	if h.Heartbeat() || h.Retransmission() || h.Refresh() {
+		t.Fatal("original packet taken for a heartbeat, a retransmission or a refresh")
+	}
+	msgs, err := Messages(b, &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Type != 100 || len(msgs[0].Data) != 7 || msgs[1].Type != 9999 || len(msgs[1].Data) != 4 {
+		t.Fatalf("messages %+v", msgs)
+	}
+	if name := msgs[1].Name(); name != "Unknown(9999)" {
+		t.Fatalf("Name() = %s", name)
+	}
+}
+
+func TestPacketErrors(t *testing.T) {
+	if _, err := ParsePacketHeader(make([]byte, PacketHeaderSize-1)); !errors.Is(err, ErrShortPacket) {
+		t.Fatalf("ParsePacketHeader of a short packet: %v", err)
+	}
+	b := packet(FlagOriginal, 1, message(100, 1, 2))
+	if _, err := ParsePacketHeader(b[:len(b)-1]); err == nil {
+		t.Fatal("no error for a size beyond the datagram")
+	}
+	h := PacketHeader{Size: uint16(len(b)), Count: 2}
+	if msgs, err := Messages(b, &h); err == nil || len(msgs) != 1 {
+		t.Fatalf("Messages of a short packet = %+v, %v", msgs, err)
+	}
+	binary.LittleEndian.PutUint16(b[PacketHeaderSize:], 2)
+	h, _ = ParsePacketHeader(b)
+	if msgs, err := Messages(b, &h); err == nil || len(msgs) != 0 {
+		t.Fatalf("Messages with an invalid size = %+v, %v", msgs, err)
+	}
+}
+
+func TestDeliveryFlags(t *testing.T) {
+	tests := []struct {
+		flag                               uint8
+		heartbeat, retransmission, refresh bool
+		name                               string
+	}{
+		{FlagHeartbeat, true, false, false, "Heartbeat"},
+		{FlagRetransmissionPart, false, true, false, "RetransmissionPart"},
+		{FlagMessageUnavailable, false, true, false, "MessageUnavailable"},
+		{FlagRefreshStart, false, false, true, "RefreshStart"},
+		{FlagRefreshEnd, false, false, true, "RefreshEnd"},
+		{FlagSequenceReset, false, false, false, "SequenceReset"},
+		{99, false, false, false, "Unknown(99)"},
+	}
+	for _, tt := range tests {
+		h := PacketHeader{DeliveryFlag: tt.flag}
+		if h.Heartbeat() != tt.heartbeat || h.Retransmission() != tt.retransmission || h.Refresh() != tt.refresh ||
+			FlagName(tt.flag) != tt.name {
+			t.Errorf("flag %d: heartbeat %v, retransmission %v, refresh %v, name %s",
+				tt.flag, h.Heartbeat(), h.Retransmission(), h.Refresh(), FlagName(tt.flag))
+		}
+	}
+}